@@ -1,6 +1,8 @@
 package client
 
 import (
+	"context"
+
 	"gopkg.in/jcmturner/gokrb5.v5/crypto"
 	"gopkg.in/jcmturner/gokrb5.v5/crypto/etype"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/errorcode"
@@ -12,33 +14,63 @@ import (
 )
 
 // ASExchange performs an AS exchange for the client to retrieve a TGT.
+// If the client has a FAST armor TGT the exchange is armored with FAST.
+// If the client has a certificate, or is anonymous, PKINIT pre-authentication is performed.
 func (cl *Client) ASExchange(realm string, ASReq messages.ASReq, referral int) (messages.ASRep, error) {
+	return cl.ASExchangeContext(context.Background(), realm, ASReq, referral)
+}
+
+// ASExchangeContext performs an AS exchange for the client to retrieve a TGT. The context's cancellation and deadline
+// apply to the exchanges with the KDC.
+func (cl *Client) ASExchangeContext(ctx context.Context, realm string, ASReq messages.ASReq, referral int) (messages.ASRep, error) {
 	if ok, err := cl.IsConfigured(); !ok {
 		return messages.ASRep{}, krberror.Errorf(err, krberror.ConfigError, "AS Exchange cannot be preformed")
 	}
-
-	b, err := ASReq.Marshal()
-	if err != nil {
-		return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed marshaling AS_REQ")
+	var fast *fastState
+	if cl.fastArmor != nil && !cl.GoKrb5Conf.DisablePAFXFast {
+		var err error
+		fast, err = cl.newASFASTState()
+		if err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed to create FAST armor")
+		}
+	}
+	var pk *pkinitState
+	if cl.Credentials.HasCertificate() || cl.anonymous() {
+		var err error
+		pk, err = cl.newPKINITState()
+		if err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed to create PKINIT key agreement")
+		}
 	}
 	var ASRep messages.ASRep
 
-	rb, err := cl.SendToKDC(b, realm)
+	sentReq, rb, err := cl.sendASReq(ctx, realm, ASReq, fast, pk)
 	if err != nil {
 		if e, ok := err.(messages.KRBError); ok {
 			switch e.ErrorCode {
 			case errorcode.KDC_ERR_PREAUTH_REQUIRED:
-				// From now on assume this client will need to do this pre-auth and set the PAData
-				cl.GoKrb5Conf.AssumePAEncTimestampRequired = true
-				err = setPAData(cl, e, &ASReq)
+				if pk != nil && !cl.Credentials.HasKeytab() && !cl.Credentials.HasPassword() {
+					return messages.ASRep{}, krberror.Errorf(err, krberror.KDCError, "AS Exchange Error: KDC did not accept PKINIT pre-authentication")
+				}
+				// From now on assume this client will need to do this pre-auth and set the PAData.
+				// OTP and encrypted challenge are used in preference to the encrypted timestamp when the KDC offers them
+				// within FAST.
+				if cl.fastPreAuthType(e, fast) == 0 {
+					cl.GoKrb5Conf.AssumePAEncTimestampRequired = true
+				}
+				err = setPAData(cl, e, &ASReq, fast)
 				if err != nil {
 					return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed setting AS_REQ PAData for pre-authentication required")
 				}
-				b, err := ASReq.Marshal()
-				if err != nil {
-					return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed marshaling AS_REQ with PAData")
+				sentReq, rb, err = cl.sendASReq(ctx, realm, ASReq, fast, pk)
+				if e, ok := err.(messages.KRBError); ok && fast.otpSent() && preAuthOffered(e, patype.PA_OTP_PIN_CHANGE) {
+					// The KDC requires the PIN of the OTP token to be changed
+					err = cl.setOTPPINChange(e, &ASReq, fast)
+					if err != nil {
+						return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed setting AS_REQ PAData for OTP PIN change")
+					}
+					sentReq, rb, err = cl.sendASReq(ctx, realm, ASReq, fast, pk)
 				}
-				rb, err = cl.SendToKDC(b, realm)
 				if err != nil {
 					if _, ok := err.(messages.KRBError); ok {
 						return messages.ASRep{}, krberror.Errorf(err, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
@@ -51,7 +83,15 @@ func (cl *Client) ASExchange(realm string, ASReq messages.ASReq, referral int) (
 					return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "maximum number of client referrals exceeded")
 				}
 				referral++
-				return cl.ASExchange(e.CRealm, ASReq, referral)
+				// The request is made to the client's realm indicated by the KDC
+				ASReq.ReqBody.Realm = e.CRealm
+				if len(ASReq.ReqBody.SName.NameString) == 2 && ASReq.ReqBody.SName.NameString[0] == "krbtgt" {
+					ASReq.ReqBody.SName = types.PrincipalName{
+						NameType:   ASReq.ReqBody.SName.NameType,
+						NameString: []string{"krbtgt", e.CRealm},
+					}
+				}
+				return cl.ASExchangeContext(ctx, e.CRealm, ASReq, referral)
 			default:
 				return messages.ASRep{}, krberror.Errorf(err, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
 			}
@@ -63,17 +103,121 @@ func (cl *Client) ASExchange(realm string, ASReq messages.ASReq, referral int) (
 	if err != nil {
 		return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed to process the AS_REP")
 	}
-	if ok, err := ASRep.IsValid(cl.Config, cl.Credentials, ASReq); !ok {
-		return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: AS_REP is not valid or client password/keytab incorrect")
+	if fast == nil && pk == nil {
+		if ok, err := ASRep.IsValid(cl.Config, cl.Credentials, ASReq); !ok {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: AS_REP is not valid or client password/keytab incorrect")
+		}
+		return ASRep, nil
+	}
+	key, err := cl.asReplyKey(&ASRep, sentReq, fast, pk)
+	if err != nil {
+		return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed to process the AS_REP pre-authentication data")
+	}
+	if ok, err := ASRep.IsValidWithKey(cl.Config, key, sentReq); !ok {
+		return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: AS_REP is not valid or client credentials incorrect")
 	}
 	return ASRep, nil
 }
 
-func setPAData(cl *Client, krberr messages.KRBError, ASReq *messages.ASReq) error {
+// sendASReq sends the AS_REQ to the KDC, adding PKINIT pre-authentication data if the pkinitState is not nil and
+// armoring it with FAST if the fastState is not nil.
+// The AS_REQ actually sent is returned along with the reply bytes.
+// Errors within an armored KRBError are extracted and returned.
+func (cl *Client) sendASReq(ctx context.Context, realm string, ASReq messages.ASReq, fast *fastState, pk *pkinitState) (messages.ASReq, []byte, error) {
+	if pk != nil {
+		pa, err := pk.paPKASReq(cl.Credentials, ASReq)
+		if err != nil {
+			return ASReq, []byte{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed creating PKINIT pre-authentication data")
+		}
+		ASReq.PAData = append(types.PADataSequence{pa}, ASReq.PAData...)
+	}
+	if fast != nil {
+		var err error
+		ASReq, err = fast.armorASReq(ASReq)
+		if err != nil {
+			return ASReq, []byte{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed armoring AS_REQ")
+		}
+	}
+	b, err := ASReq.Marshal()
+	if err != nil {
+		return ASReq, []byte{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed marshaling AS_REQ")
+	}
+	rb, err := cl.SendToKDCContext(ctx, b, realm)
+	if e, ok := err.(messages.KRBError); ok && fast != nil {
+		e, ferr := fast.processKRBError(e)
+		if ferr != nil {
+			return ASReq, rb, krberror.Errorf(ferr, krberror.KRBMsgError, "AS Exchange Error: failed to process FAST error from KDC")
+		}
+		return ASReq, rb, e
+	}
+	return ASReq, rb, err
+}
+
+// asReplyKey processes the FAST response and PKINIT reply in the AS_REP, if present, and returns the key to decrypt the
+// AS_REP's encrypted part.
+func (cl *Client) asReplyKey(ASRep *messages.ASRep, ASReq messages.ASReq, fast *fastState, pk *pkinitState) (types.EncryptionKey, error) {
+	var fr messages.KrbFastResponse
+	if fast != nil {
+		var err error
+		fr, err = fast.processReply(&ASRep.KDCRepFields, ASReq.ReqBody.Nonce)
+		if err != nil {
+			return types.EncryptionKey{}, err
+		}
+	}
+	var key types.EncryptionKey
+	var err error
+	pas := types.PADataSequence(ASRep.PAData)
+	if pk != nil && pas.Contains(patype.PA_PK_AS_REP) {
+		key, err = pk.replyKey(*ASRep, ASReq.ReqBody.Nonce, ASReq.ReqBody.Realm, cl.GoKrb5Conf.PKINITTrustPool, cl.Config)
+	} else if fast.otpSent() {
+		// The armor key is the reply key for OTP pre-authentication
+		key = fast.armorKey
+		err = cl.otpReplyPINChange(pas)
+	} else if fast.encryptedChallengeSent() {
+		key, err = fast.verifyEncryptedChallenge(pas, cl.Config.LibDefaults.Clockskew)
+	} else {
+		key, err = ASRep.GetClientKey(cl.Credentials)
+	}
+	if err != nil {
+		return key, err
+	}
+	if fast != nil {
+		return fast.strengthenReplyKey(fr, key)
+	}
+	return key, nil
+}
+
+func setPAData(cl *Client, krberr messages.KRBError, ASReq *messages.ASReq, fast *fastState) error {
 	if !cl.GoKrb5Conf.DisablePAFXFast {
 		pa := types.PAData{PADataType: patype.PA_REQ_ENC_PA_REP}
 		ASReq.PAData = append(ASReq.PAData, pa)
 	}
+	switch cl.fastPreAuthType(krberr, fast) {
+	case patype.PA_OTP_REQUEST:
+		return cl.setOTPPAData(krberr, ASReq, fast, "")
+	case patype.PA_ENCRYPTED_CHALLENGE:
+		et, err := preAuthEType(krberr)
+		if err != nil {
+			return krberror.Errorf(err, krberror.EncryptingError, "error getting etype for encrypted challenge")
+		}
+		key, err := cl.Key(et, krberr)
+		if err != nil {
+			return krberror.Errorf(err, krberror.EncryptingError, "error getting key from credentials")
+		}
+		pa, err := fast.paEncryptedChallenge(key)
+		if err != nil {
+			return err
+		}
+		// The encrypted challenge replaces any encrypted timestamp already set
+		var pas types.PADataSequence
+		for _, p := range ASReq.PAData {
+			if p.PADataType != patype.PA_ENC_TIMESTAMP {
+				pas = append(pas, p)
+			}
+		}
+		ASReq.PAData = append(pas, pa)
+		return nil
+	}
 	if cl.GoKrb5Conf.AssumePAEncTimestampRequired {
 		paTSb, err := types.GetPAEncTSEncAsnMarshalled()
 		if err != nil {
@@ -114,6 +258,30 @@ func setPAData(cl *Client, krberr messages.KRBError, ASReq *messages.ASReq) erro
 	return nil
 }
 
+// fastPreAuthType returns the pre-authentication type to use in a FAST armored exchange in preference to the encrypted
+// timestamp, from those offered by the KDC in the KRBError, or zero if there is none.
+func (cl *Client) fastPreAuthType(krberr messages.KRBError, fast *fastState) int32 {
+	if fast == nil {
+		return 0
+	}
+	if cl.GoKrb5Conf.OTPPrompter != nil && preAuthOffered(krberr, patype.PA_OTP_CHALLENGE) {
+		return patype.PA_OTP_REQUEST
+	}
+	if preAuthOffered(krberr, patype.PA_ENCRYPTED_CHALLENGE) {
+		return patype.PA_ENCRYPTED_CHALLENGE
+	}
+	return 0
+}
+
+// preAuthOffered indicates if the KDC offered the pre-authentication type in the PAData of the KRBError's e-data.
+func preAuthOffered(krberr messages.KRBError, paType int32) bool {
+	var pas types.PADataSequence
+	if err := pas.Unmarshal(krberr.EData); err != nil {
+		return false
+	}
+	return pas.Contains(paType)
+}
+
 func preAuthEType(krberr messages.KRBError) (etype etype.EType, err error) {
 	var etypeID int32
 	var pas types.PADataSequence
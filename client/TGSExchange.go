@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"time"
 
 	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
@@ -12,6 +13,12 @@ import (
 // TGSExchange performs a TGS exchange to retrieve a ticket to the specified SPN.
 // The ticket retrieved is added to the client's cache.
 func (cl *Client) TGSExchange(spn types.PrincipalName, kdcRealm string, tkt messages.Ticket, sessionKey types.EncryptionKey, renewal bool, referral int) (tgsReq messages.TGSReq, tgsRep messages.TGSRep, err error) {
+	return cl.TGSExchangeContext(context.Background(), spn, kdcRealm, tkt, sessionKey, renewal, referral)
+}
+
+// TGSExchangeContext performs a TGS exchange to retrieve a ticket to the specified SPN. The context's cancellation and
+// deadline apply to the exchanges with the KDC.
+func (cl *Client) TGSExchangeContext(ctx context.Context, spn types.PrincipalName, kdcRealm string, tkt messages.Ticket, sessionKey types.EncryptionKey, renewal bool, referral int) (tgsReq messages.TGSReq, tgsRep messages.TGSRep, err error) {
 	//// Check what sessions we have for this SPN.
 	//// Will get the session to the default realm if one does not exist for requested SPN
 	//sess, err := cl.GetSessionFromPrincipalName(spn)
@@ -22,39 +29,34 @@ func (cl *Client) TGSExchange(spn types.PrincipalName, kdcRealm string, tkt mess
 	if err != nil {
 		return tgsReq, tgsRep, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to generate a new TGS_REQ")
 	}
-	b, err := tgsReq.Marshal()
-	if err != nil {
-		return tgsReq, tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to generate a new TGS_REQ")
-	}
-	r, err := cl.SendToKDC(b, kdcRealm)
-	if err != nil {
-		if _, ok := err.(messages.KRBError); ok {
-			return tgsReq, tgsRep, krberror.Errorf(err, krberror.KDCError, "TGS Exchange Error: kerberos error response from KDC")
-		}
-		return tgsReq, tgsRep, krberror.Errorf(err, krberror.NetworkingError, "TGS Exchange Error: issue sending TGS_REQ to KDC")
-	}
-	err = tgsRep.Unmarshal(r)
-	if err != nil {
-		return tgsReq, tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to process the TGS_REP")
-	}
-	err = tgsRep.DecryptEncPart(sessionKey)
+	tgsRep, err = cl.sendTGSReq(ctx, &tgsReq, kdcRealm, tkt, sessionKey, types.EncryptionKey{})
 	if err != nil {
-		return tgsReq, tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to process the TGS_REP")
+		return tgsReq, tgsRep, err
 	}
-	// TODO should this check the first element is krbtgt rather than the nametype?
-	if tgsRep.Ticket.SName.NameType == nametype.KRB_NT_SRV_INST && !tgsRep.Ticket.SName.Equal(spn) {
+	if isReferralTGT(tgsRep.Ticket.SName, spn) {
 		if referral > 5 {
-			return tgsReq, tgsRep, krberror.Errorf(err, krberror.KRBMsgError, "maximum number of referrals exceeded")
+			return tgsReq, tgsRep, krberror.NewErrorf(krberror.KRBMsgError, "maximum number of referrals exceeded")
 		}
 		// Server referral https://tools.ietf.org/html/rfc6806.html#section-8
 		// The TGS Rep contains a TGT for another domain as the service resides in that domain.
 		if ok, err := tgsRep.IsValid(cl.Config, tgsReq); !ok {
 			return tgsReq, tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: TGS_REP is not valid")
 		}
-		cl.AddSession(tgsRep.Ticket, tgsRep.DecryptedEncPart)
 		realm := tgsRep.Ticket.SName.NameString[1]
+		if realm == kdcRealm {
+			return tgsReq, tgsRep, krberror.NewErrorf(krberror.KRBMsgError, "TGS Exchange Error: KDC of realm %s referred the request to itself", kdcRealm)
+		}
+		// The KDC may provide the canonical name of the service with the referral
+		d, ok, err := tgsRep.SvrReferralData(sessionKey)
+		if err != nil {
+			return tgsReq, tgsRep, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to process the server referral")
+		}
+		if ok && len(d.ReferredName.NameString) > 0 {
+			spn = d.ReferredName
+		}
+		cl.AddSession(tgsRep.Ticket, tgsRep.DecryptedEncPart)
 		referral++
-		return cl.TGSExchange(spn, realm, tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, false, referral)
+		return cl.TGSExchangeContext(ctx, spn, realm, tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, false, referral)
 	}
 	if ok, err := tgsRep.IsValid(cl.Config, tgsReq); !ok {
 		return tgsReq, tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: TGS_REP is not valid")
@@ -62,44 +64,149 @@ func (cl *Client) TGSExchange(spn types.PrincipalName, kdcRealm string, tkt mess
 	return tgsReq, tgsRep, nil
 }
 
+// isReferralTGT indicates if the ticket issued by the KDC is a TGT for another realm rather than the ticket requested.
+func isReferralTGT(sname, requested types.PrincipalName) bool {
+	return len(sname.NameString) == 2 && sname.NameString[0] == "krbtgt" && !sname.Equal(requested)
+}
+
+// sendTGSReq sends the TGS_REQ to the KDC, armoring it with FAST if available for the TGT, and decrypts the reply.
+// If a sub-key is provided it must be that of the TGS_REQ's authenticator and is used to decrypt the reply.
+func (cl *Client) sendTGSReq(ctx context.Context, tgsReq *messages.TGSReq, kdcRealm string, tkt messages.Ticket, sessionKey, subKey types.EncryptionKey) (messages.TGSRep, error) {
+	if cl.fastAvailable(tkt) {
+		return cl.fastTGSExchange(ctx, tgsReq, kdcRealm, tkt, sessionKey, subKey)
+	}
+	var tgsRep messages.TGSRep
+	b, err := tgsReq.Marshal()
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to generate a new TGS_REQ")
+	}
+	r, err := cl.SendToKDCContext(ctx, b, kdcRealm)
+	if err != nil {
+		if _, ok := err.(messages.KRBError); ok {
+			return tgsRep, krberror.Errorf(err, krberror.KDCError, "TGS Exchange Error: kerberos error response from KDC")
+		}
+		return tgsRep, krberror.Errorf(err, krberror.NetworkingError, "TGS Exchange Error: issue sending TGS_REQ to KDC")
+	}
+	err = tgsRep.Unmarshal(r)
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to process the TGS_REP")
+	}
+	if subKey.KeyType != 0 {
+		err = tgsRep.DecryptEncPartWithSubKey(subKey)
+	} else {
+		err = tgsRep.DecryptEncPart(sessionKey)
+	}
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to process the TGS_REP")
+	}
+	return tgsRep, nil
+}
+
+// fastTGSExchange sends the TGS_REQ armored with FAST, using the TGT session key and the authenticator sub-key to derive
+// the armor key, and processes the armored reply. If a sub-key is not provided a new one is generated and the TGS_REQ's
+// PA_TGS_REQ is replaced.
+func (cl *Client) fastTGSExchange(ctx context.Context, tgsReq *messages.TGSReq, kdcRealm string, tkt messages.Ticket, sessionKey, subKey types.EncryptionKey) (messages.TGSRep, error) {
+	var tgsRep messages.TGSRep
+	if subKey.KeyType == 0 {
+		var err error
+		subKey, err = newSubKey(sessionKey.KeyType)
+		if err != nil {
+			return tgsRep, krberror.Errorf(err, krberror.EncryptingError, "TGS Exchange Error: failed to generate authenticator sub-key")
+		}
+		err = tgsReq.SetPAData(cl.Credentials.CName, tkt, sessionKey, subKey)
+		if err != nil {
+			return tgsRep, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to set TGS_REQ PAData")
+		}
+	}
+	fast, err := newTGSFASTState(subKey, sessionKey)
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to create FAST armor")
+	}
+	armoredReq, err := fast.armorTGSReq(*tgsReq)
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed armoring TGS_REQ")
+	}
+	b, err := armoredReq.Marshal()
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to generate a new TGS_REQ")
+	}
+	r, err := cl.SendToKDCContext(ctx, b, kdcRealm)
+	if err != nil {
+		if e, ok := err.(messages.KRBError); ok {
+			e, ferr := fast.processKRBError(e)
+			if ferr != nil {
+				return tgsRep, krberror.Errorf(ferr, krberror.KRBMsgError, "TGS Exchange Error: failed to process FAST error from KDC")
+			}
+			return tgsRep, krberror.Errorf(e, krberror.KDCError, "TGS Exchange Error: kerberos error response from KDC")
+		}
+		return tgsRep, krberror.Errorf(err, krberror.NetworkingError, "TGS Exchange Error: issue sending TGS_REQ to KDC")
+	}
+	err = tgsRep.Unmarshal(r)
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to process the TGS_REP")
+	}
+	fr, err := fast.processReply(&tgsRep.KDCRepFields, tgsReq.ReqBody.Nonce)
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to process the FAST response")
+	}
+	key, err := fast.strengthenReplyKey(fr, subKey)
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to process the FAST response")
+	}
+	err = tgsRep.DecryptEncPartWithSubKey(key)
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to process the TGS_REP")
+	}
+	return tgsRep, nil
+}
+
 // GetServiceTicket makes a request to get a service ticket for the SPN specified
 // SPN format: <SERVICE>/<FQDN> Eg. HTTP/www.example.com
 // The ticket will be added to the client's ticket cache
 func (cl *Client) GetServiceTicket(spn string) (messages.Ticket, types.EncryptionKey, error) {
+	return cl.GetServiceTicketContext(context.Background(), spn)
+}
+
+// GetServiceTicketContext makes a request to get a service ticket for the SPN specified. The context's cancellation and
+// deadline apply to any exchanges with the KDC needed to renew or obtain the ticket.
+func (cl *Client) GetServiceTicketContext(ctx context.Context, spn string) (messages.Ticket, types.EncryptionKey, error) {
 	var tkt messages.Ticket
 	var skey types.EncryptionKey
-	if tkt, skey, ok := cl.GetCachedTicket(spn); ok {
+	if tkt, skey, ok := cl.getCachedTicket(ctx, spn); ok {
 		// Already a valid ticket in the cache
 		return tkt, skey, nil
 	}
 	princ := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, spn)
-	sess, err := cl.GetSessionFromPrincipalName(princ)
+	sess, err := cl.getSessionFromPrincipalName(ctx, princ)
 	if err != nil {
 		return tkt, skey, err
 	}
 	// Ensure TGT still valid
 	if time.Now().UTC().After(sess.EndTime) {
-		_, err := cl.updateSession(sess)
+		_, err := cl.updateSession(ctx, sess)
 		if err != nil {
 			return tkt, skey, err
 		}
 		// Get the session again as it could have been replaced by the update
-		sess, err = cl.GetSessionFromPrincipalName(princ)
+		sess, err = cl.getSessionFromPrincipalName(ctx, princ)
 		if err != nil {
 			return tkt, skey, err
 		}
 	}
-	_, tgsRep, err := cl.TGSExchange(princ, sess.Realm, sess.TGT, sess.SessionKey, false, 0)
+	_, tgsRep, err := cl.TGSExchangeContext(ctx, princ, sess.Realm, sess.TGT, sess.SessionKey, false, 0)
 	if err != nil {
 		return tkt, skey, err
 	}
-	cl.Cache.addEntry(
+	e := cl.Cache.addEntry(
 		tgsRep.Ticket,
 		tgsRep.DecryptedEncPart.AuthTime,
 		tgsRep.DecryptedEncPart.StartTime,
 		tgsRep.DecryptedEncPart.EndTime,
 		tgsRep.DecryptedEncPart.RenewTill,
+		tgsRep.DecryptedEncPart.Flags,
 		tgsRep.DecryptedEncPart.Key,
 	)
+	// The ticket may be issued to the canonical name of the service
+	cl.Cache.addAlias(spn, e)
 	return tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, nil
 }
@@ -1,6 +1,9 @@
 package client
 
 import (
+	"context"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
 	"gopkg.in/jcmturner/gokrb5.v5/messages"
 	"gopkg.in/jcmturner/gokrb5.v5/types"
 	"strings"
@@ -21,6 +24,7 @@ type CacheEntry struct {
 	StartTime  time.Time
 	EndTime    time.Time
 	RenewTill  time.Time
+	Flags      asn1.BitString
 	SessionKey types.EncryptionKey
 }
 
@@ -40,7 +44,7 @@ func (c *Cache) getEntry(spn string) (CacheEntry, bool) {
 }
 
 // AddEntry adds a ticket to the cache.
-func (c *Cache) addEntry(tkt messages.Ticket, authTime, startTime, endTime, renewTill time.Time, sessionKey types.EncryptionKey) CacheEntry {
+func (c *Cache) addEntry(tkt messages.Ticket, authTime, startTime, endTime, renewTill time.Time, flags asn1.BitString, sessionKey types.EncryptionKey) CacheEntry {
 	spn := strings.Join(tkt.SName.NameString, "/")
 	c.mux.Lock()
 	defer c.mux.Unlock()
@@ -50,11 +54,23 @@ func (c *Cache) addEntry(tkt messages.Ticket, authTime, startTime, endTime, rene
 		StartTime:  startTime,
 		EndTime:    endTime,
 		RenewTill:  renewTill,
+		Flags:      flags,
 		SessionKey: sessionKey,
 	}
 	return c.Entries[spn]
 }
 
+// addAlias adds the cache entry under the SPN provided if it differs from the name of the entry's ticket, as when the
+// KDC issues a ticket to the canonical name of the service requested.
+func (c *Cache) addAlias(spn string, e CacheEntry) {
+	if spn == strings.Join(e.Ticket.SName.NameString, "/") {
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	(*c).Entries[spn] = e
+}
+
 // Clear deletes all the cache entries
 func (c *Cache) clear() {
 	c.mux.Lock()
@@ -74,15 +90,21 @@ func (c *Cache) RemoveEntry(spn string) {
 // GetCachedTicket returns a ticket from the cache for the SPN.
 // Only a ticket that is currently valid will be returned.
 func (cl *Client) GetCachedTicket(spn string) (messages.Ticket, types.EncryptionKey, bool) {
+	return cl.getCachedTicket(context.Background(), spn)
+}
+
+// getCachedTicket returns a ticket from the cache for the SPN renewing it, within the context provided, if required.
+func (cl *Client) getCachedTicket(ctx context.Context, spn string) (messages.Ticket, types.EncryptionKey, bool) {
 	if e, ok := cl.Cache.getEntry(spn); ok {
 		//If within time window of ticket return it
 		if time.Now().UTC().After(e.StartTime) && time.Now().UTC().Before(e.EndTime) {
 			return e.Ticket, e.SessionKey, true
 		} else if time.Now().UTC().Before(e.RenewTill) {
-			e, err := cl.renewTicket(e)
+			e, err := cl.renewTicket(ctx, e)
 			if err != nil {
 				return e.Ticket, e.SessionKey, false
 			}
+			cl.Cache.addAlias(spn, e)
 			return e.Ticket, e.SessionKey, true
 		}
 	}
@@ -93,9 +115,9 @@ func (cl *Client) GetCachedTicket(spn string) (messages.Ticket, types.Encryption
 
 // renewTicket renews a cache entry ticket.
 // To renew from outside the client package use GetCachedTicket
-func (cl *Client) renewTicket(e CacheEntry) (CacheEntry, error) {
+func (cl *Client) renewTicket(ctx context.Context, e CacheEntry) (CacheEntry, error) {
 	spn := e.Ticket.SName
-	_, tgsRep, err := cl.TGSExchange(spn, e.Ticket.Realm, e.Ticket, e.SessionKey, true, 0)
+	_, tgsRep, err := cl.TGSExchangeContext(ctx, spn, e.Ticket.Realm, e.Ticket, e.SessionKey, true, 0)
 	if err != nil {
 		return e, err
 	}
@@ -105,6 +127,7 @@ func (cl *Client) renewTicket(e CacheEntry) (CacheEntry, error) {
 		tgsRep.DecryptedEncPart.StartTime,
 		tgsRep.DecryptedEncPart.EndTime,
 		tgsRep.DecryptedEncPart.RenewTill,
+		tgsRep.DecryptedEncPart.Flags,
 		tgsRep.DecryptedEncPart.Key,
 	)
 	return e, nil
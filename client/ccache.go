@@ -0,0 +1,52 @@
+package client
+
+import (
+	"fmt"
+
+	"gopkg.in/jcmturner/gokrb5.v5/credentials"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+// CCache returns a credential cache holding the client's TGTs and cached service tickets.
+func (cl *Client) CCache() (credentials.CCache, error) {
+	c := credentials.NewCCache(cl.Credentials.CName, cl.Credentials.Realm)
+	cl.sessions.mux.RLock()
+	for _, s := range cl.sessions.Entries {
+		s.mux.RLock()
+		b, err := s.TGT.Marshal()
+		if err != nil {
+			s.mux.RUnlock()
+			cl.sessions.mux.RUnlock()
+			return c, fmt.Errorf("error marshaling TGT for realm %s: %v", s.Realm, err)
+		}
+		c.AddEntry(s.TGT.SName, s.TGT.Realm, s.SessionKey, s.AuthTime, s.AuthTime, s.EndTime, s.RenewTill, s.Flags, b)
+		if s.fast {
+			// Record that the realm's KDC supports FAST as MIT krb5 does
+			tgt := types.PrincipalName{NameString: s.TGT.SName.NameString}
+			c.SetConfigEntry("fast_avail", tgt.GetPrincipalNameString()+"@"+s.TGT.Realm, []byte("yes"))
+		}
+		s.mux.RUnlock()
+	}
+	cl.sessions.mux.RUnlock()
+	cl.Cache.mux.RLock()
+	defer cl.Cache.mux.RUnlock()
+	for _, e := range cl.Cache.Entries {
+		b, err := e.Ticket.Marshal()
+		if err != nil {
+			return c, fmt.Errorf("error marshaling ticket for %s: %v", e.Ticket.SName.GetPrincipalNameString(), err)
+		}
+		c.AddEntry(e.Ticket.SName, e.Ticket.Realm, e.SessionKey, e.AuthTime, e.StartTime, e.EndTime, e.RenewTill, e.Flags, b)
+	}
+	return c, nil
+}
+
+// SaveCCache stores the client's TGTs and cached service tickets in the credential cache with the name provided so that
+// they can be used by other Kerberos aware tools. FILE, DIR, KEYRING and KCM caches are supported and a name without a
+// type is a file path. The previous contents of the cache are replaced.
+func (cl *Client) SaveCCache(name string) error {
+	c, err := cl.CCache()
+	if err != nil {
+		return err
+	}
+	return c.Store(name)
+}
@@ -2,14 +2,18 @@
 package client
 
 import (
+	"context"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"strings"
 
 	"gopkg.in/jcmturner/gokrb5.v5/config"
 	"gopkg.in/jcmturner/gokrb5.v5/credentials"
 	"gopkg.in/jcmturner/gokrb5.v5/crypto"
 	"gopkg.in/jcmturner/gokrb5.v5/crypto/etype"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/errorcode"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/flags"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
 	"gopkg.in/jcmturner/gokrb5.v5/keytab"
 	"gopkg.in/jcmturner/gokrb5.v5/krberror"
@@ -24,14 +28,24 @@ type Client struct {
 	GoKrb5Conf  *Config
 	sessions    *sessions
 	Cache       *Cache
+	Transport   Transport
+	fastArmor   *fastArmor
+	health      *kdcHealth
 }
 
 // Config struct holds GoKRB5 specific client configurations.
-// Set Disable_PA_FX_FAST to true to force this behaviour off.
+// Set Disable_PA_FX_FAST to true to force this behaviour off. This disables both the negotiation of FAST and the armoring of
+// AS and TGS exchanges.
 // Set Assume_PA_ENC_TIMESTAMP_Required to send the PA_ENC_TIMESTAMP pro-actively rather than waiting for a KRB_ERROR response from the KDC indicating it is required.
+// Set PKINITTrustPool to the pool of CA certificates used to verify the KDC's certificate during PKINIT. If nil the system roots are used.
+// Set PKINITUseECDH to use elliptic curve rather than MODP Diffie-Hellman key agreement for PKINIT.
+// Set OTPPrompter to supply one-time passwords when the KDC requires OTP pre-authentication within FAST.
 type Config struct {
 	DisablePAFXFast              bool
 	AssumePAEncTimestampRequired bool
+	PKINITTrustPool              *x509.CertPool
+	PKINITUseECDH                bool
+	OTPPrompter                  OTPPrompter
 }
 
 // NewClientWithPassword creates a new client from a password credential.
@@ -45,7 +59,28 @@ func NewClientWithPassword(username, realm, password string) Client {
 		sessions: &sessions{
 			Entries: make(map[string]*session),
 		},
-		Cache: NewCache(),
+		Cache:  NewCache(),
+		health: newKDCHealth(),
+	}
+}
+
+// NewEnterpriseClientWithPassword creates a new client from a password credential for an enterprise principal name (UPN)
+// such as user@example.com. The KDC canonicalizes the name and refers the client to the correct realm if required.
+// Set the realm to empty string to send the initial request to the realm matching the domain of the UPN.
+func NewEnterpriseClientWithPassword(upn, realm, password string) Client {
+	if realm == "" && strings.Contains(upn, "@") {
+		realm = strings.ToUpper(upn[strings.LastIndex(upn, "@")+1:])
+	}
+	creds := credentials.NewCredentialsFromPrincipal(types.NewEnterprisePrincipalName(upn), realm)
+	return Client{
+		Credentials: creds.WithPassword(password),
+		Config:      config.NewConfig(),
+		GoKrb5Conf:  &Config{},
+		sessions: &sessions{
+			Entries: make(map[string]*session),
+		},
+		Cache:  NewCache(),
+		health: newKDCHealth(),
 	}
 }
 
@@ -59,7 +94,8 @@ func NewClientWithKeytab(username, realm string, kt keytab.Keytab) Client {
 		sessions: &sessions{
 			Entries: make(map[string]*session),
 		},
-		Cache: NewCache(),
+		Cache:  NewCache(),
+		health: newKDCHealth(),
 	}
 }
 
@@ -74,7 +110,8 @@ func NewClientFromCCache(c credentials.CCache) (Client, error) {
 		sessions: &sessions{
 			Entries: make(map[string]*session),
 		},
-		Cache: NewCache(),
+		Cache:  NewCache(),
+		health: newKDCHealth(),
 	}
 	spn := types.PrincipalName{
 		NameType:   nametype.KRB_NT_SRV_INST,
@@ -94,6 +131,7 @@ func NewClientFromCCache(c credentials.CCache) (Client, error) {
 		AuthTime:   cred.AuthTime,
 		EndTime:    cred.EndTime,
 		RenewTill:  cred.RenewTill,
+		Flags:      cred.TicketFlags,
 		TGT:        tgt,
 		SessionKey: cred.Key,
 	}
@@ -109,6 +147,7 @@ func NewClientFromCCache(c credentials.CCache) (Client, error) {
 			cred.StartTime,
 			cred.EndTime,
 			cred.RenewTill,
+			cred.TicketFlags,
 			cred.Key,
 		)
 	}
@@ -121,6 +160,13 @@ func (cl *Client) WithConfig(cfg *config.Config) *Client {
 	return cl
 }
 
+// WithTransport sets the transport the client uses to exchange messages with KDCs.
+// If no transport is set the client communicates with the KDCs in its Kerberos configuration over the network.
+func (cl *Client) WithTransport(t Transport) *Client {
+	cl.Transport = t
+	return cl
+}
+
 // WithKeytab adds a keytab to the client
 func (cl *Client) WithKeytab(kt keytab.Keytab) *Client {
 	cl.Credentials.WithKeytab(kt)
@@ -173,11 +219,11 @@ func (cl *Client) IsConfigured() (bool, error) {
 	if cl.Credentials.Realm == "" {
 		return false, errors.New("client does not have a define realm")
 	}
-	// Client needs to have either a password, keytab or a session already (later when loading from CCache)
-	if !cl.Credentials.HasPassword() && !cl.Credentials.HasKeytab() {
+	// Client needs to have either a password, keytab, certificate, OTP prompter, be anonymous or have a session already (later when loading from CCache)
+	if !cl.Credentials.HasPassword() && !cl.Credentials.HasKeytab() && !cl.Credentials.HasCertificate() && cl.GoKrb5Conf.OTPPrompter == nil && !cl.anonymous() {
 		sess, err := cl.GetSessionFromRealm(cl.Credentials.Realm)
 		if err != nil || sess.AuthTime.IsZero() {
-			return false, errors.New("client has neither a keytab nor a password set and no session")
+			return false, errors.New("client has neither a keytab, a password nor a certificate set and no session")
 		}
 	}
 	if !cl.Config.LibDefaults.DNSLookupKDC {
@@ -195,6 +241,12 @@ func (cl *Client) IsConfigured() (bool, error) {
 
 // Login the client with the KDC via an AS exchange.
 func (cl *Client) Login() error {
+	return cl.LoginContext(context.Background())
+}
+
+// LoginContext logs the client in with the KDC via an AS exchange. The context's cancellation and deadline apply to the
+// exchanges with the KDC.
+func (cl *Client) LoginContext(ctx context.Context) error {
 	if ok, err := cl.IsConfigured(); !ok {
 		return err
 	}
@@ -202,15 +254,27 @@ func (cl *Client) Login() error {
 	if err != nil {
 		return krberror.Errorf(err, krberror.KRBMsgError, "error generating new AS_REQ")
 	}
-	err = setPAData(cl, messages.KRBError{}, &ASReq)
+	if cl.anonymous() {
+		types.SetFlag(&ASReq.ReqBody.KDCOptions, flags.RequestAnonymous)
+	}
+	if cl.Credentials.CName.NameType == nametype.KRB_NT_ENTERPRISE {
+		// Enterprise names must be canonicalized by the KDC: https://tools.ietf.org/html/rfc6806.html#section-5
+		types.SetFlag(&ASReq.ReqBody.KDCOptions, flags.Canonicalize)
+	}
+	err = setPAData(cl, messages.KRBError{}, &ASReq, nil)
 	if err != nil {
 		return krberror.Errorf(err, krberror.KRBMsgError, "failed setting AS_REQ PAData")
 	}
-	ASRep, err := cl.ASExchange(cl.Credentials.Realm, ASReq, 0)
+	ASRep, err := cl.ASExchangeContext(ctx, cl.Credentials.Realm, ASReq, 0)
 	if err != nil {
 		return err
 	}
-	cl.AddSession(ASRep.Ticket, ASRep.DecryptedEncPart)
+	if !cl.anonymous() {
+		// Record the canonical client name and realm returned by the KDC: https://tools.ietf.org/html/rfc6806.html#section-5
+		cl.Credentials.CName = ASRep.CName
+		cl.Credentials.Realm = ASRep.CRealm
+	}
+	cl.addSession(ASRep.Ticket, ASRep.DecryptedEncPart, cl.fastArmor != nil && !cl.GoKrb5Conf.DisablePAFXFast)
 	return nil
 }
 
@@ -5,6 +5,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"io"
 	"io/ioutil"
@@ -416,7 +417,7 @@ func TestMultiThreadedClientSession(t *testing.T) {
 	}
 	go func() {
 		for {
-			err := cl.renewTGT(s)
+			err := cl.renewTGT(context.Background(), s)
 			if err != nil {
 				t.Logf("error renewing TGT: %v", err)
 			}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/config"
+	"gopkg.in/jcmturner/gokrb5.v5/crypto"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/errorcode"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/flags"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/keyusage"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/patype"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+func TestClient_LoginEnterpriseReferral(t *testing.T) {
+	t.Parallel()
+	c, err := config.NewConfigFromString(testMemKDCConf)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	kdc := newTestMemKDC("TEST.GOKRB5", "passwordvalue")
+	canonical := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	var enterprise, canonicalize bool
+	kdc.as = func(ASReq messages.ASReq, iss *testIssue) error {
+		if ASReq.ReqBody.Realm == "TEST.GOKRB5" {
+			// The KDC of the UPN's domain refers the client to the realm of its account
+			enterprise = ASReq.ReqBody.CName.NameType == nametype.KRB_NT_ENTERPRISE
+			canonicalize = types.IsFlagSet(&ASReq.ReqBody.KDCOptions, flags.Canonicalize)
+			e := messages.NewKRBError(ASReq.ReqBody.SName, ASReq.ReqBody.Realm, errorcode.KDC_ERR_WRONG_REALM, "client not in this realm")
+			e.CRealm = "SUB.TEST.GOKRB5"
+			return e
+		}
+		if ASReq.ReqBody.Realm != "SUB.TEST.GOKRB5" {
+			return errors.New("AS_REQ not for the realm referred to")
+		}
+		// The canonical name is returned, protected by the PA_REQ_ENC_PA_REP checksum of the request
+		if !ASReq.PAData.Contains(patype.PA_REQ_ENC_PA_REP) {
+			return errors.New("AS_REQ does not contain a PA_REQ_ENC_PA_REP")
+		}
+		key, _, err := crypto.GetKeyFromPassword(kdc.password, canonical, ASReq.ReqBody.Realm, ASReq.ReqBody.EType[0], types.PADataSequence{})
+		if err != nil {
+			return err
+		}
+		b, err := ASReq.Marshal()
+		if err != nil {
+			return err
+		}
+		et, err := crypto.GetEtype(key.KeyType)
+		if err != nil {
+			return err
+		}
+		cb, err := et.GetChecksumHash(key.KeyValue, b, keyusage.KEY_USAGE_AS_REQ)
+		if err != nil {
+			return err
+		}
+		pb, err := asn1.Marshal(types.PAReqEncPARep{ChksumType: et.GetHashID(), Chksum: cb})
+		if err != nil {
+			return err
+		}
+		iss.cname = canonical
+		iss.crealm = ASReq.ReqBody.Realm
+		iss.replyKey = key
+		types.SetFlag(&iss.flags, flags.EncPARep)
+		iss.encPAData = types.PADataSequence{
+			{PADataType: patype.PA_REQ_ENC_PA_REP, PADataValue: pb},
+			{PADataType: patype.PA_FX_FAST},
+		}
+		return nil
+	}
+	cl := NewEnterpriseClientWithPassword("testuser1@test.gokrb5", "", "passwordvalue")
+	cl.WithConfig(c).WithTransport(kdc)
+	defer cl.Destroy()
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("Error on enterprise login: %v", err)
+	}
+	assert.True(t, enterprise, "AS_REQ should be for the enterprise principal name")
+	assert.True(t, canonicalize, "AS_REQ should request canonicalization")
+	assert.Equal(t, []string{
+		"AS_REQ TEST.GOKRB5 krbtgt/TEST.GOKRB5",
+		"AS_REQ SUB.TEST.GOKRB5 krbtgt/SUB.TEST.GOKRB5",
+	}, kdc.requests(), "Requests to the KDC not as expected")
+
+	// The client's name and realm become the canonical ones returned by the KDC
+	assert.True(t, canonical.Equal(cl.Credentials.CName), "Client name not canonicalized: %+v", cl.Credentials.CName)
+	assert.Equal(t, nametype.KRB_NT_PRINCIPAL, cl.Credentials.CName.NameType, "Client name type not canonicalized")
+	assert.Equal(t, "SUB.TEST.GOKRB5", cl.Credentials.Realm, "Client realm not that referred to")
+	tgt, key, err := cl.GetTGT("SUB.TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error getting TGT for the realm referred to: %v", err)
+	}
+	assert.Equal(t, "krbtgt/SUB.TEST.GOKRB5", tgt.SName.GetPrincipalNameString(), "TGT not as expected")
+	skey, ok := kdc.sessionKey(tgt)
+	assert.True(t, ok, "TGT should have been issued by the KDC")
+	assert.Equal(t, skey, key, "TGT session key not as expected")
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gopkg.in/jcmturner/gokrb5.v5/config"
+	"gopkg.in/jcmturner/gokrb5.v5/credentials"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/flags"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
+	"gopkg.in/jcmturner/gokrb5.v5/krberror"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+// Reference: https://tools.ietf.org/html/rfc4120#section-3.6
+
+// GetForwardedTGT requests a forwarded TGT for the realm specified that can be delegated to a service. The client's TGT
+// must be forwardable. The forwarded TGT does not contain any host addresses so it can be used from the service's host.
+func (cl *Client) GetForwardedTGT(realm string) (messages.Ticket, messages.EncKDCRepPart, error) {
+	return cl.GetForwardedTGTContext(context.Background(), realm)
+}
+
+// GetForwardedTGTContext requests a forwarded TGT for the realm specified within the context provided.
+func (cl *Client) GetForwardedTGTContext(ctx context.Context, realm string) (messages.Ticket, messages.EncKDCRepPart, error) {
+	sess, err := cl.validSession(ctx, realm)
+	if err != nil {
+		return messages.Ticket{}, messages.EncKDCRepPart{}, err
+	}
+	spn := types.PrincipalName{
+		NameType:   nametype.KRB_NT_SRV_INST,
+		NameString: []string{"krbtgt", sess.Realm},
+	}
+	tgsReq, err := messages.NewTGSReq(cl.Credentials.CName, sess.Realm, cl.Config, sess.TGT, sess.SessionKey, spn, false)
+	if err != nil {
+		return messages.Ticket{}, messages.EncKDCRepPart{}, krberror.Errorf(err, krberror.KRBMsgError, "Forwarded TGT Error: failed to generate a new TGS_REQ")
+	}
+	types.SetFlag(&tgsReq.ReqBody.KDCOptions, flags.Forwardable)
+	types.SetFlag(&tgsReq.ReqBody.KDCOptions, flags.Forwarded)
+	tgsReq.ReqBody.Addresses = nil
+	err = tgsReq.SetPAData(cl.Credentials.CName, sess.TGT, sess.SessionKey, types.EncryptionKey{})
+	if err != nil {
+		return messages.Ticket{}, messages.EncKDCRepPart{}, krberror.Errorf(err, krberror.KRBMsgError, "Forwarded TGT Error: failed to set TGS_REQ PAData")
+	}
+	tgsRep, err := cl.sendTGSReq(ctx, &tgsReq, sess.Realm, sess.TGT, sess.SessionKey, types.EncryptionKey{})
+	if err != nil {
+		return messages.Ticket{}, messages.EncKDCRepPart{}, err
+	}
+	if ok, err := tgsRep.IsValid(cl.Config, tgsReq); !ok {
+		return messages.Ticket{}, messages.EncKDCRepPart{}, krberror.Errorf(err, krberror.KRBMsgError, "Forwarded TGT Error: TGS_REP is not valid")
+	}
+	return tgsRep.Ticket, tgsRep.DecryptedEncPart, nil
+}
+
+// NewDelegationKRBCred creates a KRB_CRED containing a forwarded TGT for the client's realm to delegate the client's
+// credentials to a service. The KRB_CRED is encrypted with the session key of the service ticket the credentials are
+// delegated with.
+func (cl *Client) NewDelegationKRBCred(sessionKey types.EncryptionKey) (messages.KRBCred, error) {
+	return cl.NewDelegationKRBCredContext(context.Background(), sessionKey)
+}
+
+// NewDelegationKRBCredContext creates a KRB_CRED containing a forwarded TGT, requested within the context provided, to
+// delegate the client's credentials to a service.
+func (cl *Client) NewDelegationKRBCredContext(ctx context.Context, sessionKey types.EncryptionKey) (messages.KRBCred, error) {
+	tkt, dep, err := cl.GetForwardedTGTContext(ctx, cl.Credentials.Realm)
+	if err != nil {
+		return messages.KRBCred{}, err
+	}
+	info := messages.KrbCredInfo{
+		Key:       dep.Key,
+		PRealm:    cl.Credentials.Realm,
+		PName:     cl.Credentials.CName,
+		Flags:     dep.Flags,
+		AuthTime:  dep.AuthTime,
+		StartTime: dep.StartTime,
+		EndTime:   dep.EndTime,
+		RenewTill: dep.RenewTill,
+		SRealm:    dep.SRealm,
+		SName:     dep.SName,
+		CAddr:     dep.CAddr,
+	}
+	return messages.NewKRBCred([]messages.Ticket{tkt}, []messages.KrbCredInfo{info}, sessionKey)
+}
+
+// NewClientFromKRBCred creates a client from the credentials in a decrypted KRB_CRED, such as those delegated to a
+// service, so that the service can act on behalf of the client they were delegated by.
+//
+// WARNING: A client created from a KRB_CRED does not automatically renew TGTs and a failure will occur after the TGT expires.
+func NewClientFromKRBCred(krbCred messages.KRBCred) (Client, error) {
+	info := krbCred.DecryptedEncPart.TicketInfo
+	if len(info) < 1 || len(info) != len(krbCred.Tickets) {
+		return Client{}, errors.New("KRB_CRED does not contain ticket information for its tickets, it may not be decrypted")
+	}
+	creds := credentials.NewCredentialsFromPrincipal(info[0].PName, info[0].PRealm)
+	cl := Client{
+		Credentials: &creds,
+		Config:      config.NewConfig(),
+		GoKrb5Conf:  &Config{},
+		sessions: &sessions{
+			Entries: make(map[string]*session),
+		},
+		Cache:  NewCache(),
+		health: newKDCHealth(),
+	}
+	var tgt bool
+	for i, tkt := range krbCred.Tickets {
+		if len(tkt.SName.NameString) == 2 && tkt.SName.NameString[0] == "krbtgt" {
+			realm := tkt.SName.NameString[1]
+			cl.sessions.Entries[realm] = &session{
+				Realm:      realm,
+				AuthTime:   info[i].AuthTime,
+				EndTime:    info[i].EndTime,
+				RenewTill:  info[i].RenewTill,
+				Flags:      info[i].Flags,
+				TGT:        tkt,
+				SessionKey: info[i].Key,
+				cancel:     make(chan bool, 1),
+			}
+			tgt = true
+			continue
+		}
+		cl.Cache.addEntry(
+			tkt,
+			info[i].AuthTime,
+			info[i].StartTime,
+			info[i].EndTime,
+			info[i].RenewTill,
+			info[i].Flags,
+			info[i].Key,
+		)
+	}
+	if !tgt {
+		return cl, fmt.Errorf("TGT not found in KRB_CRED for %s", info[0].PName.GetPrincipalNameString())
+	}
+	return cl, nil
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/config"
+	"gopkg.in/jcmturner/gokrb5.v5/gssapi"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/flags"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+func TestClient_SetSPNEGOHeaderWithDelegation(t *testing.T) {
+	t.Parallel()
+	c, err := config.NewConfigFromString(testMemKDCConf)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	kdc := newTestMemKDC("TEST.GOKRB5", "passwordvalue")
+	var fwdReqs int
+	var forwarded, forwardable, addresses bool
+	kdc.tgs = func(TGSReq messages.TGSReq, sessionKey, subKey types.EncryptionKey, iss *testIssue) error {
+		if TGSReq.ReqBody.SName.GetPrincipalNameString() != "krbtgt/TEST.GOKRB5" {
+			return nil
+		}
+		fwdReqs++
+		forwarded = types.IsFlagSet(&TGSReq.ReqBody.KDCOptions, flags.Forwarded)
+		forwardable = types.IsFlagSet(&TGSReq.ReqBody.KDCOptions, flags.Forwardable)
+		addresses = len(TGSReq.ReqBody.Addresses) > 0
+		return nil
+	}
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue")
+	cl.WithConfig(c).WithTransport(kdc)
+	defer cl.Destroy()
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("Error on login: %v", err)
+	}
+
+	r := httptest.NewRequest("GET", "http://host.test.gokrb5/", nil)
+	err = cl.SetSPNEGOHeaderWithDelegation(r, "HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("Error setting SPNEGO header with delegation: %v", err)
+	}
+	assert.Equal(t, 1, fwdReqs, "A forwarded TGT should have been requested")
+	assert.True(t, forwarded, "TGS_REQ for the TGT should have the forwarded option set")
+	assert.True(t, forwardable, "TGS_REQ for the TGT should have the forwardable option set")
+	assert.False(t, addresses, "TGS_REQ for the forwarded TGT should not contain host addresses")
+
+	// Decode the AP_REQ from the header
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Negotiate ") {
+		t.Fatalf("Authorization header not a SPNEGO header: %s", h)
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(h, "Negotiate "))
+	if err != nil {
+		t.Fatalf("Error decoding SPNEGO header: %v", err)
+	}
+	var spnego gssapi.SPNEGO
+	err = spnego.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling SPNEGO token: %v", err)
+	}
+	var mt gssapi.MechToken
+	err = mt.Unmarshal(spnego.NegTokenInit.MechToken)
+	if err != nil {
+		t.Fatalf("Error unmarshaling mech token: %v", err)
+	}
+	tkt, skey, err := cl.GetServiceTicket("HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("Error getting cached service ticket: %v", err)
+	}
+	assert.Equal(t, tkt.EncPart.Cipher, mt.APReq.Ticket.EncPart.Cipher, "AP_REQ should contain the service ticket")
+	a, err := mt.APReq.DecryptAuthenticator(skey)
+	if err != nil {
+		t.Fatalf("Error decrypting authenticator: %v", err)
+	}
+
+	// The KRB_CRED is in the authenticator checksum
+	var chksum gssapi.AuthenticatorChksum
+	err = chksum.Unmarshal(a.Cksum.Checksum)
+	if err != nil {
+		t.Fatalf("Error unmarshaling authenticator checksum: %v", err)
+	}
+	assert.NotEqual(t, uint32(0), chksum.Flags&gssapi.GSS_C_DELEG_FLAG, "Authenticator checksum should have the delegation flag set")
+	assert.Equal(t, uint16(1), chksum.DlgOpt, "Authenticator checksum delegation option not as expected")
+	krbCred, ok, err := chksum.KRBCred()
+	if err != nil {
+		t.Fatalf("Error unmarshaling delegated KRB_CRED: %v", err)
+	}
+	if !ok {
+		t.Fatal("Authenticator checksum should contain a KRB_CRED")
+	}
+
+	// The KRB_CRED is encrypted in the AP session key and carries the forwarded TGT
+	wrong := krbCred
+	err = wrong.DecryptEncPart(types.EncryptionKey{KeyType: skey.KeyType, KeyValue: make([]byte, len(skey.KeyValue))})
+	assert.Error(t, err, "KRB_CRED should not decrypt with a key other than the AP session key")
+	err = krbCred.DecryptEncPart(skey)
+	if err != nil {
+		t.Fatalf("Error decrypting KRB_CRED with the AP session key: %v", err)
+	}
+	if !assert.Len(t, krbCred.Tickets, 1, "KRB_CRED should contain one ticket") ||
+		!assert.Len(t, krbCred.DecryptedEncPart.TicketInfo, 1, "KRB_CRED should contain one ticket info") {
+		return
+	}
+	fwd := krbCred.Tickets[0]
+	info := krbCred.DecryptedEncPart.TicketInfo[0]
+	assert.Equal(t, "krbtgt/TEST.GOKRB5", fwd.SName.GetPrincipalNameString(), "Delegated ticket should be a TGT")
+	tgt, _, err := cl.GetTGT("TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error getting TGT: %v", err)
+	}
+	assert.NotEqual(t, tgt.EncPart.Cipher, fwd.EncPart.Cipher, "Delegated ticket should be the forwarded TGT rather than the client's TGT")
+	key, ok := kdc.sessionKey(fwd)
+	assert.True(t, ok, "Delegated ticket should have been issued by the KDC")
+	assert.Equal(t, key, info.Key, "Delegated ticket session key not as expected")
+	assert.Equal(t, "testuser1", info.PName.GetPrincipalNameString(), "Delegated principal not as expected")
+	assert.Equal(t, "TEST.GOKRB5", info.PRealm, "Delegated principal realm not as expected")
+	assert.Equal(t, "krbtgt/TEST.GOKRB5", info.SName.GetPrincipalNameString(), "Delegated ticket info service not as expected")
+
+	// A KRB_CRED created directly is also encrypted in the session key provided
+	krbCred, err = cl.NewDelegationKRBCred(skey)
+	if err != nil {
+		t.Fatalf("Error creating delegation KRB_CRED: %v", err)
+	}
+	assert.Equal(t, 2, fwdReqs, "A new forwarded TGT should have been requested")
+	err = krbCred.DecryptEncPart(skey)
+	if err != nil {
+		t.Fatalf("Error decrypting KRB_CRED with the session key: %v", err)
+	}
+	assert.Equal(t, "testuser1", krbCred.DecryptedEncPart.TicketInfo[0].PName.GetPrincipalNameString(), "Delegated principal not as expected")
+}
@@ -0,0 +1,433 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"gopkg.in/jcmturner/gokrb5.v5/credentials"
+	"gopkg.in/jcmturner/gokrb5.v5/crypto"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/keyusage"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/patype"
+	"gopkg.in/jcmturner/gokrb5.v5/krberror"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+// Reference: https://tools.ietf.org/html/rfc6113
+
+// FAST key derivation peppers.
+const (
+	fastSubKeyArmorPepper      = "subkeyarmor"
+	fastTicketArmorPepper      = "ticketarmor"
+	fastStrengthenPepper       = "strengthenkey"
+	fastReplyKeyPepper         = "replykey"
+	encChallengeClientPepper   = "clientchallengearmor"
+	encChallengeKDCPepper      = "kdcchallengearmor"
+	encChallengeLongTermPepper = "challengelongterm"
+)
+
+// fastArmor holds the TGT, for example of a host principal, used to armor AS exchanges.
+type fastArmor struct {
+	CName      types.PrincipalName
+	Realm      string
+	TGT        messages.Ticket
+	SessionKey types.EncryptionKey
+}
+
+// fastState holds the state of a single FAST armored exchange with a KDC.
+type fastState struct {
+	armor        messages.KrbFastArmor
+	armorKey     types.EncryptionKey
+	cookie       []byte
+	challengeKey types.EncryptionKey // client long-term key used for encrypted challenge pre-authentication
+	otpChallenge *messages.PAOTPChallenge
+	otp          bool
+}
+
+// WithFASTArmor sets the TGT, and its session key, that the client will use to armor AS exchanges with FAST.
+// The cname and realm are those of the client principal the TGT was issued to.
+func (cl *Client) WithFASTArmor(cname types.PrincipalName, realm string, tgt messages.Ticket, sessionKey types.EncryptionKey) *Client {
+	cl.fastArmor = &fastArmor{
+		CName:      cname,
+		Realm:      realm,
+		TGT:        tgt,
+		SessionKey: sessionKey,
+	}
+	return cl
+}
+
+// WithFASTArmorCCache sets the client to armor AS exchanges with FAST using the TGT of the default principal in the CCache provided.
+func (cl *Client) WithFASTArmorCCache(c credentials.CCache) (*Client, error) {
+	spn := types.PrincipalName{
+		NameType:   nametype.KRB_NT_SRV_INST,
+		NameString: []string{"krbtgt", c.DefaultPrincipal.Realm},
+	}
+	cred, ok := c.GetEntry(spn)
+	if !ok {
+		return cl, errors.New("FAST armor TGT not found in CCache")
+	}
+	var tgt messages.Ticket
+	err := tgt.Unmarshal(cred.Ticket)
+	if err != nil {
+		return cl, krberror.Errorf(err, krberror.EncodingError, "FAST armor TGT bytes in cache are not valid")
+	}
+	return cl.WithFASTArmor(c.DefaultPrincipal.PrincipalName, c.DefaultPrincipal.Realm, tgt, cred.Key), nil
+}
+
+// WithAnonymousFASTArmor obtains an anonymous TGT from the realm's KDC with anonymous PKINIT and sets the client to
+// armor AS exchanges with FAST using it. This allows FAST to be used on hosts that do not have a keytab.
+// The KDC's certificate is verified against the client's PKINIT trust pool.
+// Set the realm to empty string to use the default realm from config.
+func (cl *Client) WithAnonymousFASTArmor(realm string) (*Client, error) {
+	return cl.WithAnonymousFASTArmorContext(context.Background(), realm)
+}
+
+// WithAnonymousFASTArmorContext obtains an anonymous TGT, within the context provided, and sets the client to armor AS
+// exchanges with FAST using it.
+func (cl *Client) WithAnonymousFASTArmorContext(ctx context.Context, realm string) (*Client, error) {
+	if realm == "" {
+		realm = cl.Config.LibDefaults.DefaultRealm
+	}
+	anon := NewAnonymousClient(realm, cl.GoKrb5Conf.PKINITTrustPool)
+	anon.WithConfig(cl.Config)
+	anon.WithTransport(cl.Transport)
+	anon.health = cl.kdcHealth()
+	anon.GoKrb5Conf.PKINITUseECDH = cl.GoKrb5Conf.PKINITUseECDH
+	err := anon.LoginContext(ctx)
+	if err != nil {
+		return cl, krberror.Errorf(err, krberror.KRBMsgError, "error obtaining anonymous FAST armor TGT")
+	}
+	defer anon.Destroy()
+	sess, err := anon.getSessionFromRealm(ctx, realm)
+	if err != nil {
+		return cl, krberror.Errorf(err, krberror.KRBMsgError, "anonymous FAST armor TGT not found")
+	}
+	return cl.WithFASTArmor(types.NewAnonymousPrincipalName(), types.AnonymousRealm, sess.TGT, sess.SessionKey), nil
+}
+
+// newASFASTState creates the state for an AS exchange explicitly armored with the client's FAST armor TGT.
+func (cl *Client) newASFASTState() (*fastState, error) {
+	if cl.fastArmor == nil {
+		return nil, errors.New("client does not have a FAST armor TGT")
+	}
+	subKey, err := newSubKey(cl.fastArmor.SessionKey.KeyType)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncryptingError, "error generating FAST armor sub-key")
+	}
+	auth, err := types.NewAuthenticator(cl.fastArmor.Realm, cl.fastArmor.CName)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.KRBMsgError, "error generating FAST armor authenticator")
+	}
+	auth.SubKey = subKey
+	armor, err := messages.NewKrbFastArmor(cl.fastArmor.TGT, cl.fastArmor.SessionKey, auth)
+	if err != nil {
+		return nil, err
+	}
+	armorKey, err := crypto.KRBFXCF2(subKey, cl.fastArmor.SessionKey, fastSubKeyArmorPepper, fastTicketArmorPepper)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncryptingError, "error calculating FAST armor key")
+	}
+	return &fastState{
+		armor:    armor,
+		armorKey: armorKey,
+	}, nil
+}
+
+// newTGSFASTState creates the state for a TGS exchange implicitly armored with the TGT session key and the sub-key in the
+// authenticator of the TGS_REQ.
+func newTGSFASTState(subKey, sessionKey types.EncryptionKey) (*fastState, error) {
+	armorKey, err := crypto.KRBFXCF2(subKey, sessionKey, fastSubKeyArmorPepper, fastTicketArmorPepper)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncryptingError, "error calculating FAST armor key")
+	}
+	return &fastState{armorKey: armorKey}, nil
+}
+
+// armorASReq returns a new AS_REQ with the pre-authentication data of the one provided moved into an armored FAST request.
+func (f *fastState) armorASReq(ASReq messages.ASReq) (messages.ASReq, error) {
+	b, err := ASReq.ReqBody.Marshal()
+	if err != nil {
+		return ASReq, krberror.Errorf(err, krberror.EncodingError, "error marshaling AS_REQ body for FAST checksum")
+	}
+	pa, err := f.paFXFast(ASReq.KDCReqFields, ASReq.PAData, b)
+	if err != nil {
+		return ASReq, err
+	}
+	ASReq.PAData = types.PADataSequence{pa}
+	return ASReq, nil
+}
+
+// armorTGSReq returns a new TGS_REQ with an armored FAST request. The PA_TGS_REQ remains in the outer request.
+func (f *fastState) armorTGSReq(tgsReq messages.TGSReq) (messages.TGSReq, error) {
+	var apReq []byte
+	var pas types.PADataSequence
+	for _, pa := range tgsReq.PAData {
+		if pa.PADataType == patype.PA_TGS_REQ {
+			apReq = pa.PADataValue
+			continue
+		}
+		pas = append(pas, pa)
+	}
+	if apReq == nil {
+		return tgsReq, krberror.NewErrorf(krberror.KRBMsgError, "TGS_REQ does not contain PA_TGS_REQ to armor")
+	}
+	pa, err := f.paFXFast(tgsReq.KDCReqFields, pas, apReq)
+	if err != nil {
+		return tgsReq, err
+	}
+	tgsReq.PAData = types.PADataSequence{
+		types.PAData{
+			PADataType:  patype.PA_TGS_REQ,
+			PADataValue: apReq,
+		},
+		pa,
+	}
+	return tgsReq, nil
+}
+
+// paFXFast generates the PA_FX_FAST pre-authentication data. The request checksum is calculated over the bytes provided
+// which are the request body for an AS_REQ and the AP_REQ of the PA_TGS_REQ for a TGS_REQ.
+func (f *fastState) paFXFast(k messages.KDCReqFields, pas types.PADataSequence, chksumData []byte) (types.PAData, error) {
+	var pa types.PAData
+	if f.cookie != nil {
+		pas = append(pas, types.PAData{
+			PADataType:  patype.PA_FX_COOKIE,
+			PADataValue: f.cookie,
+		})
+	}
+	fr := messages.KrbFastReq{
+		FastOptions: types.NewKrbFlags(),
+		PAData:      pas,
+		ReqBody:     k.ReqBody,
+	}
+	fb, err := fr.Marshal()
+	if err != nil {
+		return pa, err
+	}
+	et, err := crypto.GetEtype(f.armorKey.KeyType)
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.EncryptingError, "error getting etype of FAST armor key")
+	}
+	cb, err := et.GetChecksumHash(f.armorKey.KeyValue, chksumData, keyusage.KEY_USAGE_FAST_REQ_CHKSUM)
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.ChksumError, "error calculating FAST request checksum")
+	}
+	ed, err := crypto.GetEncryptedData(fb, f.armorKey, keyusage.KEY_USAGE_FAST_ENC, 0)
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.EncryptingError, "error encrypting FAST request")
+	}
+	ar := messages.KrbFastArmoredReq{
+		Armor: f.armor,
+		ReqChecksum: types.Checksum{
+			CksumType: et.GetHashID(),
+			Checksum:  cb,
+		},
+		EncFastReq: ed,
+	}
+	ab, err := ar.Marshal()
+	if err != nil {
+		return pa, err
+	}
+	pa = types.PAData{
+		PADataType:  patype.PA_FX_FAST,
+		PADataValue: ab,
+	}
+	return pa, nil
+}
+
+// fastResponse decrypts the FAST response within the pre-authentication data provided.
+func (f *fastState) fastResponse(pas types.PADataSequence) (messages.KrbFastResponse, error) {
+	for _, pa := range pas {
+		if pa.PADataType == patype.PA_FX_FAST {
+			var ar messages.KrbFastArmoredRep
+			err := ar.Unmarshal(pa.PADataValue)
+			if err != nil {
+				return messages.KrbFastResponse{}, err
+			}
+			return ar.DecryptEncPart(f.armorKey)
+		}
+	}
+	return messages.KrbFastResponse{}, krberror.NewErrorf(krberror.KRBMsgError, "KDC reply does not contain a FAST response")
+}
+
+// processKRBError extracts the KRBError returned within the PA_FX_ERROR of an armored error from the KDC.
+// The remaining pre-authentication data of the FAST response is set as the e-data of the returned KRBError.
+func (f *fastState) processKRBError(e messages.KRBError) (messages.KRBError, error) {
+	var pas types.PADataSequence
+	err := pas.Unmarshal(e.EData)
+	if err != nil || !pas.Contains(patype.PA_FX_FAST) {
+		// Not an armored error
+		return e, nil
+	}
+	fr, err := f.fastResponse(pas)
+	if err != nil {
+		return e, err
+	}
+	krberr := e
+	var epas types.PADataSequence
+	for _, pa := range fr.PAData {
+		switch pa.PADataType {
+		case patype.PA_FX_ERROR:
+			err = krberr.Unmarshal(pa.PADataValue)
+			if err != nil {
+				return e, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA_FX_ERROR")
+			}
+		case patype.PA_FX_COOKIE:
+			f.cookie = pa.PADataValue
+			epas = append(epas, pa)
+		default:
+			epas = append(epas, pa)
+		}
+	}
+	krberr.EData, err = asn1.Marshal(epas)
+	if err != nil {
+		return e, krberror.Errorf(err, krberror.EncodingError, "error marshaling FAST error pre-authentication data")
+	}
+	return krberr, nil
+}
+
+// processReply decrypts and verifies the FAST response of a KDC reply. The reply's pre-authentication data, client name and
+// client realm are replaced by those in the FAST response.
+func (f *fastState) processReply(k *messages.KDCRepFields, nonce int) (messages.KrbFastResponse, error) {
+	fr, err := f.fastResponse(k.PAData)
+	if err != nil {
+		return fr, err
+	}
+	if fr.Nonce != nonce {
+		return fr, krberror.NewErrorf(krberror.KRBMsgError, "possible replay attack, nonce in FAST response does not match that in request")
+	}
+	tb, err := k.Ticket.Marshal()
+	if err != nil {
+		return fr, krberror.Errorf(err, krberror.EncodingError, "error marshaling ticket to verify FAST finished checksum")
+	}
+	et, err := crypto.GetChksumEtype(fr.Finished.TicketChecksum.CksumType)
+	if err != nil {
+		return fr, krberror.Errorf(err, krberror.ChksumError, "error getting etype of FAST finished checksum")
+	}
+	if !et.VerifyChecksum(f.armorKey.KeyValue, tb, fr.Finished.TicketChecksum.Checksum, keyusage.KEY_USAGE_FAST_FINISHED) {
+		return fr, krberror.NewErrorf(krberror.ChksumError, "FAST finished ticket checksum invalid")
+	}
+	// The client name and realm in the finished structure are authenticated so must be used in preference.
+	k.CName = fr.Finished.CName
+	k.CRealm = fr.Finished.CRealm
+	k.PAData = fr.PAData
+	return fr, nil
+}
+
+// strengthenReplyKey combines the reply key with the strengthen key, if one is present in the FAST response.
+func (f *fastState) strengthenReplyKey(fr messages.KrbFastResponse, replyKey types.EncryptionKey) (types.EncryptionKey, error) {
+	if fr.StrengthenKey.KeyType == 0 {
+		return replyKey, nil
+	}
+	key, err := crypto.KRBFXCF2(fr.StrengthenKey, replyKey, fastStrengthenPepper, fastReplyKeyPepper)
+	if err != nil {
+		return replyKey, krberror.Errorf(err, krberror.EncryptingError, "error strengthening reply key")
+	}
+	return key, nil
+}
+
+// paEncryptedChallenge creates PA_ENCRYPTED_CHALLENGE pre-authentication data, encrypting the current time with the client
+// challenge key derived from the armor key and the client's long-term key.
+// Reference: https://tools.ietf.org/html/rfc6113#section-5.4.6
+func (f *fastState) paEncryptedChallenge(key types.EncryptionKey) (types.PAData, error) {
+	var pa types.PAData
+	ck, err := crypto.KRBFXCF2(f.armorKey, key, encChallengeClientPepper, encChallengeLongTermPepper)
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.EncryptingError, "error calculating client challenge key")
+	}
+	tsb, err := types.GetPAEncTSEncAsnMarshalled()
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.EncodingError, "error creating PAEncTSEnc for encrypted challenge")
+	}
+	ed, err := crypto.GetEncryptedData(tsb, ck, keyusage.KEY_USAGE_ENC_CHALLENGE_CLIENT, 0)
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.EncryptingError, "error encrypting client challenge")
+	}
+	b, err := ed.Marshal()
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.EncodingError, "error marshaling client challenge")
+	}
+	f.challengeKey = key
+	return types.PAData{
+		PADataType:  patype.PA_ENCRYPTED_CHALLENGE,
+		PADataValue: b,
+	}, nil
+}
+
+// encryptedChallengeSent indicates if encrypted challenge pre-authentication was used in the exchange.
+func (f *fastState) encryptedChallengeSent() bool {
+	return f != nil && f.challengeKey.KeyType != 0
+}
+
+// verifyEncryptedChallenge verifies the KDC's encrypted challenge in the pre-authentication data of the reply, which
+// authenticates the KDC to the client. The armor key, which replaces the reply key, is returned.
+func (f *fastState) verifyEncryptedChallenge(pas types.PADataSequence, clockSkew time.Duration) (types.EncryptionKey, error) {
+	var key types.EncryptionKey
+	var ed types.EncryptedData
+	var found bool
+	for _, pa := range pas {
+		if pa.PADataType == patype.PA_ENCRYPTED_CHALLENGE {
+			if err := ed.Unmarshal(pa.PADataValue); err != nil {
+				return key, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KDC challenge")
+			}
+			found = true
+			break
+		}
+	}
+	if !found {
+		return key, krberror.NewErrorf(krberror.KRBMsgError, "KDC did not return an encrypted challenge")
+	}
+	kk, err := crypto.KRBFXCF2(f.armorKey, f.challengeKey, encChallengeKDCPepper, encChallengeLongTermPepper)
+	if err != nil {
+		return key, krberror.Errorf(err, krberror.EncryptingError, "error calculating KDC challenge key")
+	}
+	b, err := crypto.DecryptEncPart(ed, kk, keyusage.KEY_USAGE_ENC_CHALLENGE_KDC)
+	if err != nil {
+		return key, krberror.Errorf(err, krberror.DecryptingError, "error decrypting KDC challenge")
+	}
+	var ts types.PAEncTSEnc
+	err = ts.Unmarshal(b)
+	if err != nil {
+		return key, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KDC challenge timestamp")
+	}
+	if d := time.Now().UTC().Sub(ts.PATimestamp); d > clockSkew || -d > clockSkew {
+		return key, krberror.NewErrorf(krberror.KRBMsgError, "KDC challenge timestamp outside of the allowed clock skew")
+	}
+	return f.armorKey, nil
+}
+
+// fastAvailable indicates if TGS exchanges using the TGT provided should be armored with FAST.
+func (cl *Client) fastAvailable(tgt messages.Ticket) bool {
+	if cl.GoKrb5Conf.DisablePAFXFast || len(tgt.SName.NameString) < 2 || tgt.SName.NameString[0] != "krbtgt" {
+		return false
+	}
+	cl.sessions.mux.RLock()
+	defer cl.sessions.mux.RUnlock()
+	if s, ok := cl.sessions.Entries[tgt.SName.NameString[1]]; ok {
+		s.mux.RLock()
+		defer s.mux.RUnlock()
+		return s.fast
+	}
+	return false
+}
+
+// newSubKey generates a new random key of the key type provided.
+func newSubKey(keyType int32) (types.EncryptionKey, error) {
+	et, err := crypto.GetEtype(keyType)
+	if err != nil {
+		return types.EncryptionKey{}, err
+	}
+	b := make([]byte, et.GetKeySeedBitLength()/8)
+	_, err = rand.Read(b)
+	if err != nil {
+		return types.EncryptionKey{}, err
+	}
+	return types.EncryptionKey{
+		KeyType:  keyType,
+		KeyValue: et.RandomToKey(b),
+	}, nil
+}
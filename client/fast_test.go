@@ -0,0 +1,287 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	stdasn1 "encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/config"
+	"gopkg.in/jcmturner/gokrb5.v5/crypto"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/etypeID"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/flags"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/keyusage"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/patype"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+	"gopkg.in/jcmturner/gokrb5.v5/pkinit"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+// testPKINITConf is the in-memory KDC's configuration with the host name the KDC's certificate is issued to.
+const testPKINITConf = `[libdefaults]
+ default_realm = TEST.GOKRB5
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = 127.0.0.1:88
+  pkinit_kdc_hostname = kdc.test.gokrb5
+ }
+
+[domain_realm]
+ .test.gokrb5 = TEST.GOKRB5
+`
+
+const (
+	testArmorKey    = "4d6ca4e629785c1f01baf55e2e548566b9617ae3a96868c337cb93b5e72b1c7b"
+	testLongTermKey = "fe697b52bc0d3ce14432ba036a92e65bbb52280990a2fa27883998d72af30161"
+	testOtherKey    = "e58f9eb643862c13ad38e529313462a7f73e62834fe54a01fe697b52bc0d3ce1"
+)
+
+func testAES256Key(t *testing.T, s string) types.EncryptionKey {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("Error decoding key: %v", err)
+	}
+	return types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: b}
+}
+
+// testKDCChallenge returns the PA_ENCRYPTED_CHALLENGE a KDC would return for the armor and long-term keys, with the
+// timestamp provided.
+func testKDCChallenge(t *testing.T, armorKey, key types.EncryptionKey, ts time.Time) types.PAData {
+	kk, err := crypto.KRBFXCF2(armorKey, key, "kdcchallengearmor", "challengelongterm")
+	if err != nil {
+		t.Fatalf("Error calculating KDC challenge key: %v", err)
+	}
+	b, err := asn1.Marshal(types.PAEncTSEnc{PATimestamp: ts})
+	if err != nil {
+		t.Fatalf("Error marshaling KDC challenge timestamp: %v", err)
+	}
+	ed, err := crypto.GetEncryptedData(b, kk, keyusage.KEY_USAGE_ENC_CHALLENGE_KDC, 0)
+	if err != nil {
+		t.Fatalf("Error encrypting KDC challenge: %v", err)
+	}
+	eb, err := ed.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling KDC challenge: %v", err)
+	}
+	return types.PAData{PADataType: patype.PA_ENCRYPTED_CHALLENGE, PADataValue: eb}
+}
+
+func TestFASTState_PAEncryptedChallenge(t *testing.T) {
+	t.Parallel()
+	armorKey := testAES256Key(t, testArmorKey)
+	key := testAES256Key(t, testLongTermKey)
+	f := &fastState{armorKey: armorKey}
+	assert.False(t, f.encryptedChallengeSent(), "Encrypted challenge should not be marked as sent")
+
+	pa, err := f.paEncryptedChallenge(key)
+	if err != nil {
+		t.Fatalf("Error creating encrypted challenge: %v", err)
+	}
+	assert.Equal(t, patype.PA_ENCRYPTED_CHALLENGE, pa.PADataType, "PAData type not as expected")
+	assert.True(t, f.encryptedChallengeSent(), "Encrypted challenge should be marked as sent")
+
+	// The KDC decrypts the challenge with the client challenge key
+	var ed types.EncryptedData
+	err = ed.Unmarshal(pa.PADataValue)
+	if err != nil {
+		t.Fatalf("Error unmarshaling encrypted challenge: %v", err)
+	}
+	ck, err := crypto.KRBFXCF2(armorKey, key, "clientchallengearmor", "challengelongterm")
+	if err != nil {
+		t.Fatalf("Error calculating client challenge key: %v", err)
+	}
+	b, err := crypto.DecryptEncPart(ed, ck, keyusage.KEY_USAGE_ENC_CHALLENGE_CLIENT)
+	if err != nil {
+		t.Fatalf("Error decrypting encrypted challenge: %v", err)
+	}
+	var ts types.PAEncTSEnc
+	err = ts.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling encrypted challenge timestamp: %v", err)
+	}
+	assert.WithinDuration(t, time.Now().UTC(), ts.PATimestamp, time.Minute, "Encrypted challenge timestamp not as expected")
+}
+
+func TestFASTState_VerifyEncryptedChallenge(t *testing.T) {
+	t.Parallel()
+	armorKey := testAES256Key(t, testArmorKey)
+	key := testAES256Key(t, testLongTermKey)
+	now := time.Now().UTC()
+	var tests = []struct {
+		name  string
+		pas   types.PADataSequence
+		valid bool
+	}{
+		{"valid challenge", types.PADataSequence{testKDCChallenge(t, armorKey, key, now)}, true},
+		{"missing challenge", types.PADataSequence{{PADataType: patype.PA_FX_COOKIE}}, false},
+		{"wrong long-term key", types.PADataSequence{testKDCChallenge(t, armorKey, testAES256Key(t, testOtherKey), now)}, false},
+		{"wrong armor key", types.PADataSequence{testKDCChallenge(t, testAES256Key(t, testOtherKey), key, now)}, false},
+		{"timestamp outside clock skew", types.PADataSequence{testKDCChallenge(t, armorKey, key, now.Add(-time.Hour))}, false},
+	}
+	for _, test := range tests {
+		f := &fastState{armorKey: armorKey}
+		_, err := f.paEncryptedChallenge(key)
+		if err != nil {
+			t.Fatalf("Error creating encrypted challenge: %v", err)
+		}
+		k, err := f.verifyEncryptedChallenge(test.pas, 5*time.Minute)
+		if test.valid {
+			assert.NoError(t, err, "KDC challenge should be accepted: %s", test.name)
+			assert.Equal(t, armorKey, k, "Armor key should be returned as the reply key: %s", test.name)
+		} else {
+			assert.Error(t, err, "KDC challenge should be rejected: %s", test.name)
+		}
+	}
+}
+
+// testKDCCertificate returns a self-signed PKINIT KDC certificate, issued to the KDC's host name, and its private key.
+func testKDCCertificate(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating KDC key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "kdc.test.gokrb5"},
+		DNSNames:              []string{"kdc.test.gokrb5"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		UnknownExtKeyUsage:    []stdasn1.ObjectIdentifier{stdasn1.ObjectIdentifier(pkinit.OIDPKINITKPKdc)},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("Error creating KDC certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatalf("Error parsing KDC certificate: %v", err)
+	}
+	return cert, key
+}
+
+func TestClient_WithAnonymousFASTArmor(t *testing.T) {
+	t.Parallel()
+	c, err := config.NewConfigFromString(testPKINITConf)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	cert, certKey := testKDCCertificate(t)
+	trust := x509.NewCertPool()
+	trust.AddCert(cert)
+
+	kdc := newTestMemKDC("TEST.GOKRB5", "passwordvalue")
+	var authPack pkinit.AuthPack
+	var reqBody []byte
+	var anonymous, armored bool
+	kdc.as = func(ASReq messages.ASReq, iss *testIssue) error {
+		if iss.armorKey.KeyType != 0 {
+			// The user's AS_REQ armored with the anonymous TGT
+			armored = true
+			return nil
+		}
+		anonymous = types.IsFlagSet(&ASReq.ReqBody.KDCOptions, flags.RequestAnonymous) && ASReq.ReqBody.CName.IsAnonymous()
+		var req pkinit.PAPKASReq
+		var found bool
+		for _, pa := range ASReq.PAData {
+			if pa.PADataType == patype.PA_PK_AS_REQ {
+				if err := req.Unmarshal(pa.PADataValue); err != nil {
+					return err
+				}
+				found = true
+			}
+		}
+		if !found {
+			return errors.New("AS_REQ does not contain a PA_PK_AS_REQ")
+		}
+		var err error
+		authPack, err = req.AnonymousAuthPack()
+		if err != nil {
+			return err
+		}
+		reqBody, err = ASReq.ReqBody.Marshal()
+		if err != nil {
+			return err
+		}
+		// The reply key is derived from the ECDH shared secret
+		ka, err := pkinit.NewECDHKeyAgreement(elliptic.P256())
+		if err != nil {
+			return err
+		}
+		z, err := ka.SharedSecret(authPack.ClientPublicValue.SubjectPublicKey.Bytes)
+		if err != nil {
+			return err
+		}
+		dh, err := pkinit.NewDHRepInfo(pkinit.KDCDHKeyInfo{
+			SubjectPublicKey: asn1.BitString{Bytes: ka.PublicKey(), BitLength: len(ka.PublicKey()) * 8},
+			Nonce:            authPack.PKAuthenticator.Nonce,
+		}, nil, cert, certKey)
+		if err != nil {
+			return err
+		}
+		rep := pkinit.PAPKASRep{DHInfo: dh}
+		b, err := rep.Marshal()
+		if err != nil {
+			return err
+		}
+		iss.replyKey, err = pkinit.ReplyKey(z, ASReq.ReqBody.EType[0])
+		if err != nil {
+			return err
+		}
+		iss.crealm = types.AnonymousRealm
+		iss.paData = types.PADataSequence{{PADataType: patype.PA_PK_AS_REP, PADataValue: b}}
+		return nil
+	}
+
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue")
+	cl.WithConfig(c).WithTransport(kdc)
+	cl.GoKrb5Conf.PKINITTrustPool = trust
+	cl.GoKrb5Conf.PKINITUseECDH = true
+	defer cl.Destroy()
+	_, err = cl.WithAnonymousFASTArmor("")
+	if err != nil {
+		t.Fatalf("Error obtaining anonymous FAST armor: %v", err)
+	}
+	assert.True(t, anonymous, "Armor AS_REQ should request an anonymous ticket for the anonymous principal")
+	assert.True(t, pkinit.OIDECPublicKey.Equal(authPack.ClientPublicValue.Algorithm.Algorithm), "AuthPack should carry an ECDH public value")
+	h := sha1.Sum(reqBody)
+	assert.Equal(t, h[:], authPack.PKAuthenticator.PAChecksum, "AuthPack checksum of the request body not as expected")
+	if assert.NotNil(t, cl.fastArmor, "Client should have FAST armor") {
+		assert.True(t, cl.fastArmor.CName.IsAnonymous(), "FAST armor should be for the anonymous principal")
+		assert.Equal(t, types.AnonymousRealm, cl.fastArmor.Realm, "FAST armor realm not as expected")
+		assert.Equal(t, "krbtgt/TEST.GOKRB5", cl.fastArmor.TGT.SName.GetPrincipalNameString(), "FAST armor should be a TGT")
+		key, ok := kdc.sessionKey(cl.fastArmor.TGT)
+		assert.True(t, ok, "FAST armor TGT should have been issued by the KDC")
+		assert.Equal(t, key, cl.fastArmor.SessionKey, "FAST armor session key from the PKINIT reply not as expected")
+	}
+
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("Error on armored login: %v", err)
+	}
+	assert.True(t, armored, "AS_REQ should be armored with the anonymous TGT")
+	assert.Equal(t, []string{
+		"AS_REQ TEST.GOKRB5 krbtgt/TEST.GOKRB5",
+		"AS_REQ TEST.GOKRB5 krbtgt/TEST.GOKRB5 armored",
+	}, kdc.requests(), "Requests to the KDC not as expected")
+	tgt, key, err := cl.GetTGT("TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error getting TGT: %v", err)
+	}
+	skey, ok := kdc.sessionKey(tgt)
+	assert.True(t, ok, "TGT should have been issued by the KDC")
+	assert.Equal(t, skey, key, "TGT session key not as expected")
+}
@@ -14,12 +14,13 @@ import (
 )
 
 // SetSPNEGOHeader gets the service ticket and sets it as the SPNEGO authorization header on HTTP request object.
+// Any exchange with the KDC needed is made within the request's context.
 // To auto generate the SPN from the request object pass a null string "".
 func (cl *Client) SetSPNEGOHeader(r *http.Request, spn string) error {
 	if spn == "" {
 		spn = "HTTP/" + strings.SplitN(r.Host, ":", 2)[0]
 	}
-	tkt, skey, err := cl.GetServiceTicket(spn)
+	tkt, skey, err := cl.GetServiceTicketContext(r.Context(), spn)
 	if err != nil {
 		return fmt.Errorf("could not get service ticket: %v", err)
 	}
@@ -30,12 +31,38 @@ func (cl *Client) SetSPNEGOHeader(r *http.Request, spn string) error {
 	return nil
 }
 
+// SetSPNEGOHeaderWithDelegation gets the service ticket and sets it as the SPNEGO authorization header on HTTP request
+// object, delegating a forwarded TGT for the client to the service so it can act on the client's behalf.
+// To auto generate the SPN from the request object pass a null string "".
+func (cl *Client) SetSPNEGOHeaderWithDelegation(r *http.Request, spn string) error {
+	if spn == "" {
+		spn = "HTTP/" + strings.SplitN(r.Host, ":", 2)[0]
+	}
+	tkt, skey, err := cl.GetServiceTicketContext(r.Context(), spn)
+	if err != nil {
+		return fmt.Errorf("could not get service ticket: %v", err)
+	}
+	krbCred, err := cl.NewDelegationKRBCredContext(r.Context(), skey)
+	if err != nil {
+		return fmt.Errorf("could not create credentials to delegate: %v", err)
+	}
+	SPNEGOToken, err := gssapi.GetSPNEGOKrbNegTokenInitWithDelegation(*cl.Credentials, tkt, skey, krbCred)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "could not generate SPNEGO negotiation token")
+	}
+	return setSPNEGOHeader(SPNEGOToken, r)
+}
+
 // SetSPNEGOHeader sets the provided ticket as the SPNEGO authorization header on HTTP request object.
 func SetSPNEGOHeader(creds credentials.Credentials, tkt messages.Ticket, sessionKey types.EncryptionKey, r *http.Request) error {
 	SPNEGOToken, err := gssapi.GetSPNEGOKrbNegTokenInit(creds, tkt, sessionKey)
 	if err != nil {
 		return krberror.Errorf(err, krberror.EncodingError, "could not generate SPNEGO negotiation token")
 	}
+	return setSPNEGOHeader(SPNEGOToken, r)
+}
+
+func setSPNEGOHeader(SPNEGOToken gssapi.SPNEGO, r *http.Request) error {
 	nb, err := SPNEGOToken.Marshal()
 	if err != nil {
 		return krberror.Errorf(err, krberror.EncodingError, "could not marshal SPNEGO")
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// kdcFailurePenalty is how long a KDC that failed to respond is tried after the KDCs that have not failed.
+const kdcFailurePenalty = 5 * time.Minute
+
+// kdcHealth tracks the outcome of exchanges with each KDC address so that KDCs can be tried in order of their health.
+type kdcHealth struct {
+	mux     sync.RWMutex
+	entries map[string]*kdcHealthEntry
+}
+
+type kdcHealthEntry struct {
+	latency     time.Duration
+	lastFailure time.Time
+}
+
+func newKDCHealth() *kdcHealth {
+	return &kdcHealth{entries: make(map[string]*kdcHealthEntry)}
+}
+
+// healthMux guards the creation of the KDC health of clients not created with a constructor.
+var healthMux sync.Mutex
+
+// kdcHealth returns the health of the KDCs used by the client, creating it if the client was not created with one of
+// the constructors.
+func (cl *Client) kdcHealth() *kdcHealth {
+	healthMux.Lock()
+	defer healthMux.Unlock()
+	if cl.health == nil {
+		cl.health = newKDCHealth()
+	}
+	return cl.health
+}
+
+func (h *kdcHealth) entry(addr string) *kdcHealthEntry {
+	e, ok := h.entries[addr]
+	if !ok {
+		e = new(kdcHealthEntry)
+		h.entries[addr] = e
+	}
+	return e
+}
+
+// success records a response from the KDC address along with the time taken. The latency is a moving average so that a
+// single slow response does not move the KDC to the back of the order.
+func (h *kdcHealth) success(addr string, latency time.Duration) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	e := h.entry(addr)
+	if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = (3*e.latency + latency) / 4
+	}
+	e.lastFailure = time.Time{}
+}
+
+// failure records that the KDC address could not be reached or did not respond.
+func (h *kdcHealth) failure(addr string) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.entry(addr).lastFailure = time.Now().UTC()
+}
+
+// order returns the KDC addresses, keyed on preference order, sorted by their health. KDCs that responded are tried
+// fastest first followed by those not yet used in a random order. KDCs that failed recently are tried last, the longest
+// ago failure first.
+func (h *kdcHealth) order(count int, kdcs map[int]string) map[int]string {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	now := time.Now().UTC()
+	ks := make(byHealth, 0, count)
+	for i := 1; i <= count; i++ {
+		k := rankedKDC{addr: kdcs[i], rank: 1}
+		if e, ok := h.entries[kdcs[i]]; ok {
+			switch {
+			case !e.lastFailure.IsZero() && now.Sub(e.lastFailure) < kdcFailurePenalty:
+				k.rank = 2
+				k.lastFailure = e.lastFailure
+			case e.latency > 0:
+				k.rank = 0
+				k.latency = e.latency
+			}
+		}
+		ks = append(ks, k)
+	}
+	// KDCs of equal health are shuffled so that clients spread their requests across them
+	for i := range ks {
+		j := rand.Intn(i + 1)
+		ks[i], ks[j] = ks[j], ks[i]
+	}
+	sort.Stable(ks)
+	o := make(map[int]string)
+	for i, k := range ks {
+		o[i+1] = k.addr
+	}
+	return o
+}
+
+// rankedKDC is a KDC address ranked by its health: 0 for KDCs that responded, 1 for those not yet used and 2 for those
+// that failed recently.
+type rankedKDC struct {
+	addr        string
+	rank        int
+	latency     time.Duration
+	lastFailure time.Time
+}
+
+// byHealth sorts KDCs by rank then by latency and time of failure.
+type byHealth []rankedKDC
+
+func (k byHealth) Len() int      { return len(k) }
+func (k byHealth) Swap(i, j int) { k[i], k[j] = k[j], k[i] }
+func (k byHealth) Less(i, j int) bool {
+	if k[i].rank != k[j].rank {
+		return k[i].rank < k[j].rank
+	}
+	if k[i].latency != k[j].latency {
+		return k[i].latency < k[j].latency
+	}
+	return k[i].lastFailure.Before(k[j].lastFailure)
+}
@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/asn1tools"
+	"gopkg.in/jcmturner/gokrb5.v5/config"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/asnAppTag"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/errorcode"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+func TestKDCHealth_Order(t *testing.T) {
+	t.Parallel()
+	kdcs := map[int]string{1: "kdc1:88", 2: "kdc2:88", 3: "kdc3:88"}
+	now := time.Now().UTC()
+	var tests = []struct {
+		name    string
+		entries map[string]*kdcHealthEntry
+		want    [][]string // groups of KDCs of equal health, in any order within a group
+	}{
+		{"no history", nil, [][]string{{"kdc1:88", "kdc2:88", "kdc3:88"}}},
+		{"success first", map[string]*kdcHealthEntry{
+			"kdc3:88": {latency: 10 * time.Millisecond},
+		}, [][]string{{"kdc3:88"}, {"kdc1:88", "kdc2:88"}}},
+		{"latency order", map[string]*kdcHealthEntry{
+			"kdc1:88": {latency: 30 * time.Millisecond},
+			"kdc2:88": {latency: 10 * time.Millisecond},
+			"kdc3:88": {latency: 20 * time.Millisecond},
+		}, [][]string{{"kdc2:88"}, {"kdc3:88"}, {"kdc1:88"}}},
+		{"failure last", map[string]*kdcHealthEntry{
+			"kdc1:88": {lastFailure: now.Add(-time.Minute)},
+		}, [][]string{{"kdc2:88", "kdc3:88"}, {"kdc1:88"}}},
+		{"failure after slow success", map[string]*kdcHealthEntry{
+			"kdc1:88": {lastFailure: now.Add(-time.Minute)},
+			"kdc2:88": {latency: time.Second},
+		}, [][]string{{"kdc2:88"}, {"kdc3:88"}, {"kdc1:88"}}},
+		{"oldest failure first", map[string]*kdcHealthEntry{
+			"kdc1:88": {lastFailure: now.Add(-time.Second)},
+			"kdc2:88": {lastFailure: now.Add(-2 * time.Minute)},
+		}, [][]string{{"kdc3:88"}, {"kdc2:88"}, {"kdc1:88"}}},
+		{"failure outside penalty window", map[string]*kdcHealthEntry{
+			"kdc1:88": {lastFailure: now.Add(-kdcFailurePenalty - time.Minute)},
+			"kdc2:88": {lastFailure: now.Add(-time.Minute)},
+		}, [][]string{{"kdc1:88", "kdc3:88"}, {"kdc2:88"}}},
+		{"failure outside penalty window after success", map[string]*kdcHealthEntry{
+			"kdc1:88": {latency: 20 * time.Millisecond},
+			"kdc3:88": {latency: 10 * time.Millisecond, lastFailure: now.Add(-kdcFailurePenalty - time.Minute)},
+		}, [][]string{{"kdc3:88"}, {"kdc1:88"}, {"kdc2:88"}}},
+	}
+	for _, test := range tests {
+		h := newKDCHealth()
+		for addr, e := range test.entries {
+			h.entries[addr] = e
+		}
+		o := h.order(len(kdcs), kdcs)
+		assert.Equal(t, len(kdcs), len(o), "Number of KDCs not as expected: %s", test.name)
+		i := 1
+		for _, g := range test.want {
+			var got []string
+			for range g {
+				got = append(got, o[i])
+				i++
+			}
+			sort.Strings(got)
+			assert.Equal(t, g, got, "KDC order not as expected: %s", test.name)
+		}
+	}
+
+	// KDCs of equal health are shuffled
+	h := newKDCHealth()
+	first := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		first[h.order(len(kdcs), kdcs)[1]] = true
+	}
+	assert.True(t, len(first) > 1, "KDCs of equal health should be shuffled")
+}
+
+func TestKDCHealth_SuccessFailure(t *testing.T) {
+	t.Parallel()
+	kdcs := map[int]string{1: "kdc1:88", 2: "kdc2:88"}
+	h := newKDCHealth()
+	h.failure("kdc1:88")
+	assert.Equal(t, "kdc2:88", h.order(2, kdcs)[1], "KDC that failed should be tried last")
+	h.success("kdc1:88", 40*time.Millisecond)
+	assert.True(t, h.entries["kdc1:88"].lastFailure.IsZero(), "Failure should be cleared by a success")
+	assert.Equal(t, "kdc1:88", h.order(2, kdcs)[1], "KDC that responded should be tried first")
+	h.success("kdc1:88", 80*time.Millisecond)
+	assert.Equal(t, 50*time.Millisecond, h.entries["kdc1:88"].latency, "Latency moving average not as expected")
+	h.success("kdc2:88", 10*time.Millisecond)
+	assert.Equal(t, "kdc2:88", h.order(2, kdcs)[1], "Faster KDC should be tried first")
+
+	// The health is held by the transport
+	nt := &NetworkTransport{}
+	assert.NotNil(t, nt.getHealth(), "Transport health not initialised")
+	assert.Equal(t, nt.getHealth(), nt.getHealth(), "Transport health should not change")
+	assert.True(t, nt.getHealth() != h, "Transports should not share health")
+
+	// A client not created with a constructor keeps its health across exchanges
+	var cl Client
+	assert.NotNil(t, cl.kdcHealth(), "Client health not initialised")
+	assert.True(t, cl.kdcHealth() == cl.kdcHealth(), "Client health should not change")
+}
+
+// testTCPKDC starts a stand-in KDC on a local TCP port that replies to each request with the reply provided. The number
+// of requests received is counted in the value returned.
+func testTCPKDC(t *testing.T, reply []byte) (net.Listener, *int32) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error starting stand-in KDC: %v", err)
+	}
+	var n int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			sh := make([]byte, 4)
+			if _, err := io.ReadFull(conn, sh); err == nil {
+				b := make([]byte, binary.BigEndian.Uint32(sh))
+				if _, err := io.ReadFull(conn, b); err == nil {
+					atomic.AddInt32(&n, 1)
+					binary.BigEndian.PutUint32(sh, uint32(len(reply)))
+					conn.Write(append(sh, reply...))
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return ln, &n
+}
+
+func testKRBErrorBytes(t *testing.T, code int32) []byte {
+	e := messages.NewKRBError(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"), "TEST.GOKRB5", code, "")
+	b, err := asn1.Marshal(e)
+	if err != nil {
+		t.Fatalf("Error marshaling KRB_ERROR: %v", err)
+	}
+	return asn1tools.AddASNAppTag(b, asnAppTag.KRBError)
+}
+
+func TestNetworkTransport_MasterRetry(t *testing.T) {
+	t.Parallel()
+	masterReply := []byte("master reply")
+	var tests = []struct {
+		name          string
+		replicaCode   int32
+		replicaMaster bool
+		wantMaster    bool
+	}{
+		{"preauth failed", errorcode.KDC_ERR_PREAUTH_FAILED, false, true},
+		{"key expired", errorcode.KDC_ERR_KEY_EXPIRED, false, true},
+		{"other error", errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN, false, false},
+		{"replying KDC is a master", errorcode.KDC_ERR_PREAUTH_FAILED, true, false},
+	}
+	for _, test := range tests {
+		replica, rn := testTCPKDC(t, testKRBErrorBytes(t, test.replicaCode))
+		master, mn := testTCPKDC(t, masterReply)
+		ma := master.Addr().String()
+		if test.replicaMaster {
+			ma = replica.Addr().String()
+		}
+		c, err := config.NewConfigFromString("[libdefaults]\n udp_preference_limit = 1\n\n[realms]\n TEST.GOKRB5 = {\n  kdc = " +
+			replica.Addr().String() + "\n  master_kdc = " + ma + "\n }\n")
+		if err != nil {
+			t.Fatalf("Error loading config: %v", err)
+		}
+		nt := &NetworkTransport{Config: c}
+		rb, err := nt.SendToKDC(context.Background(), []byte("request"), "TEST.GOKRB5")
+		if test.wantMaster {
+			assert.NoError(t, err, "Reply from the master KDC should be returned: %s", test.name)
+			assert.Equal(t, masterReply, rb, "Reply not from the master KDC: %s", test.name)
+			assert.Equal(t, int32(1), atomic.LoadInt32(mn), "Master KDC not asked once: %s", test.name)
+		} else {
+			if e, ok := err.(messages.KRBError); assert.True(t, ok, "KRB_ERROR from the KDC should be returned: %s", test.name) {
+				assert.Equal(t, test.replicaCode, e.ErrorCode, "Error code not as expected: %s", test.name)
+			}
+			assert.Equal(t, int32(1), atomic.LoadInt32(rn), "KDC not asked once: %s", test.name)
+			assert.Equal(t, int32(0), atomic.LoadInt32(mn), "Master KDC should not be asked: %s", test.name)
+		}
+		replica.Close()
+		master.Close()
+	}
+}
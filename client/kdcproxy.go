@@ -0,0 +1,87 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"gopkg.in/jcmturner/gokrb5.v5/config"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+)
+
+// Reference: https://msdn.microsoft.com/en-us/library/hh553774.aspx
+
+const kdcProxyContentType = "application/kerberos"
+
+// KDCProxyTransport is a Transport that sends messages to the KDCs of a realm via the MS-KKDCP KDC proxies configured for
+// it. KDC proxies are configured in the krb5.conf as kdc entries with an https URL, for example:
+//
+// kdc = https://kdcproxy.example.com/KdcProxy
+//
+// The default HTTP client is used if HTTPClient is nil.
+type KDCProxyTransport struct {
+	Config     *config.Config
+	HTTPClient *http.Client
+}
+
+// SendToKDC sends data to the KDCs of the realm through its KDC proxies. Each proxy is tried in turn until one replies.
+func (t *KDCProxyTransport) SendToKDC(ctx context.Context, b []byte, realm string) ([]byte, error) {
+	count, kps, err := t.Config.GetKDCProxiesContext(ctx, realm)
+	if err != nil {
+		return nil, err
+	}
+	if realm == "" {
+		realm = t.Config.LibDefaults.DefaultRealm
+	}
+	m := messages.NewKDCProxyMessage(b, realm)
+	mb, err := m.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for i := 1; i <= count; i++ {
+		rb, err := t.post(ctx, kps[i], mb)
+		if err == nil {
+			return rb, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("failed to communicate with KDC via KDC proxies: %v", errs)
+}
+
+// post sends the marshaled KDC-PROXY-MESSAGE to the KDC proxy URL and returns the Kerberos message in the reply.
+func (t *KDCProxyTransport) post(ctx context.Context, url string, mb []byte) ([]byte, error) {
+	hc := t.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	r, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(mb))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request to KDC proxy %s: %v", url, err)
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", kdcProxyContentType)
+	httpResp, err := hc.Do(r)
+	if err != nil {
+		return nil, fmt.Errorf("error sending to KDC proxy %s: %v", url, err)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("KDC proxy %s returned status %s", url, httpResp.Status)
+	}
+	rb, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response from KDC proxy %s: %v", url, err)
+	}
+	var m messages.KDCProxyMessage
+	err = m.Unmarshal(rb)
+	if err != nil {
+		return nil, err
+	}
+	return m.Message()
+}
@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/config"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+)
+
+// testKDCProxy is a stand-in KDC proxy that replies to each request with the status and body provided. The
+// KDC-PROXY-MESSAGEs received are recorded.
+type testKDCProxy struct {
+	status int
+	reply  []byte
+	mux    sync.Mutex
+	msgs   []messages.KDCProxyMessage
+	ctypes []string
+}
+
+func (p *testKDCProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil || r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var m messages.KDCProxyMessage
+	if err := m.Unmarshal(b); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	p.mux.Lock()
+	p.msgs = append(p.msgs, m)
+	p.ctypes = append(p.ctypes, r.Header.Get("Content-Type"))
+	p.mux.Unlock()
+	w.WriteHeader(p.status)
+	w.Write(p.reply)
+}
+
+func (p *testKDCProxy) requests() []messages.KDCProxyMessage {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return append([]messages.KDCProxyMessage{}, p.msgs...)
+}
+
+// testKDCProxyReply returns the body of a KDC proxy's reply carrying the Kerberos message provided.
+func testKDCProxyReply(t *testing.T, b []byte) []byte {
+	m := messages.NewKDCProxyMessage(b, "")
+	mb, err := m.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling KDC-PROXY-MESSAGE: %v", err)
+	}
+	return mb
+}
+
+// testKDCProxyClient returns an HTTP client that trusts the certificate of the test TLS server.
+func testKDCProxyClient(t *testing.T, s *httptest.Server) *http.Client {
+	cert, err := x509.ParseCertificate(s.TLS.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatalf("Error parsing test server certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+}
+
+func testKDCProxyConf(t *testing.T, urls ...string) *config.Config {
+	s := "[libdefaults]\n default_realm = TEST.GOKRB5\n\n[realms]\n TEST.GOKRB5 = {\n"
+	for _, u := range urls {
+		s += "  kdc = " + u + "/KdcProxy\n"
+	}
+	s += " }\n"
+	c, err := config.NewConfigFromString(s)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	return c
+}
+
+func TestKDCProxyTransport_SendToKDC(t *testing.T) {
+	t.Parallel()
+	req := []byte("kerberos request")
+	reply := []byte("kerberos reply")
+	p := &testKDCProxy{status: http.StatusOK, reply: testKDCProxyReply(t, reply)}
+	s := httptest.NewTLSServer(p)
+	defer s.Close()
+	hc := testKDCProxyClient(t, s)
+
+	// The request is framed with its length in a KDC-PROXY-MESSAGE for the realm and the framing of the reply removed
+	tr := KDCProxyTransport{Config: testKDCProxyConf(t, s.URL), HTTPClient: hc}
+	rb, err := tr.SendToKDC(context.Background(), req, "")
+	if err != nil {
+		t.Fatalf("Error sending via KDC proxy: %v", err)
+	}
+	assert.Equal(t, reply, rb, "Reply not as expected")
+	msgs := p.requests()
+	if assert.Len(t, msgs, 1, "KDC proxy should receive one request") {
+		assert.Equal(t, append([]byte{0, 0, 0, byte(len(req))}, req...), msgs[0].KerbMessage, "Request not framed with its length")
+		assert.Equal(t, "TEST.GOKRB5", msgs[0].TargetDomain, "Target domain should be the default realm")
+		assert.Equal(t, kdcProxyContentType, p.ctypes[0], "Content type not as expected")
+	}
+}
+
+func TestKDCProxyTransport_SendToKDC_Fallback(t *testing.T) {
+	t.Parallel()
+	req := []byte("kerberos request")
+	reply := []byte("kerberos reply")
+	unavailable := &testKDCProxy{status: http.StatusServiceUnavailable}
+	su := httptest.NewTLSServer(unavailable)
+	defer su.Close()
+	// The length in the framing of the reply does not match that of the message
+	m := messages.NewKDCProxyMessage(reply, "")
+	m.KerbMessage[3]++
+	b, err := m.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling KDC-PROXY-MESSAGE: %v", err)
+	}
+	badFraming := &testKDCProxy{status: http.StatusOK, reply: b}
+	sb := httptest.NewTLSServer(badFraming)
+	defer sb.Close()
+	ok := &testKDCProxy{status: http.StatusOK, reply: testKDCProxyReply(t, reply)}
+	so := httptest.NewTLSServer(ok)
+	defer so.Close()
+	hc := testKDCProxyClient(t, so)
+
+	// Proxies are tried in turn until one replies
+	tr := KDCProxyTransport{Config: testKDCProxyConf(t, su.URL, sb.URL, so.URL), HTTPClient: hc}
+	rb, err := tr.SendToKDC(context.Background(), req, "TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error sending via KDC proxies: %v", err)
+	}
+	assert.Equal(t, reply, rb, "Reply not as expected")
+	assert.Len(t, unavailable.requests(), 1, "Unavailable KDC proxy should be tried first")
+	assert.Len(t, badFraming.requests(), 1, "KDC proxy with an invalid reply should be tried second")
+	assert.Len(t, ok.requests(), 1, "Available KDC proxy should be tried last")
+
+	// An error is returned if none of the proxies reply
+	tr = KDCProxyTransport{Config: testKDCProxyConf(t, su.URL, sb.URL), HTTPClient: hc}
+	_, err = tr.SendToKDC(context.Background(), req, "TEST.GOKRB5")
+	if assert.Error(t, err, "Error expected when no KDC proxy replies") {
+		assert.Contains(t, err.Error(), "503", "Error should contain the status returned")
+		assert.Contains(t, err.Error(), "does not match its framing", "Error should contain the framing error")
+	}
+
+	// No further proxies are tried once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tr = KDCProxyTransport{Config: testKDCProxyConf(t, su.URL, so.URL), HTTPClient: hc}
+	_, err = tr.SendToKDC(ctx, req, "TEST.GOKRB5")
+	assert.Equal(t, context.Canceled, err, "Context error expected")
+	assert.Len(t, ok.requests(), 1, "KDC proxy should not be tried once the context is done")
+
+	// An error is returned if there are no proxies for the realm
+	_, err = tr.SendToKDC(context.Background(), req, "OTHER.GOKRB5")
+	assert.Error(t, err, "Error expected when the realm has no KDC proxies")
+}
@@ -2,149 +2,299 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"strings"
+	"sync"
 	"time"
 
+	"gopkg.in/jcmturner/gokrb5.v5/config"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/errorcode"
 	"gopkg.in/jcmturner/gokrb5.v5/messages"
 )
 
+// kdcTimeout is the maximum time allowed for an exchange with a single KDC or kpasswd server.
+const kdcTimeout = 5 * time.Second
+
+// Transport is the interface the client uses to exchange messages with the KDCs of a realm. An alternative
+// implementation can be set on the client to change how KDCs are reached, for example to use a proxy or an in-memory
+// KDC during testing.
+type Transport interface {
+	// SendToKDC sends the bytes provided to a KDC for the realm and returns the bytes of the KDC's reply. Cancellation
+	// and the deadline of the context should be honoured. A KRB_ERROR reply can be returned either as bytes or as the
+	// messages.KRBError.
+	SendToKDC(ctx context.Context, b []byte, realm string) ([]byte, error)
+}
+
+// NetworkTransport is the default Transport. It sends to the KDCs for the realm in the Kerberos configuration over UDP
+// and TCP as directed by the udp_preference_limit setting. If KDC proxy URLs are configured for the realm the messages
+// are sent through the KDC proxies instead.
+//
+// A KDC that replies with KDC_ERR_PREAUTH_FAILED or KDC_ERR_KEY_EXPIRED may not yet have a recently changed key, so
+// unless it is a master KDC the request is sent again to the master KDCs of the realm. The transport records the health
+// of each KDC it uses and tries the KDCs of a realm in order of their health.
+type NetworkTransport struct {
+	Config *config.Config
+	once   sync.Once
+	health *kdcHealth
+}
+
+// getHealth returns the health of the KDCs used by the transport.
+func (t *NetworkTransport) getHealth() *kdcHealth {
+	t.once.Do(func() {
+		if t.health == nil {
+			t.health = newKDCHealth()
+		}
+	})
+	return t.health
+}
+
 // SendToKDC performs network actions to send data to the KDC.
 func (cl *Client) SendToKDC(b []byte, realm string) ([]byte, error) {
-	var rb []byte
-	if cl.Config.LibDefaults.UDPPreferenceLimit == 1 {
+	return cl.SendToKDCContext(context.Background(), b, realm)
+}
+
+// SendToKDCContext performs network actions to send data to the KDC using the client's transport. Cancellation and the
+// deadline of the context provided apply to the exchange.
+func (cl *Client) SendToKDCContext(ctx context.Context, b []byte, realm string) ([]byte, error) {
+	var t Transport = &NetworkTransport{Config: cl.Config, health: cl.kdcHealth()}
+	if cl.Transport != nil {
+		t = cl.Transport
+	}
+	rb, err := t.SendToKDC(ctx, b, realm)
+	if err != nil {
+		return rb, err
+	}
+	return checkForKRBError(rb)
+}
+
+// SendToKDC sends data to a KDC for the realm. Cancellation and the deadline of the context provided apply to dialing,
+// sending to and reading from the KDCs. No further KDCs or transports are tried once the context is done.
+func (t *NetworkTransport) SendToKDC(ctx context.Context, b []byte, realm string) ([]byte, error) {
+	if c, _, _ := t.Config.GetKDCProxiesContext(ctx, realm); c > 0 {
+		kp := KDCProxyTransport{Config: t.Config}
+		return kp.SendToKDC(ctx, b, realm)
+	}
+	rb, addr, err := t.send(ctx, b, realm, false)
+	if e, ok := err.(messages.KRBError); ok && (e.ErrorCode == errorcode.KDC_ERR_PREAUTH_FAILED || e.ErrorCode == errorcode.KDC_ERR_KEY_EXPIRED) {
+		// A replica KDC may not yet have a recently changed key so the master KDC is asked instead.
+		if !t.isMaster(ctx, realm, addr) {
+			mrb, _, merr := t.send(ctx, b, realm, true)
+			if _, ok := merr.(messages.KRBError); ok || merr == nil {
+				rb, err = mrb, merr
+			}
+		}
+	}
+	return rb, err
+}
+
+// isMaster indicates if the KDC address is one of the master KDCs of the realm.
+func (t *NetworkTransport) isMaster(ctx context.Context, realm, addr string) bool {
+	for _, tcp := range []bool{false, true} {
+		_, kdcs, err := t.Config.GetMasterKDCsContext(ctx, realm, tcp)
+		if err != nil {
+			continue
+		}
+		for _, k := range kdcs {
+			if k == addr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SendToMasterKDC sends data to a master KDC for the realm. Master KDCs are given by the master_kdc entries of the
+// realm's configuration or, when DNS lookups of KDCs are enabled, by URI records with the master flag set.
+func (t *NetworkTransport) SendToMasterKDC(ctx context.Context, b []byte, realm string) ([]byte, error) {
+	if c, _, _ := t.Config.GetKDCProxiesContext(ctx, realm); c > 0 {
+		return []byte{}, errors.New("master KDCs cannot be reached when KDC proxies are used")
+	}
+	rb, _, err := t.send(ctx, b, realm, true)
+	return rb, err
+}
+
+// send the bytes to the KDCs, or master KDCs, of the realm over UDP and TCP as directed by the udp_preference_limit
+// setting. The address of the KDC that replied is returned along with its reply.
+func (t *NetworkTransport) send(ctx context.Context, b []byte, realm string, master bool) ([]byte, string, error) {
+	if t.Config.LibDefaults.UDPPreferenceLimit == 1 {
 		//1 means we should always use TCP
-		rb, errtcp := cl.sendKDCTCP(realm, b)
+		rb, addr, errtcp := t.sendKDCTCP(ctx, realm, b, master)
 		if errtcp != nil {
 			if e, ok := errtcp.(messages.KRBError); ok {
-				return rb, e
+				return rb, addr, e
+			}
+			if ctx.Err() != nil {
+				return rb, addr, ctx.Err()
 			}
-			return rb, fmt.Errorf("communication error with KDC via TCP: %v", errtcp)
+			return rb, addr, fmt.Errorf("communication error with KDC via TCP: %v", errtcp)
 		}
-		return rb, nil
+		return rb, addr, nil
 	}
-	if len(b) <= cl.Config.LibDefaults.UDPPreferenceLimit {
+	if len(b) <= t.Config.LibDefaults.UDPPreferenceLimit {
 		//Try UDP first, TCP second
-		rb, errudp := cl.sendKDCUDP(realm, b)
+		rb, addr, errudp := t.sendKDCUDP(ctx, realm, b, master)
 		if errudp != nil {
 			if e, ok := errudp.(messages.KRBError); ok && e.ErrorCode != errorcode.KRB_ERR_RESPONSE_TOO_BIG {
 				// Got a KRBError from KDC
 				// If this is not a KRB_ERR_RESPONSE_TOO_BIG we will return immediately otherwise will try TCP.
-				return rb, e
+				return rb, addr, e
+			}
+			if ctx.Err() != nil {
+				return rb, addr, ctx.Err()
 			}
 			// Try TCP
-			r, errtcp := cl.sendKDCTCP(realm, b)
+			r, taddr, errtcp := t.sendKDCTCP(ctx, realm, b, master)
 			if errtcp != nil {
 				if e, ok := errtcp.(messages.KRBError); ok {
 					// Got a KRBError
-					return r, e
+					return r, taddr, e
+				}
+				if ctx.Err() != nil {
+					return r, taddr, ctx.Err()
 				}
-				return r, fmt.Errorf("failed to communicate with KDC. Attempts made with UDP (%v) and then TCP (%v)", errudp, errtcp)
+				return r, taddr, fmt.Errorf("failed to communicate with KDC. Attempts made with UDP (%v) and then TCP (%v)", errudp, errtcp)
 			}
-			rb = r
+			rb, addr = r, taddr
 		}
-		return rb, nil
+		return rb, addr, nil
 	}
 	//Try TCP first, UDP second
-	rb, errtcp := cl.sendKDCTCP(realm, b)
+	rb, addr, errtcp := t.sendKDCTCP(ctx, realm, b, master)
 	if errtcp != nil {
 		if e, ok := errtcp.(messages.KRBError); ok {
 			// Got a KRBError from KDC so returning and not trying UDP.
-			return rb, e
+			return rb, addr, e
 		}
-		rb, errudp := cl.sendKDCUDP(realm, b)
+		if ctx.Err() != nil {
+			return rb, addr, ctx.Err()
+		}
+		r, uaddr, errudp := t.sendKDCUDP(ctx, realm, b, master)
 		if errudp != nil {
 			if e, ok := errudp.(messages.KRBError); ok {
 				// Got a KRBError
-				return rb, e
+				return r, uaddr, e
+			}
+			if ctx.Err() != nil {
+				return r, uaddr, ctx.Err()
 			}
-			return rb, fmt.Errorf("failed to communicate with KDC. Attempts made with TCP (%v) and then UDP (%v)", errtcp, errudp)
+			return r, uaddr, fmt.Errorf("failed to communicate with KDC. Attempts made with TCP (%v) and then UDP (%v)", errtcp, errudp)
 		}
+		rb, addr = r, uaddr
 	}
-	return rb, nil
+	return rb, addr, nil
 }
 
-func dialKDCUDP(count int, kdcs map[int]string) (conn *net.UDPConn, err error) {
-	i := 1
-	for i <= count {
-		udpAddr, e := net.ResolveUDPAddr("udp", kdcs[i])
-		if e != nil {
-			err = fmt.Errorf("error resolving KDC address: %v", e)
-			return
-		}
-		conn, err = net.DialUDP("udp", nil, udpAddr)
-		if err == nil {
-			conn.SetDeadline(time.Now().Add(time.Duration(5 * time.Second)))
-			return
-		}
-		i++
+// getKDCs returns the count of KDCs, or master KDCs, for the realm and a map of their addresses keyed on preference
+// order according to their health.
+func (t *NetworkTransport) getKDCs(ctx context.Context, realm string, tcp, master bool) (int, map[int]string, error) {
+	var count int
+	var kdcs map[int]string
+	var err error
+	if master {
+		count, kdcs, err = t.Config.GetMasterKDCsContext(ctx, realm, tcp)
+	} else {
+		count, kdcs, err = t.Config.GetKDCsContext(ctx, realm, tcp)
 	}
-	err = errors.New("error in getting a UDP connection to any of the KDCs")
-	return
-}
-
-func dialKDCTCP(count int, kdcs map[int]string) (conn *net.TCPConn, err error) {
-	i := 1
-	for i <= count {
-		tcpAddr, e := net.ResolveTCPAddr("tcp", kdcs[i])
-		if e != nil {
-			err = fmt.Errorf("error resolving KDC address: %v", e)
-			return
-		}
-		conn, err = net.DialTCP("tcp", nil, tcpAddr)
-		if err == nil {
-			conn.SetDeadline(time.Now().Add(time.Duration(5 * time.Second)))
-			return
-		}
-		i++
+	if err != nil {
+		return count, kdcs, err
 	}
-	err = errors.New("error in getting a TCP connection to any of the KDCs")
-	return
+	return count, t.getHealth().order(count, kdcs), nil
 }
 
 // Send the bytes to the KDC over UDP.
-func (cl *Client) sendKDCUDP(realm string, b []byte) ([]byte, error) {
-	var r []byte
-	count, kdcs, err := cl.Config.GetKDCs(realm, false)
+func (t *NetworkTransport) sendKDCUDP(ctx context.Context, realm string, b []byte, master bool) ([]byte, string, error) {
+	count, kdcs, err := t.getKDCs(ctx, realm, false, master)
 	if err != nil {
-		return r, err
+		return []byte{}, "", err
 	}
-	conn, err := dialKDCUDP(count, kdcs)
-	if err != nil {
-		return r, err
-	}
-	r, err = cl.sendUDP(conn, b)
+	return t.sendToKDCs(ctx, "udp", count, kdcs, b)
+}
+
+// SendToKDCTCP sends data to a KDC for the realm over TCP only. A KRB_ERROR reply is returned as a messages.KRBError
+// error along with the bytes of the reply.
+func (t *NetworkTransport) SendToKDCTCP(ctx context.Context, b []byte, realm string) ([]byte, error) {
+	rb, _, err := t.sendKDCTCP(ctx, realm, b, false)
+	return rb, err
+}
+
+func (t *NetworkTransport) sendKDCTCP(ctx context.Context, realm string, b []byte, master bool) ([]byte, string, error) {
+	count, kdcs, err := t.getKDCs(ctx, realm, true, master)
 	if err != nil {
-		return r, err
+		return []byte{}, "", err
 	}
-	return checkForKRBError(r)
+	return t.sendToKDCs(ctx, "tcp", count, kdcs, b)
 }
 
-func (cl *Client) sendKDCTCP(realm string, b []byte) ([]byte, error) {
-	var r []byte
-	count, kdcs, err := cl.Config.GetKDCs(realm, true)
-	if err != nil {
-		return r, err
+// sendToKDCs sends the bytes to each of the KDCs in turn, recording their health, until one of them replies. The
+// address of the KDC that replied is returned along with its reply.
+func (t *NetworkTransport) sendToKDCs(ctx context.Context, network string, count int, kdcs map[int]string, b []byte) ([]byte, string, error) {
+	h := t.getHealth()
+	d := net.Dialer{Timeout: kdcTimeout}
+	var errs []string
+	for i := 1; i <= count; i++ {
+		if ctx.Err() != nil {
+			return []byte{}, "", ctx.Err()
+		}
+		start := time.Now()
+		var rb []byte
+		c, err := d.DialContext(ctx, network, kdcs[i])
+		if err == nil {
+			if network == "tcp" {
+				rb, err = sendTCP(ctx, c.(*net.TCPConn), b)
+			} else {
+				rb, err = sendUDP(ctx, c.(*net.UDPConn), b)
+			}
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				h.failure(kdcs[i])
+			}
+			errs = append(errs, err.Error())
+			continue
+		}
+		h.success(kdcs[i], time.Since(start))
+		rb, err = checkForKRBError(rb)
+		return rb, kdcs[i], err
 	}
-	conn, err := dialKDCTCP(count, kdcs)
-	if err != nil {
-		return r, err
+	if ctx.Err() != nil {
+		return []byte{}, "", ctx.Err()
 	}
-	rb, err := cl.sendTCP(conn, b)
-	if err != nil {
-		return r, err
+	return []byte{}, "", fmt.Errorf("error sending to any of the KDCs over %s: %s", strings.ToUpper(network), strings.Join(errs, "; "))
+}
+
+// watchContext sets the connection's deadline to the earlier of the context's deadline and the KDC timeout and interrupts
+// any blocking read or write on the connection when the context is cancelled. The function returned stops watching the
+// context and must be called once the exchange is complete.
+func watchContext(ctx context.Context, conn net.Conn) func() {
+	d := time.Now().Add(kdcTimeout)
+	if cd, ok := ctx.Deadline(); ok && cd.Before(d) {
+		d = cd
+	}
+	conn.SetDeadline(d)
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+	return func() {
+		close(stop)
 	}
-	return checkForKRBError(rb)
 }
 
 // Send the bytes over UDP.
-func (cl *Client) sendUDP(conn *net.UDPConn, b []byte) ([]byte, error) {
+func sendUDP(ctx context.Context, conn *net.UDPConn, b []byte) ([]byte, error) {
 	var r []byte
 	defer conn.Close()
+	stop := watchContext(ctx, conn)
+	defer stop()
 	_, err := conn.Write(b)
 	if err != nil {
 		return r, fmt.Errorf("error sending to (%s): %v", conn.RemoteAddr().String(), err)
@@ -162,8 +312,10 @@ func (cl *Client) sendUDP(conn *net.UDPConn, b []byte) ([]byte, error) {
 }
 
 // Send the bytes over TCP.
-func (cl *Client) sendTCP(conn *net.TCPConn, b []byte) ([]byte, error) {
+func sendTCP(ctx context.Context, conn *net.TCPConn, b []byte) ([]byte, error) {
 	defer conn.Close()
+	stop := watchContext(ctx, conn)
+	defer stop()
 	var r []byte
 	/*
 		RFC https://tools.ietf.org/html/rfc4120#section-7.2.2
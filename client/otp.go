@@ -0,0 +1,168 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/jcmturner/gokrb5.v5/crypto"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/keyusage"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/patype"
+	"gopkg.in/jcmturner/gokrb5.v5/krberror"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+// Reference: https://tools.ietf.org/html/rfc6560
+
+// OTPPrompter is implemented by applications to supply one-time passwords from the user's token when the KDC requires
+// OTP pre-authentication. OTP pre-authentication is only performed within FAST armored AS exchanges.
+type OTPPrompter interface {
+	// OTP is called with the KDC's OTP challenge and returns the one-time password for one of the tokens in the
+	// challenge's token information.
+	OTP(challenge messages.PAOTPChallenge) (OTPResponse, error)
+	// PINChange is called when the KDC sends a PIN change for the token. If the KDC rejected the one-time password
+	// because the PIN must be changed the new PIN returned is sent to the KDC with a further one-time password. If the PIN
+	// change is in a successful reply it contains the PIN set by the system and the PIN returned is ignored.
+	PINChange(pinChange messages.PAOTPPINChange) (string, error)
+}
+
+// OTPResponse is the one-time password for the token, identified by its index in the challenge's token information,
+// and the token's PIN if it is to be sent separately.
+type OTPResponse struct {
+	TokenIndex int
+	Value      string
+	PIN        string
+}
+
+// setOTPPAData prompts for a one-time password in response to the OTP challenge from the KDC and sets PA_OTP_REQUEST
+// pre-authentication data in the AS_REQ. If a new PIN is provided it is sent in the request.
+func (cl *Client) setOTPPAData(krberr messages.KRBError, ASReq *messages.ASReq, fast *fastState, newPIN string) error {
+	var pas types.PADataSequence
+	if err := pas.Unmarshal(krberr.EData); err == nil {
+		for _, pa := range pas {
+			if pa.PADataType == patype.PA_OTP_CHALLENGE {
+				var c messages.PAOTPChallenge
+				if err := c.Unmarshal(pa.PADataValue); err != nil {
+					return err
+				}
+				fast.otpChallenge = &c
+				break
+			}
+		}
+	}
+	if fast.otpChallenge == nil {
+		return errors.New("KDC did not provide an OTP challenge")
+	}
+	resp, err := cl.GoKrb5Conf.OTPPrompter.OTP(*fast.otpChallenge)
+	if err != nil {
+		return fmt.Errorf("error getting one-time password: %v", err)
+	}
+	if newPIN != "" {
+		resp.PIN = newPIN
+	}
+	pa, err := fast.paOTPRequest(resp)
+	if err != nil {
+		return err
+	}
+	// The OTP request replaces any encrypted timestamp or earlier OTP request already set
+	pas = types.PADataSequence{}
+	for _, p := range ASReq.PAData {
+		if p.PADataType != patype.PA_ENC_TIMESTAMP && p.PADataType != patype.PA_OTP_REQUEST {
+			pas = append(pas, p)
+		}
+	}
+	ASReq.PAData = append(pas, pa)
+	return nil
+}
+
+// setOTPPINChange prompts for a new PIN in response to a PIN change from the KDC and sets a new PA_OTP_REQUEST
+// carrying it in the AS_REQ.
+func (cl *Client) setOTPPINChange(krberr messages.KRBError, ASReq *messages.ASReq, fast *fastState) error {
+	var pas types.PADataSequence
+	err := pas.Unmarshal(krberr.EData)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KRBError data")
+	}
+	pc, err := otpPINChange(pas)
+	if err != nil {
+		return err
+	}
+	pin, err := cl.GoKrb5Conf.OTPPrompter.PINChange(pc)
+	if err != nil {
+		return fmt.Errorf("error getting new PIN: %v", err)
+	}
+	return cl.setOTPPAData(krberr, ASReq, fast, pin)
+}
+
+// otpReplyPINChange passes any PIN change in the pre-authentication data of the AS_REP to the client's OTP prompter.
+func (cl *Client) otpReplyPINChange(pas types.PADataSequence) error {
+	if !pas.Contains(patype.PA_OTP_PIN_CHANGE) {
+		return nil
+	}
+	pc, err := otpPINChange(pas)
+	if err != nil {
+		return err
+	}
+	_, err = cl.GoKrb5Conf.OTPPrompter.PINChange(pc)
+	return err
+}
+
+// otpPINChange returns the PA-OTP-PIN-CHANGE from the PAData provided.
+func otpPINChange(pas types.PADataSequence) (messages.PAOTPPINChange, error) {
+	var pc messages.PAOTPPINChange
+	for _, pa := range pas {
+		if pa.PADataType == patype.PA_OTP_PIN_CHANGE {
+			err := pc.Unmarshal(pa.PADataValue)
+			return pc, err
+		}
+	}
+	return pc, errors.New("PA-OTP-PIN-CHANGE not found")
+}
+
+// paOTPRequest creates PA_OTP_REQUEST pre-authentication data for the one-time password provided. The nonce from the
+// KDC's challenge is encrypted with the armor key.
+func (f *fastState) paOTPRequest(resp OTPResponse) (types.PAData, error) {
+	var pa types.PAData
+	c := f.otpChallenge
+	if resp.TokenIndex < 0 || resp.TokenIndex >= len(c.TokenInfo) {
+		return pa, fmt.Errorf("OTP token index %d not in the KDC's challenge", resp.TokenIndex)
+	}
+	ti := c.TokenInfo[resp.TokenIndex]
+	enc := messages.PAOTPEncRequest{Nonce: c.Nonce}
+	b, err := enc.Marshal()
+	if err != nil {
+		return pa, err
+	}
+	ed, err := crypto.GetEncryptedData(b, f.armorKey, keyusage.KEY_USAGE_PA_OTP_REQUEST, 0)
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.EncryptingError, "error encrypting OTP nonce")
+	}
+	req := messages.PAOTPRequest{
+		Flags:        types.NewKrbFlags(),
+		EncData:      ed,
+		OTPValue:     []byte(resp.Value),
+		OTPPIN:       resp.PIN,
+		OTPChallenge: ti.Challenge,
+		OTPFormat:    ti.Format,
+		OTPTokenID:   ti.TokenID,
+		OTPAlgID:     ti.AlgID,
+		OTPVendor:    ti.Vendor,
+	}
+	if types.IsFlagSet(&ti.Flags, messages.OTPFlagNextOTP) {
+		types.SetFlag(&req.Flags, messages.OTPFlagNextOTP)
+	}
+	b, err = req.Marshal()
+	if err != nil {
+		return pa, err
+	}
+	f.otp = true
+	return types.PAData{
+		PADataType:  patype.PA_OTP_REQUEST,
+		PADataValue: b,
+	}, nil
+}
+
+// otpSent indicates if OTP pre-authentication was used in the exchange.
+func (f *fastState) otpSent() bool {
+	return f != nil && f.otp
+}
@@ -0,0 +1,154 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/config"
+	"gopkg.in/jcmturner/gokrb5.v5/crypto"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/errorcode"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/keyusage"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/patype"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+// testOTPPrompter returns the one-time password for the first token in the KDC's challenge.
+type testOTPPrompter struct {
+	otp        string
+	challenges []messages.PAOTPChallenge
+}
+
+func (p *testOTPPrompter) OTP(challenge messages.PAOTPChallenge) (OTPResponse, error) {
+	p.challenges = append(p.challenges, challenge)
+	return OTPResponse{TokenIndex: 0, Value: p.otp}, nil
+}
+
+func (p *testOTPPrompter) PINChange(pinChange messages.PAOTPPINChange) (string, error) {
+	return "", errors.New("PIN change not expected")
+}
+
+func TestClient_LoginOTP(t *testing.T) {
+	t.Parallel()
+	c, err := config.NewConfigFromString(testMemKDCConf)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	kdc := newTestMemKDC("TEST.GOKRB5", "passwordvalue")
+	// The host's TGT armors the user's AS exchange
+	host := NewClientWithPassword("testhost", "TEST.GOKRB5", "passwordvalue")
+	host.WithConfig(c).WithTransport(kdc)
+	defer host.Destroy()
+	err = host.Login()
+	if err != nil {
+		t.Fatalf("Error on host login: %v", err)
+	}
+	armorTGT, armorSessionKey, err := host.GetTGT("TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error getting host TGT: %v", err)
+	}
+
+	nonce := []byte("testotpnonce")
+	cookie := []byte("testcookie")
+	var armorKeys []types.EncryptionKey
+	var otpReq messages.PAOTPRequest
+	var encNonce []byte
+	var sentCookie bool
+	kdc.as = func(ASReq messages.ASReq, iss *testIssue) error {
+		if iss.armorKey.KeyType == 0 {
+			return errors.New("AS_REQ is not armored")
+		}
+		armorKeys = append(armorKeys, iss.armorKey)
+		var found bool
+		for _, pa := range ASReq.PAData {
+			switch pa.PADataType {
+			case patype.PA_OTP_REQUEST:
+				if err := otpReq.Unmarshal(pa.PADataValue); err != nil {
+					return err
+				}
+				found = true
+			case patype.PA_FX_COOKIE:
+				sentCookie = bytes.Equal(cookie, pa.PADataValue)
+			}
+		}
+		if !found {
+			// Challenge the client for a one-time password from its token
+			ch := messages.PAOTPChallenge{
+				Nonce:   nonce,
+				Service: "gokrb5 test",
+				TokenInfo: []messages.OTPTokenInfo{{
+					Flags:   types.NewKrbFlags(),
+					Vendor:  "gokrb5",
+					TokenID: []byte("testtoken"),
+				}},
+			}
+			cb, err := ch.Marshal()
+			if err != nil {
+				return err
+			}
+			e := messages.NewKRBError(ASReq.ReqBody.SName, ASReq.ReqBody.Realm, errorcode.KDC_ERR_PREAUTH_REQUIRED, "OTP required")
+			e.EData, err = asn1.Marshal(types.PADataSequence{
+				{PADataType: patype.PA_OTP_CHALLENGE, PADataValue: cb},
+				{PADataType: patype.PA_FX_COOKIE, PADataValue: cookie},
+			})
+			if err != nil {
+				return err
+			}
+			return e
+		}
+		// The challenge nonce is returned encrypted in the armor key
+		b, err := crypto.DecryptEncPart(otpReq.EncData, iss.armorKey, keyusage.KEY_USAGE_PA_OTP_REQUEST)
+		if err != nil {
+			return err
+		}
+		var enc messages.PAOTPEncRequest
+		if err := enc.Unmarshal(b); err != nil {
+			return err
+		}
+		encNonce = enc.Nonce
+		if string(otpReq.OTPValue) != "123456" {
+			return messages.NewKRBError(ASReq.ReqBody.SName, ASReq.ReqBody.Realm, errorcode.KDC_ERR_PREAUTH_FAILED, "OTP incorrect")
+		}
+		// The armor key is the reply key for OTP pre-authentication
+		iss.replyKey = iss.armorKey
+		return nil
+	}
+
+	// The client has no password so the AS_REP can only be decrypted with the armor key
+	p := &testOTPPrompter{otp: "123456"}
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "")
+	cl.WithConfig(c).WithTransport(kdc)
+	cl.GoKrb5Conf.OTPPrompter = p
+	cl.WithFASTArmor(host.Credentials.CName, "TEST.GOKRB5", armorTGT, armorSessionKey)
+	defer cl.Destroy()
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("Error on OTP login: %v", err)
+	}
+	assert.Equal(t, []string{
+		"AS_REQ TEST.GOKRB5 krbtgt/TEST.GOKRB5",
+		"AS_REQ TEST.GOKRB5 krbtgt/TEST.GOKRB5 armored",
+		"AS_REQ TEST.GOKRB5 krbtgt/TEST.GOKRB5 armored",
+	}, kdc.requests(), "Requests to the KDC not as expected")
+	if assert.Len(t, p.challenges, 1, "Prompter should have been called once with the KDC's challenge") {
+		assert.Equal(t, nonce, p.challenges[0].Nonce, "Challenge nonce not as expected")
+		assert.Equal(t, "gokrb5 test", p.challenges[0].Service, "Challenge service not as expected")
+	}
+	assert.Equal(t, nonce, encNonce, "Encrypted nonce in the OTP request not as expected")
+	assert.Equal(t, []byte("testtoken"), otpReq.OTPTokenID, "OTP request token ID not as expected")
+	assert.Equal(t, "gokrb5", otpReq.OTPVendor, "OTP request vendor not as expected")
+	assert.True(t, sentCookie, "FAST cookie from the KDC should be returned with the OTP request")
+	if assert.Len(t, armorKeys, 2, "Both AS_REQs should be armored") {
+		assert.Equal(t, armorKeys[0], armorKeys[1], "The OTP round trip should be armored with the same armor key")
+	}
+	tgt, key, err := cl.GetTGT("TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error getting TGT: %v", err)
+	}
+	skey, ok := kdc.sessionKey(tgt)
+	assert.True(t, ok, "TGT should have been issued by the KDC")
+	assert.Equal(t, skey, key, "TGT session key from the armor key encrypted reply not as expected")
+}
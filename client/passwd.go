@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"net"
 
@@ -22,11 +23,17 @@ const (
 
 // ChangePasswd changes the password of the client to the value provided.
 func (cl *Client) ChangePasswd(newPasswd string) (bool, error) {
+	return cl.ChangePasswdContext(context.Background(), newPasswd)
+}
+
+// ChangePasswdContext changes the password of the client to the value provided. The context's cancellation and
+// deadline apply to the exchanges with the KDC and kpasswd server.
+func (cl *Client) ChangePasswdContext(ctx context.Context, newPasswd string) (bool, error) {
 	ASReq, err := messages.NewASReqForChgPasswd(cl.Credentials.Realm, cl.Config, cl.Credentials.CName)
 	if err != nil {
 		return false, err
 	}
-	ASRep, err := cl.ASExchange(cl.Credentials.Realm, ASReq, 0)
+	ASRep, err := cl.ASExchangeContext(ctx, cl.Credentials.Realm, ASReq, 0)
 	if err != nil {
 		return false, err
 	}
@@ -35,7 +42,7 @@ func (cl *Client) ChangePasswd(newPasswd string) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	r, err := cl.sendToKPasswd(msg)
+	r, err := cl.sendToKPasswd(ctx, msg)
 	if err != nil {
 		return false, err
 	}
@@ -49,7 +56,7 @@ func (cl *Client) ChangePasswd(newPasswd string) (bool, error) {
 	return true, nil
 }
 
-func (cl *Client) sendToKPasswd(msg kadmin.Request) (r kadmin.Reply, err error) {
+func (cl *Client) sendToKPasswd(ctx context.Context, msg kadmin.Request) (r kadmin.Reply, err error) {
 	_, kps, err := cl.Config.GetKpasswdServers(cl.Credentials.Realm, true)
 	if err != nil {
 		return
@@ -60,35 +67,35 @@ func (cl *Client) sendToKPasswd(msg kadmin.Request) (r kadmin.Reply, err error)
 		return
 	}
 	if len(b) <= cl.Config.LibDefaults.UDPPreferenceLimit {
-		return cl.sendKPasswdUDP(b, addr)
+		return cl.sendKPasswdUDP(ctx, b, addr)
 	}
-	return cl.sendKPasswdTCP(b, addr)
+	return cl.sendKPasswdTCP(ctx, b, addr)
 }
 
-func (cl *Client) sendKPasswdTCP(b []byte, kadmindAddr string) (r kadmin.Reply, err error) {
-	tcpAddr, err := net.ResolveTCPAddr("tcp", kadmindAddr)
+func (cl *Client) sendKPasswdTCP(ctx context.Context, b []byte, kadmindAddr string) (r kadmin.Reply, err error) {
+	d := net.Dialer{Timeout: kdcTimeout}
+	c, err := d.DialContext(ctx, "tcp", kadmindAddr)
 	if err != nil {
 		return
 	}
-	conn, err := net.DialTCP("tcp", nil, tcpAddr)
+	rb, err := sendTCP(ctx, c.(*net.TCPConn), b)
 	if err != nil {
 		return
 	}
-	rb, err := cl.sendTCP(conn, b)
 	err = r.Unmarshal(rb)
 	return
 }
 
-func (cl *Client) sendKPasswdUDP(b []byte, kadmindAddr string) (r kadmin.Reply, err error) {
-	udpAddr, err := net.ResolveUDPAddr("udp", kadmindAddr)
+func (cl *Client) sendKPasswdUDP(ctx context.Context, b []byte, kadmindAddr string) (r kadmin.Reply, err error) {
+	d := net.Dialer{Timeout: kdcTimeout}
+	c, err := d.DialContext(ctx, "udp", kadmindAddr)
 	if err != nil {
 		return
 	}
-	conn, err := net.DialUDP("udp", nil, udpAddr)
+	rb, err := sendUDP(ctx, c.(*net.UDPConn), b)
 	if err != nil {
 		return
 	}
-	rb, err := cl.sendUDP(conn, b)
 	err = r.Unmarshal(rb)
 	return
 }
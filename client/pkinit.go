@@ -0,0 +1,155 @@
+package client
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"crypto/x509"
+
+	"gopkg.in/jcmturner/gokrb5.v5/config"
+	"gopkg.in/jcmturner/gokrb5.v5/credentials"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/patype"
+	"gopkg.in/jcmturner/gokrb5.v5/krberror"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+	"gopkg.in/jcmturner/gokrb5.v5/pkinit"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+// Reference: https://tools.ietf.org/html/rfc4556
+
+// pkinitState holds the ephemeral key agreement of a single PKINIT AS exchange.
+type pkinitState struct {
+	keyAgreement pkinit.KeyAgreement
+}
+
+// NewClientWithCertificate creates a new client that authenticates with PKINIT using the X.509 certificate and private key.
+// The KDC's certificate is verified against the trust pool provided. If the pool is nil the system roots are used.
+// Set the realm to empty string to use the default realm from config.
+func NewClientWithCertificate(username, realm string, cert *x509.Certificate, key crypto.Signer, trust *x509.CertPool) Client {
+	creds := credentials.NewCredentials(username, realm)
+	return Client{
+		Credentials: creds.WithCertificate(cert, key),
+		Config:      config.NewConfig(),
+		GoKrb5Conf:  &Config{PKINITTrustPool: trust},
+		sessions: &sessions{
+			Entries: make(map[string]*session),
+		},
+		Cache:  NewCache(),
+		health: newKDCHealth(),
+	}
+}
+
+// NewAnonymousClient creates a new client that obtains anonymous tickets from the realm's KDC using anonymous PKINIT:
+// https://tools.ietf.org/html/rfc8062
+// The KDC's certificate is verified against the trust pool provided. If the pool is nil the system roots are used.
+// Set the realm to empty string to use the default realm from config.
+func NewAnonymousClient(realm string, trust *x509.CertPool) Client {
+	creds := credentials.NewCredentialsFromPrincipal(types.NewAnonymousPrincipalName(), realm)
+	return Client{
+		Credentials: &creds,
+		Config:      config.NewConfig(),
+		GoKrb5Conf:  &Config{PKINITTrustPool: trust},
+		sessions: &sessions{
+			Entries: make(map[string]*session),
+		},
+		Cache:  NewCache(),
+		health: newKDCHealth(),
+	}
+}
+
+// anonymous indicates if the client obtains anonymous tickets.
+func (cl *Client) anonymous() bool {
+	return cl.Credentials.CName.IsAnonymous()
+}
+
+// newPKINITState generates the ephemeral key agreement for a PKINIT AS exchange.
+func (cl *Client) newPKINITState() (*pkinitState, error) {
+	var ka pkinit.KeyAgreement
+	var err error
+	if cl.GoKrb5Conf.PKINITUseECDH {
+		ka, err = pkinit.NewECDHKeyAgreement(elliptic.P256())
+	} else {
+		ka, err = pkinit.NewModPKeyAgreement(pkinit.MODPGroup14)
+	}
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncryptingError, "error generating PKINIT key agreement")
+	}
+	return &pkinitState{keyAgreement: ka}, nil
+}
+
+// paPKASReq generates the PA_PK_AS_REQ pre-authentication data for the AS_REQ signed with the client's certificate.
+// The AuthPack is left unsigned for an anonymous client.
+func (p *pkinitState) paPKASReq(creds *credentials.Credentials, ASReq messages.ASReq) (types.PAData, error) {
+	var pa types.PAData
+	b, err := ASReq.ReqBody.Marshal()
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.EncodingError, "error marshaling AS_REQ body for PKINIT checksum")
+	}
+	spki, err := p.keyAgreement.PublicKeyInfo()
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.EncodingError, "error getting PKINIT client public value")
+	}
+	var req pkinit.PAPKASReq
+	a := pkinit.NewAuthPack(b, ASReq.ReqBody.Nonce, spki)
+	if creds.CName.IsAnonymous() {
+		req, err = pkinit.NewAnonymousPAPKASReq(a)
+	} else {
+		req, err = pkinit.NewPAPKASReq(a, creds.Certificate, creds.PrivateKey)
+	}
+	if err != nil {
+		return pa, err
+	}
+	rb, err := req.Marshal()
+	if err != nil {
+		return pa, err
+	}
+	pa = types.PAData{
+		PADataType:  patype.PA_PK_AS_REQ,
+		PADataValue: rb,
+	}
+	return pa, nil
+}
+
+// replyKey verifies the KDC's PA_PK_AS_REP in the AS_REP and returns the key to decrypt the AS_REP's encrypted part. The
+// KDC's certificate must be issued to the TGS of the realm provided, or to one of the realm's configured KDC host names,
+// and have the extended key usage configured for the realm.
+func (p *pkinitState) replyKey(ASRep messages.ASRep, nonce int, realm string, trust *x509.CertPool, c *config.Config) (types.EncryptionKey, error) {
+	var key types.EncryptionKey
+	var rep pkinit.PAPKASRep
+	var found bool
+	for _, pa := range ASRep.PAData {
+		if pa.PADataType == patype.PA_PK_AS_REP {
+			err := rep.Unmarshal(pa.PADataValue)
+			if err != nil {
+				return key, err
+			}
+			found = true
+			break
+		}
+	}
+	if !found {
+		return key, krberror.NewErrorf(krberror.KRBMsgError, "AS_REP does not contain a PKINIT reply")
+	}
+	if len(rep.EncKeyPack) > 0 {
+		return key, krberror.NewErrorf(krberror.KRBMsgError, "PKINIT public key encryption reply not supported")
+	}
+	checks := pkinit.KDCCertificateChecks{
+		EKUChecking:  c.PKINITEKUChecking(realm),
+		KDCHostnames: c.PKINITKDCHostnames(realm),
+	}
+	kdcKey, err := rep.DHInfo.KDCDHKeyInfo(x509.VerifyOptions{Roots: trust}, realm, checks)
+	if err != nil {
+		return key, err
+	}
+	if kdcKey.Nonce != nonce {
+		return key, krberror.NewErrorf(krberror.KRBMsgError, "possible replay attack, nonce in KDC DH key info does not match that in request")
+	}
+	z, err := p.keyAgreement.SharedSecret(kdcKey.SubjectPublicKey.Bytes)
+	if err != nil {
+		return key, krberror.Errorf(err, krberror.DecryptingError, "error calculating PKINIT shared secret")
+	}
+	x, err := rep.DHInfo.DHSharedSecretInput(z, nil)
+	if err != nil {
+		return key, krberror.Errorf(err, krberror.KRBMsgError, "invalid PKINIT reply")
+	}
+	return pkinit.ReplyKey(x, ASRep.EncPart.EType)
+}
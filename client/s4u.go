@@ -0,0 +1,203 @@
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"time"
+
+	"gopkg.in/jcmturner/gokrb5.v5/crypto"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/flags"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
+	"gopkg.in/jcmturner/gokrb5.v5/krberror"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+	"gopkg.in/jcmturner/gokrb5.v5/pac"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+// Reference: https://msdn.microsoft.com/en-us/library/cc246071.aspx
+
+// S4U2Self performs a service for user to self (protocol transition) TGS exchange to obtain a service ticket to the
+// client's own principal on behalf of the user provided. The client must be a service principal whose key is available from
+// its keytab or password so that the ticket can be decrypted.
+//
+// The ticket, with its encrypted part decrypted, its session key and the processed PAC are returned. If the KDC did not
+// include a PAC in the ticket an empty PAC is returned.
+func (cl *Client) S4U2Self(user types.PrincipalName, userRealm string) (messages.Ticket, types.EncryptionKey, pac.PACType, error) {
+	return cl.S4U2SelfContext(context.Background(), user, userRealm)
+}
+
+// S4U2SelfContext performs a service for user to self TGS exchange within the context provided.
+func (cl *Client) S4U2SelfContext(ctx context.Context, user types.PrincipalName, userRealm string) (messages.Ticket, types.EncryptionKey, pac.PACType, error) {
+	return cl.s4u2Self(ctx, user, userRealm, nil)
+}
+
+// S4U2SelfWithCertificate performs a service for user to self TGS exchange identifying the user by their X.509
+// certificate rather than principal name. The KDC maps the certificate to the user principal.
+func (cl *Client) S4U2SelfWithCertificate(cert *x509.Certificate, userRealm string) (messages.Ticket, types.EncryptionKey, pac.PACType, error) {
+	return cl.S4U2SelfWithCertificateContext(context.Background(), cert, userRealm)
+}
+
+// S4U2SelfWithCertificateContext performs a service for user to self TGS exchange, identifying the user by their X.509
+// certificate, within the context provided.
+func (cl *Client) S4U2SelfWithCertificateContext(ctx context.Context, cert *x509.Certificate, userRealm string) (messages.Ticket, types.EncryptionKey, pac.PACType, error) {
+	return cl.s4u2Self(ctx, types.PrincipalName{}, userRealm, cert)
+}
+
+func (cl *Client) s4u2Self(ctx context.Context, user types.PrincipalName, userRealm string, cert *x509.Certificate) (messages.Ticket, types.EncryptionKey, pac.PACType, error) {
+	var tkt messages.Ticket
+	var skey types.EncryptionKey
+	var p pac.PACType
+	if userRealm == "" {
+		userRealm = cl.Credentials.Realm
+	}
+	sess, err := cl.validSession(ctx, cl.Credentials.Realm)
+	if err != nil {
+		return tkt, skey, p, err
+	}
+	tgsReq, err := messages.NewTGSReq(cl.Credentials.CName, sess.Realm, cl.Config, sess.TGT, sess.SessionKey, cl.Credentials.CName, false)
+	if err != nil {
+		return tkt, skey, p, krberror.Errorf(err, krberror.KRBMsgError, "S4U2Self Error: failed to generate a new TGS_REQ")
+	}
+	// The ticket must be forwardable if it is to be used as evidence in a S4U2Proxy request
+	types.SetFlag(&tgsReq.ReqBody.KDCOptions, flags.Forwardable)
+	subKey, err := newSubKey(sess.SessionKey.KeyType)
+	if err != nil {
+		return tkt, skey, p, krberror.Errorf(err, krberror.EncryptingError, "S4U2Self Error: failed to generate authenticator sub-key")
+	}
+	err = tgsReq.SetPAData(cl.Credentials.CName, sess.TGT, sess.SessionKey, subKey)
+	if err != nil {
+		return tkt, skey, p, krberror.Errorf(err, krberror.KRBMsgError, "S4U2Self Error: failed to set TGS_REQ PAData")
+	}
+	var certBytes []byte
+	if cert != nil {
+		certBytes = cert.Raw
+	} else {
+		pa, err := messages.NewPAForUser(user, userRealm, sess.SessionKey)
+		if err != nil {
+			return tkt, skey, p, krberror.Errorf(err, krberror.KRBMsgError, "S4U2Self Error: failed to create PA-FOR-USER")
+		}
+		tgsReq.PAData = append(tgsReq.PAData, pa)
+	}
+	pa, err := messages.NewPAS4UX509User(tgsReq.ReqBody.Nonce, user, userRealm, certBytes, subKey)
+	if err != nil {
+		return tkt, skey, p, krberror.Errorf(err, krberror.KRBMsgError, "S4U2Self Error: failed to create PA-S4U-X509-USER")
+	}
+	tgsReq.PAData = append(tgsReq.PAData, pa)
+	tgsRep, err := cl.sendTGSReq(ctx, &tgsReq, sess.Realm, sess.TGT, sess.SessionKey, subKey)
+	if err != nil {
+		return tkt, skey, p, err
+	}
+	// The client name in the reply is that of the user rather than the service
+	vReq := tgsReq
+	if cert != nil {
+		vReq.ReqBody.CName = tgsRep.CName
+	} else {
+		vReq.ReqBody.CName = user
+	}
+	if ok, err := tgsRep.IsValid(cl.Config, vReq); !ok {
+		return tkt, skey, p, krberror.Errorf(err, krberror.KRBMsgError, "S4U2Self Error: TGS_REP is not valid")
+	}
+	tkt = tgsRep.Ticket
+	key, err := cl.serviceKey(tkt)
+	if err != nil {
+		return tkt, skey, p, krberror.Errorf(err, krberror.DecryptingError, "S4U2Self Error: could not get the client's key to decrypt the ticket")
+	}
+	err = tkt.DecryptEncPartWithKey(key)
+	if err != nil {
+		return tkt, skey, p, krberror.Errorf(err, krberror.DecryptingError, "S4U2Self Error: failed to decrypt the ticket")
+	}
+	_, p, err = tkt.GetPACTypeWithKey(key)
+	if err != nil {
+		return tkt, skey, p, krberror.Errorf(err, krberror.KRBMsgError, "S4U2Self Error: failed to process the ticket's PAC")
+	}
+	return tkt, tgsRep.DecryptedEncPart.Key, p, nil
+}
+
+// S4U2Proxy performs a service for user to proxy (constrained delegation) TGS exchange to obtain a service ticket to the
+// SPN specified on behalf of the user to whom the evidence ticket was issued. The evidence ticket is a ticket to this
+// client, from S4U2Self or from an AP_REQ, and must be forwardable unless resource-based constrained delegation applies.
+// SPN format: <SERVICE>/<FQDN> Eg. MSSQLSvc/sql.example.com
+//
+// The delegated ticket is not added to the client's cache as its client is the user rather than this client.
+func (cl *Client) S4U2Proxy(evidence messages.Ticket, spn string) (messages.Ticket, types.EncryptionKey, error) {
+	return cl.S4U2ProxyContext(context.Background(), evidence, spn)
+}
+
+// S4U2ProxyContext performs a service for user to proxy TGS exchange within the context provided.
+func (cl *Client) S4U2ProxyContext(ctx context.Context, evidence messages.Ticket, spn string) (messages.Ticket, types.EncryptionKey, error) {
+	var tkt messages.Ticket
+	var skey types.EncryptionKey
+	sess, err := cl.validSession(ctx, cl.Credentials.Realm)
+	if err != nil {
+		return tkt, skey, err
+	}
+	princ := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, spn)
+	tgsReq, err := messages.NewTGSReq(cl.Credentials.CName, sess.Realm, cl.Config, sess.TGT, sess.SessionKey, princ, false)
+	if err != nil {
+		return tkt, skey, krberror.Errorf(err, krberror.KRBMsgError, "S4U2Proxy Error: failed to generate a new TGS_REQ")
+	}
+	types.SetFlag(&tgsReq.ReqBody.KDCOptions, flags.Forwardable)
+	types.SetFlag(&tgsReq.ReqBody.KDCOptions, flags.CNameInAddlTkt)
+	tgsReq.ReqBody.AdditionalTickets = []messages.Ticket{evidence}
+	// The PA_TGS_REQ must be set after the body is complete as the authenticator checksums the body
+	subKey, err := newSubKey(sess.SessionKey.KeyType)
+	if err != nil {
+		return tkt, skey, krberror.Errorf(err, krberror.EncryptingError, "S4U2Proxy Error: failed to generate authenticator sub-key")
+	}
+	err = tgsReq.SetPAData(cl.Credentials.CName, sess.TGT, sess.SessionKey, subKey)
+	if err != nil {
+		return tkt, skey, krberror.Errorf(err, krberror.KRBMsgError, "S4U2Proxy Error: failed to set TGS_REQ PAData")
+	}
+	pa, err := messages.NewPAPACOptions(messages.PACOptionResourceBasedConstrainedDelegation)
+	if err != nil {
+		return tkt, skey, krberror.Errorf(err, krberror.KRBMsgError, "S4U2Proxy Error: failed to create PA-PAC-OPTIONS")
+	}
+	tgsReq.PAData = append(tgsReq.PAData, pa)
+	tgsRep, err := cl.sendTGSReq(ctx, &tgsReq, sess.Realm, sess.TGT, sess.SessionKey, subKey)
+	if err != nil {
+		return tkt, skey, err
+	}
+	// The client name in the reply is that of the user in the evidence ticket
+	vReq := tgsReq
+	if len(evidence.DecryptedEncPart.CName.NameString) > 0 {
+		vReq.ReqBody.CName = evidence.DecryptedEncPart.CName
+	} else {
+		vReq.ReqBody.CName = tgsRep.CName
+	}
+	if ok, err := tgsRep.IsValid(cl.Config, vReq); !ok {
+		return tkt, skey, krberror.Errorf(err, krberror.KRBMsgError, "S4U2Proxy Error: TGS_REP is not valid")
+	}
+	return tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, nil
+}
+
+// serviceKey returns the client's long term key, as a service, used to encrypt the ticket provided.
+func (cl *Client) serviceKey(tkt messages.Ticket) (types.EncryptionKey, error) {
+	if cl.Credentials.HasKeytab() {
+		return cl.Credentials.Keytab.GetEncryptionKey(cl.Credentials.CName.NameString, cl.Credentials.Realm, tkt.EncPart.KVNO, tkt.EncPart.EType)
+	}
+	et, err := crypto.GetEtype(tkt.EncPart.EType)
+	if err != nil {
+		return types.EncryptionKey{}, err
+	}
+	return cl.Key(et, messages.KRBError{})
+}
+
+// validSession returns the session for the realm provided ensuring its TGT has not expired.
+func (cl *Client) validSession(ctx context.Context, realm string) (*session, error) {
+	sess, err := cl.getSessionFromRealm(ctx, realm)
+	if err != nil {
+		return sess, err
+	}
+	if time.Now().UTC().After(sess.EndTime) {
+		_, err := cl.updateSession(ctx, sess)
+		if err != nil {
+			return sess, err
+		}
+		// Get the session again as it could have been replaced by the update
+		sess, err = cl.getSessionFromRealm(ctx, realm)
+		if err != nil {
+			return sess, err
+		}
+	}
+	return sess, nil
+}
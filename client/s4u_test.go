@@ -0,0 +1,264 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/config"
+	"gopkg.in/jcmturner/gokrb5.v5/crypto"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/errorcode"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/flags"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/keyusage"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/patype"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+// testS4U2SelfReq records what the in-memory KDC found in a S4U2Self TGS_REQ.
+type testS4U2SelfReq struct {
+	forUser     *messages.PAForUser
+	x509User    *messages.PAS4UX509User
+	forwardable bool
+}
+
+// testS4U2SelfKDC returns an in-memory KDC that processes S4U2Self TGS_REQs as a KDC would, verifying the checksums of
+// the PA-FOR-USER and PA-S4U-X509-USER and issuing a ticket to the user, mapped from the certificate's common name if
+// there is one, encrypted with the service's long-term key.
+func testS4U2SelfKDC(req *testS4U2SelfReq) *testMemKDC {
+	kdc := newTestMemKDC("TEST.GOKRB5", "passwordvalue")
+	kdc.tgs = func(TGSReq messages.TGSReq, sessionKey, subKey types.EncryptionKey, iss *testIssue) error {
+		req.forwardable = types.IsFlagSet(&TGSReq.ReqBody.KDCOptions, flags.Forwardable)
+		for _, pa := range TGSReq.PAData {
+			switch pa.PADataType {
+			case patype.PA_FOR_USER:
+				var p messages.PAForUser
+				if err := p.Unmarshal(pa.PADataValue); err != nil {
+					return err
+				}
+				if !p.VerifyChecksum(sessionKey) {
+					return errors.New("PA-FOR-USER checksum not valid")
+				}
+				req.forUser = &p
+				iss.cname = p.UserName
+			case patype.PA_FOR_X509_USER:
+				var p messages.PAS4UX509User
+				if err := p.Unmarshal(pa.PADataValue); err != nil {
+					return err
+				}
+				b, err := asn1.Marshal(p.UserID)
+				if err != nil {
+					return err
+				}
+				et, err := crypto.GetEtype(subKey.KeyType)
+				if err != nil {
+					return err
+				}
+				if !et.VerifyChecksum(subKey.KeyValue, b, p.Checksum.Checksum, keyusage.PA_S4U_X509_USER_REQUEST) {
+					return errors.New("PA-S4U-X509-USER checksum not valid")
+				}
+				if p.UserID.Nonce != TGSReq.ReqBody.Nonce {
+					return errors.New("PA-S4U-X509-USER nonce does not match the TGS_REQ")
+				}
+				req.x509User = &p
+				if len(p.UserID.SubjectCertificate) > 0 {
+					cert, err := x509.ParseCertificate(p.UserID.SubjectCertificate)
+					if err != nil {
+						return err
+					}
+					iss.cname = types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, cert.Subject.CommonName)
+				}
+			}
+		}
+		key, err := kdc.serviceKey(TGSReq.ReqBody.SName, sessionKey.KeyType)
+		if err != nil {
+			return err
+		}
+		iss.ticketKey = key
+		types.SetFlag(&iss.flags, flags.Forwardable)
+		return nil
+	}
+	return kdc
+}
+
+func TestClient_S4U2Self(t *testing.T) {
+	t.Parallel()
+	c, err := config.NewConfigFromString(testMemKDCConf)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	var req testS4U2SelfReq
+	kdc := testS4U2SelfKDC(&req)
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue")
+	cl.WithConfig(c).WithTransport(kdc)
+	defer cl.Destroy()
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("Error on login: %v", err)
+	}
+
+	user := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser2")
+	tkt, key, p, err := cl.S4U2Self(user, "")
+	if err != nil {
+		t.Fatalf("Error performing S4U2Self: %v", err)
+	}
+	if assert.NotNil(t, req.forUser, "TGS_REQ should contain a PA-FOR-USER") {
+		assert.Equal(t, user, req.forUser.UserName, "PA-FOR-USER user name not as expected")
+		assert.Equal(t, "TEST.GOKRB5", req.forUser.UserRealm, "PA-FOR-USER user realm not as expected")
+		assert.Equal(t, messages.S4UAuthPackage, req.forUser.AuthPackage, "PA-FOR-USER auth package not as expected")
+	}
+	if assert.NotNil(t, req.x509User, "TGS_REQ should contain a PA-S4U-X509-USER") {
+		assert.Equal(t, user, req.x509User.UserID.CName, "PA-S4U-X509-USER user name not as expected")
+		assert.Empty(t, req.x509User.UserID.SubjectCertificate, "PA-S4U-X509-USER should not contain a certificate")
+	}
+	assert.True(t, req.forwardable, "S4U2Self ticket should be requested forwardable")
+	assert.Equal(t, "testuser1", tkt.SName.GetPrincipalNameString(), "Ticket should be to the client itself")
+	assert.Equal(t, user, tkt.DecryptedEncPart.CName, "Ticket should be issued to the user")
+	assert.Equal(t, "TEST.GOKRB5", tkt.DecryptedEncPart.CRealm, "Ticket client realm not as expected")
+	assert.True(t, types.IsFlagSet(&tkt.DecryptedEncPart.Flags, flags.Forwardable), "Ticket should be forwardable")
+	assert.Equal(t, tkt.DecryptedEncPart.Key, key, "Session key not as expected")
+	assert.Equal(t, uint32(0), p.CBuffers, "Ticket without a PAC should return an empty PAC")
+	reqs := kdc.requests()
+	assert.Equal(t, "TGS_REQ TEST.GOKRB5 testuser1", reqs[len(reqs)-1], "S4U2Self request not as expected")
+
+	// An error from the KDC is returned
+	kdc.tgs = func(TGSReq messages.TGSReq, sessionKey, subKey types.EncryptionKey, iss *testIssue) error {
+		return messages.NewKRBError(TGSReq.ReqBody.SName, "TEST.GOKRB5", errorcode.KDC_ERR_BADOPTION, "S4U2Self not permitted")
+	}
+	_, _, _, err = cl.S4U2Self(user, "")
+	assert.Error(t, err, "S4U2Self should fail when the KDC rejects it")
+}
+
+func TestClient_S4U2SelfWithCertificate(t *testing.T) {
+	t.Parallel()
+	c, err := config.NewConfigFromString(testMemKDCConf)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	var req testS4U2SelfReq
+	kdc := testS4U2SelfKDC(&req)
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue")
+	cl.WithConfig(c).WithTransport(kdc)
+	defer cl.Destroy()
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("Error on login: %v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "testuser2"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("Error creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatalf("Error parsing certificate: %v", err)
+	}
+
+	tkt, _, _, err := cl.S4U2SelfWithCertificate(cert, "")
+	if err != nil {
+		t.Fatalf("Error performing S4U2Self with certificate: %v", err)
+	}
+	assert.Nil(t, req.forUser, "TGS_REQ should not contain a PA-FOR-USER when identifying the user by certificate")
+	if assert.NotNil(t, req.x509User, "TGS_REQ should contain a PA-S4U-X509-USER") {
+		assert.Equal(t, cert.Raw, req.x509User.UserID.SubjectCertificate, "PA-S4U-X509-USER certificate not as expected")
+		assert.Equal(t, "TEST.GOKRB5", req.x509User.UserID.CRealm, "PA-S4U-X509-USER user realm not as expected")
+	}
+	assert.Equal(t, "testuser2", tkt.DecryptedEncPart.CName.GetPrincipalNameString(), "Ticket should be issued to the user the certificate maps to")
+}
+
+func TestClient_S4U2Proxy(t *testing.T) {
+	t.Parallel()
+	c, err := config.NewConfigFromString(testMemKDCConf)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	var sreq testS4U2SelfReq
+	kdc := testS4U2SelfKDC(&sreq)
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue")
+	cl.WithConfig(c).WithTransport(kdc)
+	defer cl.Destroy()
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("Error on login: %v", err)
+	}
+	user := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser2")
+	evidence, _, _, err := cl.S4U2Self(user, "")
+	if err != nil {
+		t.Fatalf("Error performing S4U2Self: %v", err)
+	}
+
+	// The KDC checks the evidence ticket, which it can decrypt with the service's key, and issues the ticket to its client
+	var addl []messages.Ticket
+	var cnameInAddlTkt, rbcd bool
+	kdc.tgs = func(TGSReq messages.TGSReq, sessionKey, subKey types.EncryptionKey, iss *testIssue) error {
+		addl = TGSReq.ReqBody.AdditionalTickets
+		cnameInAddlTkt = types.IsFlagSet(&TGSReq.ReqBody.KDCOptions, flags.CNameInAddlTkt)
+		for _, pa := range TGSReq.PAData {
+			if pa.PADataType == patype.PA_PAC_OPTIONS {
+				var p messages.PAPACOptions
+				if err := p.Unmarshal(pa.PADataValue); err != nil {
+					return err
+				}
+				rbcd = types.IsFlagSet(&p.KerberosFlags, messages.PACOptionResourceBasedConstrainedDelegation)
+			}
+		}
+		if len(addl) != 1 {
+			return errors.New("TGS_REQ should have one additional ticket")
+		}
+		et := addl[0]
+		key, err := kdc.serviceKey(et.SName, et.EncPart.EType)
+		if err != nil {
+			return err
+		}
+		if err := et.DecryptEncPartWithKey(key); err != nil {
+			return err
+		}
+		iss.cname = et.DecryptedEncPart.CName
+		return nil
+	}
+	spn := "HTTP/host.test.gokrb5"
+	tkt, key, err := cl.S4U2Proxy(evidence, spn)
+	if err != nil {
+		t.Fatalf("Error performing S4U2Proxy: %v", err)
+	}
+	if assert.Len(t, addl, 1, "TGS_REQ should have the evidence as its additional ticket") {
+		assert.Equal(t, evidence.EncPart.Cipher, addl[0].EncPart.Cipher, "Additional ticket should be the evidence ticket")
+	}
+	assert.True(t, cnameInAddlTkt, "TGS_REQ should have the cname-in-addl-tkt option set")
+	assert.True(t, rbcd, "TGS_REQ should have the PA-PAC-OPTIONS resource-based constrained delegation flag set")
+	assert.Equal(t, spn, tkt.SName.GetPrincipalNameString(), "Ticket service name not as expected")
+	assert.NotEmpty(t, key.KeyValue, "Ticket session key is empty")
+	reqs := kdc.requests()
+	assert.Equal(t, "TGS_REQ TEST.GOKRB5 "+spn, reqs[len(reqs)-1], "S4U2Proxy request not as expected")
+
+	// The delegated ticket is not cached as its client is the user
+	_, ok := cl.Cache.getEntry(spn)
+	assert.False(t, ok, "Delegated ticket should not be cached")
+
+	// A reply that is not for the user of the evidence ticket is rejected
+	kdc.tgs = func(TGSReq messages.TGSReq, sessionKey, subKey types.EncryptionKey, iss *testIssue) error {
+		iss.cname = types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser3")
+		return nil
+	}
+	_, _, err = cl.S4U2Proxy(evidence, spn)
+	assert.Error(t, err, "S4U2Proxy reply for another user should not be accepted")
+}
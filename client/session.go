@@ -1,11 +1,14 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/jcmturner/gofork/encoding/asn1"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/patype"
 	"gopkg.in/jcmturner/gokrb5.v5/krberror"
 	"gopkg.in/jcmturner/gokrb5.v5/messages"
 	"gopkg.in/jcmturner/gokrb5.v5/types"
@@ -32,22 +35,28 @@ type session struct {
 	AuthTime             time.Time
 	EndTime              time.Time
 	RenewTill            time.Time
+	Flags                asn1.BitString
 	TGT                  messages.Ticket
 	SessionKey           types.EncryptionKey
 	SessionKeyExpiration time.Time
+	fast                 bool
 	cancel               chan bool
 	mux                  sync.RWMutex
 }
 
+// update the session with the TGT and encrypted part of a KDC reply. Support for FAST is kept for the life of the session
+// as TGS_REPs, such as those renewing the TGT, do not indicate the KDC's support for FAST.
 func (s *session) update(tkt messages.Ticket, dep messages.EncKDCRepPart) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 	s.AuthTime = dep.AuthTime
 	s.EndTime = dep.EndTime
 	s.RenewTill = dep.RenewTill
+	s.Flags = dep.Flags
 	s.TGT = tkt
 	s.SessionKey = dep.Key
 	s.SessionKeyExpiration = dep.KeyExpiration
+	s.fast = s.fast || dep.EncPAData.Contains(patype.PA_FX_FAST)
 }
 
 func (s *session) destroy() {
@@ -62,6 +71,12 @@ func (s *session) destroy() {
 // AddSession adds a session for a realm with a TGT to the client's session cache.
 // A goroutine is started to automatically renew the TGT before expiry.
 func (cl *Client) AddSession(tkt messages.Ticket, dep messages.EncKDCRepPart) {
+	cl.addSession(tkt, dep, false)
+}
+
+// addSession adds a session to the client's session cache. The session is marked as supporting FAST if fast is true or the
+// KDC indicated its support for FAST in the encrypted pre-authentication data of its reply.
+func (cl *Client) addSession(tkt messages.Ticket, dep messages.EncKDCRepPart, fast bool) {
 	cl.sessions.mux.Lock()
 	defer cl.sessions.mux.Unlock()
 	s := &session{
@@ -69,9 +84,11 @@ func (cl *Client) AddSession(tkt messages.Ticket, dep messages.EncKDCRepPart) {
 		AuthTime:             dep.AuthTime,
 		EndTime:              dep.EndTime,
 		RenewTill:            dep.RenewTill,
+		Flags:                dep.Flags,
 		TGT:                  tkt,
 		SessionKey:           dep.Key,
 		SessionKeyExpiration: dep.KeyExpiration,
+		fast:                 fast || dep.EncPAData.Contains(patype.PA_FX_FAST),
 		cancel:               make(chan bool, 1),
 	}
 	// if a session already exists for this, cancel its auto renew.
@@ -96,7 +113,7 @@ func (cl *Client) enableAutoSessionRenewal(s *session) {
 			timer = time.NewTimer(w)
 			select {
 			case <-timer.C:
-				renewal, err := cl.updateSession(s)
+				renewal, err := cl.updateSession(context.Background(), s)
 				if !renewal && err == nil {
 					// end this goroutine as there will have been a new login and new auto renewal goroutine created.
 					return
@@ -111,12 +128,12 @@ func (cl *Client) enableAutoSessionRenewal(s *session) {
 }
 
 // RenewTGT renews the client's TGT session.
-func (cl *Client) renewTGT(s *session) error {
+func (cl *Client) renewTGT(ctx context.Context, s *session) error {
 	spn := types.PrincipalName{
 		NameType:   nametype.KRB_NT_SRV_INST,
 		NameString: []string{"krbtgt", s.Realm},
 	}
-	_, tgsRep, err := cl.TGSExchange(spn, s.TGT.Realm, s.TGT, s.SessionKey, true, 0)
+	_, tgsRep, err := cl.TGSExchangeContext(ctx, spn, s.TGT.Realm, s.TGT, s.SessionKey, true, 0)
 	if err != nil {
 		return krberror.Errorf(err, krberror.KRBMsgError, "error renewing TGT")
 	}
@@ -126,47 +143,87 @@ func (cl *Client) renewTGT(s *session) error {
 
 // updateSession updates either through renewal or creating a new login.
 // The boolean indicates if the update was a renewal.
-func (cl *Client) updateSession(s *session) (bool, error) {
+func (cl *Client) updateSession(ctx context.Context, s *session) (bool, error) {
 	if time.Now().UTC().Before(s.RenewTill) {
-		err := cl.renewTGT(s)
+		err := cl.renewTGT(ctx, s)
 		return true, err
 	}
-	err := cl.Login()
+	err := cl.LoginContext(ctx)
 	return false, err
 }
 
-func (cl *Client) getSessionFromRemoteRealm(realm string) (*session, error) {
+// getSessionFromRemoteRealm obtains a cross realm TGT for the realm provided by following the authentication path from
+// the client's realm, as defined in the [capaths] section of the configuration or otherwise the realm hierarchy.
+// The path is followed one hop at a time, using the TGT of each realm to obtain the TGT of the next. A session is added
+// for each cross realm TGT obtained.
+func (cl *Client) getSessionFromRemoteRealm(ctx context.Context, realm string) (*session, error) {
 	cl.sessions.mux.RLock()
 	sess, ok := cl.sessions.Entries[cl.Credentials.Realm]
 	cl.sessions.mux.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("client does not have a session for realm %s, login first", cl.Credentials.Realm)
 	}
+	for _, r := range cl.Config.RealmPath(cl.Credentials.Realm, realm) {
+		s, err := cl.crossRealmSession(ctx, sess, r)
+		if err != nil {
+			return nil, err
+		}
+		sess = s
+	}
+	return sess, nil
+}
 
+// crossRealmSession returns the session for the realm provided, obtaining a cross realm TGT for it using the session
+// provided if there is not one already. An existing session whose TGT has expired is renewed if it is still within its
+// renewable lifetime, otherwise a new cross realm TGT is obtained.
+func (cl *Client) crossRealmSession(ctx context.Context, sess *session, realm string) (*session, error) {
+	cl.sessions.mux.RLock()
+	s, ok := cl.sessions.Entries[realm]
+	cl.sessions.mux.RUnlock()
+	if ok {
+		now := time.Now().UTC()
+		s.mux.RLock()
+		valid, renewable := now.Before(s.EndTime), now.Before(s.RenewTill)
+		s.mux.RUnlock()
+		if valid {
+			return s, nil
+		}
+		if renewable && cl.renewTGT(ctx, s) == nil {
+			return s, nil
+		}
+	}
 	spn := types.PrincipalName{
 		NameType:   nametype.KRB_NT_SRV_INST,
 		NameString: []string{"krbtgt", realm},
 	}
-
-	_, tgsRep, err := cl.TGSExchange(spn, cl.Credentials.Realm, sess.TGT, sess.SessionKey, false, 0)
+	_, tgsRep, err := cl.TGSExchangeContext(ctx, spn, sess.Realm, sess.TGT, sess.SessionKey, false, 0)
 	if err != nil {
-		return nil, err
+		return nil, krberror.Errorf(err, krberror.KRBMsgError, "error obtaining cross realm TGT for %s from realm %s", realm, sess.Realm)
 	}
 	cl.AddSession(tgsRep.Ticket, tgsRep.DecryptedEncPart)
-
 	cl.sessions.mux.RLock()
 	defer cl.sessions.mux.RUnlock()
-	return cl.sessions.Entries[realm], nil
+	s, ok = cl.sessions.Entries[realm]
+	if !ok {
+		return nil, fmt.Errorf("KDC of realm %s did not issue a cross realm TGT for realm %s", sess.Realm, realm)
+	}
+	return s, nil
 }
 
 // GetSessionFromRealm returns the session for the realm provided.
 func (cl *Client) GetSessionFromRealm(realm string) (sess *session, err error) {
+	return cl.getSessionFromRealm(context.Background(), realm)
+}
+
+// getSessionFromRealm returns the session for the realm provided, requesting a cross realm TGT within the context
+// provided if there is not one.
+func (cl *Client) getSessionFromRealm(ctx context.Context, realm string) (sess *session, err error) {
 	cl.sessions.mux.RLock()
 	s, ok := cl.sessions.Entries[realm]
 	cl.sessions.mux.RUnlock()
 	if !ok {
 		// Try to request TGT from trusted remote Realm
-		s, err = cl.getSessionFromRemoteRealm(realm)
+		s, err = cl.getSessionFromRemoteRealm(ctx, realm)
 		if err != nil {
 			return
 		}
@@ -186,6 +243,10 @@ func (cl *Client) GetSessionFromRealm(realm string) (sess *session, err error) {
 
 // GetSessionFromPrincipalName returns the session for the realm of the principal provided.
 func (cl *Client) GetSessionFromPrincipalName(spn types.PrincipalName) (*session, error) {
+	return cl.getSessionFromPrincipalName(context.Background(), spn)
+}
+
+func (cl *Client) getSessionFromPrincipalName(ctx context.Context, spn types.PrincipalName) (*session, error) {
 	realm := cl.Config.ResolveRealm(spn.NameString[len(spn.NameString)-1])
-	return cl.GetSessionFromRealm(realm)
+	return cl.getSessionFromRealm(ctx, realm)
 }
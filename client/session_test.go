@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/config"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/patype"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+func TestSession_Update_FAST(t *testing.T) {
+	t.Parallel()
+	s := &session{Realm: "TEST.GOKRB5"}
+	s.update(messages.Ticket{}, messages.EncKDCRepPart{})
+	assert.False(t, s.fast, "Session should not support FAST without a reply indicating FAST support")
+	s.update(messages.Ticket{}, messages.EncKDCRepPart{EncPAData: types.PADataSequence{{PADataType: patype.PA_FX_FAST}}})
+	assert.True(t, s.fast, "Session should support FAST after a reply indicating FAST support")
+	// A renewal TGS_REP does not carry the FAST indicator
+	s.update(messages.Ticket{}, messages.EncKDCRepPart{})
+	assert.True(t, s.fast, "Session should still support FAST after a renewal")
+}
+
+func TestClient_GetSessionFromRemoteRealm(t *testing.T) {
+	t.Parallel()
+	c, err := config.NewConfigFromString(testMemKDCConf + `
+[capaths]
+ TEST.GOKRB5 = {
+  C.GOKRB5 = A.GOKRB5
+  C.GOKRB5 = B.GOKRB5
+  D.GOKRB5 = A.GOKRB5
+  D.GOKRB5 = B.GOKRB5
+  D.GOKRB5 = C.GOKRB5
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	kdc := newTestMemKDC("TEST.GOKRB5", "passwordvalue")
+	kdc.trusts = map[string][]string{
+		"TEST.GOKRB5": {"A.GOKRB5"},
+		"A.GOKRB5":    {"B.GOKRB5"},
+		"B.GOKRB5":    {"C.GOKRB5"},
+	}
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue")
+	cl.WithConfig(c).WithTransport(kdc)
+	defer cl.Destroy()
+	ctx := context.Background()
+	err = cl.LoginContext(ctx)
+	if err != nil {
+		t.Fatalf("Error on login: %v", err)
+	}
+
+	// The path is followed one hop at a time
+	sess, err := cl.getSessionFromRealm(ctx, "C.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error getting session for remote realm: %v", err)
+	}
+	assert.Equal(t, "krbtgt/C.GOKRB5", sess.TGT.SName.GetPrincipalNameString(), "Cross realm TGT not as expected")
+	assert.Equal(t, "B.GOKRB5", sess.TGT.Realm, "Cross realm TGT not issued by the last realm of the path")
+	assert.Equal(t, []string{
+		"AS_REQ TEST.GOKRB5 krbtgt/TEST.GOKRB5",
+		"TGS_REQ TEST.GOKRB5 krbtgt/A.GOKRB5",
+		"TGS_REQ A.GOKRB5 krbtgt/B.GOKRB5",
+		"TGS_REQ B.GOKRB5 krbtgt/C.GOKRB5",
+	}, kdc.requests(), "Authentication path not as expected")
+
+	// The error of the hop that failed is returned
+	_, err = cl.getSessionFromRealm(ctx, "D.GOKRB5")
+	if assert.Error(t, err, "Session for an untrusted realm should not be obtained") {
+		assert.Contains(t, err.Error(), "cross realm TGT for D.GOKRB5 from realm C.GOKRB5", "Error not from the hop that failed")
+	}
+
+	home, err := cl.getSessionFromRealm(ctx, "TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	expire := func(realm string, renewTill time.Time) *session {
+		cl.sessions.mux.RLock()
+		s := cl.sessions.Entries[realm]
+		cl.sessions.mux.RUnlock()
+		s.mux.Lock()
+		s.EndTime = time.Now().UTC().Add(-time.Minute)
+		s.RenewTill = renewTill
+		s.mux.Unlock()
+		return s
+	}
+
+	// A cached session that has not expired is used as is
+	n := len(kdc.requests())
+	_, err = cl.crossRealmSession(ctx, home, "A.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error getting cross realm session: %v", err)
+	}
+	assert.Len(t, kdc.requests(), n, "Valid cross realm session should not be requested again")
+
+	// An expired session within its renewable lifetime is renewed
+	s := expire("A.GOKRB5", time.Now().UTC().Add(time.Hour))
+	rs, err := cl.crossRealmSession(ctx, home, "A.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error renewing cross realm session: %v", err)
+	}
+	assert.Equal(t, []string{"TGS_REQ TEST.GOKRB5 krbtgt/A.GOKRB5 renew"}, kdc.requests()[n:], "Expired cross realm session not renewed")
+	assert.True(t, rs == s, "Renewed session should be the cached session")
+	assert.True(t, time.Now().UTC().Before(rs.EndTime), "Renewed session has expired")
+
+	// An expired session beyond its renewable lifetime is requested again
+	n = len(kdc.requests())
+	s = expire("A.GOKRB5", time.Now().UTC().Add(-time.Minute))
+	rs, err = cl.crossRealmSession(ctx, home, "A.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error requesting cross realm session again: %v", err)
+	}
+	assert.Equal(t, []string{"TGS_REQ TEST.GOKRB5 krbtgt/A.GOKRB5"}, kdc.requests()[n:], "Expired cross realm session not requested again")
+	assert.True(t, rs != s, "Expired session should be replaced")
+	assert.True(t, time.Now().UTC().Before(rs.EndTime), "New session has expired")
+}
@@ -0,0 +1,479 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/asn1tools"
+	"gopkg.in/jcmturner/gokrb5.v5/config"
+	"gopkg.in/jcmturner/gokrb5.v5/crypto"
+	"gopkg.in/jcmturner/gokrb5.v5/iana"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/asnAppTag"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/errorcode"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/flags"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/keyusage"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/msgtype"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/patype"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+const testMemKDCConf = `[libdefaults]
+ default_realm = TEST.GOKRB5
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = 127.0.0.1:88
+ }
+
+[domain_realm]
+ .test.gokrb5 = TEST.GOKRB5
+`
+
+// testKDCRep mirrors the encoding of a KDC reply so that the in-memory KDC can marshal its replies. The Ticket raw value
+// must carry its explicit context specific tag as the tag of a raw value is not applied when marshaling.
+type testKDCRep struct {
+	PVNO    int                  `asn1:"explicit,tag:0"`
+	MsgType int                  `asn1:"explicit,tag:1"`
+	PAData  types.PADataSequence `asn1:"explicit,optional,tag:2"`
+	CRealm  string               `asn1:"generalstring,explicit,tag:3"`
+	CName   types.PrincipalName  `asn1:"explicit,tag:4"`
+	Ticket  asn1.RawValue        `asn1:"explicit,tag:5"`
+	EncPart types.EncryptedData  `asn1:"explicit,tag:6"`
+}
+
+// testMemKDC is an in-memory KDC used as a client's Transport. It issues tickets for any principal of the client's realm
+// that are only meaningful to itself, remembering the session key of each ticket so it can process the TGS_REQs that
+// present them. Cross realm TGTs are only issued by a realm's KDC for the realms it trusts. Each request received is
+// logged. The as and tgs hooks, if set, are called with each AS_REQ and TGS_REQ to check them and change what is issued.
+// An AS_REQ armored with FAST is passed to the as hook with the pre-authentication data and body of its FAST request, and
+// the reply, or a KRBError returned by the hook, is armored in turn.
+type testMemKDC struct {
+	password string
+	realm    string
+	trusts   map[string][]string
+	as       func(ASReq messages.ASReq, iss *testIssue) error
+	tgs      func(TGSReq messages.TGSReq, sessionKey, subKey types.EncryptionKey, iss *testIssue) error
+	mux      sync.Mutex
+	keys     map[string]types.EncryptionKey
+	reqs     []string
+}
+
+// testIssue is what the in-memory KDC issues in reply to a request.
+type testIssue struct {
+	cname types.PrincipalName
+	// crealm, if set, is the client realm of the reply rather than the KDC's realm.
+	crealm string
+	flags  asn1.BitString
+	// ticketKey, if set, is the key the ticket's encrypted part is encrypted with. Otherwise the encrypted part is random
+	// bytes only meaningful to the KDC.
+	ticketKey types.EncryptionKey
+	// replyKey, if set, is the key an AS reply is encrypted with rather than the client's long-term key.
+	replyKey types.EncryptionKey
+	// armorKey is the FAST armor key of an armored request. The reply's pre-authentication data is returned in an armored
+	// FAST response.
+	armorKey types.EncryptionKey
+	paData   types.PADataSequence
+	// encPAData is the pre-authentication data in the reply's encrypted part.
+	encPAData types.PADataSequence
+}
+
+func newTestMemKDC(realm, password string) *testMemKDC {
+	return &testMemKDC{
+		password: password,
+		realm:    realm,
+		keys:     make(map[string]types.EncryptionKey),
+	}
+}
+
+// requests returns the log of requests received by the KDC.
+func (k *testMemKDC) requests() []string {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	return append([]string{}, k.reqs...)
+}
+
+func (k *testMemKDC) SendToKDC(ctx context.Context, b []byte, realm string) ([]byte, error) {
+	if ctx.Err() != nil {
+		return []byte{}, ctx.Err()
+	}
+	var ASReq messages.ASReq
+	if err := ASReq.Unmarshal(b); err == nil {
+		iss := testIssue{cname: ASReq.ReqBody.CName, flags: types.NewKrbFlags()}
+		l := fmt.Sprintf("AS_REQ %s %s", realm, ASReq.ReqBody.SName.GetPrincipalNameString())
+		if ASReq.PAData.Contains(patype.PA_FX_FAST) {
+			l += " armored"
+			armorKey, fr, err := k.fastReq(ASReq)
+			if err != nil {
+				return []byte{}, err
+			}
+			iss.armorKey = armorKey
+			ASReq.PAData = fr.PAData
+			ASReq.ReqBody = fr.ReqBody
+		}
+		k.log(l)
+		if k.as != nil {
+			if err := k.as(ASReq, &iss); err != nil {
+				if e, ok := err.(messages.KRBError); ok && iss.armorKey.KeyType != 0 {
+					return []byte{}, k.fastError(iss.armorKey, e, ASReq.ReqBody.Nonce)
+				}
+				return []byte{}, err
+			}
+		}
+		key := iss.replyKey
+		if key.KeyType == 0 {
+			var err error
+			key, _, err = crypto.GetKeyFromPassword(k.password, ASReq.ReqBody.CName, ASReq.ReqBody.Realm, ASReq.ReqBody.EType[0], types.PADataSequence{})
+			if err != nil {
+				return []byte{}, err
+			}
+		}
+		return k.reply(msgtype.KRB_AS_REP, asnAppTag.ASREP, asnAppTag.EncASRepPart, keyusage.AS_REP_ENCPART, key, ASReq.ReqBody, iss)
+	}
+	var TGSReq messages.TGSReq
+	if err := TGSReq.Unmarshal(b); err == nil {
+		l := fmt.Sprintf("TGS_REQ %s %s", realm, TGSReq.ReqBody.SName.GetPrincipalNameString())
+		if types.IsFlagSet(&TGSReq.ReqBody.KDCOptions, flags.Renew) {
+			l += " renew"
+		}
+		k.log(l)
+		if !k.trusted(realm, TGSReq.ReqBody.SName) {
+			return []byte{}, messages.NewKRBError(TGSReq.ReqBody.SName, realm, errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN, "realm not trusted")
+		}
+		key, subKey, err := k.tgsReqKeys(TGSReq, realm)
+		if err != nil {
+			return []byte{}, err
+		}
+		iss := testIssue{cname: TGSReq.ReqBody.CName, flags: types.NewKrbFlags()}
+		if k.tgs != nil {
+			if err := k.tgs(TGSReq, key, subKey, &iss); err != nil {
+				return []byte{}, err
+			}
+		}
+		// The reply is encrypted with the authenticator's sub-key if there is one
+		if subKey.KeyType != 0 {
+			return k.reply(msgtype.KRB_TGS_REP, asnAppTag.TGSREP, asnAppTag.EncTGSRepPart, keyusage.TGS_REP_ENCPART_AUTHENTICATOR_SUB_KEY, subKey, TGSReq.ReqBody, iss)
+		}
+		return k.reply(msgtype.KRB_TGS_REP, asnAppTag.TGSREP, asnAppTag.EncTGSRepPart, keyusage.TGS_REP_ENCPART_SESSION_KEY, key, TGSReq.ReqBody, iss)
+	}
+	return []byte{}, errors.New("request is neither an AS_REQ nor a TGS_REQ")
+}
+
+func (k *testMemKDC) log(s string) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	k.reqs = append(k.reqs, s)
+}
+
+// trusted indicates if the KDC of the realm issues tickets for the principal. Only cross realm TGTs are restricted.
+func (k *testMemKDC) trusted(realm string, sname types.PrincipalName) bool {
+	if len(sname.NameString) != 2 || sname.NameString[0] != "krbtgt" || sname.NameString[1] == realm {
+		return true
+	}
+	for _, r := range k.trusts[realm] {
+		if r == sname.NameString[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// tgsReqKeys returns the session key of the ticket presented in the TGS_REQ's PA_TGS_REQ, which must be a TGT for the
+// realm or have been issued by the KDC of the realm, and the sub-key of its authenticator, if it has one.
+func (k *testMemKDC) tgsReqKeys(TGSReq messages.TGSReq, realm string) (types.EncryptionKey, types.EncryptionKey, error) {
+	for _, pa := range TGSReq.PAData {
+		if pa.PADataType != patype.PA_TGS_REQ {
+			continue
+		}
+		var APReq messages.APReq
+		if err := APReq.Unmarshal(pa.PADataValue); err != nil {
+			return types.EncryptionKey{}, types.EncryptionKey{}, err
+		}
+		if APReq.Ticket.Realm != realm && APReq.Ticket.SName.GetPrincipalNameString() != "krbtgt/"+realm {
+			return types.EncryptionKey{}, types.EncryptionKey{}, fmt.Errorf("ticket in TGS_REQ is not for realm %s", realm)
+		}
+		key, ok := k.sessionKey(APReq.Ticket)
+		if !ok {
+			return types.EncryptionKey{}, types.EncryptionKey{}, errors.New("ticket in TGS_REQ was not issued by this KDC")
+		}
+		a, err := APReq.DecryptAuthenticator(key)
+		if err != nil {
+			return types.EncryptionKey{}, types.EncryptionKey{}, err
+		}
+		return key, a.SubKey, nil
+	}
+	return types.EncryptionKey{}, types.EncryptionKey{}, errors.New("TGS_REQ does not contain a PA_TGS_REQ")
+}
+
+// fastReq returns the armor key and the decrypted FAST request of an armored AS_REQ. The armor ticket must have been
+// issued by the KDC.
+func (k *testMemKDC) fastReq(ASReq messages.ASReq) (types.EncryptionKey, messages.KrbFastReq, error) {
+	var armorKey types.EncryptionKey
+	var fr messages.KrbFastReq
+	var ar messages.KrbFastArmoredReq
+	for _, pa := range ASReq.PAData {
+		if pa.PADataType == patype.PA_FX_FAST {
+			if err := ar.Unmarshal(pa.PADataValue); err != nil {
+				return armorKey, fr, err
+			}
+		}
+	}
+	var APReq messages.APReq
+	if err := APReq.Unmarshal(ar.Armor.ArmorValue); err != nil {
+		return armorKey, fr, err
+	}
+	key, ok := k.sessionKey(APReq.Ticket)
+	if !ok {
+		return armorKey, fr, errors.New("FAST armor ticket was not issued by this KDC")
+	}
+	// The armor AP_REQ is a standard AP_REQ even though its ticket is a TGT
+	b, err := crypto.DecryptEncPart(APReq.Authenticator, key, keyusage.AP_REQ_AUTHENTICATOR)
+	if err != nil {
+		return armorKey, fr, err
+	}
+	var a types.Authenticator
+	if err := a.Unmarshal(b); err != nil {
+		return armorKey, fr, err
+	}
+	armorKey, err = crypto.KRBFXCF2(a.SubKey, key, fastSubKeyArmorPepper, fastTicketArmorPepper)
+	if err != nil {
+		return armorKey, fr, err
+	}
+	b, err = ASReq.ReqBody.Marshal()
+	if err != nil {
+		return armorKey, fr, err
+	}
+	et, err := crypto.GetChksumEtype(ar.ReqChecksum.CksumType)
+	if err != nil {
+		return armorKey, fr, err
+	}
+	if !et.VerifyChecksum(armorKey.KeyValue, b, ar.ReqChecksum.Checksum, keyusage.KEY_USAGE_FAST_REQ_CHKSUM) {
+		return armorKey, fr, errors.New("FAST request checksum invalid")
+	}
+	b, err = crypto.DecryptEncPart(ar.EncFastReq, armorKey, keyusage.KEY_USAGE_FAST_ENC)
+	if err != nil {
+		return armorKey, fr, err
+	}
+	err = fr.Unmarshal(b)
+	return armorKey, fr, err
+}
+
+// fastRep returns the PA_FX_FAST pre-authentication data carrying the FAST response encrypted with the armor key.
+func (k *testMemKDC) fastRep(armorKey types.EncryptionKey, resp messages.KrbFastResponse) (types.PAData, error) {
+	b, err := resp.Marshal()
+	if err != nil {
+		return types.PAData{}, err
+	}
+	ed, err := crypto.GetEncryptedData(b, armorKey, keyusage.KEY_USAGE_FAST_REP, 0)
+	if err != nil {
+		return types.PAData{}, err
+	}
+	ar := messages.KrbFastArmoredRep{EncFastRep: ed}
+	b, err = ar.Marshal()
+	if err != nil {
+		return types.PAData{}, err
+	}
+	return types.PAData{PADataType: patype.PA_FX_FAST, PADataValue: b}, nil
+}
+
+// fastError armors the KRBError. The error is returned in the PA_FX_ERROR of the FAST response along with the
+// pre-authentication data of its e-data.
+func (k *testMemKDC) fastError(armorKey types.EncryptionKey, e messages.KRBError, nonce int) error {
+	var pas types.PADataSequence
+	if len(e.EData) > 0 {
+		if err := pas.Unmarshal(e.EData); err != nil {
+			return err
+		}
+	}
+	inner := e
+	inner.EData = nil
+	b, err := asn1.Marshal(inner)
+	if err != nil {
+		return err
+	}
+	pas = append(types.PADataSequence{{PADataType: patype.PA_FX_ERROR, PADataValue: asn1tools.AddASNAppTag(b, asnAppTag.KRBError)}}, pas...)
+	pa, err := k.fastRep(armorKey, messages.KrbFastResponse{PAData: pas, Nonce: nonce})
+	if err != nil {
+		return err
+	}
+	e.EData, err = asn1.Marshal(types.PADataSequence{pa})
+	if err != nil {
+		return err
+	}
+	return e
+}
+
+// sessionKey returns the session key of a ticket issued by the KDC.
+func (k *testMemKDC) sessionKey(tkt messages.Ticket) (types.EncryptionKey, bool) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	key, ok := k.keys[string(tkt.EncPart.Cipher)]
+	return key, ok
+}
+
+// serviceKey returns the long-term key of the principal, derived from the KDC's password, for the encryption type.
+func (k *testMemKDC) serviceKey(princ types.PrincipalName, etype int32) (types.EncryptionKey, error) {
+	key, _, err := crypto.GetKeyFromPassword(k.password, princ, k.realm, etype, types.PADataSequence{})
+	return key, err
+}
+
+// reply issues a ticket for the service requested and returns the marshaled reply with its encrypted part encrypted
+// using the key provided.
+func (k *testMemKDC) reply(msgType, appTag, encAppTag int, usage uint32, key types.EncryptionKey, body messages.KDCReqBody, iss testIssue) ([]byte, error) {
+	now := time.Now().UTC()
+	crealm := k.realm
+	if iss.crealm != "" {
+		crealm = iss.crealm
+	}
+	var tkt messages.Ticket
+	var sk types.EncryptionKey
+	var err error
+	if iss.ticketKey.KeyType != 0 {
+		tkt, sk, err = messages.NewTicketWithKey(iss.cname, crealm, body.SName, body.Realm, iss.flags, iss.ticketKey, 1, now, now, now.Add(time.Hour), now.Add(2*time.Hour))
+		if err != nil {
+			return []byte{}, err
+		}
+	} else {
+		sk, err = newSubKey(key.KeyType)
+		if err != nil {
+			return []byte{}, err
+		}
+		c := make([]byte, 32)
+		if _, err := rand.Read(c); err != nil {
+			return []byte{}, err
+		}
+		tkt = messages.Ticket{
+			TktVNO:  iana.PVNO,
+			Realm:   body.Realm,
+			SName:   body.SName,
+			EncPart: types.EncryptedData{EType: key.KeyType, KVNO: 1, Cipher: c},
+		}
+	}
+	k.mux.Lock()
+	k.keys[string(tkt.EncPart.Cipher)] = sk
+	k.mux.Unlock()
+	dep := messages.EncKDCRepPart{
+		Key:       sk,
+		LastReqs:  []messages.LastReq{{LRValue: now}},
+		Nonce:     body.Nonce,
+		Flags:     iss.flags,
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   now.Add(time.Hour),
+		RenewTill: now.Add(2 * time.Hour),
+		SRealm:    body.Realm,
+		SName:     body.SName,
+		EncPAData: iss.encPAData,
+	}
+	b, err := asn1.Marshal(dep)
+	if err != nil {
+		return []byte{}, err
+	}
+	ed, err := crypto.GetEncryptedData(asn1tools.AddASNAppTag(b, encAppTag), key, usage, 1)
+	if err != nil {
+		return []byte{}, err
+	}
+	tb, err := tkt.Marshal()
+	if err != nil {
+		return []byte{}, err
+	}
+	pas := iss.paData
+	if iss.armorKey.KeyType != 0 {
+		et, err := crypto.GetEtype(iss.armorKey.KeyType)
+		if err != nil {
+			return []byte{}, err
+		}
+		cb, err := et.GetChecksumHash(iss.armorKey.KeyValue, tb, keyusage.KEY_USAGE_FAST_FINISHED)
+		if err != nil {
+			return []byte{}, err
+		}
+		pa, err := k.fastRep(iss.armorKey, messages.KrbFastResponse{
+			PAData: iss.paData,
+			Finished: messages.KrbFastFinished{
+				Timestamp:      now,
+				CRealm:         crealm,
+				CName:          iss.cname,
+				TicketChecksum: types.Checksum{CksumType: et.GetHashID(), Checksum: cb},
+			},
+			Nonce: body.Nonce,
+		})
+		if err != nil {
+			return []byte{}, err
+		}
+		pas = types.PADataSequence{pa}
+	}
+	rep := testKDCRep{
+		PVNO:    iana.PVNO,
+		MsgType: msgType,
+		PAData:  pas,
+		CRealm:  crealm,
+		CName:   iss.cname,
+		Ticket: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        5,
+			IsCompound: true,
+			Bytes:      tb,
+		},
+		EncPart: ed,
+	}
+	b, err = asn1.Marshal(rep)
+	if err != nil {
+		return []byte{}, err
+	}
+	return asn1tools.AddASNAppTag(b, appTag), nil
+}
+
+func TestClient_Transport(t *testing.T) {
+	t.Parallel()
+	c, err := config.NewConfigFromString(testMemKDCConf)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	kdc := newTestMemKDC("TEST.GOKRB5", "passwordvalue")
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue")
+	cl.WithConfig(c).WithTransport(kdc)
+	defer cl.Destroy()
+
+	ctx := context.Background()
+	err = cl.LoginContext(ctx)
+	if err != nil {
+		t.Fatalf("Error on login: %v", err)
+	}
+	sess, err := cl.GetSessionFromRealm("TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	assert.Equal(t, "krbtgt/TEST.GOKRB5", sess.TGT.SName.GetPrincipalNameString(), "TGT not as expected")
+
+	spn := "HTTP/host.test.gokrb5"
+	tkt, key, err := cl.GetServiceTicketContext(ctx, spn)
+	if err != nil {
+		t.Fatalf("Error getting service ticket: %v", err)
+	}
+	assert.Equal(t, spn, tkt.SName.GetPrincipalNameString(), "Ticket service name not as expected")
+	assert.Equal(t, "TEST.GOKRB5", tkt.Realm, "Ticket realm not as expected")
+	assert.NotEmpty(t, key.KeyValue, "Service ticket session key is empty")
+
+	// The ticket is served from the cache
+	ctkt, ckey, err := cl.GetServiceTicketContext(ctx, spn)
+	if err != nil {
+		t.Fatalf("Error getting cached service ticket: %v", err)
+	}
+	assert.Equal(t, tkt.EncPart.Cipher, ctkt.EncPart.Cipher, "Cached ticket not as expected")
+	assert.Equal(t, key, ckey, "Cached session key not as expected")
+	assert.Equal(t, []string{"AS_REQ TEST.GOKRB5 krbtgt/TEST.GOKRB5", "TGS_REQ TEST.GOKRB5 HTTP/host.test.gokrb5"}, kdc.requests(), "Requests to the KDC not as expected")
+
+	// The context is passed to the transport
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, _, err = cl.GetServiceTicketContext(cctx, "HTTP/other.test.gokrb5")
+	assert.Error(t, err, "Cancelled context should cause an error")
+	assert.Len(t, kdc.requests(), 2, "Request should not reach the KDC once the context is cancelled")
+}
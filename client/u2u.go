@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+
+	"gopkg.in/jcmturner/gokrb5.v5/iana/flags"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
+	"gopkg.in/jcmturner/gokrb5.v5/krberror"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+// Reference: https://tools.ietf.org/html/rfc4120#section-3.7
+
+// GetTGT returns the client's TGT for the realm specified, and its session key, renewing it if it has expired.
+// A client acting as a user-to-user service provides the TGT to its peers and uses the session key to validate their
+// AP_REQs.
+func (cl *Client) GetTGT(realm string) (messages.Ticket, types.EncryptionKey, error) {
+	return cl.GetTGTContext(context.Background(), realm)
+}
+
+// GetTGTContext returns the client's TGT for the realm specified, and its session key, renewing it within the context
+// provided if it has expired.
+func (cl *Client) GetTGTContext(ctx context.Context, realm string) (messages.Ticket, types.EncryptionKey, error) {
+	sess, err := cl.validSession(ctx, realm)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	return sess.TGT, sess.SessionKey, nil
+}
+
+// GetUserToUserTicket makes a request to get a user-to-user service ticket for the principal specified. The ticket is
+// encrypted in the session key of the principal's TGT, provided, rather than its long term key so the principal does not
+// need a keytab to accept it.
+// The ticket is not added to the client's ticket cache.
+func (cl *Client) GetUserToUserTicket(spn string, tgt messages.Ticket) (messages.Ticket, types.EncryptionKey, error) {
+	return cl.GetUserToUserTicketContext(context.Background(), spn, tgt)
+}
+
+// GetUserToUserTicketContext makes a request to get a user-to-user service ticket for the principal specified within the
+// context provided.
+func (cl *Client) GetUserToUserTicketContext(ctx context.Context, spn string, tgt messages.Ticket) (messages.Ticket, types.EncryptionKey, error) {
+	var tkt messages.Ticket
+	var skey types.EncryptionKey
+	// The KDC must be able to decrypt the additional TGT so the request is sent to the TGT's realm
+	sess, err := cl.validSession(ctx, tgt.Realm)
+	if err != nil {
+		return tkt, skey, err
+	}
+	princ := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, spn)
+	tgsReq, err := messages.NewTGSReq(cl.Credentials.CName, sess.Realm, cl.Config, sess.TGT, sess.SessionKey, princ, false)
+	if err != nil {
+		return tkt, skey, krberror.Errorf(err, krberror.KRBMsgError, "User-to-User Error: failed to generate a new TGS_REQ")
+	}
+	types.SetFlag(&tgsReq.ReqBody.KDCOptions, flags.EncTktInSkey)
+	tgsReq.ReqBody.AdditionalTickets = []messages.Ticket{tgt}
+	// The PA_TGS_REQ must be set again now the body is complete as the authenticator checksums the body
+	err = tgsReq.SetPAData(cl.Credentials.CName, sess.TGT, sess.SessionKey, types.EncryptionKey{})
+	if err != nil {
+		return tkt, skey, krberror.Errorf(err, krberror.KRBMsgError, "User-to-User Error: failed to set TGS_REQ PAData")
+	}
+	tgsRep, err := cl.sendTGSReq(ctx, &tgsReq, sess.Realm, sess.TGT, sess.SessionKey, types.EncryptionKey{})
+	if err != nil {
+		return tkt, skey, err
+	}
+	if ok, err := tgsRep.IsValid(cl.Config, tgsReq); !ok {
+		return tkt, skey, krberror.Errorf(err, krberror.KRBMsgError, "User-to-User Error: TGS_REP is not valid")
+	}
+	return tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, nil
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/config"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/flags"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+func TestClient_GetUserToUserTicket(t *testing.T) {
+	t.Parallel()
+	c, err := config.NewConfigFromString(testMemKDCConf)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	kdc := newTestMemKDC("TEST.GOKRB5", "passwordvalue")
+	// The user-to-user service provides its TGT to the client
+	svc := NewClientWithPassword("testuser2", "TEST.GOKRB5", "passwordvalue")
+	svc.WithConfig(c).WithTransport(kdc)
+	defer svc.Destroy()
+	err = svc.Login()
+	if err != nil {
+		t.Fatalf("Error on service login: %v", err)
+	}
+	tgt, tgtKey, err := svc.GetTGT("TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error getting service TGT: %v", err)
+	}
+
+	// The KDC encrypts the ticket in the session key of the additional TGT, which it issued
+	var encTktInSkey bool
+	var addl []messages.Ticket
+	kdc.tgs = func(TGSReq messages.TGSReq, sessionKey, subKey types.EncryptionKey, iss *testIssue) error {
+		encTktInSkey = types.IsFlagSet(&TGSReq.ReqBody.KDCOptions, flags.EncTktInSkey)
+		addl = TGSReq.ReqBody.AdditionalTickets
+		if !encTktInSkey || len(addl) != 1 {
+			return errors.New("TGS_REQ is not a user-to-user request")
+		}
+		key, ok := kdc.sessionKey(addl[0])
+		if !ok {
+			return errors.New("additional ticket was not issued by this KDC")
+		}
+		iss.ticketKey = key
+		return nil
+	}
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue")
+	cl.WithConfig(c).WithTransport(kdc)
+	defer cl.Destroy()
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("Error on login: %v", err)
+	}
+	tkt, key, err := cl.GetUserToUserTicket("testuser2", tgt)
+	if err != nil {
+		t.Fatalf("Error getting user-to-user ticket: %v", err)
+	}
+	assert.True(t, encTktInSkey, "TGS_REQ should have the enc-tkt-in-skey option set")
+	if assert.Len(t, addl, 1, "TGS_REQ should have the service's TGT as its additional ticket") {
+		assert.Equal(t, tgt.EncPart.Cipher, addl[0].EncPart.Cipher, "Additional ticket should be the service's TGT")
+		assert.Equal(t, "krbtgt/TEST.GOKRB5", addl[0].SName.GetPrincipalNameString(), "Additional ticket should be a TGT")
+	}
+	reqs := kdc.requests()
+	assert.Equal(t, "TGS_REQ TEST.GOKRB5 testuser2", reqs[len(reqs)-1], "User-to-user request not as expected")
+
+	// The service decrypts the ticket with its TGT session key rather than a long term key
+	err = tkt.DecryptEncPartWithKey(tgtKey)
+	if err != nil {
+		t.Fatalf("Error decrypting user-to-user ticket with the TGT session key: %v", err)
+	}
+	assert.Equal(t, "testuser1", tkt.DecryptedEncPart.CName.GetPrincipalNameString(), "Ticket client not as expected")
+	assert.Equal(t, key, tkt.DecryptedEncPart.Key, "Ticket session key not as expected")
+
+	// The ticket is not cached
+	_, ok := cl.Cache.getEntry("testuser2")
+	assert.False(t, ok, "User-to-user ticket should not be cached")
+}
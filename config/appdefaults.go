@@ -0,0 +1,110 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AppDefaults represents the [appdefaults] section of the configuration. Options can be set for all applications, for
+// an application, for a realm or for an application within a realm.
+// https://web.mit.edu/kerberos/krb5-latest/doc/admin/conf_files/krb5_conf.html#appdefaults
+type AppDefaults struct {
+	values   map[string][]string
+	sections map[string]*AppDefaults
+}
+
+func newAppDefaults() *AppDefaults {
+	return &AppDefaults{
+		values:   make(map[string][]string),
+		sections: make(map[string]*AppDefaults),
+	}
+}
+
+// Parse the lines of the [appdefaults] section of the configuration and add to the options.
+func (a *AppDefaults) parseLines(lines []string) error {
+	stack := []*AppDefaults{a}
+	for _, line := range lines {
+		l := strings.TrimSpace(line)
+		if l == "" {
+			continue
+		}
+		if strings.HasPrefix(l, "}") {
+			if len(stack) < 2 {
+				return errors.New("invalid appdefaults section in configuration")
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		if !strings.Contains(l, "=") {
+			return fmt.Errorf("appdefaults configuration line invalid: %s", line)
+		}
+		kv := strings.SplitN(l, "=", 2)
+		k := strings.TrimSpace(kv[0])
+		v := strings.TrimSpace(kv[1])
+		cur := stack[len(stack)-1]
+		if !strings.HasPrefix(v, "{") {
+			cur.values[k] = append(cur.values[k], v)
+			continue
+		}
+		sub, ok := cur.sections[k]
+		if !ok {
+			sub = newAppDefaults()
+			cur.sections[k] = sub
+		}
+		// A block may be given on a single line, such as EXAMPLE.COM = { forwardable = true }
+		if inner := strings.TrimSpace(v[1:]); strings.HasSuffix(inner, "}") {
+			if inner = strings.TrimSpace(strings.TrimSuffix(inner, "}")); inner != "" {
+				if err := sub.parseLines([]string{inner}); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		stack = append(stack, sub)
+	}
+	if len(stack) > 1 {
+		return errors.New("invalid appdefaults section in configuration: block not closed")
+	}
+	return nil
+}
+
+// Get returns the value of the option for the application and realm provided and whether it is set. As with MIT krb5 an
+// option set for the application within the realm takes precedence over one set for the application, which takes
+// precedence over one set for the realm, which takes precedence over one set for all applications.
+func (a *AppDefaults) Get(app, realm, option string) (string, bool) {
+	for _, path := range [][]string{{app, realm}, {realm, app}, {app}, {realm}, {}} {
+		if v, ok := a.get(path, option); ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// GetBool returns the boolean value of the option for the application and realm provided. The default value given is
+// returned if the option is not set or is not a boolean.
+func (a *AppDefaults) GetBool(app, realm, option string, def bool) bool {
+	v, ok := a.Get(app, realm, option)
+	if !ok {
+		return def
+	}
+	b, err := parseBoolean(v)
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+func (a *AppDefaults) get(path []string, option string) (string, bool) {
+	s := a
+	for _, n := range path {
+		var ok bool
+		if s, ok = s.sections[n]; !ok {
+			return "", false
+		}
+	}
+	if v := s.values[option]; len(v) > 0 {
+		return v[0], true
+	}
+	return "", false
+}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNS resource record type number of URI records: https://tools.ietf.org/html/rfc7553
+const dnsTypeURI uint16 = 256
+
+// URI represents a single DNS URI resource record.
+type URI struct {
+	Priority uint16
+	Weight   uint16
+	Target   string
+}
+
+// URIResolver performs DNS URI record lookups. If the Config's Resolver also implements URIResolver it is used for
+// URI lookups, otherwise the name servers in /etc/resolv.conf, or that given by the DNSUTILS_OVERRIDE_NS environment
+// variable, are queried directly.
+type URIResolver interface {
+	LookupURI(ctx context.Context, name string) ([]URI, error)
+}
+
+func (c *Config) uriResolver() URIResolver {
+	if r, ok := c.Resolver.(URIResolver); ok {
+		return r
+	}
+	return systemURIResolver
+}
+
+// The time for which a lookup finding no URI records is cached.
+const uriNegativeTTL = time.Minute
+
+// systemURIResolver is shared by all configurations so that its cache applies across them.
+var systemURIResolver = &dnsURIResolver{cache: make(map[string]uriCacheEntry)}
+
+// dnsURIResolver queries the system's name servers for URI records as the standard library does not support them. The
+// records found are cached for their time to live.
+type dnsURIResolver struct {
+	mux   sync.Mutex
+	cache map[string]uriCacheEntry
+}
+
+type uriCacheEntry struct {
+	uris    []URI
+	expires time.Time
+}
+
+// LookupURI returns the URI records for the name provided.
+func (r *dnsURIResolver) LookupURI(ctx context.Context, name string) ([]URI, error) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	r.mux.Lock()
+	e, ok := r.cache[name]
+	r.mux.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.uris, nil
+	}
+	id, q, err := uriQuery(name)
+	if err != nil {
+		return nil, err
+	}
+	ns, err := nameServers()
+	if err != nil {
+		return nil, err
+	}
+	var errs []string
+	for _, s := range ns {
+		b, err := dnsExchange(ctx, "udp", s, q)
+		if err == nil && len(b) > 2 && b[2]&0x02 != 0 {
+			// Response truncated, retry over TCP
+			b, err = dnsExchange(ctx, "tcp", s, q)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			errs = append(errs, err.Error())
+			continue
+		}
+		uris, ttl, err := parseURIResponse(id, b)
+		if err != nil {
+			return nil, err
+		}
+		if len(uris) < 1 {
+			ttl = uriNegativeTTL
+		}
+		r.mux.Lock()
+		r.cache[name] = uriCacheEntry{uris: uris, expires: time.Now().Add(ttl)}
+		r.mux.Unlock()
+		return uris, nil
+	}
+	return nil, fmt.Errorf("error looking up URI records for %s: %s", name, strings.Join(errs, "; "))
+}
+
+// nameServers returns the address of the name server given by the DNSUTILS_OVERRIDE_NS environment variable or
+// otherwise those configured in /etc/resolv.conf.
+func nameServers() ([]string, error) {
+	if ns := os.Getenv("DNSUTILS_OVERRIDE_NS"); ns != "" {
+		return []string{ns}, nil
+	}
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return nil, fmt.Errorf("could not read name servers: %v", err)
+	}
+	defer f.Close()
+	var s []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fs := strings.Fields(scanner.Text())
+		if len(fs) > 1 && fs[0] == "nameserver" {
+			s = append(s, net.JoinHostPort(fs[1], "53"))
+		}
+	}
+	if len(s) < 1 {
+		return nil, errors.New("no name servers configured in /etc/resolv.conf")
+	}
+	return s, nil
+}
+
+// uriQuery creates a recursive DNS query message for the URI records of the name provided.
+func uriQuery(name string) (uint16, []byte, error) {
+	b := make([]byte, 12, 512)
+	if _, err := rand.Read(b[:2]); err != nil {
+		return 0, nil, fmt.Errorf("could not generate DNS message ID: %v", err)
+	}
+	id := binary.BigEndian.Uint16(b[:2])
+	// Recursion desired with a single question
+	b[2] = 0x01
+	binary.BigEndian.PutUint16(b[4:6], 1)
+	for _, l := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(l) < 1 || len(l) > 63 {
+			return 0, nil, fmt.Errorf("invalid DNS name %s", name)
+		}
+		b = append(b, byte(len(l)))
+		b = append(b, l...)
+	}
+	b = append(b, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint16(b[len(b)-4:], dnsTypeURI)
+	binary.BigEndian.PutUint16(b[len(b)-2:], 1)
+	return id, b, nil
+}
+
+// dnsExchange sends the DNS query to the server over the network specified and returns the response message.
+func dnsExchange(ctx context.Context, network, server string, q []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	conn.SetDeadline(deadline)
+	if network == "tcp" {
+		l := make([]byte, 2)
+		binary.BigEndian.PutUint16(l, uint16(len(q)))
+		if _, err = conn.Write(append(l, q...)); err != nil {
+			return nil, err
+		}
+		if _, err = io.ReadFull(conn, l); err != nil {
+			return nil, err
+		}
+		b := make([]byte, binary.BigEndian.Uint16(l))
+		_, err = io.ReadFull(conn, b)
+		return b, err
+	}
+	if _, err = conn.Write(q); err != nil {
+		return nil, err
+	}
+	b := make([]byte, 65535)
+	n, err := conn.Read(b)
+	return b[:n], err
+}
+
+// parseURIResponse extracts the URI records from the answer section of a DNS response message along with the lowest time
+// to live of the records.
+func parseURIResponse(id uint16, b []byte) ([]URI, time.Duration, error) {
+	if len(b) < 12 {
+		return nil, 0, errors.New("DNS response message too short")
+	}
+	if binary.BigEndian.Uint16(b[:2]) != id || b[2]&0x80 == 0 {
+		return nil, 0, errors.New("DNS response message does not match the query")
+	}
+	switch b[3] & 0x0f {
+	case 0:
+	case 3:
+		// Name does not exist
+		return nil, 0, nil
+	default:
+		return nil, 0, fmt.Errorf("DNS server returned error code %d", b[3]&0x0f)
+	}
+	qd := int(binary.BigEndian.Uint16(b[4:6]))
+	an := int(binary.BigEndian.Uint16(b[6:8]))
+	i := 12
+	var err error
+	for j := 0; j < qd; j++ {
+		if i, err = skipDNSName(b, i); err != nil {
+			return nil, 0, err
+		}
+		i += 4
+	}
+	var uris []URI
+	var ttl time.Duration
+	for j := 0; j < an; j++ {
+		if i, err = skipDNSName(b, i); err != nil {
+			return nil, 0, err
+		}
+		if i+10 > len(b) {
+			return nil, 0, errors.New("DNS response message truncated")
+		}
+		t := binary.BigEndian.Uint16(b[i : i+2])
+		rttl := time.Duration(binary.BigEndian.Uint32(b[i+4:i+8])) * time.Second
+		l := int(binary.BigEndian.Uint16(b[i+8 : i+10]))
+		i += 10
+		if i+l > len(b) {
+			return nil, 0, errors.New("DNS response message truncated")
+		}
+		if t == dnsTypeURI && l >= 4 {
+			if len(uris) < 1 || rttl < ttl {
+				ttl = rttl
+			}
+			uris = append(uris, URI{
+				Priority: binary.BigEndian.Uint16(b[i : i+2]),
+				Weight:   binary.BigEndian.Uint16(b[i+2 : i+4]),
+				Target:   string(b[i+4 : i+l]),
+			})
+		}
+		i += l
+	}
+	return uris, ttl, nil
+}
+
+// skipDNSName returns the index in the message following the, possibly compressed, domain name starting at index i.
+func skipDNSName(b []byte, i int) (int, error) {
+	for i < len(b) {
+		l := int(b[i])
+		switch {
+		case l == 0:
+			return i + 1, nil
+		case l&0xc0 == 0xc0:
+			return i + 2, nil
+		default:
+			i += l + 1
+		}
+	}
+	return i, errors.New("DNS response message truncated")
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Environment variables, as used by MIT krb5, that locate the configuration, credential cache and keytabs.
+// https://web.mit.edu/kerberos/krb5-latest/doc/user/user_config/kerberos.html#environment-variables
+const (
+	EnvConfig           = "KRB5_CONFIG"
+	EnvCCacheName       = "KRB5CCNAME"
+	EnvKeytabName       = "KRB5_KTNAME"
+	EnvClientKeytabName = "KRB5_CLIENT_KTNAME"
+)
+
+// DefaultConfigPath is the configuration file loaded when KRB5_CONFIG is not set.
+const DefaultConfigPath = "/etc/krb5.conf"
+
+// LoadDefault loads the KRB5 configuration from the files listed in KRB5_CONFIG, separated as for PATH, or from the
+// default configuration file if it is not set.
+func LoadDefault() (*Config, error) {
+	paths := []string{DefaultConfigPath}
+	if e := os.Getenv(EnvConfig); e != "" {
+		paths = filepath.SplitList(e)
+	}
+	return LoadFiles(paths...)
+}
+
+// LoadFiles loads the KRB5 configuration from the file paths provided. Files that do not exist are skipped. As with MIT
+// krb5 a setting in an earlier file takes precedence over the same setting in a later file.
+func LoadFiles(paths ...string) (*Config, error) {
+	var confs []string
+	for _, p := range paths {
+		b, err := ioutil.ReadFile(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("configuration file could not be read: %s %v", p, err)
+		}
+		// Settings parsed later replace those parsed earlier so the files are parsed in reverse order
+		confs = append([]string{string(b)}, confs...)
+	}
+	if len(confs) < 1 {
+		return nil, fmt.Errorf("no configuration file could be found in %s", strings.Join(paths, string(filepath.ListSeparator)))
+	}
+	c, err := NewConfigFromString(strings.Join(confs, "\n"))
+	if err != nil {
+		return nil, err
+	}
+	// The realms of the files are merged when they are parsed together so each file is parsed for its realms, keeping
+	// the definition of each realm from the earliest file
+	var rs []Realm
+	for i := len(confs) - 1; i >= 0; i-- {
+		fc, err := NewConfigFromString(confs[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range fc.Realms {
+			var defined bool
+			for _, e := range rs {
+				if e.Realm == r.Realm {
+					defined = true
+					break
+				}
+			}
+			if !defined {
+				rs = append(rs, r)
+			}
+		}
+	}
+	c.Realms = rs
+	return c, nil
+}
+
+// ExpandPath expands the %{token} parameters in a configured path or cache name as MIT krb5 does. The TEMP, uid, USERID,
+// euid, username and null tokens are supported.
+// https://web.mit.edu/kerberos/krb5-latest/doc/admin/conf_files/krb5_conf.html#parameter-expansion
+func ExpandPath(s string) (string, error) {
+	var b bytes.Buffer
+	for {
+		i := strings.Index(s, "%{")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		j := strings.Index(s[i:], "}")
+		if j < 0 {
+			return "", fmt.Errorf("path %s has an unterminated token", s)
+		}
+		b.WriteString(s[:i])
+		t := s[i+2 : i+j]
+		switch t {
+		case "TEMP":
+			b.WriteString(os.TempDir())
+		case "uid", "USERID":
+			b.WriteString(currentUID(os.Getuid()))
+		case "euid":
+			b.WriteString(currentUID(os.Geteuid()))
+		case "username":
+			u, err := user.Current()
+			if err != nil {
+				return "", fmt.Errorf("could not expand username token: %v", err)
+			}
+			b.WriteString(u.Username)
+		case "null":
+		default:
+			return "", fmt.Errorf("path token %%{%s} is not supported", t)
+		}
+		s = s[i+j+1:]
+	}
+}
+
+// currentUID returns the user ID provided, or that of the current user on platforms without numeric user IDs.
+func currentUID(id int) string {
+	if id >= 0 {
+		return strconv.Itoa(id)
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Uid
+	}
+	return "0"
+}
+
+// CCacheName returns the name of the default credential cache. KRB5CCNAME takes precedence over default_ccache_name.
+func (c *Config) CCacheName() (string, error) {
+	return c.envOrConfigured(EnvCCacheName, c.LibDefaults.DefaultCCacheName)
+}
+
+// KeytabName returns the name of the default keytab used by services. KRB5_KTNAME takes precedence over
+// default_keytab_name.
+func (c *Config) KeytabName() (string, error) {
+	return c.envOrConfigured(EnvKeytabName, c.LibDefaults.DefaultKeytabName)
+}
+
+// ClientKeytabName returns the name of the default keytab used by clients. KRB5_CLIENT_KTNAME takes precedence over
+// default_client_keytab_name.
+func (c *Config) ClientKeytabName() (string, error) {
+	return c.envOrConfigured(EnvClientKeytabName, c.LibDefaults.DefaultClientKeytabName)
+}
+
+func (c *Config) envOrConfigured(env, configured string) (string, error) {
+	if n := os.Getenv(env); n != "" {
+		return n, nil
+	}
+	if configured == "" {
+		return "", fmt.Errorf("%s is not set and there is no configured default", env)
+	}
+	return ExpandPath(configured)
+}
@@ -1,17 +1,91 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"math/rand"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 
 	"gopkg.in/jcmturner/dnsutils.v1"
 )
 
+// Resolver performs the DNS lookups used to discover Kerberos realms.
+// If the Config's Resolver is nil the lookups are made with net.LookupTXT.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+func (c *Config) resolver() Resolver {
+	if c.Resolver != nil {
+		return c.Resolver
+	}
+	return netResolver{}
+}
+
+// netResolver looks up TXT records with the net package. The lookup cannot be cancelled so its result is abandoned
+// once the context is done.
+type netResolver struct{}
+
+// LookupTXT returns the TXT records for the name provided.
+func (netResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	type result struct {
+		txts []string
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		txts, err := net.LookupTXT(name)
+		ch <- result{txts, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.txts, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// lookupRealm finds the realm of the host from _kerberos TXT records for the host name and then, following the
+// realm_try_domains setting, its domain components: the host's domain is tried at 0, also its parent at 1 and so on.
+// -1 does not try the domain components.
+// https://web.mit.edu/kerberos/krb5-latest/doc/admin/realm_config.html#mapping-hostnames-onto-kerberos-realms
+func (c *Config) lookupRealm(ctx context.Context, hostname string) (string, error) {
+	hostname = strings.Trim(hostname, ".")
+	if hostname == "" {
+		return "", errors.New("no host name to look up the realm of")
+	}
+	labels := strings.Split(hostname, ".")
+	for i := range labels {
+		if i > c.LibDefaults.RealmTryDomains+1 {
+			break
+		}
+		txts, err := c.resolver().LookupTXT(ctx, "_kerberos."+strings.Join(labels[i:], "."))
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			continue
+		}
+		for _, txt := range txts {
+			if r := strings.TrimSpace(txt); r != "" {
+				return r, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no kerberos TXT record found for %s", hostname)
+}
+
 // GetKDCs returns the count of KDCs available and a map of KDC host names keyed on preference order.
 func (c *Config) GetKDCs(realm string, tcp bool) (int, map[int]string, error) {
+	return c.GetKDCsContext(context.Background(), realm, tcp)
+}
+
+// GetKDCsContext returns the count of KDCs available and a map of KDC host names keyed on preference order. Cancellation
+// and the deadline of the context provided apply to the DNS URI record lookups.
+func (c *Config) GetKDCsContext(ctx context.Context, realm string, tcp bool) (int, map[int]string, error) {
 	if realm == "" {
 		realm = c.LibDefaults.DefaultRealm
 	}
@@ -24,6 +98,10 @@ func (c *Config) GetKDCs(realm string, tcp bool) (int, map[int]string, error) {
 		if tcp {
 			proto = "tcp"
 		}
+		// Prefer URI records, falling back to SRV records if there are none for the transport
+		if ks := c.kdcURIAddresses(ctx, realm, proto, false); len(ks) > 0 {
+			return len(ks), orderedServ(ks), nil
+		}
 		c, addrs, err := dnsutils.OrderedSRV("kerberos", proto, realm)
 		if err != nil {
 			return count, kdcs, err
@@ -36,7 +114,7 @@ func (c *Config) GetKDCs(realm string, tcp bool) (int, map[int]string, error) {
 			kdcs[k] = strings.TrimRight(v.Target, ".") + ":" + strconv.Itoa(int(v.Port))
 		}
 	} else {
-		// Get the KDCs from the krb5.conf an order them randomly for preference.
+		// Get the KDCs from the krb5.conf in the order configured. The client orders them by their health.
 		var ks []string
 		for _, r := range c.Realms {
 			if r.Realm == realm {
@@ -48,11 +126,136 @@ func (c *Config) GetKDCs(realm string, tcp bool) (int, map[int]string, error) {
 		if count < 1 {
 			return count, kdcs, fmt.Errorf("no KDCs defined in configuration for realm %s", realm)
 		}
-		kdcs = randServOrder(ks)
+		kdcs = orderedServ(ks)
 	}
 	return count, kdcs, nil
 }
 
+// GetKDCProxies returns the count of MS-KKDCP KDC proxy URLs configured for the realm and a map of the URLs keyed on
+// preference order. KDC proxies are configured as kdc entries in the realm's section of the krb5.conf with an https URL.
+func (c *Config) GetKDCProxies(realm string) (int, map[int]string, error) {
+	return c.GetKDCProxiesContext(context.Background(), realm)
+}
+
+// GetKDCProxiesContext returns the count of MS-KKDCP KDC proxy URLs configured for the realm and a map of the URLs keyed
+// on preference order. Cancellation and the deadline of the context provided apply to the DNS URI record lookups.
+func (c *Config) GetKDCProxiesContext(ctx context.Context, realm string) (int, map[int]string, error) {
+	if realm == "" {
+		realm = c.LibDefaults.DefaultRealm
+	}
+	kps := make(map[int]string)
+	var ks []string
+	for _, r := range c.Realms {
+		if r.Realm == realm {
+			ks = append(ks, r.KDCProxy...)
+			break
+		}
+	}
+	if len(ks) < 1 && c.LibDefaults.DNSLookupKDC {
+		ks = c.kdcURIAddresses(ctx, realm, "kkdcp", false)
+	}
+	count := len(ks)
+	if count < 1 {
+		return count, kps, fmt.Errorf("no KDC proxies defined in configuration for realm %s", realm)
+	}
+	return count, orderedServ(ks), nil
+}
+
+// GetMasterKDCs returns the count of master KDCs available and a map of master KDC host names keyed on preference order.
+// Master KDCs are taken from the master_kdc entries of the realm's configuration or, if DNS lookups of KDCs are enabled,
+// from URI records with the master flag set.
+func (c *Config) GetMasterKDCs(realm string, tcp bool) (int, map[int]string, error) {
+	return c.GetMasterKDCsContext(context.Background(), realm, tcp)
+}
+
+// GetMasterKDCsContext returns the count of master KDCs available and a map of master KDC host names keyed on preference
+// order. Cancellation and the deadline of the context provided apply to the DNS URI record lookups.
+func (c *Config) GetMasterKDCsContext(ctx context.Context, realm string, tcp bool) (int, map[int]string, error) {
+	if realm == "" {
+		realm = c.LibDefaults.DefaultRealm
+	}
+	var ks []string
+	for _, r := range c.Realms {
+		if r.Realm == realm {
+			for _, k := range r.MasterKDC {
+				if _, _, err := net.SplitHostPort(k); err != nil {
+					k = net.JoinHostPort(k, "88")
+				}
+				ks = append(ks, k)
+			}
+			break
+		}
+	}
+	if len(ks) < 1 && c.LibDefaults.DNSLookupKDC {
+		proto := "udp"
+		if tcp {
+			proto = "tcp"
+		}
+		ks = c.kdcURIAddresses(ctx, realm, proto, true)
+	}
+	count := len(ks)
+	if count < 1 {
+		return count, map[int]string{}, fmt.Errorf("no master KDCs found for realm %s", realm)
+	}
+	return count, orderedServ(ks), nil
+}
+
+// kdcURIAddresses returns, in preference order, the addresses in the realm's _kerberos URI records for the transport
+// specified. URI records have the form krb5srv:[flags]:transport:residual where the "m" flag marks a master KDC and
+// the transport is udp, tcp or kkdcp.
+// https://web.mit.edu/kerberos/krb5-latest/doc/admin/realm_config.html#kdc-discovery
+func (c *Config) kdcURIAddresses(ctx context.Context, realm, transport string, master bool) []string {
+	if !c.LibDefaults.DNSURILookup {
+		return nil
+	}
+	uris, err := c.uriResolver().LookupURI(ctx, "_kerberos."+realm)
+	if err != nil {
+		return nil
+	}
+	sort.Stable(uriPreference(uris))
+	var ks []string
+	for _, u := range uris {
+		p := strings.SplitN(u.Target, ":", 4)
+		if len(p) != 4 || !strings.EqualFold(p[0], "krb5srv") || !strings.EqualFold(p[2], transport) {
+			continue
+		}
+		if master && !strings.ContainsAny(p[1], "mM") {
+			continue
+		}
+		a := p[3]
+		if transport == "kkdcp" {
+			if !strings.HasPrefix(strings.ToLower(a), "https://") {
+				continue
+			}
+		} else if _, _, err := net.SplitHostPort(a); err != nil {
+			// No port number specified default to 88
+			a = net.JoinHostPort(a, "88")
+		}
+		ks = append(ks, a)
+	}
+	return ks
+}
+
+// uriPreference sorts URI records by ascending priority and then descending weight.
+type uriPreference []URI
+
+func (u uriPreference) Len() int      { return len(u) }
+func (u uriPreference) Swap(i, j int) { u[i], u[j] = u[j], u[i] }
+func (u uriPreference) Less(i, j int) bool {
+	if u[i].Priority != u[j].Priority {
+		return u[i].Priority < u[j].Priority
+	}
+	return u[i].Weight > u[j].Weight
+}
+
+func orderedServ(ks []string) map[int]string {
+	m := make(map[int]string)
+	for i, k := range ks {
+		m[i+1] = k
+	}
+	return m
+}
+
 // GetKpasswdServers returns the count of kpasswd servers available and a map of kpasswd host names keyed on preference order.
 // https://web.mit.edu/kerberos/krb5-latest/doc/admin/conf_files/krb5_conf.html#realms - see kpasswd_server section
 func (c *Config) GetKpasswdServers(realm string, tcp bool) (int, map[int]string, error) {
@@ -83,7 +286,7 @@ func (c *Config) GetKpasswdServers(realm string, tcp bool) (int, map[int]string,
 			kdcs[k] = strings.TrimRight(v.Target, ".") + ":" + strconv.Itoa(int(v.Port))
 		}
 	} else {
-		// Get the KDCs from the krb5.conf an order them randomly for preference.
+		// Get the kpasswd servers from the krb5.conf in the order configured.
 		var ks []string
 		var ka []string
 		for _, r := range c.Realms {
@@ -106,32 +309,7 @@ func (c *Config) GetKpasswdServers(realm string, tcp bool) (int, map[int]string,
 		if count < 1 {
 			return count, kdcs, fmt.Errorf("no kpasswd or kadmin defined in configuration for realm %s", realm)
 		}
-		kdcs = randServOrder(ks)
+		kdcs = orderedServ(ks)
 	}
 	return count, kdcs, nil
 }
-
-func randServOrder(ks []string) map[int]string {
-	kdcs := make(map[int]string)
-	count := len(ks)
-	i := 1
-	if count > 1 {
-		l := len(ks)
-		for l > 0 {
-			ri := rand.Intn(l)
-			kdcs[i] = ks[ri]
-			if l > 1 {
-				// Remove the entry from the source slice by swapping with the last entry and truncating
-				ks[len(ks)-1], ks[ri] = ks[ri], ks[len(ks)-1]
-				ks = ks[:len(ks)-1]
-				l = len(ks)
-			} else {
-				l = 0
-			}
-			i++
-		}
-	} else {
-		kdcs[i] = ks[0]
-	}
-	return kdcs
-}
@@ -3,13 +3,16 @@ package config
 
 import (
 	"bufio"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"os"
 	"os/user"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -24,8 +27,11 @@ type Config struct {
 	LibDefaults *LibDefaults
 	Realms      []Realm
 	DomainRealm DomainRealm
-	//CaPaths
-	//AppDefaults
+	CAPaths     CAPaths
+	AppDefaults *AppDefaults
+	Resolver    Resolver
+	// Warnings lists the directives, sections and relations in the configuration that are not supported and so ignored.
+	Warnings []string
 	//Plugins
 }
 
@@ -38,6 +44,8 @@ func NewConfig() *Config {
 	return &Config{
 		LibDefaults: newLibDefaults(),
 		DomainRealm: d,
+		CAPaths:     make(CAPaths),
+		AppDefaults: newAppDefaults(),
 	}
 }
 
@@ -45,12 +53,12 @@ func NewConfig() *Config {
 type LibDefaults struct {
 	AllowWeakCrypto bool //default false
 	// ap_req_checksum_type int //unlikely to support this
-	Canonicalize bool          //default false
-	CCacheType   int           //default is 4. unlikely to implement older
-	Clockskew    time.Duration //max allowed skew in seconds, default 300
-	//Default_ccache_name string // default /tmp/krb5cc_%{uid} //Not implementing as will hold in memory
-	DefaultClientKeytabName string //default /usr/local/var/krb5/user/%{euid}/client.keytab
-	DefaultKeytabName       string //default /etc/krb5.keytab
+	Canonicalize            bool          //default false
+	CCacheType              int           //default is 4. unlikely to implement older
+	Clockskew               time.Duration //max allowed skew in seconds, default 300
+	DefaultCCacheName       string        //default FILE:/tmp/krb5cc_%{uid}
+	DefaultClientKeytabName string        //default FILE:/usr/local/var/krb5/user/%{euid}/client.keytab
+	DefaultKeytabName       string        //default FILE:/etc/krb5.keytab
 	DefaultRealm            string
 	DefaultTGSEnctypes      []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
 	DefaultTktEnctypes      []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
@@ -59,6 +67,7 @@ type LibDefaults struct {
 	DNSCanonicalizeHostname bool     //default true
 	DNSLookupKDC            bool     //default false
 	DNSLookupRealm          bool
+	DNSURILookup            bool           //default false. Also requires dns_lookup_kdc
 	ExtraAddresses          []net.IP       //Not implementing yet
 	Forwardable             bool           //default false
 	IgnoreAcceptorHostname  bool           //default false
@@ -71,6 +80,7 @@ type LibDefaults struct {
 	PermittedEnctypes   []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
 	PermittedEnctypeIDs []int32
 	//plugin_base_dir string //not supporting plugins
+	PKINITEKUChecking     string        //default kpKDC
 	PreferredPreauthTypes []int         //default “17, 16, 15, 14”, which forces libkrb5 to attempt to use PKINIT if it is supported
 	Proxiable             bool          //default false
 	RDNS                  bool          //default true
@@ -80,15 +90,16 @@ type LibDefaults struct {
 	TicketLifetime        time.Duration //default 1 day
 	UDPPreferenceLimit    int           // 1 means to always use tcp. MIT krb5 has a default value of 1465, and it prevents user setting more than 32700.
 	VerifyAPReqNofail     bool          //default false
+
+	// set records the relations set by the configuration parsed.
+	set map[string]bool
 }
 
 // Create a new LibDefaults struct.
 func newLibDefaults() *LibDefaults {
-	uid := "0"
 	var hdir string
 	usr, _ := user.Current()
 	if usr != nil {
-		uid = usr.Uid
 		hdir = usr.HomeDir
 	}
 	opts := asn1.BitString{}
@@ -97,8 +108,9 @@ func newLibDefaults() *LibDefaults {
 	return &LibDefaults{
 		CCacheType:              4,
 		Clockskew:               time.Duration(300) * time.Second,
-		DefaultClientKeytabName: fmt.Sprintf("/usr/local/var/krb5/user/%s/client.keytab", uid),
-		DefaultKeytabName:       "/etc/krb5.keytab",
+		DefaultCCacheName:       "FILE:/tmp/krb5cc_%{uid}",
+		DefaultClientKeytabName: "FILE:/usr/local/var/krb5/user/%{euid}/client.keytab",
+		DefaultKeytabName:       "FILE:/etc/krb5.keytab",
 		DefaultTGSEnctypes:      []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
 		DefaultTktEnctypes:      []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
 		DNSCanonicalizeHostname: true,
@@ -107,6 +119,7 @@ func newLibDefaults() *LibDefaults {
 		KDCTimeSync:             1,
 		NoAddresses:             true,
 		PermittedEnctypes:       []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
+		PKINITEKUChecking:       "kpKDC",
 		RDNS:                    true,
 		RealmTryDomains:         -1,
 		SafeChecksumType:        8,
@@ -116,18 +129,20 @@ func newLibDefaults() *LibDefaults {
 	}
 }
 
-// Parse the lines of the [libdefaults] section of the configuration into the LibDefaults struct.
-func (l *LibDefaults) parseLines(lines []string) error {
+// Parse the lines of the [libdefaults] section of the configuration into the LibDefaults struct. Warnings are returned
+// for relations that are not supported.
+func (l *LibDefaults) parseLines(lines []string) ([]string, error) {
+	var warnings []string
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 		if line == "" {
 			continue
 		}
 		if strings.Contains(line, "v4_") {
-			return errors.New("v4 configurations are not supported in Realms section")
+			return nil, errors.New("v4 configurations are not supported in Realms section")
 		}
 		if !strings.Contains(line, "=") {
-			return fmt.Errorf("libdefaults configuration line invalid: %s", line)
+			return nil, fmt.Errorf("libdefaults configuration line invalid: %s", line)
 		}
 
 		p := strings.Split(line, "=")
@@ -136,28 +151,30 @@ func (l *LibDefaults) parseLines(lines []string) error {
 		case "allow_weak_crypto":
 			v, err := parseBoolean(p[1])
 			if err != nil {
-				return fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
 			}
 			l.AllowWeakCrypto = v
 		case "canonicalize":
 			v, err := parseBoolean(p[1])
 			if err != nil {
-				return fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
 			}
 			l.Canonicalize = v
 		case "ccache_type":
 			p[1] = strings.TrimSpace(p[1])
 			v, err := strconv.ParseUint(p[1], 10, 32)
 			if err != nil || v < 0 || v > 4 {
-				return fmt.Errorf("libdefaults configuration line invalid: %s", line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid: %s", line)
 			}
 			l.CCacheType = int(v)
 		case "clockskew":
 			d, err := parseDuration(p[1])
 			if err != nil {
-				return fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
 			}
 			l.Clockskew = d
+		case "default_ccache_name":
+			l.DefaultCCacheName = strings.TrimSpace(p[1])
 		case "default_client_keytab_name":
 			l.DefaultClientKeytabName = strings.TrimSpace(p[1])
 		case "default_keytab_name":
@@ -171,21 +188,27 @@ func (l *LibDefaults) parseLines(lines []string) error {
 		case "dns_canonicalize_hostname":
 			v, err := parseBoolean(p[1])
 			if err != nil {
-				return fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
 			}
 			l.DNSCanonicalizeHostname = v
 		case "dns_lookup_kdc":
 			v, err := parseBoolean(p[1])
 			if err != nil {
-				return fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
 			}
 			l.DNSLookupKDC = v
 		case "dns_lookup_realm":
 			v, err := parseBoolean(p[1])
 			if err != nil {
-				return fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
 			}
 			l.DNSLookupRealm = v
+		case "dns_uri_lookup":
+			v, err := parseBoolean(p[1])
+			if err != nil {
+				return nil, fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
+			}
+			l.DNSURILookup = v
 		case "extra_addresses":
 			ipStr := strings.TrimSpace(p[1])
 			for _, ip := range strings.Split(ipStr, ",") {
@@ -196,19 +219,19 @@ func (l *LibDefaults) parseLines(lines []string) error {
 		case "forwardable":
 			v, err := parseBoolean(p[1])
 			if err != nil {
-				return fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
 			}
 			l.Forwardable = v
 		case "ignore_acceptor_hostname":
 			v, err := parseBoolean(p[1])
 			if err != nil {
-				return fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
 			}
 			l.IgnoreAcceptorHostname = v
 		case "k5login_authoritative":
 			v, err := parseBoolean(p[1])
 			if err != nil {
-				return fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
 			}
 			l.K5LoginAuthoritative = v
 		case "k5login_directory":
@@ -218,7 +241,7 @@ func (l *LibDefaults) parseLines(lines []string) error {
 			v = strings.Replace(v, "0x", "", -1)
 			b, err := hex.DecodeString(v)
 			if err != nil {
-				return fmt.Errorf("libdefaults configuration line invalid: %s", line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid: %s", line)
 			}
 			l.KDCDefaultOptions.Bytes = b
 			l.KDCDefaultOptions.BitLength = len(b) * 8
@@ -226,25 +249,31 @@ func (l *LibDefaults) parseLines(lines []string) error {
 			p[1] = strings.TrimSpace(p[1])
 			v, err := strconv.ParseInt(p[1], 10, 32)
 			if err != nil || v < 0 {
-				return fmt.Errorf("libdefaults configuration line invalid: %s", line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid: %s", line)
 			}
 			l.KDCTimeSync = int(v)
 		case "noaddresses":
 			v, err := parseBoolean(p[1])
 			if err != nil {
-				return fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
 			}
 			l.NoAddresses = v
 		case "permitted_enctypes":
 			l.PermittedEnctypes = strings.Fields(p[1])
+		case "pkinit_eku_checking":
+			v, err := parseEKUChecking(p[1])
+			if err != nil {
+				return nil, fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
+			}
+			l.PKINITEKUChecking = v
 		case "preferred_preauth_types":
 			p[1] = strings.TrimSpace(p[1])
 			t := strings.Split(p[1], ",")
 			var v []int
 			for _, s := range t {
-				i, err := strconv.ParseInt(s, 10, 32)
+				i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 32)
 				if err != nil {
-					return fmt.Errorf("libdefaults configuration line invalid: %s", line)
+					return nil, fmt.Errorf("libdefaults configuration line invalid: %s", line)
 				}
 				v = append(v, int(i))
 			}
@@ -252,63 +281,67 @@ func (l *LibDefaults) parseLines(lines []string) error {
 		case "proxiable":
 			v, err := parseBoolean(p[1])
 			if err != nil {
-				return fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
 			}
 			l.Proxiable = v
 		case "rdns":
 			v, err := parseBoolean(p[1])
 			if err != nil {
-				return fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
 			}
 			l.RDNS = v
 		case "realm_try_domains":
 			p[1] = strings.TrimSpace(p[1])
 			v, err := strconv.ParseInt(p[1], 10, 32)
 			if err != nil || v < -1 {
-				return fmt.Errorf("libdefaults configuration line invalid: %s", line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid: %s", line)
 			}
 			l.RealmTryDomains = int(v)
 		case "renew_lifetime":
 			d, err := parseDuration(p[1])
 			if err != nil {
-				return fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
 			}
 			l.RenewLifetime = d
 		case "safe_checksum_type":
 			p[1] = strings.TrimSpace(p[1])
 			v, err := strconv.ParseInt(p[1], 10, 32)
 			if err != nil || v < 0 {
-				return fmt.Errorf("libdefaults configuration line invalid: %s", line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid: %s", line)
 			}
 			l.SafeChecksumType = int(v)
 		case "ticket_lifetime":
 			d, err := parseDuration(p[1])
 			if err != nil {
-				return fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
 			}
 			l.TicketLifetime = d
 		case "udp_preference_limit":
 			p[1] = strings.TrimSpace(p[1])
 			v, err := strconv.ParseUint(p[1], 10, 32)
 			if err != nil || v > 32700 {
-				return fmt.Errorf("libdefaults configuration line invalid: %s", line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid: %s", line)
 			}
 			l.UDPPreferenceLimit = int(v)
 		case "verify_ap_req_nofail":
 			v, err := parseBoolean(p[1])
 			if err != nil {
-				return fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
+				return nil, fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
 			}
 			l.VerifyAPReqNofail = v
 		default:
-			//Ignore the line
+			warnings = append(warnings, fmt.Sprintf("libdefaults relation %s is not supported", key))
 			continue
 		}
+		if l.set == nil {
+			l.set = make(map[string]bool)
+		}
+		l.set[key] = true
 	}
 	l.DefaultTGSEnctypeIDs = parseETypes(l.DefaultTGSEnctypes, l.AllowWeakCrypto)
 	l.DefaultTktEnctypeIDs = parseETypes(l.DefaultTktEnctypes, l.AllowWeakCrypto)
 	l.PermittedEnctypeIDs = parseETypes(l.PermittedEnctypes, l.AllowWeakCrypto)
-	return nil
+	return warnings, nil
 }
 
 // Realm represents an entry in the [realms] section of the configuration.
@@ -319,26 +352,33 @@ type Realm struct {
 	//auth_to_local_names //Not implementing for now
 	DefaultDomain string
 	KDC           []string
+	KDCProxy      []string //https URLs of MS-KKDCP KDC proxies given as kdc entries
 	KPasswdServer []string //default admin_server:464
 	MasterKDC     []string
+	//PKINIT
+	PKINITEKUChecking string   //default that of libdefaults
+	PKINITKDCHostname []string //host names accepted in a dNSName of the KDC's certificate
 }
 
-// Parse the lines of a [realms] entry into the Realm struct.
-func (r *Realm) parseLines(name string, lines []string) error {
+// Parse the lines of a [realms] entry into the Realm struct. Warnings are returned for relations that are not supported.
+func (r *Realm) parseLines(name string, lines []string) ([]string, error) {
 	r.Realm = name
+	var warnings []string
 	var adminServerFinal bool
 	var KDCFinal bool
+	var KDCProxyFinal bool
 	var kpasswdServerFinal bool
 	var masterKDCFinal bool
+	var pkinitKDCHostnameFinal bool
 	for _, line := range lines {
 		if strings.TrimSpace(line) == "" {
 			continue
 		}
 		if !strings.Contains(line, "=") {
-			return fmt.Errorf("realm configuration line invalid: %s", line)
+			return nil, fmt.Errorf("realm configuration line invalid: %s", line)
 		}
 
-		p := strings.Split(line, "=")
+		p := strings.SplitN(line, "=", 2)
 		key := strings.TrimSpace(strings.ToLower(p[0]))
 		v := strings.TrimSpace(p[1])
 		switch key {
@@ -347,6 +387,11 @@ func (r *Realm) parseLines(name string, lines []string) error {
 		case "default_domain":
 			r.DefaultDomain = v
 		case "kdc":
+			if strings.HasPrefix(strings.ToLower(v), "https://") {
+				// MS-KKDCP KDC proxy URL
+				appendUntilFinal(&r.KDCProxy, v, &KDCProxyFinal)
+				continue
+			}
 			if !strings.Contains(v, ":") {
 				// No port number specified default to 88
 				if strings.HasSuffix(v, `*`) {
@@ -360,9 +405,16 @@ func (r *Realm) parseLines(name string, lines []string) error {
 			appendUntilFinal(&r.KPasswdServer, v, &kpasswdServerFinal)
 		case "master_kdc":
 			appendUntilFinal(&r.MasterKDC, v, &masterKDCFinal)
+		case "pkinit_eku_checking":
+			e, err := parseEKUChecking(v)
+			if err != nil {
+				return nil, fmt.Errorf("realm configuration line invalid. %v: %s", err, line)
+			}
+			r.PKINITEKUChecking = e
+		case "pkinit_kdc_hostname":
+			appendUntilFinal(&r.PKINITKDCHostname, v, &pkinitKDCHostnameFinal)
 		default:
-			//Ignore the line
-			continue
+			warnings = append(warnings, fmt.Sprintf("realm %s relation %s is not supported", name, key))
 		}
 	}
 	//default for Kpasswd_server = admin_server:464
@@ -372,12 +424,15 @@ func (r *Realm) parseLines(name string, lines []string) error {
 			r.KPasswdServer = append(r.KPasswdServer, s[0]+":464")
 		}
 	}
-	return nil
+	return warnings, nil
 }
 
-// Parse the lines of the [realms] section of the configuration into an slice of Realm structs.
-func parseRealms(lines []string) ([]Realm, error) {
-	var realms []Realm
+// Parse the lines of the [realms] section of the configuration into an slice of Realm structs. Warnings are returned for
+// relations that are not supported. The relations of a realm defined more than once, such as in separate included files,
+// are merged into a single Realm.
+func parseRealms(lines []string) ([]Realm, []string, error) {
+	var names []string
+	blocks := make(map[string][]string)
 	start := -1
 	var name string
 	for i, l := range lines {
@@ -385,16 +440,16 @@ func parseRealms(lines []string) ([]Realm, error) {
 			continue
 		}
 		if strings.Contains(l, "v4_") {
-			return nil, errors.New("v4 configurations are not supported in Realms section")
+			return nil, nil, errors.New("v4 configurations are not supported in Realms section")
 		}
 		if strings.Contains(l, "{") {
 			if start >= 0 {
 				// already started a block!!!
-				return nil, errors.New("invalid Realms section in configuration")
+				return nil, nil, errors.New("invalid Realms section in configuration")
 			}
 			start = i
 			if !strings.Contains(l, "=") {
-				return nil, fmt.Errorf("realm configuration line invalid: %s", l)
+				return nil, nil, fmt.Errorf("realm configuration line invalid: %s", l)
 			}
 			p := strings.Split(l, "=")
 			name = strings.TrimSpace(p[0])
@@ -402,15 +457,28 @@ func parseRealms(lines []string) ([]Realm, error) {
 		if strings.Contains(l, "}") {
 			if start < 0 {
 				// but not started a block!!!
-				return nil, errors.New("invalid Realms section in configuration")
+				return nil, nil, errors.New("invalid Realms section in configuration")
+			}
+			if _, ok := blocks[name]; !ok {
+				names = append(names, name)
 			}
-			var r Realm
-			r.parseLines(name, lines[start+1:i])
-			realms = append(realms, r)
+			blocks[name] = append(blocks[name], lines[start+1:i]...)
 			start = -1
 		}
 	}
-	return realms, nil
+	var realms []Realm
+	var warnings []string
+	for _, name := range names {
+		var r Realm
+		w, err := r.parseLines(name, blocks[name])
+		if err != nil {
+			// An invalid relation does not prevent the use of the rest of the realm's configuration
+			w = append(w, err.Error())
+		}
+		warnings = append(warnings, w...)
+		realms = append(realms, r)
+	}
+	return realms, warnings, nil
 }
 
 // DomainRealm maps the domains to realms representing the [domain_realm] section of the configuration.
@@ -444,7 +512,8 @@ func (d *DomainRealm) deleteMapping(domain, realm string) {
 }
 
 // ResolveRealm resolves the kerberos realm for the specified domain name from the domain to realm mapping.
-// The most specific mapping is returned.
+// The most specific mapping is returned. If there is no mapping and dns_lookup_realm is enabled the realm is looked up
+// in _kerberos TXT records.
 func (c *Config) ResolveRealm(domainName string) string {
 	domainName = strings.TrimSuffix(domainName, ".")
 
@@ -461,9 +530,123 @@ func (c *Config) ResolveRealm(domainName string) string {
 			return r
 		}
 	}
+
+	// Look up the realm in DNS TXT records if configured to do so in krb5.conf
+	if c.LibDefaults.DNSLookupRealm {
+		if r, err := c.lookupRealm(context.Background(), domainName); err == nil {
+			return r
+		}
+	}
 	return c.LibDefaults.DefaultRealm
 }
 
+// CAPaths represents the [capaths] section of the configuration. It maps client realms to server realms and the
+// intermediate realms, in order, of the authentication path between them. A "." value indicates a direct path.
+type CAPaths map[string]map[string][]string
+
+// Parse the lines of the [capaths] section of the configuration and add to the paths.
+func (p *CAPaths) parseLines(lines []string) error {
+	var client string
+	var inBlock bool
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		if strings.Contains(l, "{") {
+			if inBlock {
+				return errors.New("invalid capaths section in configuration")
+			}
+			if !strings.Contains(l, "=") {
+				return fmt.Errorf("capaths configuration line invalid: %s", l)
+			}
+			client = strings.TrimSpace(strings.SplitN(l, "=", 2)[0])
+			if _, ok := (*p)[client]; !ok {
+				(*p)[client] = make(map[string][]string)
+			}
+			inBlock = true
+			continue
+		}
+		if strings.Contains(l, "}") {
+			if !inBlock {
+				return errors.New("invalid capaths section in configuration")
+			}
+			inBlock = false
+			continue
+		}
+		if !inBlock || !strings.Contains(l, "=") {
+			return fmt.Errorf("capaths configuration line invalid: %s", l)
+		}
+		kv := strings.SplitN(l, "=", 2)
+		server := strings.TrimSpace(kv[0])
+		(*p)[client][server] = append((*p)[client][server], strings.Fields(kv[1])...)
+	}
+	return nil
+}
+
+// RealmPath returns the realms, in order, through which a client of the client realm obtains cross-realm TGTs to reach
+// the server realm. The path ends with the server realm. It is taken from the [capaths] section of the configuration if
+// defined there, otherwise the hierarchical path implied by the realm names is returned.
+func (c *Config) RealmPath(clientRealm, serverRealm string) []string {
+	if clientRealm == serverRealm {
+		return nil
+	}
+	if ims, ok := c.CAPaths[clientRealm][serverRealm]; ok {
+		var path []string
+		for _, r := range ims {
+			if r != "." && r != serverRealm {
+				path = append(path, r)
+			}
+		}
+		return append(path, serverRealm)
+	}
+	return hierarchicalRealmPath(clientRealm, serverRealm)
+}
+
+// PKINITEKUChecking returns the extended key usage required of the certificate of the realm's KDC by PKINIT, as given by
+// the pkinit_eku_checking relation of the realm or otherwise of the [libdefaults] section.
+func (c *Config) PKINITEKUChecking(realm string) string {
+	for _, r := range c.Realms {
+		if r.Realm == realm && r.PKINITEKUChecking != "" {
+			return r.PKINITEKUChecking
+		}
+	}
+	return c.LibDefaults.PKINITEKUChecking
+}
+
+// PKINITKDCHostnames returns the host names accepted by PKINIT in a dNSName subject alternative name of the certificate
+// of the realm's KDC, as given by the pkinit_kdc_hostname relations of the realm.
+func (c *Config) PKINITKDCHostnames(realm string) []string {
+	for _, r := range c.Realms {
+		if r.Realm == realm {
+			return r.PKINITKDCHostname
+		}
+	}
+	return nil
+}
+
+// hierarchicalRealmPath returns the path from the client realm up the realm hierarchy to the closest common ancestor
+// realm, or the top level realm if there is not one, and then down to the server realm.
+func hierarchicalRealmPath(clientRealm, serverRealm string) []string {
+	cp := strings.Split(clientRealm, ".")
+	sp := strings.Split(serverRealm, ".")
+	var common int
+	for common < len(cp) && common < len(sp) && cp[len(cp)-1-common] == sp[len(sp)-1-common] {
+		common++
+	}
+	up := len(cp) - common
+	if common == 0 {
+		up--
+	}
+	var path []string
+	for i := 1; i <= up; i++ {
+		path = append(path, strings.Join(cp[i:], "."))
+	}
+	for i := len(sp) - 1 - common; i >= 0; i-- {
+		path = append(path, strings.Join(sp[i:], "."))
+	}
+	return path
+}
+
 // Load the KRB5 configuration from the specified file path.
 func Load(cfgPath string) (*Config, error) {
 	fh, err := os.Open(cfgPath)
@@ -472,7 +655,7 @@ func Load(cfgPath string) (*Config, error) {
 	}
 	defer fh.Close()
 	scanner := bufio.NewScanner(fh)
-	return NewConfigFromScanner(scanner)
+	return newConfigFromScanner(scanner, cfgPath)
 }
 
 // NewConfigFromString creates a new Config struct from a string.
@@ -489,68 +672,178 @@ func NewConfigFromReader(r io.Reader) (*Config, error) {
 
 // NewConfigFromScanner creates a new Config struct from a bufio.Scanner.
 func NewConfigFromScanner(scanner *bufio.Scanner) (*Config, error) {
+	return newConfigFromScanner(scanner, "")
+}
+
+// sectionHeader matches the line starting a section of the configuration and captures the section's name.
+var sectionHeader = regexp.MustCompile(`^\s*\[(.*)\]\s*`)
+
+// Sections of the configuration used only by the KDC and administration servers, ignored without warning.
+var serverSections = []string{"logging", "kdcdefaults", "dbdefaults", "dbmodules"}
+
+func newConfigFromScanner(scanner *bufio.Scanner, path string) (*Config, error) {
 	c := NewConfig()
-	sections := make(map[int]string)
-	var sectionLineNum []int
-	var lines []string
-	for scanner.Scan() {
-		// Skip comments and blank lines
-		if matched, _ := regexp.MatchString(`^\s*(#|;|\n)`, scanner.Text()); matched {
-			continue
-		}
-		if matched, _ := regexp.MatchString(`^\s*\[libdefaults\]\s*`, scanner.Text()); matched {
-			sections[len(lines)] = "libdefaults"
-			sectionLineNum = append(sectionLineNum, len(lines))
-			continue
-		}
-		if matched, _ := regexp.MatchString(`^\s*\[realms\]\s*`, scanner.Text()); matched {
-			sections[len(lines)] = "realms"
-			sectionLineNum = append(sectionLineNum, len(lines))
-			continue
-		}
-		if matched, _ := regexp.MatchString(`^\s*\[domain_realm\]\s*`, scanner.Text()); matched {
-			sections[len(lines)] = "domain_realm"
-			sectionLineNum = append(sectionLineNum, len(lines))
+	var stack []string
+	if path != "" {
+		stack = append(stack, absPath(path))
+	}
+	raw, err := c.readLines(scanner, stack)
+	if err != nil {
+		return nil, err
+	}
+	// Lines of a section that appears more than once, such as when it is continued after an include, are parsed together
+	var order []string
+	sections := make(map[string][]string)
+	var section string
+	for _, l := range raw {
+		if m := sectionHeader.FindStringSubmatch(l); m != nil {
+			section = strings.ToLower(strings.TrimSpace(m[1]))
+			if _, ok := sections[section]; !ok {
+				order = append(order, section)
+				sections[section] = []string{}
+			}
 			continue
 		}
-		if matched, _ := regexp.MatchString(`^\s*\[.*\]\s*`, scanner.Text()); matched {
-			sections[len(lines)] = "unknown_section"
-			sectionLineNum = append(sectionLineNum, len(lines))
-			continue
+		if section != "" {
+			sections[section] = append(sections[section], l)
 		}
-		lines = append(lines, scanner.Text())
 	}
-	for i, start := range sectionLineNum {
-		var end int
-		if i+1 >= len(sectionLineNum) {
-			end = len(lines)
-		} else {
-			end = sectionLineNum[i+1]
-		}
-		switch section := sections[start]; section {
+	for _, section := range order {
+		lines := sections[section]
+		switch section {
 		case "libdefaults":
-			err := c.LibDefaults.parseLines(lines[start:end])
+			w, err := c.LibDefaults.parseLines(lines)
 			if err != nil {
 				return nil, fmt.Errorf("error processing libdefaults section: %v", err)
 			}
+			c.Warnings = append(c.Warnings, w...)
 		case "realms":
-			realms, err := parseRealms(lines[start:end])
+			realms, w, err := parseRealms(lines)
 			if err != nil {
 				return nil, fmt.Errorf("error processing realms section: %v", err)
 			}
 			c.Realms = realms
+			c.Warnings = append(c.Warnings, w...)
 		case "domain_realm":
-			err := c.DomainRealm.parseLines(lines[start:end])
+			err := c.DomainRealm.parseLines(lines)
 			if err != nil {
 				return nil, fmt.Errorf("error processing domaain_realm section: %v", err)
 			}
+		case "capaths":
+			err := c.CAPaths.parseLines(lines)
+			if err != nil {
+				return nil, fmt.Errorf("error processing capaths section: %v", err)
+			}
+		case "appdefaults":
+			err := c.AppDefaults.parseLines(lines)
+			if err != nil {
+				return nil, fmt.Errorf("error processing appdefaults section: %v", err)
+			}
+		case "plugins":
+			c.Warnings = append(c.Warnings, "plugins section is not supported")
 		default:
-			continue
+			var server bool
+			for _, s := range serverSections {
+				if section == s {
+					server = true
+					break
+				}
+			}
+			if !server {
+				c.Warnings = append(c.Warnings, fmt.Sprintf("unknown section [%s] ignored", section))
+			}
 		}
 	}
 	return c, nil
 }
 
+// includeDirective matches the include, includedir and module directives and captures the directive and its argument.
+var includeDirective = regexp.MustCompile(`^\s*(include|includedir|module)\s+([^=]+)$`)
+
+// includeDirFileName matches the names of the files in an includedir directory that are read.
+var includeDirFileName = regexp.MustCompile(`^([A-Za-z0-9_-]+|[^.].*\.conf)$`)
+
+// readLines returns the lines of the configuration, less comments, with the contents of included files in place of the
+// include and includedir directives. The stack holds the paths of the files being read to detect include cycles.
+// https://web.mit.edu/kerberos/krb5-latest/doc/admin/conf_files/krb5_conf.html#structure
+func (c *Config) readLines(scanner *bufio.Scanner, stack []string) ([]string, error) {
+	var lines []string
+	var section string
+	for scanner.Scan() {
+		l := scanner.Text()
+		// Skip comments and blank lines
+		if matched, _ := regexp.MatchString(`^\s*(#|;|\n)`, l); matched {
+			continue
+		}
+		if sectionHeader.MatchString(l) {
+			section = l
+		}
+		m := includeDirective.FindStringSubmatch(l)
+		if m == nil {
+			lines = append(lines, l)
+			continue
+		}
+		arg := strings.TrimSpace(m[2])
+		var paths []string
+		switch m[1] {
+		case "module":
+			c.Warnings = append(c.Warnings, fmt.Sprintf("module directive for %s is not supported", arg))
+			continue
+		case "include":
+			paths = []string{arg}
+		case "includedir":
+			fs, err := ioutil.ReadDir(arg)
+			if err != nil {
+				return nil, fmt.Errorf("configuration directory could not be read: %s %v", arg, err)
+			}
+			for _, f := range fs {
+				if f.Mode().IsRegular() && includeDirFileName.MatchString(f.Name()) {
+					paths = append(paths, filepath.Join(arg, f.Name()))
+				}
+			}
+		}
+		for _, p := range paths {
+			inc, err := c.readFile(p, stack)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, inc...)
+		}
+		// Lines following the directive continue the section it was in
+		if section != "" && len(paths) > 0 {
+			lines = append(lines, section)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading configuration: %v", err)
+	}
+	return lines, nil
+}
+
+// readFile returns the lines of the included configuration file at the path provided.
+func (c *Config) readFile(path string, stack []string) ([]string, error) {
+	path = absPath(path)
+	for _, s := range stack {
+		if s == path {
+			return nil, fmt.Errorf("configuration file %s includes itself", path)
+		}
+	}
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("included configuration file could not be opened: %s %v", path, err)
+	}
+	defer fh.Close()
+	return c.readLines(bufio.NewScanner(fh), append(stack[:len(stack):len(stack)], path))
+}
+
+// absPath returns the absolute form of the path so that files included by different paths are recognised as the same.
+func absPath(path string) string {
+	if a, err := filepath.Abs(path); err == nil {
+		return a
+	}
+	return filepath.Clean(path)
+}
+
 // Parse a space delimited list of ETypes into a list of EType numbers optionally filtering out weak ETypes.
 func parseETypes(s []string, w bool) []int32 {
 	var eti []int32
@@ -652,6 +945,17 @@ func parseBoolean(s string) (bool, error) {
 	return false, errors.New("invalid boolean value")
 }
 
+// Parse the extended key usage required of a KDC's certificate by PKINIT into its canonical name.
+func parseEKUChecking(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	for _, v := range []string{"kpKDC", "kpServerAuth", "none"} {
+		if strings.EqualFold(s, v) {
+			return v, nil
+		}
+	}
+	return "", errors.New("invalid PKINIT EKU checking value")
+}
+
 // Parse array of strings but stop if an asterisk is placed at the end of a line.
 func appendUntilFinal(s *[]string, value string, final *bool) {
 	if *final {
@@ -1,8 +1,15 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
+	"net"
 	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -361,6 +368,112 @@ func TestLoadTabs(t *testing.T) {
 
 }
 
+func TestLoadKDCProxy(t *testing.T) {
+	t.Parallel()
+	c, err := NewConfigFromString(`[libdefaults]
+ default_realm = TEST.GOKRB5
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = https://kdcproxy1.test.gokrb5/KdcProxy
+  kdc = https://kdcproxy2.test.gokrb5:8443/KdcProxy?realm=TEST.GOKRB5
+  kdc = 10.80.88.88
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.Equal(t, []string{"https://kdcproxy1.test.gokrb5/KdcProxy", "https://kdcproxy2.test.gokrb5:8443/KdcProxy?realm=TEST.GOKRB5"}, c.Realms[0].KDCProxy, "[realm] KDC proxies not as expected")
+	assert.Equal(t, []string{"10.80.88.88:88"}, c.Realms[0].KDC, "[realm] Kdc not as expectd")
+	count, kps, err := c.GetKDCProxies("")
+	if err != nil {
+		t.Fatalf("Error getting KDC proxies: %v", err)
+	}
+	assert.Equal(t, 2, count, "Number of KDC proxies not as expected")
+	assert.Equal(t, "https://kdcproxy1.test.gokrb5/KdcProxy", kps[1], "First KDC proxy not as expected")
+	_, _, err = c.GetKDCProxies("EXAMPLE.COM")
+	assert.Error(t, err, "Error expected for realm without KDC proxies")
+}
+
+func TestLoadPKINIT(t *testing.T) {
+	t.Parallel()
+	c, err := NewConfigFromString(`[libdefaults]
+ default_realm = TEST.GOKRB5
+ pkinit_eku_checking = none
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = 10.80.88.88
+ }
+ AD.GOKRB5 = {
+  kdc = dc1.ad.gokrb5
+  pkinit_eku_checking = KPServerAuth
+  pkinit_kdc_hostname = dc1.ad.gokrb5
+  pkinit_kdc_hostname = dc2.ad.gokrb5
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.Empty(t, c.Warnings, "PKINIT relations should not cause warnings")
+	assert.Equal(t, "none", c.PKINITEKUChecking("TEST.GOKRB5"), "EKU checking from [libdefaults] not as expected")
+	assert.Equal(t, "kpServerAuth", c.PKINITEKUChecking("AD.GOKRB5"), "EKU checking of realm not as expected")
+	assert.Empty(t, c.PKINITKDCHostnames("TEST.GOKRB5"), "KDC host names not as expected")
+	assert.Equal(t, []string{"dc1.ad.gokrb5", "dc2.ad.gokrb5"}, c.PKINITKDCHostnames("AD.GOKRB5"), "KDC host names of realm not as expected")
+	assert.Equal(t, "kpKDC", NewConfig().PKINITEKUChecking("TEST.GOKRB5"), "Default EKU checking not as expected")
+
+	_, err = NewConfigFromString(`[libdefaults]
+ pkinit_eku_checking = kpOther
+`)
+	assert.Error(t, err, "Invalid EKU checking value should not load")
+}
+
+func TestLoadCAPaths(t *testing.T) {
+	t.Parallel()
+	c, err := NewConfigFromString(`[libdefaults]
+ default_realm = ANL.GOV
+
+[capaths]
+ ANL.GOV = {
+  TEST.ANL.GOV = .
+  PNL.GOV = ES.NET
+  NERSC.GOV = ES.NET
+  DOE.GOV = ES.NET
+  EXAMPLE.COM = ES.NET
+  EXAMPLE.COM = HUB.EXAMPLE.COM
+ }
+ PNL.GOV = {
+  ANL.GOV = ES.NET
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.Equal(t, []string{"."}, c.CAPaths["ANL.GOV"]["TEST.ANL.GOV"], "[capaths] direct path not as expected")
+	assert.Equal(t, []string{"ES.NET", "HUB.EXAMPLE.COM"}, c.CAPaths["ANL.GOV"]["EXAMPLE.COM"], "[capaths] multi-hop path not as expected")
+	assert.Equal(t, []string{"ES.NET"}, c.CAPaths["PNL.GOV"]["ANL.GOV"], "[capaths] path not as expected")
+
+	tests := []struct {
+		client string
+		server string
+		want   []string
+	}{
+		{"ANL.GOV", "ANL.GOV", nil},
+		{"ANL.GOV", "TEST.ANL.GOV", []string{"TEST.ANL.GOV"}},
+		{"ANL.GOV", "PNL.GOV", []string{"ES.NET", "PNL.GOV"}},
+		{"ANL.GOV", "EXAMPLE.COM", []string{"ES.NET", "HUB.EXAMPLE.COM", "EXAMPLE.COM"}},
+		// Hierarchical paths where [capaths] is not configured
+		{"A.B.C", "D.B.C", []string{"B.C", "D.B.C"}},
+		{"A.B.C", "B.C", []string{"B.C"}},
+		{"B.C", "A.B.C", []string{"A.B.C"}},
+		{"USERS.CORP.EXAMPLE.COM", "APPS.DEV.EXAMPLE.COM", []string{"CORP.EXAMPLE.COM", "EXAMPLE.COM", "DEV.EXAMPLE.COM", "APPS.DEV.EXAMPLE.COM"}},
+		{"ATHENA.MIT.EDU", "EXAMPLE.COM", []string{"MIT.EDU", "EDU", "COM", "EXAMPLE.COM"}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, c.RealmPath(test.client, test.server), "Realm path not as expected from "+test.client+" to "+test.server)
+	}
+}
+
 func TestParseDuration(t *testing.T) {
 	t.Parallel()
 	// https://web.mit.edu/kerberos/krb5-1.12/doc/basic/date_format.html#duration
@@ -415,3 +528,540 @@ func TestResolveRealm(t *testing.T) {
 		})
 	}
 }
+
+type stubResolver map[string][]string
+
+func (r stubResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if txt, ok := r[name]; ok {
+		return txt, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func TestResolveRealm_DNSLookupRealm(t *testing.T) {
+	t.Parallel()
+	c, err := NewConfigFromString(krb5Conf)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	c.LibDefaults.DNSLookupRealm = true
+	c.Resolver = stubResolver{
+		"_kerberos.host.dev.corp.gokrb5": {"DEV.CORP.GOKRB5"},
+		"_kerberos.corp.gokrb5":          {"CORP.GOKRB5"},
+	}
+
+	tests := []struct {
+		tryDomains int
+		domainName string
+		want       string
+	}{
+		{-1, "hostname1.example.com", "EXAMPLE.COM"},
+		{-1, "host.dev.corp.gokrb5", "DEV.CORP.GOKRB5"},
+		{-1, "other.dev.corp.gokrb5.", "TEST.GOKRB5"},
+		{2, "other.dev.corp.gokrb5.", "CORP.GOKRB5"},
+		{1, "other.dev.corp.gokrb5", "CORP.GOKRB5"},
+		{0, "other.dev.corp.gokrb5", "TEST.GOKRB5"},
+		{-1, "unknown.com", "TEST.GOKRB5"},
+	}
+	for _, tt := range tests {
+		cfg := *c
+		ld := *c.LibDefaults
+		ld.RealmTryDomains = tt.tryDomains
+		cfg.LibDefaults = &ld
+		assert.Equal(t, tt.want, cfg.ResolveRealm(tt.domainName), "Realm not as expected for: "+tt.domainName)
+	}
+}
+
+type stubURIResolver struct {
+	stubResolver
+	uris map[string][]URI
+}
+
+func (r stubURIResolver) LookupURI(ctx context.Context, name string) ([]URI, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return r.uris[name], nil
+}
+
+func TestGetKDCs_URI(t *testing.T) {
+	t.Parallel()
+	c := NewConfig()
+	c.LibDefaults.DNSLookupKDC = true
+	c.LibDefaults.DNSURILookup = true
+	c.Resolver = stubURIResolver{uris: map[string][]URI{
+		"_kerberos.TEST.GOKRB5": {
+			{Priority: 20, Weight: 0, Target: "krb5srv::tcp:kdc2.test.gokrb5"},
+			{Priority: 10, Weight: 0, Target: "krb5srv:m:tcp:kdc1.test.gokrb5:8888"},
+			{Priority: 10, Weight: 0, Target: "krb5srv:m:udp:kdc1.test.gokrb5"},
+			{Priority: 10, Weight: 0, Target: "krb5srv::kkdcp:https://kdcproxy.test.gokrb5/KdcProxy"},
+			{Priority: 10, Weight: 0, Target: "krb5srv::kkdcp:kdcproxy.test.gokrb5"},
+			{Priority: 10, Weight: 0, Target: "other:m:tcp:host.test.gokrb5"},
+		},
+	}}
+
+	count, kdcs, err := c.GetKDCs("TEST.GOKRB5", true)
+	if err != nil {
+		t.Fatalf("Error getting KDCs: %v", err)
+	}
+	assert.Equal(t, 2, count, "Number of KDCs not as expected")
+	assert.Equal(t, "kdc1.test.gokrb5:8888", kdcs[1], "KDC not as expected")
+	assert.Equal(t, "kdc2.test.gokrb5:88", kdcs[2], "KDC not as expected")
+
+	count, kdcs, err = c.GetMasterKDCs("TEST.GOKRB5", false)
+	if err != nil {
+		t.Fatalf("Error getting master KDCs: %v", err)
+	}
+	assert.Equal(t, 1, count, "Number of master KDCs not as expected")
+	assert.Equal(t, "kdc1.test.gokrb5:88", kdcs[1], "Master KDC not as expected")
+
+	count, kps, err := c.GetKDCProxies("TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error getting KDC proxies: %v", err)
+	}
+	assert.Equal(t, 1, count, "Number of KDC proxies not as expected")
+	assert.Equal(t, "https://kdcproxy.test.gokrb5/KdcProxy", kps[1], "KDC proxy not as expected")
+
+	// The URI records cannot be looked up once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = c.GetMasterKDCsContext(ctx, "TEST.GOKRB5", false)
+	assert.Error(t, err, "Master KDCs should not be found with a cancelled context")
+	_, _, err = c.GetKDCProxiesContext(ctx, "TEST.GOKRB5")
+	assert.Error(t, err, "KDC proxies should not be found with a cancelled context")
+
+	c.LibDefaults.DNSURILookup = false
+	_, _, err = c.GetKDCProxies("TEST.GOKRB5")
+	assert.Error(t, err, "KDC proxies should not be looked up when dns_uri_lookup is disabled")
+}
+
+func TestParseURIResponse(t *testing.T) {
+	t.Parallel()
+	id, q, err := uriQuery("_kerberos.TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error creating URI query: %v", err)
+	}
+	target := "krb5srv:m:tcp:kdc.test.gokrb5"
+	b := append([]byte{}, q...)
+	// Mark as a response with one answer
+	b[2] |= 0x80
+	b[7] = 1
+	// Answer name is a pointer to the question name
+	b = append(b, 0xc0, 12, 1, 0, 0, 1, 0, 0, 0x0e, 0x10, 0, byte(4+len(target)), 0, 10, 0, 5)
+	b = append(b, target...)
+	uris, ttl, err := parseURIResponse(id, b)
+	if err != nil {
+		t.Fatalf("Error parsing URI response: %v", err)
+	}
+	assert.Equal(t, []URI{{Priority: 10, Weight: 5, Target: target}}, uris, "URI records not as expected")
+	assert.Equal(t, time.Hour, ttl, "URI record time to live not as expected")
+
+	_, _, err = parseURIResponse(id+1, b)
+	assert.Error(t, err, "Response with a different ID should be rejected")
+	_, _, err = parseURIResponse(id, b[:len(b)-3])
+	assert.Error(t, err, "Truncated response should be rejected")
+}
+
+func TestDNSURIResolver_LookupURI(t *testing.T) {
+	// Not parallel as the name server is overridden through the environment
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error starting name server: %v", err)
+	}
+	defer conn.Close()
+	target := "krb5srv::tcp:kdc.test.gokrb5"
+	var queries int32
+	go func() {
+		b := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&queries, 1)
+			r := append([]byte{}, b[:n]...)
+			r[2] |= 0x80
+			r[7] = 1
+			r = append(r, 0xc0, 12, 1, 0, 0, 1, 0, 0, 0x0e, 0x10, 0, byte(4+len(target)), 0, 10, 0, 5)
+			r = append(r, target...)
+			conn.WriteTo(r, addr)
+		}
+	}()
+	ns := os.Getenv("DNSUTILS_OVERRIDE_NS")
+	defer os.Setenv("DNSUTILS_OVERRIDE_NS", ns)
+	os.Setenv("DNSUTILS_OVERRIDE_NS", conn.LocalAddr().String())
+
+	r := &dnsURIResolver{cache: make(map[string]uriCacheEntry)}
+	for i := 0; i < 2; i++ {
+		uris, err := r.LookupURI(context.Background(), "_kerberos.TEST.GOKRB5")
+		if err != nil {
+			t.Fatalf("Error looking up URI records: %v", err)
+		}
+		assert.Equal(t, []URI{{Priority: 10, Weight: 5, Target: target}}, uris, "URI records not as expected")
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&queries), "URI records should be cached for their time to live")
+
+	// Expired records are looked up again
+	r.cache["_kerberos.test.gokrb5"] = uriCacheEntry{expires: time.Now().Add(-time.Second)}
+	_, err = r.LookupURI(context.Background(), "_kerberos.TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error looking up URI records: %v", err)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&queries), "Expired URI records should be looked up again")
+}
+
+func TestExpandPath(t *testing.T) {
+	t.Parallel()
+	uid := strconv.Itoa(os.Getuid())
+	if os.Getuid() < 0 {
+		usr, _ := user.Current()
+		uid = usr.Uid
+	}
+	var tests = []struct {
+		path     string
+		expanded string
+	}{
+		{"FILE:/tmp/krb5cc_%{uid}", "FILE:/tmp/krb5cc_" + uid},
+		{"%{TEMP}/krb5cc%{null}", filepath.Join(os.TempDir(), "krb5cc")},
+		{"/etc/krb5.keytab", "/etc/krb5.keytab"},
+	}
+	for _, test := range tests {
+		p, err := ExpandPath(test.path)
+		if err != nil {
+			t.Errorf("Error expanding %s: %v", test.path, err)
+			continue
+		}
+		assert.Equal(t, test.expanded, p, "Expanded path not as expected for %s", test.path)
+	}
+	_, err := ExpandPath("%{LIBDIR}/krb5")
+	assert.Error(t, err, "Unsupported token should not expand")
+	_, err = ExpandPath("/tmp/krb5cc_%{uid")
+	assert.Error(t, err, "Unterminated token should not expand")
+}
+
+func TestLoadFiles(t *testing.T) {
+	t.Parallel()
+	f1, _ := ioutil.TempFile(os.TempDir(), "TEST-gokrb5-krb5.conf")
+	defer os.Remove(f1.Name())
+	f1.WriteString(`[libdefaults]
+ default_realm = TEST.GOKRB5
+ default_ccache_name = KEYRING:persistent:%{uid}
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = kdc1.test.gokrb5:88
+ }
+`)
+	f1.Close()
+	f2, _ := ioutil.TempFile(os.TempDir(), "TEST-gokrb5-krb5.conf")
+	defer os.Remove(f2.Name())
+	f2.WriteString(`[libdefaults]
+ default_realm = OTHER.GOKRB5
+ default_keytab_name = FILE:/etc/other.keytab
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = kdc2.test.gokrb5:88
+ }
+ OTHER.GOKRB5 = {
+  kdc = kdc.other.gokrb5:88
+ }
+`)
+	f2.Close()
+
+	c, err := LoadFiles(f1.Name(), filepath.Join(os.TempDir(), "TEST-gokrb5-missing.conf"), f2.Name())
+	if err != nil {
+		t.Fatalf("Error loading config files: %v", err)
+	}
+	assert.Equal(t, "TEST.GOKRB5", c.LibDefaults.DefaultRealm, "Setting in the first file should take precedence")
+	assert.Equal(t, "KEYRING:persistent:%{uid}", c.LibDefaults.DefaultCCacheName, "[libdefaults] default_ccache_name not as expected")
+	assert.Equal(t, "FILE:/etc/other.keytab", c.LibDefaults.DefaultKeytabName, "Setting only in the second file not as expected")
+	if assert.Equal(t, 2, len(c.Realms), "Number of realms not as expected") {
+		for _, r := range c.Realms {
+			if r.Realm == "TEST.GOKRB5" {
+				assert.Equal(t, []string{"kdc1.test.gokrb5:88"}, r.KDC, "Realm in the first file should take precedence")
+			}
+		}
+	}
+
+	_, err = LoadFiles(filepath.Join(os.TempDir(), "TEST-gokrb5-missing.conf"))
+	assert.Error(t, err, "Loading no existing files should error")
+}
+
+func TestConfig_CCacheName(t *testing.T) {
+	t.Parallel()
+	c, _ := NewConfigFromString(krb5Conf)
+	c.LibDefaults.DefaultCCacheName = "DIR:%{TEMP}/krb5cc"
+	os.Unsetenv(EnvCCacheName)
+	n, err := c.CCacheName()
+	if err != nil {
+		t.Fatalf("Error getting default ccache name: %v", err)
+	}
+	assert.Equal(t, "DIR:"+filepath.Join(os.TempDir(), "krb5cc"), n, "Configured ccache name not as expected")
+	os.Setenv(EnvCCacheName, "KEYRING:session:test")
+	defer os.Unsetenv(EnvCCacheName)
+	n, err = c.CCacheName()
+	if err != nil {
+		t.Fatalf("Error getting default ccache name: %v", err)
+	}
+	assert.Equal(t, "KEYRING:session:test", n, "KRB5CCNAME should take precedence over default_ccache_name")
+
+	os.Unsetenv(EnvKeytabName)
+	n, err = c.KeytabName()
+	if err != nil {
+		t.Fatalf("Error getting default keytab name: %v", err)
+	}
+	assert.Equal(t, c.LibDefaults.DefaultKeytabName, n, "Keytab name not as expected")
+}
+
+func TestLoad_Include(t *testing.T) {
+	t.Parallel()
+	d, err := ioutil.TempDir(os.TempDir(), "TEST-gokrb5-krb5.conf.d")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(d)
+	ioutil.WriteFile(filepath.Join(d, "realms.conf"), []byte(`[realms]
+ OTHER.GOKRB5 = {
+  kdc = kdc.other.gokrb5:88
+ }
+`), 0600)
+	ioutil.WriteFile(filepath.Join(d, "domains"), []byte(`[domain_realm]
+ .other.gokrb5 = OTHER.GOKRB5
+`), 0600)
+	// Editor backup files in an includedir directory are not read
+	ioutil.WriteFile(filepath.Join(d, "domains~"), []byte(`[libdefaults]
+ default_realm = BACKUP.GOKRB5
+`), 0600)
+	inc := filepath.Join(d, "libdefaults.inc")
+	ioutil.WriteFile(inc, []byte(`[libdefaults]
+ ticket_lifetime = 10h
+`), 0600)
+	f, _ := ioutil.TempFile(os.TempDir(), "TEST-gokrb5-krb5.conf")
+	f.Close()
+	cf := f.Name()
+	defer os.Remove(cf)
+	ioutil.WriteFile(cf, []byte(`includedir `+d+`
+[libdefaults]
+ default_realm = TEST.GOKRB5
+include `+inc+`
+ forwardable = true
+module plugin.so:residual
+`), 0600)
+
+	c, err := Load(cf)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.Equal(t, "TEST.GOKRB5", c.LibDefaults.DefaultRealm, "[libdefaults] default_realm not as expected")
+	assert.Equal(t, time.Duration(10)*time.Hour, c.LibDefaults.TicketLifetime, "Included [libdefaults] ticket_lifetime not as expected")
+	assert.True(t, c.LibDefaults.Forwardable, "Relation following an include should continue the section it was in")
+	if assert.Equal(t, 1, len(c.Realms), "Number of realms not as expected") {
+		assert.Equal(t, "OTHER.GOKRB5", c.Realms[0].Realm, "Realm from includedir not as expected")
+	}
+	assert.Equal(t, "OTHER.GOKRB5", c.ResolveRealm("host.other.gokrb5"), "Domain mapping from includedir not as expected")
+	assert.Contains(t, c.Warnings, "module directive for plugin.so:residual is not supported", "Warnings not as expected")
+
+	// A file that includes itself cannot be loaded
+	ioutil.WriteFile(inc, []byte(`[libdefaults]
+include `+cf+`
+`), 0600)
+	_, err = Load(cf)
+	assert.Error(t, err, "Include cycle should error")
+}
+
+func TestLoad_IncludeRealms(t *testing.T) {
+	t.Parallel()
+	d, err := ioutil.TempDir(os.TempDir(), "TEST-gokrb5-krb5.conf.d")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(d)
+	inc1 := filepath.Join(d, "realms1.conf")
+	ioutil.WriteFile(inc1, []byte(`[realms]
+ TEST.GOKRB5 = {
+  kdc = kdc2.test.gokrb5:88
+  admin_server = kdc2.test.gokrb5:749
+ }
+`), 0600)
+	inc2 := filepath.Join(d, "realms2.conf")
+	ioutil.WriteFile(inc2, []byte(`[realms]
+ TEST.GOKRB5 = {
+  kdc = kdc3.test.gokrb5:88
+  admin_server = kdc3.test.gokrb5:749
+ }
+`), 0600)
+	cf := filepath.Join(d, "krb5.conf")
+	ioutil.WriteFile(cf, []byte(`[realms]
+ TEST.GOKRB5 = {
+  kdc = kdc1.test.gokrb5:88
+ }
+include `+inc1+`
+include `+inc2+`
+ OTHER.GOKRB5 = {
+  kdc = kdc.other.gokrb5:88
+ }
+`), 0600)
+
+	c, err := Load(cf)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if assert.Equal(t, 2, len(c.Realms), "Number of realms not as expected") {
+		assert.Equal(t, "TEST.GOKRB5", c.Realms[0].Realm, "Realm not as expected")
+		assert.Equal(t, []string{"kdc1.test.gokrb5:88", "kdc2.test.gokrb5:88", "kdc3.test.gokrb5:88"}, c.Realms[0].KDC, "KDCs of the realm from all files not as expected")
+		assert.Equal(t, []string{"kdc2.test.gokrb5:749", "kdc3.test.gokrb5:749"}, c.Realms[0].AdminServer, "Admin servers of the realm from all files not as expected")
+		assert.Equal(t, "OTHER.GOKRB5", c.Realms[1].Realm, "Realm following the includes not as expected")
+	}
+}
+
+func TestAppDefaults(t *testing.T) {
+	t.Parallel()
+	c, err := NewConfigFromString(krb5Conf + `
+ forwardable = false
+ TEST.GOKRB5 = {
+  debug = true
+  pam = { ticket_lifetime = 1h }
+ }
+ kinit = {
+  TEST.GOKRB5 = {
+   forwardable = false
+  }
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	var tests = []struct {
+		app, realm, option string
+		value              string
+		set                bool
+	}{
+		{"pam", "TEST.GOKRB5", "ticket_lifetime", "1h", true},
+		{"pam", "EXAMPLE.COM", "ticket_lifetime", "36000", true},
+		{"pam", "EXAMPLE.COM", "forwardable", "true", true},
+		{"kinit", "TEST.GOKRB5", "forwardable", "false", true},
+		{"kinit", "TEST.GOKRB5", "debug", "true", true},
+		{"kinit", "EXAMPLE.COM", "forwardable", "false", true},
+		{"kinit", "EXAMPLE.COM", "debug", "", false},
+	}
+	for _, test := range tests {
+		v, ok := c.AppDefaults.Get(test.app, test.realm, test.option)
+		assert.Equal(t, test.set, ok, "Presence of %s for %s in %s not as expected", test.option, test.app, test.realm)
+		assert.Equal(t, test.value, v, "Value of %s for %s in %s not as expected", test.option, test.app, test.realm)
+	}
+	assert.True(t, c.AppDefaults.GetBool("pam", "EXAMPLE.COM", "forwardable", false), "Boolean option not as expected")
+	assert.True(t, c.AppDefaults.GetBool("pam", "EXAMPLE.COM", "no_such_option", true), "Default of boolean option not as expected")
+}
+
+func TestConfig_Warnings(t *testing.T) {
+	t.Parallel()
+	c, err := NewConfigFromString(krb5Conf + `
+[plugins]
+ ccselect = {
+  disable = k5identity
+ }
+
+[login]
+ krb5_get_tickets = false
+
+[libdefaults]
+ qualify_shortname = test.gokrb5
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	// Sections given more than once are parsed together where they first appear
+	assert.Equal(t, []string{
+		"libdefaults relation qualify_shortname is not supported",
+		"realm EXAMPLE.COM relation auth_to_local is not supported",
+		"plugins section is not supported",
+		"unknown section [login] ignored",
+	}, c.Warnings, "Warnings not as expected")
+}
+
+func TestConfig_Marshal(t *testing.T) {
+	t.Parallel()
+	c, err := NewConfigFromString(krb5Conf + `
+[libdefaults]
+ clockskew = 2m
+ extra_addresses = 10.1.1.1,fe80::1
+ preferred_preauth_types = 17, 16, 15, 14
+ default_ccache_name = KEYRING:persistent:%{uid}
+ kdc_default_options = 0x40000010
+
+[realms]
+ PROXY.GOKRB5 = {
+  kdc = https://kdcproxy.test.gokrb5/KdcProxy
+  master_kdc = kdc1.proxy.gokrb5:88
+  kpasswd_server = kdc1.proxy.gokrb5:464
+ }
+
+[capaths]
+ ANL.GOV = {
+  TEST.ANL.GOV = .
+  EXAMPLE.COM = ES.NET
+  EXAMPLE.COM = HUB.EXAMPLE.COM
+ }
+
+[appdefaults]
+ forwardable = false
+ TEST.GOKRB5 = {
+  pam = { ticket_lifetime = 1h }
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	b, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling config: %v", err)
+	}
+	mc, err := NewConfigFromString(string(b))
+	if err != nil {
+		t.Fatalf("Error loading marshaled config: %v\n%s", err, b)
+	}
+	// Relations that are not supported are not marshaled
+	c.Warnings = nil
+	assert.Equal(t, c, mc, "Config loaded from marshaled bytes not as expected")
+	assert.Empty(t, mc.Warnings, "Marshaled config should not cause warnings")
+
+	// A configuration built in code can be handed to other programs
+	nc := NewConfig()
+	nc.LibDefaults.DefaultRealm = "TEST.GOKRB5"
+	nc.LibDefaults.TicketLifetime = 8 * time.Hour
+	nc.Realms = append(nc.Realms, Realm{Realm: "TEST.GOKRB5", KDC: []string{"kdc.test.gokrb5:88"}})
+	nc.DomainRealm[".test.gokrb5"] = "TEST.GOKRB5"
+	b, err = nc.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling config: %v", err)
+	}
+	mc, err = NewConfigFromString(string(b))
+	if err != nil {
+		t.Fatalf("Error loading marshaled config: %v\n%s", err, b)
+	}
+	assert.Equal(t, nc.LibDefaults.DefaultRealm, mc.LibDefaults.DefaultRealm, "[libdefaults] default_realm not as expected")
+	assert.Equal(t, nc.LibDefaults.TicketLifetime, mc.LibDefaults.TicketLifetime, "[libdefaults] ticket_lifetime not as expected")
+	assert.Equal(t, nc.Realms, mc.Realms, "Realms not as expected")
+	assert.Equal(t, nc.DomainRealm, mc.DomainRealm, "Domain mappings not as expected")
+	// Defaults are left to the program reading the configuration
+	for _, tag := range []string{"k5login_directory", "default_tkt_enctypes", "default_tgs_enctypes", "permitted_enctypes", "clockskew"} {
+		assert.NotContains(t, string(b), tag, "Default [libdefaults] %s should not be marshaled", tag)
+	}
+
+	// Encryption types set by ID are marshaled
+	nc.LibDefaults.DefaultTktEnctypeIDs = []int32{18, 17}
+	b, err = nc.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling config: %v", err)
+	}
+	mc, err = NewConfigFromString(string(b))
+	if err != nil {
+		t.Fatalf("Error loading marshaled config: %v\n%s", err, b)
+	}
+	assert.Equal(t, []int32{18, 17}, mc.LibDefaults.DefaultTktEnctypeIDs, "[libdefaults] default_tkt_enctypes not as expected")
+
+	nc.Realms = append(nc.Realms, Realm{Realm: "BAD = {"})
+	_, err = nc.Marshal()
+	assert.Error(t, err, "Realm name that cannot be parsed back should not marshal")
+}
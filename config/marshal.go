@@ -0,0 +1,309 @@
+package config
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/jcmturner/gokrb5.v5/iana/etypeID"
+)
+
+// Marshal returns the configuration in the krb5.conf format with the [libdefaults], [realms], [domain_realm], [capaths]
+// and [appdefaults] sections. Loading the output with NewConfigFromString gives the same configuration.
+func (c *Config) Marshal() ([]byte, error) {
+	var b bytes.Buffer
+	if c.LibDefaults != nil {
+		b.WriteString("[libdefaults]\n")
+		if err := c.LibDefaults.marshal(&b); err != nil {
+			return nil, fmt.Errorf("error marshaling libdefaults section: %v", err)
+		}
+	}
+	b.WriteString("\n[realms]\n")
+	for _, r := range c.Realms {
+		if err := r.marshal(&b); err != nil {
+			return nil, fmt.Errorf("error marshaling realms section: %v", err)
+		}
+	}
+	b.WriteString("\n[domain_realm]\n")
+	if err := c.DomainRealm.marshal(&b); err != nil {
+		return nil, fmt.Errorf("error marshaling domain_realm section: %v", err)
+	}
+	b.WriteString("\n[capaths]\n")
+	if err := c.CAPaths.marshal(&b); err != nil {
+		return nil, fmt.Errorf("error marshaling capaths section: %v", err)
+	}
+	if c.AppDefaults != nil {
+		b.WriteString("\n[appdefaults]\n")
+		if err := c.AppDefaults.marshal(&b, " "); err != nil {
+			return nil, fmt.Errorf("error marshaling appdefaults section: %v", err)
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// Write the configuration in the krb5.conf format to the io.Writer.
+func (c *Config) Write(w io.Writer) (int, error) {
+	b, err := c.Marshal()
+	if err != nil {
+		return 0, err
+	}
+	return w.Write(b)
+}
+
+// validTag reports whether the name can be parsed back as the tag of a relation or block.
+func validTag(tag string) bool {
+	return tag != "" && !strings.ContainsAny(tag, "={}[]\r\n") && !strings.ContainsAny(tag[:1], "#;")
+}
+
+// writeRelation writes a tag = value line. Names and values that could not be parsed back are rejected.
+func writeRelation(b *bytes.Buffer, indent, tag, value string) error {
+	if !validTag(tag) || strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("relation %s = %s cannot be represented in the configuration format", tag, value)
+	}
+	fmt.Fprintf(b, "%s%s = %s\n", indent, tag, value)
+	return nil
+}
+
+// writeBlockStart writes the tag = { line that starts a block of relations.
+func writeBlockStart(b *bytes.Buffer, indent, tag string) error {
+	if !validTag(tag) {
+		return fmt.Errorf("name %s cannot be represented in the configuration format", tag)
+	}
+	fmt.Fprintf(b, "%s%s = {\n", indent, tag)
+	return nil
+}
+
+func formatDuration(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
+
+// Marshal the LibDefaults struct into the lines of the [libdefaults] section. Only the relations set by the configuration
+// parsed or differing from their defaults are written so that programs reading the output apply their own defaults.
+func (l *LibDefaults) marshal(b *bytes.Buffer) error {
+	defaults := make(map[string]string)
+	for _, r := range newLibDefaults().relations() {
+		defaults[r[0]] = r[1]
+	}
+	for _, r := range l.relations() {
+		if r[1] == "" || (!l.set[r[0]] && r[1] == defaults[r[0]]) {
+			continue
+		}
+		// The libdefaults parser splits lines on every equals sign
+		if strings.Contains(r[1], "=") {
+			return fmt.Errorf("libdefaults %s value %s cannot contain =", r[0], r[1])
+		}
+		if err := writeRelation(b, " ", r[0], r[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relations returns the tag and value of each relation of the [libdefaults] section. The value is empty for a relation
+// that has no value.
+func (l *LibDefaults) relations() [][2]string {
+	var rels [][2]string
+	add := func(tag, value string) {
+		rels = append(rels, [2]string{tag, value})
+	}
+	add("allow_weak_crypto", strconv.FormatBool(l.AllowWeakCrypto))
+	add("canonicalize", strconv.FormatBool(l.Canonicalize))
+	add("ccache_type", strconv.Itoa(l.CCacheType))
+	add("clockskew", formatDuration(l.Clockskew))
+	add("default_ccache_name", l.DefaultCCacheName)
+	add("default_client_keytab_name", l.DefaultClientKeytabName)
+	add("default_keytab_name", l.DefaultKeytabName)
+	add("default_realm", l.DefaultRealm)
+	add("default_tgs_enctypes", strings.Join(l.enctypes(l.DefaultTGSEnctypes, l.DefaultTGSEnctypeIDs), " "))
+	add("default_tkt_enctypes", strings.Join(l.enctypes(l.DefaultTktEnctypes, l.DefaultTktEnctypeIDs), " "))
+	add("dns_canonicalize_hostname", strconv.FormatBool(l.DNSCanonicalizeHostname))
+	add("dns_lookup_kdc", strconv.FormatBool(l.DNSLookupKDC))
+	add("dns_lookup_realm", strconv.FormatBool(l.DNSLookupRealm))
+	add("dns_uri_lookup", strconv.FormatBool(l.DNSURILookup))
+	var ips []string
+	for _, ip := range l.ExtraAddresses {
+		ips = append(ips, ip.String())
+	}
+	add("extra_addresses", strings.Join(ips, ","))
+	add("forwardable", strconv.FormatBool(l.Forwardable))
+	add("ignore_acceptor_hostname", strconv.FormatBool(l.IgnoreAcceptorHostname))
+	add("k5login_authoritative", strconv.FormatBool(l.K5LoginAuthoritative))
+	add("k5login_directory", l.K5LoginDirectory)
+	var opts string
+	if len(l.KDCDefaultOptions.Bytes) > 0 {
+		opts = "0x" + hex.EncodeToString(l.KDCDefaultOptions.Bytes)
+	}
+	add("kdc_default_options", opts)
+	add("kdc_timesync", strconv.Itoa(l.KDCTimeSync))
+	add("noaddresses", strconv.FormatBool(l.NoAddresses))
+	add("permitted_enctypes", strings.Join(l.enctypes(l.PermittedEnctypes, l.PermittedEnctypeIDs), " "))
+	add("pkinit_eku_checking", l.PKINITEKUChecking)
+	var ts []string
+	for _, t := range l.PreferredPreauthTypes {
+		ts = append(ts, strconv.Itoa(t))
+	}
+	add("preferred_preauth_types", strings.Join(ts, ", "))
+	add("proxiable", strconv.FormatBool(l.Proxiable))
+	add("rdns", strconv.FormatBool(l.RDNS))
+	add("realm_try_domains", strconv.Itoa(l.RealmTryDomains))
+	add("renew_lifetime", formatDuration(l.RenewLifetime))
+	add("safe_checksum_type", strconv.Itoa(l.SafeChecksumType))
+	add("ticket_lifetime", formatDuration(l.TicketLifetime))
+	add("udp_preference_limit", strconv.Itoa(l.UDPPreferenceLimit))
+	add("verify_ap_req_nofail", strconv.FormatBool(l.VerifyAPReqNofail))
+	return rels
+}
+
+// etypeNames are the names written for the encryption type IDs supported.
+var etypeNames = map[int32]string{
+	etypeID.AES128_CTS_HMAC_SHA1_96:    "aes128-cts-hmac-sha1-96",
+	etypeID.AES256_CTS_HMAC_SHA1_96:    "aes256-cts-hmac-sha1-96",
+	etypeID.AES128_CTS_HMAC_SHA256_128: "aes128-cts-hmac-sha256-128",
+	etypeID.AES256_CTS_HMAC_SHA384_192: "aes256-cts-hmac-sha384-192",
+	etypeID.DES3_CBC_SHA1_KD:           "des3-cbc-sha1-kd",
+	etypeID.RC4_HMAC:                   "arcfour-hmac",
+}
+
+// enctypes returns the names of an encryption type list. If the IDs of the list have been set to other than those of
+// the names, as when the configuration is built in code, the names of the IDs are returned instead.
+func (l *LibDefaults) enctypes(names []string, ids []int32) []string {
+	if len(ids) < 1 {
+		return names
+	}
+	pids := parseETypes(names, l.AllowWeakCrypto)
+	same := len(pids) == len(ids)
+	for i := 0; same && i < len(ids); i++ {
+		same = pids[i] == ids[i]
+	}
+	if same {
+		return names
+	}
+	var ns []string
+	for _, id := range ids {
+		if n, ok := etypeNames[id]; ok {
+			ns = append(ns, n)
+		}
+	}
+	return ns
+}
+
+// Marshal the Realm struct into a block of the [realms] section.
+func (r *Realm) marshal(b *bytes.Buffer) error {
+	if err := writeBlockStart(b, " ", r.Realm); err != nil {
+		return err
+	}
+	var rels [][2]string
+	addAll := func(tag string, values []string) {
+		for _, v := range values {
+			rels = append(rels, [2]string{tag, v})
+		}
+	}
+	addAll("admin_server", r.AdminServer)
+	if r.DefaultDomain != "" {
+		rels = append(rels, [2]string{"default_domain", r.DefaultDomain})
+	}
+	addAll("kdc", r.KDC)
+	addAll("kdc", r.KDCProxy)
+	addAll("kpasswd_server", r.KPasswdServer)
+	addAll("master_kdc", r.MasterKDC)
+	if r.PKINITEKUChecking != "" {
+		rels = append(rels, [2]string{"pkinit_eku_checking", r.PKINITEKUChecking})
+	}
+	addAll("pkinit_kdc_hostname", r.PKINITKDCHostname)
+	for _, rel := range rels {
+		// Braces in a value would be taken as the start or end of the realm's block
+		if strings.ContainsAny(rel[1], "{}") {
+			return fmt.Errorf("realm %s %s value %s cannot contain braces", r.Realm, rel[0], rel[1])
+		}
+		if err := writeRelation(b, "  ", rel[0], rel[1]); err != nil {
+			return err
+		}
+	}
+	b.WriteString(" }\n")
+	return nil
+}
+
+// Marshal the domain to realm mappings into the lines of the [domain_realm] section, ordered by domain.
+func (d DomainRealm) marshal(b *bytes.Buffer) error {
+	var domains []string
+	for domain := range d {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	for _, domain := range domains {
+		if err := writeRelation(b, " ", domain, d[domain]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Marshal the authentication paths into the blocks of the [capaths] section, ordered by realm.
+func (p CAPaths) marshal(b *bytes.Buffer) error {
+	var clients []string
+	for client := range p {
+		clients = append(clients, client)
+	}
+	sort.Strings(clients)
+	for _, client := range clients {
+		if err := writeBlockStart(b, " ", client); err != nil {
+			return err
+		}
+		var servers []string
+		for server := range p[client] {
+			servers = append(servers, server)
+		}
+		sort.Strings(servers)
+		for _, server := range servers {
+			for _, v := range p[client][server] {
+				if strings.ContainsAny(v, "{}") {
+					return fmt.Errorf("capaths %s %s value %s cannot contain braces", client, server, v)
+				}
+				if err := writeRelation(b, "  ", server, v); err != nil {
+					return err
+				}
+			}
+		}
+		b.WriteString(" }\n")
+	}
+	return nil
+}
+
+// Marshal the options into lines of the [appdefaults] section, ordered by name with the options before the blocks.
+func (a *AppDefaults) marshal(b *bytes.Buffer, indent string) error {
+	var names []string
+	for n := range a.values {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		for _, v := range a.values[n] {
+			if strings.HasPrefix(v, "{") {
+				return fmt.Errorf("appdefaults %s value %s cannot start with {", n, v)
+			}
+			if err := writeRelation(b, indent, n, v); err != nil {
+				return err
+			}
+		}
+	}
+	names = names[:0]
+	for n := range a.sections {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if err := writeBlockStart(b, indent, n); err != nil {
+			return err
+		}
+		if err := a.sections[n].marshal(b, indent+" "); err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "%s}\n", indent)
+	}
+	return nil
+}
@@ -4,17 +4,24 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"strings"
 	"time"
 	"unsafe"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
 	"gopkg.in/jcmturner/gokrb5.v5/types"
 )
 
 const (
 	headerFieldTagKDCOffset = 1
+
+	// Configuration entries are stored as credentials for a server principal in this realm.
+	configEntryRealm = "X-CACHECONF:"
+	configEntryName  = "krb5_ccache_conf_data"
 )
 
 // CCache is the file credentials cache as define here: https://web.mit.edu/kerberos/krb5-latest/doc/formats/ccache_file_format.html
@@ -59,6 +66,17 @@ type credential struct {
 	SecondTicket []byte
 }
 
+// NewCCache creates a new, empty, version 4 credential cache for the client principal provided.
+func NewCCache(cname types.PrincipalName, realm string) CCache {
+	return CCache{
+		Version: 4,
+		DefaultPrincipal: principal{
+			Realm:         realm,
+			PrincipalName: cname,
+		},
+	}
+}
+
 // LoadCCache loads a credential cache file into a CCache type.
 func LoadCCache(cpath string) (CCache, error) {
 	k, err := ioutil.ReadFile(cpath)
@@ -119,7 +137,8 @@ func parseHeader(b []byte, p *int, c *CCache, e *binary.ByteOrder) error {
 	}
 	h := header{}
 	h.length = uint16(readInt16(b, p, e))
-	for *p <= int(h.length) {
+	end := *p + int(h.length)
+	for *p < end {
 		f := headerField{}
 		f.tag = uint16(readInt16(b, p, e))
 		f.length = uint16(readInt16(b, p, e))
@@ -250,6 +269,177 @@ func (c *CCache) GetEntries() []credential {
 	return creds
 }
 
+// AddEntry adds a credential for the ticket of the server principal provided to the cache. The client of the credential is
+// the cache's default principal. Any existing credential for the same server principal is replaced.
+func (c *CCache) AddEntry(sname types.PrincipalName, srealm string, key types.EncryptionKey, authTime, startTime, endTime, renewTill time.Time, flags asn1.BitString, tkt []byte) {
+	cred := credential{
+		Client:      c.DefaultPrincipal,
+		Server:      principal{Realm: srealm, PrincipalName: sname},
+		Key:         key,
+		AuthTime:    authTime,
+		StartTime:   startTime,
+		EndTime:     endTime,
+		RenewTill:   renewTill,
+		TicketFlags: flags,
+		Ticket:      tkt,
+	}
+	c.setCredential(cred)
+}
+
+// SetConfigEntry sets a configuration entry in the cache. The principal is optional and associates the entry with the
+// principal name given in its string form.
+// https://web.mit.edu/kerberos/krb5-latest/doc/formats/ccache_file_format.html#cache-configuration-entries
+func (c *CCache) SetConfigEntry(key, principalName string, value []byte) {
+	pn := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{configEntryName, key},
+	}
+	if principalName != "" {
+		pn.NameString = append(pn.NameString, principalName)
+	}
+	c.setCredential(credential{
+		Client:      c.DefaultPrincipal,
+		Server:      principal{Realm: configEntryRealm, PrincipalName: pn},
+		TicketFlags: types.NewKrbFlags(),
+		Ticket:      value,
+	})
+}
+
+// GetConfigEntry returns the value of the configuration entry for the key and optional principal name provided.
+func (c *CCache) GetConfigEntry(key, principalName string) ([]byte, bool) {
+	ns := []string{configEntryName, key}
+	if principalName != "" {
+		ns = append(ns, principalName)
+	}
+	for _, cred := range c.Credentials {
+		if cred.Server.Realm == configEntryRealm && cred.Server.PrincipalName.Equal(types.PrincipalName{NameString: ns}) {
+			return cred.Ticket, true
+		}
+	}
+	return nil, false
+}
+
+// setCredential adds the credential to the cache replacing any existing credential for the same server principal.
+func (c *CCache) setCredential(cred credential) {
+	for i := range c.Credentials {
+		if c.Credentials[i].Server.Realm == cred.Server.Realm && c.Credentials[i].Server.PrincipalName.Equal(cred.Server.PrincipalName) {
+			c.Credentials[i] = cred
+			return
+		}
+	}
+	c.Credentials = append(c.Credentials, cred)
+}
+
+// KDCTimeOffset returns the offset of the KDC's clock from the client's recorded in the cache header.
+func (c *CCache) KDCTimeOffset() (time.Duration, bool) {
+	for _, f := range c.Header.fields {
+		if f.tag == headerFieldTagKDCOffset && f.valid() {
+			s := int32(binary.BigEndian.Uint32(f.value[0:4]))
+			us := int32(binary.BigEndian.Uint32(f.value[4:8]))
+			return time.Duration(s)*time.Second + time.Duration(us)*time.Microsecond, true
+		}
+	}
+	return 0, false
+}
+
+// SetKDCTimeOffset records the offset of the KDC's clock from the client's in the cache header.
+func (c *CCache) SetKDCTimeOffset(d time.Duration) {
+	f := headerField{
+		tag:    headerFieldTagKDCOffset,
+		length: 8,
+		value:  make([]byte, 8),
+	}
+	binary.BigEndian.PutUint32(f.value[0:4], uint32(int32(d/time.Second)))
+	binary.BigEndian.PutUint32(f.value[4:8], uint32(int32((d%time.Second)/time.Microsecond)))
+	for i := range c.Header.fields {
+		if c.Header.fields[i].tag == headerFieldTagKDCOffset {
+			c.Header.fields[i] = f
+			return
+		}
+	}
+	c.Header.fields = append(c.Header.fields, f)
+}
+
+// Marshal the credential cache into a byte slice. Versions 3 and 4 of the file format are supported.
+func (c *CCache) Marshal() ([]byte, error) {
+	if c.Version != 3 && c.Version != 4 {
+		return nil, fmt.Errorf("marshaling credential cache version %d is not supported", c.Version)
+	}
+	buf := new(bytes.Buffer)
+	buf.Write([]byte{5, c.Version})
+	if c.Version == 4 {
+		var l int
+		for _, f := range c.Header.fields {
+			l += 4 + len(f.value)
+		}
+		writeInt16(buf, int16(l))
+		for _, f := range c.Header.fields {
+			writeInt16(buf, int16(f.tag))
+			writeInt16(buf, int16(len(f.value)))
+			buf.Write(f.value)
+		}
+	}
+	c.DefaultPrincipal.marshal(buf)
+	for _, cred := range c.Credentials {
+		cred.marshal(buf, c.Version)
+	}
+	return buf.Bytes(), nil
+}
+
+// Write the credential cache bytes to io.Writer.
+// Returns the number of bytes written
+func (c *CCache) Write(w io.Writer) (int, error) {
+	b, err := c.Marshal()
+	if err != nil {
+		return 0, fmt.Errorf("error marshaling credential cache: %v", err)
+	}
+	return w.Write(b)
+}
+
+func (princ principal) marshal(buf *bytes.Buffer) {
+	writeInt32(buf, princ.PrincipalName.NameType)
+	writeInt32(buf, int32(len(princ.PrincipalName.NameString)))
+	writeData(buf, []byte(princ.Realm))
+	for _, n := range princ.PrincipalName.NameString {
+		writeData(buf, []byte(n))
+	}
+}
+
+func (cred credential) marshal(buf *bytes.Buffer, v uint8) {
+	cred.Client.marshal(buf)
+	cred.Server.marshal(buf)
+	writeInt16(buf, int16(cred.Key.KeyType))
+	if v == 3 {
+		//repeated twice in version 3
+		writeInt16(buf, int16(cred.Key.KeyType))
+	}
+	writeData(buf, cred.Key.KeyValue)
+	writeTimestamp(buf, cred.AuthTime)
+	writeTimestamp(buf, cred.StartTime)
+	writeTimestamp(buf, cred.EndTime)
+	writeTimestamp(buf, cred.RenewTill)
+	if cred.IsSKey {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+	f := make([]byte, 4)
+	copy(f, cred.TicketFlags.Bytes)
+	buf.Write(f)
+	writeInt32(buf, int32(len(cred.Addresses)))
+	for _, a := range cred.Addresses {
+		writeInt16(buf, int16(a.AddrType))
+		writeData(buf, a.Address)
+	}
+	writeInt32(buf, int32(len(cred.AuthData)))
+	for _, a := range cred.AuthData {
+		writeInt16(buf, int16(a.ADType))
+		writeData(buf, a.ADData)
+	}
+	writeData(buf, cred.Ticket)
+	writeData(buf, cred.SecondTicket)
+}
+
 func (h *headerField) valid() bool {
 	// Done as a switch in case other tag values are added in the future.
 	switch h.tag {
@@ -281,6 +471,28 @@ func readAuthDataEntry(b []byte, p *int, e *binary.ByteOrder) types.Authorizatio
 	return a
 }
 
+func writeData(buf *bytes.Buffer, b []byte) {
+	writeInt32(buf, int32(len(b)))
+	buf.Write(b)
+}
+
+// Write a timestamp as the seconds since the epoch. A zero time is written as zero.
+func writeTimestamp(buf *bytes.Buffer, t time.Time) {
+	if t.IsZero() {
+		writeInt32(buf, 0)
+		return
+	}
+	writeInt32(buf, int32(t.Unix()))
+}
+
+func writeInt16(buf *bytes.Buffer, i int16) {
+	binary.Write(buf, binary.BigEndian, i)
+}
+
+func writeInt32(buf *bytes.Buffer, i int32) {
+	binary.Write(buf, binary.BigEndian, i)
+}
+
 // Read bytes representing a timestamp.
 func readTimestamp(b []byte, p *int, e *binary.ByteOrder) time.Time {
 	return time.Unix(int64(readInt32(b, p, e)), 0)
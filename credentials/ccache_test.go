@@ -3,6 +3,7 @@ package credentials
 import (
 	"encoding/hex"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
@@ -123,3 +124,69 @@ func TestCCache_GetEntries(t *testing.T) {
 	creds := c.GetEntries()
 	assert.Equal(t, 2, len(creds), "Number of credentials entries not as expected")
 }
+
+func TestCCache_Marshal(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c, err := ParseCCache(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	mb, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling cache: %v", err)
+	}
+	assert.Equal(t, b, mb, "Marshaled bytes not as expected")
+}
+
+func TestNewCCache(t *testing.T) {
+	t.Parallel()
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	tgtpn := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5")
+	key := types.EncryptionKey{KeyType: 18, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	now := time.Unix(time.Now().Unix(), 0)
+	flags := types.NewKrbFlags()
+	types.SetFlag(&flags, 1)
+
+	for _, v := range []uint8{3, 4} {
+		c := NewCCache(cname, "TEST.GOKRB5")
+		c.Version = v
+		c.AddEntry(tgtpn, "TEST.GOKRB5", key, now, now, now.Add(time.Hour), now.Add(24*time.Hour), flags, []byte{1, 2, 3})
+		c.AddEntry(tgtpn, "TEST.GOKRB5", key, now, now, now.Add(time.Hour), now.Add(24*time.Hour), flags, []byte{4, 5, 6})
+		c.SetConfigEntry("fast_avail", "krbtgt/TEST.GOKRB5@TEST.GOKRB5", []byte("yes"))
+		if v == 4 {
+			c.SetKDCTimeOffset(-90*time.Second - 5*time.Microsecond)
+		}
+		b, err := c.Marshal()
+		if err != nil {
+			t.Fatalf("Error marshaling version %d cache: %v", v, err)
+		}
+		c, err = ParseCCache(b)
+		if err != nil {
+			t.Fatalf("Error parsing version %d cache: %v", v, err)
+		}
+		assert.Equal(t, v, c.Version, "Version not as expected")
+		assert.Equal(t, cname, c.GetClientPrincipalName(), "Client principal name not as expected")
+		assert.Equal(t, 2, len(c.Credentials), "Number of credentials not as expected")
+		assert.Equal(t, 1, len(c.GetEntries()), "Number of credential entries not as expected")
+		cred, ok := c.GetEntry(tgtpn)
+		if !ok {
+			t.Fatalf("TGT not found in version %d cache", v)
+		}
+		assert.Equal(t, key, cred.Key, "Key not as expected")
+		assert.Equal(t, now.Add(time.Hour), cred.EndTime, "End time not as expected")
+		assert.Equal(t, flags.Bytes, cred.TicketFlags.Bytes, "Ticket flags not as expected")
+		assert.Equal(t, []byte{4, 5, 6}, cred.Ticket, "Ticket not as expected")
+		val, ok := c.GetConfigEntry("fast_avail", "krbtgt/TEST.GOKRB5@TEST.GOKRB5")
+		assert.True(t, ok, "Config entry not found")
+		assert.Equal(t, []byte("yes"), val, "Config entry value not as expected")
+		d, ok := c.KDCTimeOffset()
+		assert.Equal(t, v == 4, ok, "KDC time offset presence not as expected")
+		if ok {
+			assert.Equal(t, -90*time.Second-5*time.Microsecond, d, "KDC time offset not as expected")
+		}
+	}
+}
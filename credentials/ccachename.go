@@ -0,0 +1,261 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/jcmturner/gokrb5.v5/config"
+)
+
+// Credential cache types that can be named in the form TYPE:residual.
+// https://web.mit.edu/kerberos/krb5-latest/doc/basic/ccache_def.html#ccache-types
+const (
+	CCacheTypeFile    = "FILE"
+	CCacheTypeDir     = "DIR"
+	CCacheTypeKeyring = "KEYRING"
+)
+
+const (
+	// Name of the file in a DIR collection holding the file name of the primary cache.
+	dirPrimaryFile = "primary"
+	// Prefix of the file names of the caches in a DIR collection.
+	dirCCachePrefix = "tkt"
+)
+
+// CCacheCollection is a collection of credential caches, one of which is the primary cache.
+// https://web.mit.edu/kerberos/krb5-latest/doc/basic/ccache_def.html#collections-of-caches
+type CCacheCollection interface {
+	// List returns the full names of the caches in the collection.
+	List() ([]string, error)
+	// Primary returns the full name of the collection's primary cache.
+	Primary() (string, error)
+	// Switch makes the cache with the full name provided the primary cache of the collection.
+	Switch(name string) error
+}
+
+// splitCCacheName splits a credential cache name into its type and residual. A name without a type is a FILE path.
+func splitCCacheName(name string) (string, string) {
+	i := strings.Index(name, ":")
+	// A single character type is a Windows drive letter rather than a cache type
+	if i < 2 {
+		return CCacheTypeFile, name
+	}
+	return strings.ToUpper(name[:i]), name[i+1:]
+}
+
+// LoadCCacheName loads the credential cache with the name provided, as would be given by KRB5CCNAME or
+// default_ccache_name. FILE, DIR, KEYRING and KCM caches are supported. A collection name loads the collection's primary cache.
+func LoadCCacheName(name string) (CCache, error) {
+	t, r := splitCCacheName(name)
+	switch t {
+	case CCacheTypeFile:
+		return LoadCCache(r)
+	case CCacheTypeDir:
+		p, err := dirCCachePath(r)
+		if err != nil {
+			return CCache{}, err
+		}
+		return LoadCCache(p)
+	case CCacheTypeKeyring:
+		return loadKeyringCCache(r)
+	case CCacheTypeKCM:
+		k := NewKCMClient("")
+		n, err := k.cacheName(r)
+		if err != nil {
+			return CCache{}, err
+		}
+		return k.Load(n)
+	default:
+		return CCache{}, fmt.Errorf("credential cache type %s is not supported", t)
+	}
+}
+
+// LoadDefaultCCache loads the default credential cache named by KRB5CCNAME or, if it is not set, the configuration's
+// default_ccache_name.
+func LoadDefaultCCache(c *config.Config) (CCache, error) {
+	n, err := c.CCacheName()
+	if err != nil {
+		return CCache{}, fmt.Errorf("could not determine the default credential cache: %v", err)
+	}
+	return LoadCCacheName(n)
+}
+
+// Store writes the credential cache to the cache with the name provided, replacing its contents. FILE, DIR, KEYRING and
+// KCM caches are supported. A collection name stores to the collection's primary cache.
+func (c *CCache) Store(name string) error {
+	t, r := splitCCacheName(name)
+	switch t {
+	case CCacheTypeFile:
+		return c.writeFile(r)
+	case CCacheTypeDir:
+		p, err := dirCCachePath(r)
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(r, ":") {
+			if err := os.MkdirAll(r, 0700); err != nil {
+				return fmt.Errorf("error creating credential cache directory: %v", err)
+			}
+		}
+		return c.writeFile(p)
+	case CCacheTypeKeyring:
+		return storeKeyringCCache(r, c)
+	case CCacheTypeKCM:
+		k := NewKCMClient("")
+		n, err := k.cacheName(r)
+		if err != nil {
+			return err
+		}
+		return k.Store(n, c)
+	default:
+		return fmt.Errorf("credential cache type %s is not supported", t)
+	}
+}
+
+// writeFile replaces the file at the path provided with the credential cache. The file is readable only by its owner.
+func (c *CCache) writeFile(path string) error {
+	b, err := c.Marshal()
+	if err != nil {
+		return fmt.Errorf("error marshaling credential cache: %v", err)
+	}
+	return writeFileAtomic(path, b)
+}
+
+// writeFileAtomic writes the bytes to a temporary file, readable only by its owner, that then replaces the file at path.
+func writeFileAtomic(path string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".")
+	if err != nil {
+		return fmt.Errorf("error creating credential cache file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing credential cache file: %v", err)
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("error writing credential cache file: %v", err)
+	}
+	return nil
+}
+
+// OpenCCacheCollection opens the collection of credential caches with the name provided. A FILE cache is a collection
+// of the one cache.
+func OpenCCacheCollection(name string) (CCacheCollection, error) {
+	t, r := splitCCacheName(name)
+	switch t {
+	case CCacheTypeFile:
+		return fileCollection(CCacheTypeFile + ":" + r), nil
+	case CCacheTypeDir:
+		if strings.HasPrefix(r, ":") {
+			return dirCollection(filepath.Dir(r[1:])), nil
+		}
+		return dirCollection(r), nil
+	case CCacheTypeKeyring:
+		return openKeyringCollection(r)
+	case CCacheTypeKCM:
+		return kcmCollection{client: NewKCMClient("")}, nil
+	default:
+		return nil, fmt.Errorf("credential cache type %s is not supported", t)
+	}
+}
+
+// fileCollection is the collection of a single FILE cache.
+type fileCollection string
+
+// List returns the name of the FILE cache.
+func (f fileCollection) List() ([]string, error) {
+	return []string{string(f)}, nil
+}
+
+// Primary returns the name of the FILE cache.
+func (f fileCollection) Primary() (string, error) {
+	return string(f), nil
+}
+
+// Switch returns an error unless the name is of the FILE cache as it is the only cache in the collection.
+func (f fileCollection) Switch(name string) error {
+	if _, r := splitCCacheName(name); CCacheTypeFile+":"+r != string(f) {
+		return errors.New("a FILE credential cache collection holds only one cache")
+	}
+	return nil
+}
+
+// dirCollection is a directory of FILE caches, with names starting tkt, the primary of which is named by the primary file.
+type dirCollection string
+
+// dirCCachePath returns the path of the cache file for the DIR residual provided. A residual starting with a colon is the
+// path of a cache within a collection, otherwise it is the collection's directory and the path of the primary is returned.
+func dirCCachePath(r string) (string, error) {
+	if strings.HasPrefix(r, ":") {
+		p := r[1:]
+		if !strings.HasPrefix(filepath.Base(p), dirCCachePrefix) {
+			return "", fmt.Errorf("DIR credential cache file name %s does not start with %s", p, dirCCachePrefix)
+		}
+		return p, nil
+	}
+	return dirCollection(r).primaryPath()
+}
+
+func (d dirCollection) primaryPath() (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(string(d), dirPrimaryFile))
+	if os.IsNotExist(err) {
+		return filepath.Join(string(d), dirCCachePrefix), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading primary of DIR credential cache collection: %v", err)
+	}
+	n := strings.TrimSpace(string(b))
+	if !strings.HasPrefix(n, dirCCachePrefix) || strings.ContainsAny(n, `/\`) {
+		return "", fmt.Errorf("primary of DIR credential cache collection is not valid: %s", n)
+	}
+	return filepath.Join(string(d), n), nil
+}
+
+// List returns the names of the caches in the directory.
+func (d dirCollection) List() ([]string, error) {
+	fs, err := ioutil.ReadDir(string(d))
+	if err != nil {
+		return nil, fmt.Errorf("error reading DIR credential cache collection: %v", err)
+	}
+	var ns []string
+	for _, f := range fs {
+		if f.Mode().IsRegular() && strings.HasPrefix(f.Name(), dirCCachePrefix) {
+			ns = append(ns, CCacheTypeDir+"::"+filepath.Join(string(d), f.Name()))
+		}
+	}
+	sort.Strings(ns)
+	return ns, nil
+}
+
+// Primary returns the name of the primary cache of the directory.
+func (d dirCollection) Primary() (string, error) {
+	p, err := d.primaryPath()
+	if err != nil {
+		return "", err
+	}
+	return CCacheTypeDir + "::" + p, nil
+}
+
+// Switch makes the cache named the primary cache of the directory.
+func (d dirCollection) Switch(name string) error {
+	t, r := splitCCacheName(name)
+	if t != CCacheTypeDir || !strings.HasPrefix(r, ":") {
+		return fmt.Errorf("%s is not the name of a cache within a DIR collection", name)
+	}
+	p, err := dirCCachePath(r)
+	if err != nil {
+		return err
+	}
+	if filepath.Clean(filepath.Dir(p)) != filepath.Clean(string(d)) {
+		return fmt.Errorf("%s is not in the DIR collection %s", name, string(d))
+	}
+	return writeFileAtomic(filepath.Join(string(d), dirPrimaryFile), []byte(filepath.Base(p)+"\n"))
+}
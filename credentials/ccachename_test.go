@@ -0,0 +1,121 @@
+package credentials
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/config"
+	"gopkg.in/jcmturner/gokrb5.v5/testdata"
+)
+
+func TestDirCCacheCollection(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c, err := ParseCCache(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	d, err := ioutil.TempDir(os.TempDir(), "krb5cc")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(d)
+	dir := filepath.Join(d, "collection")
+
+	// Storing to the collection stores to the default primary
+	err = c.Store("DIR:" + dir)
+	if err != nil {
+		t.Fatalf("Error storing to DIR collection: %v", err)
+	}
+	err = c.Store("DIR::" + filepath.Join(dir, "tktother"))
+	if err != nil {
+		t.Fatalf("Error storing to DIR cache: %v", err)
+	}
+	err = c.Store("DIR::" + filepath.Join(dir, "notacache"))
+	assert.Error(t, err, "Cache file names in a DIR collection must start with tkt")
+
+	col, err := OpenCCacheCollection("DIR:" + dir)
+	if err != nil {
+		t.Fatalf("Error opening DIR collection: %v", err)
+	}
+	ns, err := col.List()
+	if err != nil {
+		t.Fatalf("Error listing DIR collection: %v", err)
+	}
+	assert.Equal(t, []string{"DIR::" + filepath.Join(dir, "tkt"), "DIR::" + filepath.Join(dir, "tktother")}, ns, "Caches in collection not as expected")
+	p, err := col.Primary()
+	if err != nil {
+		t.Fatalf("Error getting primary of DIR collection: %v", err)
+	}
+	assert.Equal(t, "DIR::"+filepath.Join(dir, "tkt"), p, "Primary cache not as expected")
+
+	err = col.Switch("DIR::" + filepath.Join(dir, "tktother"))
+	if err != nil {
+		t.Fatalf("Error switching primary of DIR collection: %v", err)
+	}
+	p, _ = col.Primary()
+	assert.Equal(t, "DIR::"+filepath.Join(dir, "tktother"), p, "Primary cache not as expected after switch")
+	err = col.Switch("DIR::" + filepath.Join(d, "tktother"))
+	assert.Error(t, err, "Switching to a cache outside the collection should fail")
+
+	lc, err := LoadCCacheName("DIR:" + dir)
+	if err != nil {
+		t.Fatalf("Error loading primary of DIR collection: %v", err)
+	}
+	assert.Equal(t, filepath.Join(dir, "tktother"), lc.Path, "Loaded cache path not as expected")
+	assert.Equal(t, c.Credentials, lc.Credentials, "Loaded credentials not as expected")
+}
+
+func TestLoadCCacheName_File(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c, err := ParseCCache(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	f, err := ioutil.TempFile(os.TempDir(), "krb5cc")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	for _, n := range []string{"FILE:" + f.Name(), f.Name()} {
+		err = c.Store(n)
+		if err != nil {
+			t.Fatalf("Error storing cache %s: %v", n, err)
+		}
+		lc, err := LoadCCacheName(n)
+		if err != nil {
+			t.Fatalf("Error loading cache %s: %v", n, err)
+		}
+		assert.Equal(t, c.DefaultPrincipal, lc.DefaultPrincipal, "Default principal not as expected")
+		assert.Equal(t, c.Credentials, lc.Credentials, "Credentials not as expected")
+	}
+	fi, err := os.Stat(f.Name())
+	if err != nil {
+		t.Fatalf("Error getting cache file info: %v", err)
+	}
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm(), "Cache file permissions not as expected")
+
+	_, err = LoadCCacheName("MEMORY:test")
+	assert.Error(t, err, "Unsupported cache types should not load")
+
+	cfg := config.NewConfig()
+	cfg.LibDefaults.DefaultCCacheName = "FILE:" + f.Name()
+	os.Unsetenv(config.EnvCCacheName)
+	lc, err := LoadDefaultCCache(cfg)
+	if err != nil {
+		t.Fatalf("Error loading default cache: %v", err)
+	}
+	assert.Equal(t, c.DefaultPrincipal, lc.DefaultPrincipal, "Default principal not as expected")
+}
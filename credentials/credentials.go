@@ -2,6 +2,8 @@
 package credentials
 
 import (
+	"crypto"
+	"crypto/x509"
 	"time"
 
 	"github.com/hashicorp/go-uuid"
@@ -13,11 +15,14 @@ import (
 const (
 	// AttributeKeyADCredentials assigned number for AD credentials.
 	AttributeKeyADCredentials = 1
+	// AttributeKeyDelegatedCredentials assigned number for the decrypted KRB_CRED delegated by the client.
+	AttributeKeyDelegatedCredentials = 2
 )
 
 // Credentials struct for a user.
 // Contains either a keytab, password or both.
 // Keytabs are used over passwords if both are defined.
+// A certificate and private key may also be defined for PKINIT authentication.
 type Credentials struct {
 	Username    string
 	displayName string
@@ -25,11 +30,14 @@ type Credentials struct {
 	CName       types.PrincipalName
 	Keytab      keytab.Keytab
 	Password    string
+	Certificate *x509.Certificate
+	PrivateKey  crypto.Signer
 	Attributes  map[int]interface{}
 	ValidUntil  time.Time
 
 	authenticated   bool
 	human           bool
+	anonymous       bool
 	authTime        time.Time
 	groupMembership map[string]bool
 	sessionID       string
@@ -97,6 +105,13 @@ func (c *Credentials) WithPassword(password string) *Credentials {
 	return c
 }
 
+// WithCertificate sets the X.509 certificate and its private key in the Credentials struct.
+func (c *Credentials) WithCertificate(cert *x509.Certificate, key crypto.Signer) *Credentials {
+	c.Certificate = cert
+	c.PrivateKey = key
+	return c
+}
+
 // HasKeytab queries if the Credentials has a keytab defined.
 func (c *Credentials) HasKeytab() bool {
 	if len(c.Keytab.Entries) > 0 {
@@ -118,6 +133,14 @@ func (c *Credentials) HasPassword() bool {
 	return false
 }
 
+// HasCertificate queries if the Credentials has a certificate and private key defined.
+func (c *Credentials) HasCertificate() bool {
+	if c.Certificate != nil && c.PrivateKey != nil {
+		return true
+	}
+	return false
+}
+
 // SetADCredentials adds ADCredentials attributes to the credentials
 func (c *Credentials) SetADCredentials(a ADCredentials) {
 	c.Attributes[AttributeKeyADCredentials] = a
@@ -177,6 +200,16 @@ func (c *Credentials) SetHuman(b bool) {
 	c.human = b
 }
 
+// Anonymous indicates if the credential was authenticated with an anonymous ticket.
+func (c *Credentials) Anonymous() bool {
+	return c.anonymous
+}
+
+// SetAnonymous sets the credential as having been authenticated with an anonymous ticket.
+func (c *Credentials) SetAnonymous(b bool) {
+	c.anonymous = b
+}
+
 // AuthTime returns the time the credential was authenticated.
 func (c *Credentials) AuthTime() time.Time {
 	return c.authTime
@@ -0,0 +1,301 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+// CCacheTypeKCM is the type of credential caches held by a KCM daemon such as sssd-kcm or Heimdal's kcm.
+const CCacheTypeKCM = "KCM"
+
+// DefaultKCMSocket is the default path of the Unix socket KCM daemons listen on.
+const DefaultKCMSocket = "/var/run/.heim_org.h5l.kcm-socket"
+
+// KCM protocol operation codes.
+// https://github.com/krb5/krb5/blob/master/src/include/kcm.h
+const (
+	kcmOpInitialize       = 4
+	kcmOpDestroy          = 5
+	kcmOpStore            = 6
+	kcmOpGetPrincipal     = 8
+	kcmOpGetCredUUIDList  = 9
+	kcmOpGetCredByUUID    = 10
+	kcmOpRemoveCred       = 11
+	kcmOpGetCacheUUIDList = 18
+	kcmOpGetCacheByUUID   = 19
+	kcmOpGetDefaultCache  = 20
+	kcmOpSetDefaultCache  = 21
+	kcmOpGetKDCOffset     = 22
+	kcmOpSetKDCOffset     = 23
+)
+
+const (
+	kcmProtocolVersionMajor = 2
+	kcmProtocolVersionMinor = 0
+	kcmUUIDLength           = 16
+	kcmTimeout              = 10 * time.Second
+	kcmMaxReplyLength       = 10 * 1024 * 1024
+)
+
+// KCMError is a non-zero status code returned by the KCM daemon. The codes are com_err codes of the krb5 library.
+type KCMError struct {
+	Operation uint16
+	Code      int32
+}
+
+// Error returns the description of the KCM error.
+func (e KCMError) Error() string {
+	return fmt.Sprintf("KCM operation %d failed with status code %d", e.Operation, e.Code)
+}
+
+// KCMClient exchanges requests with a KCM daemon over its Unix socket to manage the credential caches it holds.
+type KCMClient struct {
+	SocketPath string
+}
+
+// NewKCMClient creates a new KCM client for the socket path provided. If the path is empty the default socket is used.
+func NewKCMClient(socketPath string) *KCMClient {
+	if socketPath == "" {
+		socketPath = DefaultKCMSocket
+	}
+	return &KCMClient{SocketPath: socketPath}
+}
+
+// request sends a request for the operation with the payload provided to the KCM daemon and returns the reply payload.
+func (k *KCMClient) request(op uint16, payload []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", k.SocketPath, kcmTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to KCM socket %s: %v", k.SocketPath, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(kcmTimeout))
+	// Length prefixed request of the protocol version, operation code and payload
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(b[0:4], uint32(4+len(payload)))
+	b[4] = kcmProtocolVersionMajor
+	b[5] = kcmProtocolVersionMinor
+	binary.BigEndian.PutUint16(b[6:8], op)
+	b = append(b, payload...)
+	if _, err = conn.Write(b); err != nil {
+		return nil, fmt.Errorf("error sending KCM request: %v", err)
+	}
+	h := make([]byte, 4)
+	if _, err = io.ReadFull(conn, h); err != nil {
+		return nil, fmt.Errorf("error reading KCM reply: %v", err)
+	}
+	l := binary.BigEndian.Uint32(h)
+	if l < 4 || l > kcmMaxReplyLength {
+		return nil, fmt.Errorf("KCM reply length %d not valid", l)
+	}
+	r := make([]byte, l)
+	if _, err = io.ReadFull(conn, r); err != nil {
+		return nil, fmt.Errorf("error reading KCM reply: %v", err)
+	}
+	if c := int32(binary.BigEndian.Uint32(r[0:4])); c != 0 {
+		return nil, KCMError{Operation: op, Code: c}
+	}
+	return r[4:], nil
+}
+
+// kcmName returns the bytes of the null terminated cache name sent in KCM requests.
+func kcmName(name string) []byte {
+	return append([]byte(name), 0)
+}
+
+// readKCMName returns the null terminated name at the start of the bytes provided.
+func readKCMName(b []byte) (string, error) {
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return "", errors.New("KCM reply does not contain a null terminated name")
+	}
+	return string(b[:i]), nil
+}
+
+// DefaultCacheName returns the name of the default cache held by the KCM daemon.
+func (k *KCMClient) DefaultCacheName() (string, error) {
+	r, err := k.request(kcmOpGetDefaultCache, nil)
+	if err != nil {
+		return "", err
+	}
+	return readKCMName(r)
+}
+
+// SetDefaultCacheName sets the cache with the name provided as the default cache held by the KCM daemon.
+func (k *KCMClient) SetDefaultCacheName(name string) error {
+	_, err := k.request(kcmOpSetDefaultCache, kcmName(name))
+	return err
+}
+
+// ListCaches returns the names of the caches held by the KCM daemon.
+func (k *KCMClient) ListCaches() ([]string, error) {
+	r, err := k.request(kcmOpGetCacheUUIDList, nil)
+	if err != nil {
+		return nil, err
+	}
+	var ns []string
+	for i := 0; i+kcmUUIDLength <= len(r); i += kcmUUIDLength {
+		nb, err := k.request(kcmOpGetCacheByUUID, r[i:i+kcmUUIDLength])
+		if err != nil {
+			return nil, err
+		}
+		n, err := readKCMName(nb)
+		if err != nil {
+			return nil, err
+		}
+		ns = append(ns, n)
+	}
+	return ns, nil
+}
+
+// Load returns the cache with the name provided from the KCM daemon.
+func (k *KCMClient) Load(name string) (CCache, error) {
+	c := CCache{
+		Version: 4,
+		Path:    CCacheTypeKCM + ":" + name,
+	}
+	e := binary.ByteOrder(binary.BigEndian)
+	r, err := k.request(kcmOpGetPrincipal, kcmName(name))
+	if err != nil {
+		return c, err
+	}
+	if len(r) < 1 {
+		return c, fmt.Errorf("KCM credential cache %s has no default principal", name)
+	}
+	p := 0
+	c.DefaultPrincipal = parsePrincipal(r, &p, &c, &e)
+	if r, err = k.request(kcmOpGetKDCOffset, kcmName(name)); err == nil && len(r) == 4 {
+		c.SetKDCTimeOffset(time.Duration(int32(binary.BigEndian.Uint32(r))) * time.Second)
+	}
+	r, err = k.request(kcmOpGetCredUUIDList, kcmName(name))
+	if err != nil {
+		return c, err
+	}
+	for i := 0; i+kcmUUIDLength <= len(r); i += kcmUUIDLength {
+		cb, err := k.request(kcmOpGetCredByUUID, append(kcmName(name), r[i:i+kcmUUIDLength]...))
+		if err != nil {
+			return c, err
+		}
+		p = 0
+		cred, err := parseCredential(cb, &p, &c, &e)
+		if err != nil {
+			return c, fmt.Errorf("error parsing credential of KCM credential cache: %v", err)
+		}
+		c.Credentials = append(c.Credentials, cred)
+	}
+	return c, nil
+}
+
+// Store replaces the contents of the cache with the name provided in the KCM daemon with the credential cache given.
+func (k *KCMClient) Store(name string, c *CCache) error {
+	buf := bytes.NewBuffer(kcmName(name))
+	c.DefaultPrincipal.marshal(buf)
+	if _, err := k.request(kcmOpInitialize, buf.Bytes()); err != nil {
+		return err
+	}
+	if d, ok := c.KDCTimeOffset(); ok {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(int32(d/time.Second)))
+		if _, err := k.request(kcmOpSetKDCOffset, append(kcmName(name), b...)); err != nil {
+			return err
+		}
+	}
+	for _, cred := range c.Credentials {
+		if err := k.StoreCredential(name, cred); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StoreCredential adds the credential to the cache with the name provided in the KCM daemon.
+func (k *KCMClient) StoreCredential(name string, cred credential) error {
+	buf := bytes.NewBuffer(kcmName(name))
+	cred.marshal(buf, 4)
+	_, err := k.request(kcmOpStore, buf.Bytes())
+	return err
+}
+
+// RemoveCredential removes the credentials for the server principal provided from the cache with the name provided in the
+// KCM daemon. Not all KCM daemons support the removal of credentials.
+func (k *KCMClient) RemoveCredential(name string, sname types.PrincipalName, srealm string) error {
+	buf := bytes.NewBuffer(kcmName(name))
+	// No match flags so credentials are matched on the server principal only
+	writeInt32(buf, 0)
+	buf.WriteByte(0)
+	buf.WriteByte(1)
+	principal{Realm: srealm, PrincipalName: sname}.marshal(buf)
+	(credential{}).marshalMatch(buf)
+	_, err := k.request(kcmOpRemoveCred, buf.Bytes())
+	return err
+}
+
+// marshalMatch writes the fields of the credential, following the principals, used to match credentials for removal.
+func (cred credential) marshalMatch(buf *bytes.Buffer) {
+	writeInt16(buf, int16(cred.Key.KeyType))
+	writeData(buf, cred.Key.KeyValue)
+	writeTimestamp(buf, cred.AuthTime)
+	writeTimestamp(buf, cred.StartTime)
+	writeTimestamp(buf, cred.EndTime)
+	writeTimestamp(buf, cred.RenewTill)
+	// Not a user to user ticket, no ticket flags, addresses or authorization data
+	buf.WriteByte(0)
+	writeInt32(buf, 0)
+	writeInt32(buf, 0)
+	writeInt32(buf, 0)
+	writeData(buf, cred.Ticket)
+	writeData(buf, cred.SecondTicket)
+}
+
+// Destroy removes the cache with the name provided from the KCM daemon.
+func (k *KCMClient) Destroy(name string) error {
+	_, err := k.request(kcmOpDestroy, kcmName(name))
+	return err
+}
+
+// cacheName returns the name of the cache within the KCM daemon for the KCM residual provided. An empty residual is
+// the daemon's default cache.
+func (k *KCMClient) cacheName(r string) (string, error) {
+	if r != "" {
+		return r, nil
+	}
+	return k.DefaultCacheName()
+}
+
+// kcmCollection is the collection of the caches held by a KCM daemon.
+type kcmCollection struct {
+	client *KCMClient
+}
+
+// List returns the names of the caches held by the KCM daemon.
+func (k kcmCollection) List() ([]string, error) {
+	ns, err := k.client.ListCaches()
+	for i := range ns {
+		ns[i] = CCacheTypeKCM + ":" + ns[i]
+	}
+	return ns, err
+}
+
+// Primary returns the name of the default cache of the KCM daemon.
+func (k kcmCollection) Primary() (string, error) {
+	n, err := k.client.DefaultCacheName()
+	if err != nil {
+		return "", err
+	}
+	return CCacheTypeKCM + ":" + n, nil
+}
+
+// Switch sets the cache named as the default cache of the KCM daemon.
+func (k kcmCollection) Switch(name string) error {
+	t, r := splitCCacheName(name)
+	if t != CCacheTypeKCM || r == "" {
+		return fmt.Errorf("%s is not the name of a KCM credential cache", name)
+	}
+	return k.client.SetDefaultCacheName(r)
+}
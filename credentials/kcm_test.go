@@ -0,0 +1,314 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/testdata"
+)
+
+// KRB5_FCC_NOFILE com_err code returned by the stand-in KCM server for caches it does not hold.
+const testKCMNoCache = -1765328189
+
+type testKCMCache struct {
+	name   string
+	princ  []byte
+	creds  [][]byte
+	offset []byte
+}
+
+// testKCMServer is a stand-in KCM daemon holding its caches in memory.
+type testKCMServer struct {
+	mux     sync.Mutex
+	l       net.Listener
+	caches  []*testKCMCache
+	deflt   string
+	version []byte
+}
+
+func newTestKCMServer(t *testing.T) (*testKCMServer, string) {
+	d, err := ioutil.TempDir("", "kcm")
+	if err != nil {
+		t.Fatalf("Error creating directory for KCM socket: %v", err)
+	}
+	p := filepath.Join(d, "kcm.sock")
+	l, err := net.Listen("unix", p)
+	if err != nil {
+		os.RemoveAll(d)
+		t.Skipf("Unix sockets are not available: %v", err)
+	}
+	s := &testKCMServer{l: l, deflt: "0"}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s, p
+}
+
+func (s *testKCMServer) close(p string) {
+	s.l.Close()
+	os.RemoveAll(filepath.Dir(p))
+}
+
+func (s *testKCMServer) serve(conn net.Conn) {
+	defer conn.Close()
+	h := make([]byte, 4)
+	if _, err := io.ReadFull(conn, h); err != nil {
+		return
+	}
+	b := make([]byte, binary.BigEndian.Uint32(h))
+	if _, err := io.ReadFull(conn, b); err != nil || len(b) < 4 {
+		return
+	}
+	s.mux.Lock()
+	s.version = b[0:2]
+	r, code := s.handle(binary.BigEndian.Uint16(b[2:4]), b[4:])
+	s.mux.Unlock()
+	rb := make([]byte, 8, 8+len(r))
+	binary.BigEndian.PutUint32(rb[0:4], uint32(4+len(r)))
+	binary.BigEndian.PutUint32(rb[4:8], uint32(code))
+	conn.Write(append(rb, r...))
+}
+
+func (s *testKCMServer) cache(name string) *testKCMCache {
+	for _, c := range s.caches {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func testKCMUUID(i int) []byte {
+	u := make([]byte, kcmUUIDLength)
+	binary.BigEndian.PutUint32(u[kcmUUIDLength-4:], uint32(i))
+	return u
+}
+
+func (s *testKCMServer) handle(op uint16, b []byte) ([]byte, int32) {
+	var name string
+	if op != kcmOpGetDefaultCache && op != kcmOpGetCacheUUIDList && op != kcmOpGetCacheByUUID {
+		i := bytes.IndexByte(b, 0)
+		if i < 0 {
+			return nil, -1
+		}
+		name, b = string(b[:i]), b[i+1:]
+	}
+	switch op {
+	case kcmOpGetDefaultCache:
+		return kcmName(s.deflt), 0
+	case kcmOpSetDefaultCache:
+		s.deflt = name
+		return nil, 0
+	case kcmOpGetCacheUUIDList:
+		var r []byte
+		for i := range s.caches {
+			r = append(r, testKCMUUID(i)...)
+		}
+		return r, 0
+	case kcmOpGetCacheByUUID:
+		i := int(binary.BigEndian.Uint32(b[kcmUUIDLength-4 : kcmUUIDLength]))
+		if i >= len(s.caches) {
+			return nil, testKCMNoCache
+		}
+		return kcmName(s.caches[i].name), 0
+	case kcmOpInitialize:
+		if c := s.cache(name); c != nil {
+			c.princ, c.creds, c.offset = b, nil, nil
+			return nil, 0
+		}
+		s.caches = append(s.caches, &testKCMCache{name: name, princ: b})
+		return nil, 0
+	}
+	c := s.cache(name)
+	if c == nil {
+		return nil, testKCMNoCache
+	}
+	switch op {
+	case kcmOpDestroy:
+		for i := range s.caches {
+			if s.caches[i] == c {
+				s.caches = append(s.caches[:i], s.caches[i+1:]...)
+				break
+			}
+		}
+	case kcmOpStore:
+		c.creds = append(c.creds, b)
+	case kcmOpGetPrincipal:
+		return c.princ, 0
+	case kcmOpGetCredUUIDList:
+		var r []byte
+		for i := range c.creds {
+			r = append(r, testKCMUUID(i)...)
+		}
+		return r, 0
+	case kcmOpGetCredByUUID:
+		i := int(binary.BigEndian.Uint32(b[kcmUUIDLength-4 : kcmUUIDLength]))
+		if i >= len(c.creds) {
+			return nil, testKCMNoCache
+		}
+		return c.creds[i], 0
+	case kcmOpRemoveCred:
+		// Match flags and absent client principal precede the server principal
+		var cc CCache
+		e := binary.ByteOrder(binary.BigEndian)
+		p := 6
+		srv := parsePrincipal(b, &p, &cc, &e)
+		var creds [][]byte
+		for _, cb := range c.creds {
+			p = 0
+			cred, err := parseCredential(cb, &p, &cc, &e)
+			if err != nil || !cred.Server.PrincipalName.Equal(srv.PrincipalName) || cred.Server.Realm != srv.Realm {
+				creds = append(creds, cb)
+			}
+		}
+		c.creds = creds
+	case kcmOpGetKDCOffset:
+		if c.offset == nil {
+			return nil, testKCMNoCache
+		}
+		return c.offset, 0
+	case kcmOpSetKDCOffset:
+		c.offset = b
+	default:
+		return nil, -1
+	}
+	return nil, 0
+}
+
+func TestKCMClient(t *testing.T) {
+	t.Parallel()
+	s, p := newTestKCMServer(t)
+	defer s.close(p)
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c, err := ParseCCache(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	k := NewKCMClient(p)
+
+	_, err = k.Load("0")
+	if assert.Error(t, err, "Loading a cache not held should error") {
+		assert.IsType(t, KCMError{}, err, "Error type not as expected")
+	}
+	err = k.Store("0", &c)
+	if err != nil {
+		t.Fatalf("Error storing KCM cache: %v", err)
+	}
+	s.mux.Lock()
+	assert.Equal(t, []byte{kcmProtocolVersionMajor, kcmProtocolVersionMinor}, s.version, "Protocol version not as expected")
+	s.mux.Unlock()
+	err = k.Store("1", &c)
+	if err != nil {
+		t.Fatalf("Error storing KCM cache: %v", err)
+	}
+	ns, err := k.ListCaches()
+	if err != nil {
+		t.Fatalf("Error listing KCM caches: %v", err)
+	}
+	assert.Equal(t, []string{"0", "1"}, ns, "KCM cache names not as expected")
+
+	lc, err := k.Load("1")
+	if err != nil {
+		t.Fatalf("Error loading KCM cache: %v", err)
+	}
+	assert.Equal(t, "KCM:1", lc.Path, "Loaded cache name not as expected")
+	assert.Equal(t, c.DefaultPrincipal, lc.DefaultPrincipal, "Default principal not as expected")
+	assert.Equal(t, c.Credentials, lc.Credentials, "Credentials not as expected")
+	d, ok := lc.KDCTimeOffset()
+	cd, cok := c.KDCTimeOffset()
+	assert.Equal(t, cok, ok, "KDC time offset presence not as expected")
+	assert.Equal(t, cd, d, "KDC time offset not as expected")
+
+	cred := c.Credentials[0]
+	err = k.RemoveCredential("1", cred.Server.PrincipalName, cred.Server.Realm)
+	if err != nil {
+		t.Fatalf("Error removing credential from KCM cache: %v", err)
+	}
+	lc, _ = k.Load("1")
+	assert.Equal(t, len(c.Credentials)-1, len(lc.Credentials), "Number of credentials after removal not as expected")
+	for _, lcred := range lc.Credentials {
+		assert.False(t, lcred.Server.PrincipalName.Equal(cred.Server.PrincipalName), "Removed credential still in cache")
+	}
+
+	err = k.StoreCredential("1", cred)
+	if err != nil {
+		t.Fatalf("Error storing credential in KCM cache: %v", err)
+	}
+	lc, _ = k.Load("1")
+	assert.Equal(t, len(c.Credentials), len(lc.Credentials), "Number of credentials after store not as expected")
+
+	err = k.Destroy("0")
+	if err != nil {
+		t.Fatalf("Error destroying KCM cache: %v", err)
+	}
+	ns, _ = k.ListCaches()
+	assert.Equal(t, []string{"1"}, ns, "KCM cache names after destroy not as expected")
+}
+
+func TestKCMCCacheCollection(t *testing.T) {
+	t.Parallel()
+	s, p := newTestKCMServer(t)
+	defer s.close(p)
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c, err := ParseCCache(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	k := NewKCMClient(p)
+	col := kcmCollection{client: k}
+
+	dn, err := k.DefaultCacheName()
+	if err != nil {
+		t.Fatalf("Error getting default KCM cache name: %v", err)
+	}
+	assert.Equal(t, "0", dn, "Default cache name not as expected")
+	for _, n := range []string{"0", "1"} {
+		err = k.Store(n, &c)
+		if err != nil {
+			t.Fatalf("Error storing KCM cache: %v", err)
+		}
+	}
+	ns, err := col.List()
+	if err != nil {
+		t.Fatalf("Error listing KCM collection: %v", err)
+	}
+	assert.Equal(t, []string{"KCM:0", "KCM:1"}, ns, "Caches in collection not as expected")
+	pn, err := col.Primary()
+	if err != nil {
+		t.Fatalf("Error getting primary of KCM collection: %v", err)
+	}
+	assert.Equal(t, "KCM:0", pn, "Primary cache not as expected")
+	err = col.Switch("KCM:1")
+	if err != nil {
+		t.Fatalf("Error switching primary of KCM collection: %v", err)
+	}
+	pn, _ = col.Primary()
+	assert.Equal(t, "KCM:1", pn, "Primary cache not as expected after switch")
+	assert.Error(t, col.Switch("FILE:/tmp/krb5cc"), "Switching to a cache of another type should error")
+	n, err := k.cacheName("")
+	if err != nil {
+		t.Fatalf("Error resolving default KCM cache name: %v", err)
+	}
+	assert.Equal(t, "1", n, "Cache name for empty residual not as expected")
+}
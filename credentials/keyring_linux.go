@@ -0,0 +1,431 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Linux kernel key management: https://man7.org/linux/man-pages/man7/keyrings.7.html
+const (
+	keySpecThreadKeyring  int32 = -1
+	keySpecProcessKeyring int32 = -2
+	keySpecSessionKeyring int32 = -3
+	keySpecUserKeyring    int32 = -4
+
+	keyctlGetKeyringID  = 0
+	keyctlDescribe      = 6
+	keyctlClear         = 7
+	keyctlSearch        = 10
+	keyctlRead          = 11
+	keyctlGetPersistent = 22
+
+	keyTypeKeyring = "keyring"
+	keyTypeUser    = "user"
+)
+
+// Layout of the credential caches within the kernel keyrings as used by MIT krb5.
+const (
+	keyringCollectionPrefix     = "_krb_"
+	keyringPersistentCollection = "_krb"
+	keyringPrimaryKey           = "krb_ccache:primary"
+	keyringPrimaryVersion       = 1
+	keyringPrincipalKey         = "__krb5_princ__"
+	keyringTimeOffsetsKey       = "__krb5_time_offsets__"
+	keyringDefaultSubsidiary    = "tkt"
+)
+
+// keyringName is a parsed KEYRING credential cache residual of the form [anchor:]collection[:subsidiary].
+type keyringName struct {
+	anchor     string
+	collection string
+	subsidiary string
+}
+
+func parseKeyringResidual(r string) (keyringName, error) {
+	p := strings.SplitN(r, ":", 3)
+	var n keyringName
+	switch p[0] {
+	case "persistent", "user", "session", "process", "thread":
+		n.anchor = p[0]
+		if len(p) > 1 {
+			n.collection = p[1]
+		}
+		if len(p) > 2 {
+			n.subsidiary = p[2]
+		}
+	default:
+		// Legacy name of a cache in the session keyring
+		n.anchor = "session"
+		n.collection = r
+		n.subsidiary = r
+	}
+	if n.anchor == "persistent" && n.collection == "" {
+		n.collection = strconv.Itoa(os.Getuid())
+	}
+	if n.collection == "" {
+		return n, fmt.Errorf("KEYRING credential cache name %s is not valid", r)
+	}
+	return n, nil
+}
+
+func (n keyringName) String() string {
+	return CCacheTypeKeyring + ":" + n.anchor + ":" + n.collection + ":" + n.subsidiary
+}
+
+// collectionKeyring returns the ID of the keyring holding the caches of the collection, creating it if requested.
+func (n keyringName) collectionKeyring(create bool) (int32, error) {
+	var base int32
+	var err error
+	desc := keyringCollectionPrefix + n.collection
+	if n.anchor == "persistent" {
+		uid, err := strconv.Atoi(n.collection)
+		if err != nil {
+			return 0, fmt.Errorf("persistent KEYRING credential cache uid %s is not valid", n.collection)
+		}
+		spec := keySpecProcessKeyring
+		base, err = keyctlInt(keyctlGetPersistent, uintptr(uid), uintptr(spec))
+		if err != nil {
+			return 0, fmt.Errorf("error getting persistent keyring: %v", err)
+		}
+		desc = keyringPersistentCollection
+	} else {
+		spec := map[string]int32{
+			"user":    keySpecUserKeyring,
+			"session": keySpecSessionKeyring,
+			"process": keySpecProcessKeyring,
+			"thread":  keySpecThreadKeyring,
+		}[n.anchor]
+		base, err = keyctlInt(keyctlGetKeyringID, uintptr(spec), 1)
+		if err != nil {
+			return 0, fmt.Errorf("error getting %s keyring: %v", n.anchor, err)
+		}
+	}
+	return getKeyring(base, desc, create)
+}
+
+// primary returns the subsidiary name of the collection's primary cache.
+func (n keyringName) primary(collection int32) string {
+	id, err := searchKey(collection, keyTypeUser, keyringPrimaryKey)
+	if err != nil {
+		return keyringDefaultSubsidiary
+	}
+	b, err := readKey(id)
+	if err != nil || len(b) < 8 || binary.BigEndian.Uint32(b[0:4]) != keyringPrimaryVersion {
+		return keyringDefaultSubsidiary
+	}
+	l := int(binary.BigEndian.Uint32(b[4:8]))
+	if len(b) < 8+l || l < 1 {
+		return keyringDefaultSubsidiary
+	}
+	return string(b[8 : 8+l])
+}
+
+func setPrimary(collection int32, subsidiary string) error {
+	b := make([]byte, 8, 8+len(subsidiary))
+	binary.BigEndian.PutUint32(b[0:4], keyringPrimaryVersion)
+	binary.BigEndian.PutUint32(b[4:8], uint32(len(subsidiary)))
+	b = append(b, subsidiary...)
+	_, err := addKey(keyTypeUser, keyringPrimaryKey, b, collection)
+	return err
+}
+
+func loadKeyringCCache(r string) (CCache, error) {
+	var c CCache
+	n, err := parseKeyringResidual(r)
+	if err != nil {
+		return c, err
+	}
+	col, err := n.collectionKeyring(false)
+	if err != nil {
+		return c, err
+	}
+	if n.subsidiary == "" {
+		n.subsidiary = n.primary(col)
+	}
+	ring, err := searchKey(col, keyTypeKeyring, n.subsidiary)
+	if err != nil {
+		return c, fmt.Errorf("KEYRING credential cache %s not found: %v", n, err)
+	}
+	ids, err := keyringKeys(ring)
+	if err != nil {
+		return c, err
+	}
+	c.Version = 4
+	c.Path = n.String()
+	e := binary.ByteOrder(binary.BigEndian)
+	var princ bool
+	for _, id := range ids {
+		t, desc, err := describeKey(id)
+		if err != nil || t != keyTypeUser {
+			continue
+		}
+		b, err := readKey(id)
+		if err != nil {
+			return c, fmt.Errorf("error reading key %s of KEYRING credential cache: %v", desc, err)
+		}
+		p := 0
+		switch desc {
+		case keyringPrincipalKey:
+			c.DefaultPrincipal = parsePrincipal(b, &p, &c, &e)
+			princ = true
+		case keyringTimeOffsetsKey:
+			if len(b) == 8 {
+				c.SetKDCTimeOffset(time.Duration(int32(binary.BigEndian.Uint32(b[0:4])))*time.Second +
+					time.Duration(int32(binary.BigEndian.Uint32(b[4:8])))*time.Microsecond)
+			}
+		default:
+			cred, err := parseCredential(b, &p, &c, &e)
+			if err != nil {
+				return c, fmt.Errorf("error parsing credential %s of KEYRING credential cache: %v", desc, err)
+			}
+			c.Credentials = append(c.Credentials, cred)
+		}
+	}
+	if !princ {
+		return c, fmt.Errorf("KEYRING credential cache %s has no default principal", n)
+	}
+	return c, nil
+}
+
+func storeKeyringCCache(r string, c *CCache) error {
+	n, err := parseKeyringResidual(r)
+	if err != nil {
+		return err
+	}
+	col, err := n.collectionKeyring(true)
+	if err != nil {
+		return err
+	}
+	_, perr := searchKey(col, keyTypeUser, keyringPrimaryKey)
+	if n.subsidiary == "" {
+		n.subsidiary = n.primary(col)
+	}
+	ring, err := getKeyring(col, n.subsidiary, true)
+	if err != nil {
+		return err
+	}
+	if _, err = keyctlInt(keyctlClear, uintptr(ring), 0); err != nil {
+		return fmt.Errorf("error clearing KEYRING credential cache: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	c.DefaultPrincipal.marshal(buf)
+	if _, err = addKey(keyTypeUser, keyringPrincipalKey, buf.Bytes(), ring); err != nil {
+		return fmt.Errorf("error storing principal in KEYRING credential cache: %v", err)
+	}
+	if d, ok := c.KDCTimeOffset(); ok {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint32(b[0:4], uint32(int32(d/time.Second)))
+		binary.BigEndian.PutUint32(b[4:8], uint32(int32((d%time.Second)/time.Microsecond)))
+		if _, err = addKey(keyTypeUser, keyringTimeOffsetsKey, b, ring); err != nil {
+			return fmt.Errorf("error storing time offsets in KEYRING credential cache: %v", err)
+		}
+	}
+	for _, cred := range c.Credentials {
+		buf.Reset()
+		cred.marshal(buf, 4)
+		if _, err = addKey(keyTypeUser, cred.Server.unparse(), buf.Bytes(), ring); err != nil {
+			return fmt.Errorf("error storing credential in KEYRING credential cache: %v", err)
+		}
+	}
+	if perr != nil {
+		// The collection has no primary cache yet
+		return setPrimary(col, n.subsidiary)
+	}
+	return nil
+}
+
+// unparse returns the principal in string form with the separators within components escaped.
+func (princ principal) unparse() string {
+	r := strings.NewReplacer(`\`, `\\`, "/", `\/`, "@", `\@`)
+	ns := make([]string, len(princ.PrincipalName.NameString))
+	for i, s := range princ.PrincipalName.NameString {
+		ns[i] = r.Replace(s)
+	}
+	return strings.Join(ns, "/") + "@" + r.Replace(princ.Realm)
+}
+
+// keyringCollection is a collection of caches held in a kernel keyring.
+type keyringCollection keyringName
+
+func openKeyringCollection(r string) (CCacheCollection, error) {
+	n, err := parseKeyringResidual(r)
+	if err != nil {
+		return nil, err
+	}
+	n.subsidiary = ""
+	return keyringCollection(n), nil
+}
+
+// List returns the names of the caches in the keyring collection.
+func (k keyringCollection) List() ([]string, error) {
+	col, err := keyringName(k).collectionKeyring(false)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := keyringKeys(col)
+	if err != nil {
+		return nil, err
+	}
+	var ns []string
+	for _, id := range ids {
+		t, desc, err := describeKey(id)
+		if err != nil || t != keyTypeKeyring {
+			continue
+		}
+		n := keyringName(k)
+		n.subsidiary = desc
+		ns = append(ns, n.String())
+	}
+	return ns, nil
+}
+
+// Primary returns the name of the primary cache of the keyring collection.
+func (k keyringCollection) Primary() (string, error) {
+	n := keyringName(k)
+	col, err := n.collectionKeyring(false)
+	if err != nil {
+		n.subsidiary = keyringDefaultSubsidiary
+		return n.String(), nil
+	}
+	n.subsidiary = n.primary(col)
+	return n.String(), nil
+}
+
+// Switch makes the cache named the primary cache of the keyring collection.
+func (k keyringCollection) Switch(name string) error {
+	t, r := splitCCacheName(name)
+	if t != CCacheTypeKeyring {
+		return fmt.Errorf("%s is not the name of a KEYRING credential cache", name)
+	}
+	n, err := parseKeyringResidual(r)
+	if err != nil {
+		return err
+	}
+	if n.anchor != k.anchor || n.collection != k.collection || n.subsidiary == "" {
+		return fmt.Errorf("%s is not in the KEYRING collection", name)
+	}
+	col, err := n.collectionKeyring(false)
+	if err != nil {
+		return err
+	}
+	if _, err := searchKey(col, keyTypeKeyring, n.subsidiary); err != nil {
+		return fmt.Errorf("KEYRING credential cache %s not found: %v", name, err)
+	}
+	return setPrimary(col, n.subsidiary)
+}
+
+// getKeyring returns the ID of the keyring with the description provided within the keyring given, creating it if requested.
+func getKeyring(ring int32, desc string, create bool) (int32, error) {
+	id, err := searchKey(ring, keyTypeKeyring, desc)
+	if err == nil || !create {
+		return id, err
+	}
+	return addKey(keyTypeKeyring, desc, nil, ring)
+}
+
+func keyctlInt(cmd int, a2, a3 uintptr) (int32, error) {
+	r, _, errno := syscall.Syscall6(syscall.SYS_KEYCTL, uintptr(cmd), a2, a3, 0, 0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int32(r), nil
+}
+
+func searchKey(ring int32, keyType, desc string) (int32, error) {
+	t, err := syscall.BytePtrFromString(keyType)
+	if err != nil {
+		return -1, err
+	}
+	d, err := syscall.BytePtrFromString(desc)
+	if err != nil {
+		return -1, err
+	}
+	r, _, errno := syscall.Syscall6(syscall.SYS_KEYCTL, keyctlSearch, uintptr(ring), uintptr(unsafe.Pointer(t)), uintptr(unsafe.Pointer(d)), 0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int32(r), nil
+}
+
+func addKey(keyType, desc string, payload []byte, ring int32) (int32, error) {
+	t, err := syscall.BytePtrFromString(keyType)
+	if err != nil {
+		return -1, err
+	}
+	d, err := syscall.BytePtrFromString(desc)
+	if err != nil {
+		return -1, err
+	}
+	var p unsafe.Pointer
+	if len(payload) > 0 {
+		p = unsafe.Pointer(&payload[0])
+	}
+	r, _, errno := syscall.Syscall6(syscall.SYS_ADD_KEY, uintptr(unsafe.Pointer(t)), uintptr(unsafe.Pointer(d)), uintptr(p), uintptr(len(payload)), uintptr(ring), 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int32(r), nil
+}
+
+func readKey(id int32) ([]byte, error) {
+	var b []byte
+	for {
+		var p unsafe.Pointer
+		if len(b) > 0 {
+			p = unsafe.Pointer(&b[0])
+		}
+		r, _, errno := syscall.Syscall6(syscall.SYS_KEYCTL, keyctlRead, uintptr(id), uintptr(p), uintptr(len(b)), 0, 0)
+		if errno != 0 {
+			return nil, errno
+		}
+		if int(r) <= len(b) {
+			return b[:r], nil
+		}
+		b = make([]byte, r)
+	}
+}
+
+// describeKey returns the type and description of the key.
+func describeKey(id int32) (string, string, error) {
+	b := make([]byte, 256)
+	for {
+		r, _, errno := syscall.Syscall6(syscall.SYS_KEYCTL, keyctlDescribe, uintptr(id), uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)), 0, 0)
+		if errno != 0 {
+			return "", "", errno
+		}
+		if int(r) <= len(b) {
+			// type;uid;gid;perm;description followed by a null terminator
+			p := strings.SplitN(strings.TrimRight(string(b[:r]), "\x00"), ";", 5)
+			if len(p) != 5 {
+				return "", "", errors.New("key description not valid")
+			}
+			return p[0], p[4], nil
+		}
+		b = make([]byte, r)
+	}
+}
+
+// keyringKeys returns the IDs of the keys linked to the keyring.
+func keyringKeys(ring int32) ([]int32, error) {
+	b, err := readKey(ring)
+	if err != nil {
+		return nil, fmt.Errorf("error reading keyring: %v", err)
+	}
+	var e binary.ByteOrder = binary.BigEndian
+	if isNativeEndianLittle() {
+		e = binary.LittleEndian
+	}
+	ids := make([]int32, len(b)/4)
+	for i := range ids {
+		ids[i] = int32(e.Uint32(b[i*4 : i*4+4]))
+	}
+	return ids, nil
+}
@@ -0,0 +1,66 @@
+package credentials
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/testdata"
+)
+
+func TestKeyringCCacheCollection(t *testing.T) {
+	t.Parallel()
+	spec := keySpecProcessKeyring
+	if _, err := keyctlInt(keyctlGetKeyringID, uintptr(spec), 1); err != nil {
+		t.Skipf("Kernel keyrings are not available: %v", err)
+	}
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c, err := ParseCCache(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+
+	err = c.Store("KEYRING:process:gokrb5")
+	if err != nil {
+		t.Fatalf("Error storing to KEYRING collection: %v", err)
+	}
+	err = c.Store("KEYRING:process:gokrb5:other")
+	if err != nil {
+		t.Fatalf("Error storing to KEYRING cache: %v", err)
+	}
+	col, err := OpenCCacheCollection("KEYRING:process:gokrb5")
+	if err != nil {
+		t.Fatalf("Error opening KEYRING collection: %v", err)
+	}
+	ns, err := col.List()
+	if err != nil {
+		t.Fatalf("Error listing KEYRING collection: %v", err)
+	}
+	assert.ElementsMatch(t, []string{"KEYRING:process:gokrb5:tkt", "KEYRING:process:gokrb5:other"}, ns, "Caches in collection not as expected")
+	p, err := col.Primary()
+	if err != nil {
+		t.Fatalf("Error getting primary of KEYRING collection: %v", err)
+	}
+	assert.Equal(t, "KEYRING:process:gokrb5:tkt", p, "Primary cache not as expected")
+	err = col.Switch("KEYRING:process:gokrb5:other")
+	if err != nil {
+		t.Fatalf("Error switching primary of KEYRING collection: %v", err)
+	}
+	p, _ = col.Primary()
+	assert.Equal(t, "KEYRING:process:gokrb5:other", p, "Primary cache not as expected after switch")
+
+	lc, err := LoadCCacheName("KEYRING:process:gokrb5")
+	if err != nil {
+		t.Fatalf("Error loading KEYRING cache: %v", err)
+	}
+	assert.Equal(t, "KEYRING:process:gokrb5:other", lc.Path, "Loaded cache name not as expected")
+	assert.Equal(t, c.DefaultPrincipal, lc.DefaultPrincipal, "Default principal not as expected")
+	assert.ElementsMatch(t, c.Credentials, lc.Credentials, "Credentials not as expected")
+	d, ok := lc.KDCTimeOffset()
+	cd, cok := c.KDCTimeOffset()
+	assert.Equal(t, cok, ok, "KDC time offset presence not as expected")
+	assert.Equal(t, cd, d, "KDC time offset not as expected")
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package credentials
+
+import "errors"
+
+var errKeyringUnsupported = errors.New("KEYRING credential caches are only supported on Linux")
+
+func loadKeyringCCache(r string) (CCache, error) {
+	return CCache{}, errKeyringUnsupported
+}
+
+func storeKeyringCCache(r string, c *CCache) error {
+	return errKeyringUnsupported
+}
+
+func openKeyringCollection(r string) (CCacheCollection, error) {
+	return nil, errKeyringUnsupported
+}
@@ -127,3 +127,8 @@ func (e Aes128CtsHmacSha96) VerifyChecksum(protocolKey, data, chksum []byte, usa
 	}
 	return hmac.Equal(chksum, c)
 }
+
+// PRF is the pseudo-random function for the etype. It is used in the calculation of KRB-FX-CF2.
+func (e Aes128CtsHmacSha96) PRF(protocolKey, data []byte) ([]byte, error) {
+	return rfc3961.PseudoRandom(protocolKey, data, e)
+}
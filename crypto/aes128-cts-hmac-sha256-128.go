@@ -129,3 +129,8 @@ func (e Aes128CtsHmacSha256128) VerifyChecksum(protocolKey, data, chksum []byte,
 	}
 	return hmac.Equal(chksum, c)
 }
+
+// PRF is the pseudo-random function for the etype. It is used in the calculation of KRB-FX-CF2.
+func (e Aes128CtsHmacSha256128) PRF(protocolKey, data []byte) ([]byte, error) {
+	return rfc8009.PseudoRandom(protocolKey, data, e), nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"gopkg.in/jcmturner/gokrb5.v5/crypto/etype"
+	"gopkg.in/jcmturner/gokrb5.v5/crypto/rfc6113"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/chksumtype"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/etypeID"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/patype"
@@ -173,3 +174,26 @@ func DecryptMessage(ciphertext []byte, key types.EncryptionKey, usage uint32) ([
 	}
 	return b, nil
 }
+
+// KRBFXCF2 combines two keys into a new key as defined by the KRB-FX-CF2 function in RFC 6113.
+// The key returned is of the same etype as key1.
+func KRBFXCF2(key1, key2 types.EncryptionKey, pepper1, pepper2 string) (types.EncryptionKey, error) {
+	var key types.EncryptionKey
+	e1, err := GetEtype(key1.KeyType)
+	if err != nil {
+		return key, fmt.Errorf("error getting etype of first key: %v", err)
+	}
+	e2, err := GetEtype(key2.KeyType)
+	if err != nil {
+		return key, fmt.Errorf("error getting etype of second key: %v", err)
+	}
+	k, err := rfc6113.KRBFXCF2(key1.KeyValue, key2.KeyValue, []byte(pepper1), []byte(pepper2), e1, e2)
+	if err != nil {
+		return key, fmt.Errorf("error combining keys: %v", err)
+	}
+	key = types.EncryptionKey{
+		KeyType:  key1.KeyType,
+		KeyValue: k,
+	}
+	return key, nil
+}
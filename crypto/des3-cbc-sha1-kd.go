@@ -136,3 +136,8 @@ func (e Des3CbcSha1Kd) VerifyChecksum(protocolKey, data, chksum []byte, usage ui
 	}
 	return hmac.Equal(chksum, c)
 }
+
+// PRF is the pseudo-random function for the etype. It is used in the calculation of KRB-FX-CF2.
+func (e Des3CbcSha1Kd) PRF(protocolKey, data []byte) ([]byte, error) {
+	return rfc3961.PseudoRandom(protocolKey, data, e)
+}
@@ -26,4 +26,5 @@ type EType interface {
 	GetChecksumHash(protocolKey, data []byte, usage uint32) ([]byte, error)
 	VerifyChecksum(protocolKey, data, chksum []byte, usage uint32) bool
 	GetHashFunc() func() hash.Hash
+	PRF(protocolKey, data []byte) ([]byte, error)
 }
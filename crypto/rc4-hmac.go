@@ -4,9 +4,7 @@ import (
 	"bytes"
 	"crypto/md5"
 	"hash"
-	"io"
 
-	"golang.org/x/crypto/md4"
 	"gopkg.in/jcmturner/gokrb5.v5/crypto/rfc3961"
 	"gopkg.in/jcmturner/gokrb5.v5/crypto/rfc4757"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/chksumtype"
@@ -75,11 +73,9 @@ func (e RC4HMAC) StringToKey(secret string, salt string, s2kparams string) ([]by
 }
 
 // RandomToKey returns a key from the bytes provided.
+// For RC4-HMAC this is the identity function.
 func (e RC4HMAC) RandomToKey(b []byte) []byte {
-	r := bytes.NewReader(b)
-	h := md4.New()
-	io.Copy(h, r)
-	return h.Sum(nil)
+	return b
 }
 
 // EncryptData encrypts the data provided.
@@ -135,3 +131,8 @@ func (e RC4HMAC) VerifyChecksum(protocolKey, data, chksum []byte, usage uint32)
 	}
 	return true
 }
+
+// PRF is the pseudo-random function for the etype. It is used in the calculation of KRB-FX-CF2.
+func (e RC4HMAC) PRF(protocolKey, data []byte) ([]byte, error) {
+	return rfc4757.PseudoRandom(protocolKey, data), nil
+}
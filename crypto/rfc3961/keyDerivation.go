@@ -73,7 +73,10 @@ func DES3StringToKey(secret, salt string, e etype.EType) ([]byte, error) {
 func PseudoRandom(key, b []byte, e etype.EType) ([]byte, error) {
 	h := e.GetHashFunc()()
 	h.Write(b)
-	tmp := h.Sum(nil)[:e.GetMessageBlockByteSize()]
+	tmp := h.Sum(nil)
+	// Truncate to a multiple of the cipher block size
+	m := e.GetCypherBlockBitLength() / 8
+	tmp = tmp[:(len(tmp)/m)*m]
 	k, err := e.DeriveKey(key, []byte(prfconstant))
 	if err != nil {
 		return []byte{}, err
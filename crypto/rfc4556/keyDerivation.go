@@ -0,0 +1,27 @@
+// Package rfc4556 provides the key derivation function used by PKINIT as specified in RFC 4556
+package rfc4556
+
+import (
+	"crypto/sha1"
+
+	"gopkg.in/jcmturner/gokrb5.v5/crypto/etype"
+)
+
+// OctetString2Key derives a key of the etype provided from the octet string x.
+//
+// https://tools.ietf.org/html/rfc4556#section-3.2.3.1
+//
+// octetstring2key(x) == random-to-key(K-truncate(SHA1(0x00 | x) | SHA1(0x01 | x) | SHA1(0x02 | x) | ...))
+//
+// x is the Diffie-Hellman shared secret concatenated with the client and KDC nonces, if present.
+func OctetString2Key(x []byte, e etype.EType) []byte {
+	n := e.GetKeySeedBitLength() / 8
+	var out []byte
+	for i := 0; len(out) < n; i++ {
+		h := sha1.New()
+		h.Write([]byte{byte(i)})
+		h.Write(x)
+		out = append(out, h.Sum(nil)...)
+	}
+	return e.RandomToKey(out[:n])
+}
@@ -0,0 +1,32 @@
+package rfc4556
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/crypto"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/etypeID"
+)
+
+func TestOctetString2Key(t *testing.T) {
+	t.Parallel()
+	x := make([]byte, 32)
+	for i := range x {
+		x[i] = byte(i)
+	}
+	var tests = []struct {
+		etype int32
+		key   string
+	}{
+		{etypeID.AES128_CTS_HMAC_SHA1_96, "ab8316b2da0714eb8d07143f3a380433"},
+		{etypeID.AES256_CTS_HMAC_SHA1_96, "ab8316b2da0714eb8d07143f3a380433284da277d91af6b75b59a531f08c6aaf"},
+	}
+	for _, test := range tests {
+		et, err := crypto.GetEtype(test.etype)
+		if err != nil {
+			t.Fatalf("error getting etype %d: %v", test.etype, err)
+		}
+		assert.Equal(t, test.key, hex.EncodeToString(OctetString2Key(x, et)), "key not as expected for etype %d", test.etype)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/hmac"
 	"crypto/md5"
+	"crypto/sha1"
 	"io"
 )
 
@@ -38,3 +39,10 @@ func HMAC(key []byte, data []byte) []byte {
 	mac.Write(data)
 	return mac.Sum(nil)
 }
+
+// PseudoRandom function for RC4 keys. RFC 4757 does not define one so the HMAC-SHA1 function used by MS-KILE and MIT is applied.
+func PseudoRandom(key []byte, data []byte) []byte {
+	mac := hmac.New(sha1.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
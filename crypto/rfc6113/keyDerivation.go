@@ -0,0 +1,53 @@
+// Package rfc6113 provides the key derivation functions used by the Kerberos pre-authentication framework as specified in RFC 6113
+package rfc6113
+
+import (
+	"errors"
+
+	"gopkg.in/jcmturner/gokrb5.v5/crypto/etype"
+)
+
+// PRFPlus implements the PRF+ function defined in RFC 6113 returning n bytes.
+//
+// https://tools.ietf.org/html/rfc6113#section-5.1
+//
+// PRF+(protocol key, octet string) -> (octet string)
+//
+// PRF+(key, shared-info) := pseudo-random( key,  1 || shared-info ) || pseudo-random( key, 2 || shared-info ) || ...
+func PRFPlus(protocolKey, b []byte, n int, e etype.EType) ([]byte, error) {
+	var out []byte
+	// The counter is a single octet so the output is limited in size.
+	for i := 1; len(out) < n; i++ {
+		if i > 255 {
+			return nil, errors.New("PRF+ output length requested is too large")
+		}
+		prf, err := e.PRF(protocolKey, append([]byte{byte(i)}, b...))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, prf...)
+	}
+	return out[:n], nil
+}
+
+// KRBFXCF2 combines two protocol keys into one as defined in RFC 6113. The resulting key is of the etype e1 of the first key.
+//
+// https://tools.ietf.org/html/rfc6113#section-5.1
+//
+// KRB-FX-CF2(K1, K2, pepper1, pepper2) := random-to-key(PRF+(K1, pepper1) ^ PRF+(K2, pepper2))
+func KRBFXCF2(protocolKey1, protocolKey2, pepper1, pepper2 []byte, e1, e2 etype.EType) ([]byte, error) {
+	n := e1.GetKeySeedBitLength() / 8
+	o1, err := PRFPlus(protocolKey1, pepper1, n, e1)
+	if err != nil {
+		return nil, err
+	}
+	o2, err := PRFPlus(protocolKey2, pepper2, n, e2)
+	if err != nil {
+		return nil, err
+	}
+	x := make([]byte, n)
+	for i := range x {
+		x[i] = o1[i] ^ o2[i]
+	}
+	return e1.RandomToKey(x), nil
+}
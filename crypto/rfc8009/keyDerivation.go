@@ -21,6 +21,12 @@ func DeriveRandom(protocolKey, usage []byte, e etype.EType) ([]byte, error) {
 	return KDF_HMAC_SHA2(protocolKey, []byte("prf"), usage, h.Size(), e), nil
 }
 
+// PseudoRandom function as defined in RFC 8009: https://tools.ietf.org/html/rfc8009#section-5
+func PseudoRandom(protocolKey, b []byte, e etype.EType) []byte {
+	h := e.GetHashFunc()()
+	return KDF_HMAC_SHA2(protocolKey, []byte("prf"), b, h.Size()*8, e)
+}
+
 // DeriveKey derives a key from the protocol key based on the usage and the etype's specific methods.
 //
 // https://tools.ietf.org/html/rfc8009#section-5
@@ -117,3 +117,20 @@ func NewNegTokenInitKrb5(creds credentials.Credentials, tkt messages.Ticket, ses
 		MechToken: mtb,
 	}, nil
 }
+
+// NewNegTokenInitKrb5WithDelegation creates new Init negotiation token for Kerberos 5 that delegates the credentials in the
+// KRB_CRED to the service.
+func NewNegTokenInitKrb5WithDelegation(creds credentials.Credentials, tkt messages.Ticket, sessionKey types.EncryptionKey, krbCred messages.KRBCred) (NegTokenInit, error) {
+	mt, err := NewAPREQMechTokenWithDelegation(creds, tkt, sessionKey, krbCred, []int{GSS_C_INTEG_FLAG, GSS_C_CONF_FLAG}, []int{})
+	if err != nil {
+		return NegTokenInit{}, fmt.Errorf("error getting MechToken; %v", err)
+	}
+	mtb, err := mt.Marshal()
+	if err != nil {
+		return NegTokenInit{}, fmt.Errorf("error marshalling MechToken; %v", err)
+	}
+	return NegTokenInit{
+		MechTypes: []asn1.ObjectIdentifier{MechTypeOIDKRB5},
+		MechToken: mtb,
+	}, nil
+}
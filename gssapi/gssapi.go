@@ -100,3 +100,16 @@ func GetSPNEGOKrbNegTokenInit(creds credentials.Credentials, tkt messages.Ticket
 		NegTokenInit: negTokenInit,
 	}, nil
 }
+
+// GetSPNEGOKrbNegTokenInitWithDelegation returns an SPNEGO struct containing a NegTokenInit that delegates the credentials
+// in the KRB_CRED to the service.
+func GetSPNEGOKrbNegTokenInitWithDelegation(creds credentials.Credentials, tkt messages.Ticket, sessionKey types.EncryptionKey, krbCred messages.KRBCred) (SPNEGO, error) {
+	negTokenInit, err := NewNegTokenInitKrb5WithDelegation(creds, tkt, sessionKey, krbCred)
+	if err != nil {
+		return SPNEGO{}, fmt.Errorf("could not create NegTokenInit: %v", err)
+	}
+	return SPNEGO{
+		Init:         true,
+		NegTokenInit: negTokenInit,
+	}, nil
+}
@@ -124,15 +124,29 @@ func (m *MechToken) IsKRBError() bool {
 
 // NewAPREQMechToken creates new Kerberos AP_REQ MechToken.
 func NewAPREQMechToken(creds credentials.Credentials, tkt messages.Ticket, sessionKey types.EncryptionKey, GSSAPIFlags []int, APOptions []int) (MechToken, error) {
+	auth, err := NewAuthenticator(creds, GSSAPIFlags)
+	if err != nil {
+		return MechToken{}, err
+	}
+	return newAPREQMechToken(tkt, sessionKey, auth, APOptions)
+}
+
+// NewAPREQMechTokenWithDelegation creates new Kerberos AP_REQ MechToken that delegates the credentials in the KRB_CRED to
+// the service. The KRB_CRED should be encrypted in the session key provided.
+func NewAPREQMechTokenWithDelegation(creds credentials.Credentials, tkt messages.Ticket, sessionKey types.EncryptionKey, krbCred messages.KRBCred, GSSAPIFlags []int, APOptions []int) (MechToken, error) {
+	auth, err := NewAuthenticatorWithDelegation(creds, krbCred, GSSAPIFlags)
+	if err != nil {
+		return MechToken{}, err
+	}
+	return newAPREQMechToken(tkt, sessionKey, auth, APOptions)
+}
+
+func newAPREQMechToken(tkt messages.Ticket, sessionKey types.EncryptionKey, auth types.Authenticator, APOptions []int) (MechToken, error) {
 	var m MechToken
 	m.OID = MechTypeOIDKRB5
 	tb, _ := hex.DecodeString(TOK_ID_KRB_AP_REQ)
 	m.TokID = tb
 
-	auth, err := NewAuthenticator(creds, GSSAPIFlags)
-	if err != nil {
-		return m, err
-	}
 	APReq, err := messages.NewAPReq(
 		tkt,
 		sessionKey,
@@ -151,29 +165,110 @@ func NewAPREQMechToken(creds credentials.Credentials, tkt messages.Ticket, sessi
 // NewAuthenticator creates a new kerberos authenticator for kerberos MechToken
 func NewAuthenticator(creds credentials.Credentials, flags []int) (types.Authenticator, error) {
 	//RFC 4121 Section 4.1.1
-	auth, err := types.NewAuthenticator(creds.Realm, creds.CName)
+	auth, err := types.NewAuthenticator(authenticatorRealm(creds), creds.CName)
+	if err != nil {
+		return auth, krberror.Errorf(err, krberror.KRBMsgError, "error generating new authenticator")
+	}
+	auth.Cksum = types.Checksum{
+		CksumType: chksumtype.GSSAPI,
+		Checksum:  newAuthenticatorChksum(flags, nil),
+	}
+	return auth, nil
+}
+
+// NewAuthenticatorWithDelegation creates a new kerberos authenticator for kerberos MechToken with the KRB_CRED included
+// in the checksum and the GSS_C_DELEG_FLAG set.
+func NewAuthenticatorWithDelegation(creds credentials.Credentials, krbCred messages.KRBCred, flags []int) (types.Authenticator, error) {
+	//RFC 4121 Section 4.1.1
+	auth, err := types.NewAuthenticator(authenticatorRealm(creds), creds.CName)
 	if err != nil {
 		return auth, krberror.Errorf(err, krberror.KRBMsgError, "error generating new authenticator")
 	}
+	b, err := krbCred.Marshal()
+	if err != nil {
+		return auth, krberror.Errorf(err, krberror.EncodingError, "error marshaling KRB_CRED for delegation")
+	}
 	auth.Cksum = types.Checksum{
 		CksumType: chksumtype.GSSAPI,
-		Checksum:  newAuthenticatorChksum(flags),
+		Checksum:  newAuthenticatorChksum(flags, b),
 	}
 	return auth, nil
 }
 
-// Create new authenticator checksum for kerberos MechToken
-func newAuthenticatorChksum(flags []int) []byte {
+// authenticatorRealm returns the client realm for the authenticator. Anonymous tickets are issued to the anonymous realm.
+func authenticatorRealm(creds credentials.Credentials) string {
+	if creds.CName.IsAnonymous() {
+		return types.AnonymousRealm
+	}
+	return creds.Realm
+}
+
+// Create new authenticator checksum for kerberos MechToken.
+// The delegation fields are only included, and the GSS_C_DELEG_FLAG set, if a KRB_CRED is provided.
+func newAuthenticatorChksum(flags []int, krbCred []byte) []byte {
 	a := make([]byte, 24)
 	binary.LittleEndian.PutUint32(a[:4], 16)
+	var f uint32
 	for _, i := range flags {
-		if i == GSS_C_DELEG_FLAG {
-			x := make([]byte, 28-len(a))
-			a = append(a, x...)
+		if i != GSS_C_DELEG_FLAG {
+			f |= uint32(i)
 		}
-		f := binary.LittleEndian.Uint32(a[20:24])
-		f |= uint32(i)
-		binary.LittleEndian.PutUint32(a[20:24], f)
 	}
+	if len(krbCred) > 0 {
+		f |= uint32(GSS_C_DELEG_FLAG)
+		d := make([]byte, 4)
+		binary.LittleEndian.PutUint16(d[:2], 1)
+		binary.LittleEndian.PutUint16(d[2:], uint16(len(krbCred)))
+		a = append(a, d...)
+		a = append(a, krbCred...)
+	}
+	binary.LittleEndian.PutUint32(a[20:24], f)
 	return a
 }
+
+// AuthenticatorChksum is the RFC 4121 section 4.1.1 checksum in the authenticator of a kerberos MechToken.
+type AuthenticatorChksum struct {
+	Bnd    []byte
+	Flags  uint32
+	DlgOpt uint16
+	Deleg  []byte
+}
+
+// Unmarshal bytes b into the AuthenticatorChksum struct.
+func (c *AuthenticatorChksum) Unmarshal(b []byte) error {
+	if len(b) < 24 {
+		return errors.New("authenticator checksum is too short")
+	}
+	l := binary.LittleEndian.Uint32(b[:4])
+	if l != 16 {
+		return fmt.Errorf("authenticator checksum channel binding length is %d not 16", l)
+	}
+	c.Bnd = b[4:20]
+	c.Flags = binary.LittleEndian.Uint32(b[20:24])
+	if c.Flags&GSS_C_DELEG_FLAG == 0 {
+		return nil
+	}
+	if len(b) < 28 {
+		return errors.New("authenticator checksum indicates delegation but does not contain the delegation fields")
+	}
+	c.DlgOpt = binary.LittleEndian.Uint16(b[24:26])
+	dl := int(binary.LittleEndian.Uint16(b[26:28]))
+	if len(b) < 28+dl {
+		return errors.New("authenticator checksum delegation length exceeds the checksum")
+	}
+	c.Deleg = b[28 : 28+dl]
+	return nil
+}
+
+// KRBCred returns the delegated KRB_CRED within the checksum, if any.
+func (c *AuthenticatorChksum) KRBCred() (messages.KRBCred, bool, error) {
+	var k messages.KRBCred
+	if c.Flags&GSS_C_DELEG_FLAG == 0 || c.DlgOpt != 1 || len(c.Deleg) == 0 {
+		return k, false, nil
+	}
+	err := k.Unmarshal(c.Deleg)
+	if err != nil {
+		return k, false, err
+	}
+	return k, true, nil
+}
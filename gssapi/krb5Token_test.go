@@ -42,10 +42,38 @@ func TestMechToken_newAuthenticatorChksum(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Error decoding MechToken hex: %v", err)
 	}
-	cb := newAuthenticatorChksum([]int{GSS_C_INTEG_FLAG, GSS_C_CONF_FLAG})
+	cb := newAuthenticatorChksum([]int{GSS_C_INTEG_FLAG, GSS_C_CONF_FLAG}, nil)
 	assert.Equal(t, b, cb, "SPNEGO Authenticator checksum not as expected")
 }
 
+func TestMechToken_newAuthenticatorChksum_Delegation(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.TestVectors["encode_krb5_cred"])
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	cb := newAuthenticatorChksum([]int{GSS_C_INTEG_FLAG, GSS_C_CONF_FLAG}, b)
+	var c AuthenticatorChksum
+	err = c.Unmarshal(cb)
+	if err != nil {
+		t.Fatalf("Error unmarshaling authenticator checksum: %v", err)
+	}
+	assert.Equal(t, uint32(GSS_C_DELEG_FLAG|GSS_C_INTEG_FLAG|GSS_C_CONF_FLAG), c.Flags, "Checksum flags not as expected")
+	assert.Equal(t, uint16(1), c.DlgOpt, "DlgOpt not as expected")
+	assert.Equal(t, b, c.Deleg, "Delegated KRB_CRED bytes not as expected")
+	k, ok, err := c.KRBCred()
+	if err != nil {
+		t.Fatalf("Error getting KRB_CRED from checksum: %v", err)
+	}
+	assert.True(t, ok, "KRB_CRED not found in checksum")
+	assert.Equal(t, 2, len(k.Tickets), "Number of tickets in KRB_CRED not as expected")
+
+	// The delegation flag is not set without a KRB_CRED
+	cb = newAuthenticatorChksum([]int{GSS_C_DELEG_FLAG, GSS_C_INTEG_FLAG, GSS_C_CONF_FLAG}, nil)
+	expected, _ := hex.DecodeString(AuthChksum)
+	assert.Equal(t, expected, cb, "SPNEGO Authenticator checksum not as expected")
+}
+
 // Test with explicit subkey generation.
 func TestMechToken_newAuthenticatorWithSubkeyGeneration(t *testing.T) {
 	t.Parallel()
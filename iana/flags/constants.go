@@ -17,11 +17,13 @@ const (
 	PreAuthent             = 10
 	HWAuthent              = 11
 	OptHardwareAuth        = 11
-	RequestAnonymous       = 12
 	TransitedPolicyChecked = 12
 	OKAsDelegate           = 13
+	CNameInAddlTkt         = 14
+	Anonymous              = 14
 	EncPARep               = 15
 	Canonicalize           = 15
+	RequestAnonymous       = 16
 	DisableTransitedCheck  = 26
 	RenewableOK            = 27
 	EncTktInSkey           = 28
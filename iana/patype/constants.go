@@ -74,4 +74,5 @@ const (
 	//UNASSIGNED : 151-164
 	PA_SUPPORTED_ETYPES int32 = 165
 	PA_EXTENDED_ERROR   int32 = 166
+	PA_PAC_OPTIONS      int32 = 167
 )
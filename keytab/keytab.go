@@ -8,9 +8,11 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"strings"
 	"time"
 	"unsafe"
 
+	"gopkg.in/jcmturner/gokrb5.v5/config"
 	"gopkg.in/jcmturner/gokrb5.v5/types"
 )
 
@@ -114,6 +116,40 @@ func Load(ktPath string) (kt Keytab, err error) {
 	return Parse(k)
 }
 
+// LoadName loads the keytab with the name provided in the form TYPE:residual. FILE and WRFILE keytabs are supported and a
+// name without a type is a file path.
+func LoadName(name string) (Keytab, error) {
+	t, r := "FILE", name
+	// A single character type is a Windows drive letter rather than a keytab type
+	if i := strings.Index(name, ":"); i > 1 {
+		t, r = strings.ToUpper(name[:i]), name[i+1:]
+	}
+	if t != "FILE" && t != "WRFILE" {
+		return Keytab{}, fmt.Errorf("keytab type %s is not supported", t)
+	}
+	return Load(r)
+}
+
+// LoadDefault loads the default keytab used by services, named by KRB5_KTNAME or, if it is not set, the configuration's
+// default_keytab_name.
+func LoadDefault(c *config.Config) (Keytab, error) {
+	n, err := c.KeytabName()
+	if err != nil {
+		return Keytab{}, fmt.Errorf("could not determine the default keytab: %v", err)
+	}
+	return LoadName(n)
+}
+
+// LoadDefaultClient loads the default keytab used by clients, named by KRB5_CLIENT_KTNAME or, if it is not set, the
+// configuration's default_client_keytab_name.
+func LoadDefaultClient(c *config.Config) (Keytab, error) {
+	n, err := c.ClientKeytabName()
+	if err != nil {
+		return Keytab{}, fmt.Errorf("could not determine the default client keytab: %v", err)
+	}
+	return LoadName(n)
+}
+
 // Marshal keytab into byte slice
 func (kt Keytab) Marshal() ([]byte, error) {
 	b := []byte{keytabFirstByte, kt.Version}
@@ -2,10 +2,13 @@ package keytab
 
 import (
 	"encoding/hex"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/config"
 	"gopkg.in/jcmturner/gokrb5.v5/testdata"
 )
 
@@ -45,3 +48,33 @@ func TestMarshal(t *testing.T) {
 		t.Fatalf("Error parsing marshaled bytes: %v", err)
 	}
 }
+
+func TestLoadName(t *testing.T) {
+	t.Parallel()
+	dat, _ := hex.DecodeString(testdata.TESTUSER1_KEYTAB)
+	f, err := ioutil.TempFile(os.TempDir(), "TEST-gokrb5-keytab")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(dat)
+	f.Close()
+	for _, n := range []string{f.Name(), "FILE:" + f.Name(), "WRFILE:" + f.Name()} {
+		kt, err := LoadName(n)
+		if err != nil {
+			t.Fatalf("Error loading keytab %s: %v", n, err)
+		}
+		assert.Equal(t, "testuser1", kt.Entries[0].Principal.Components[0], "Component in principal not as expected")
+	}
+	_, err = LoadName("MEMORY:test")
+	assert.Error(t, err, "Unsupported keytab types should not load")
+
+	c := config.NewConfig()
+	c.LibDefaults.DefaultClientKeytabName = "FILE:" + f.Name()
+	os.Unsetenv(config.EnvClientKeytabName)
+	kt, err := LoadDefaultClient(c)
+	if err != nil {
+		t.Fatalf("Error loading default client keytab: %v", err)
+	}
+	assert.Equal(t, "TEST.GOKRB5", kt.Entries[0].Principal.Realm, "Realm of principal not as expected")
+}
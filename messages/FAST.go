@@ -0,0 +1,229 @@
+package messages
+
+// Reference: https://tools.ietf.org/html/rfc6113
+// Section: 5.4
+
+import (
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"gopkg.in/jcmturner/gokrb5.v5/crypto"
+	"gopkg.in/jcmturner/gokrb5.v5/iana"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/keyusage"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/msgtype"
+	"gopkg.in/jcmturner/gokrb5.v5/krberror"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+// FXFastArmorAPRequest is the armor type for an armor value that is an AP_REQ.
+const FXFastArmorAPRequest int32 = 1
+
+// KrbFastArmor implements RFC 6113 KrbFastArmor: https://tools.ietf.org/html/rfc6113#section-5.4.1
+type KrbFastArmor struct {
+	ArmorType  int32  `asn1:"explicit,tag:0"`
+	ArmorValue []byte `asn1:"explicit,tag:1"`
+}
+
+// KrbFastArmoredReq implements RFC 6113 KrbFastArmoredReq: https://tools.ietf.org/html/rfc6113#section-5.4.2
+type KrbFastArmoredReq struct {
+	Armor       KrbFastArmor        `asn1:"explicit,optional,tag:0"`
+	ReqChecksum types.Checksum      `asn1:"explicit,tag:1"`
+	EncFastReq  types.EncryptedData `asn1:"explicit,tag:2"`
+}
+
+type marshalKrbFastReq struct {
+	FastOptions asn1.BitString       `asn1:"explicit,tag:0"`
+	PAData      types.PADataSequence `asn1:"explicit,tag:1"`
+	ReqBody     asn1.RawValue        `asn1:"explicit,tag:2"`
+}
+
+// KrbFastReq implements RFC 6113 KrbFastReq: https://tools.ietf.org/html/rfc6113#section-5.4.2
+type KrbFastReq struct {
+	FastOptions asn1.BitString
+	PAData      types.PADataSequence
+	ReqBody     KDCReqBody
+}
+
+// KrbFastArmoredRep implements RFC 6113 KrbFastArmoredRep: https://tools.ietf.org/html/rfc6113#section-5.4.3
+type KrbFastArmoredRep struct {
+	EncFastRep types.EncryptedData `asn1:"explicit,tag:0"`
+}
+
+// KrbFastResponse implements RFC 6113 KrbFastResponse: https://tools.ietf.org/html/rfc6113#section-5.4.3
+type KrbFastResponse struct {
+	PAData        types.PADataSequence `asn1:"explicit,tag:0"`
+	StrengthenKey types.EncryptionKey  `asn1:"explicit,optional,tag:1"`
+	Finished      KrbFastFinished      `asn1:"explicit,optional,tag:2"`
+	Nonce         int                  `asn1:"explicit,tag:3"`
+}
+
+// KrbFastFinished implements RFC 6113 KrbFastFinished: https://tools.ietf.org/html/rfc6113#section-5.4.3
+type KrbFastFinished struct {
+	Timestamp      time.Time           `asn1:"generalized,explicit,tag:0"`
+	Usec           int                 `asn1:"explicit,tag:1"`
+	CRealm         string              `asn1:"generalstring,explicit,tag:2"`
+	CName          types.PrincipalName `asn1:"explicit,tag:3"`
+	TicketChecksum types.Checksum      `asn1:"explicit,tag:4"`
+}
+
+// NewKrbFastArmor generates a new KrbFastArmor with an AP_REQ armor value from the ticket and authenticator provided.
+// The authenticator should contain the sub-key from which the armor key is derived.
+func NewKrbFastArmor(tkt Ticket, sessionKey types.EncryptionKey, auth types.Authenticator) (KrbFastArmor, error) {
+	var a KrbFastArmor
+	m, err := auth.Marshal()
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncodingError, "marshaling error of FAST armor authenticator")
+	}
+	// The armor AP_REQ is a standard AP_REQ even though the ticket is usually a TGT
+	ed, err := crypto.GetEncryptedData(m, sessionKey, keyusage.AP_REQ_AUTHENTICATOR, tkt.EncPart.KVNO)
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncryptingError, "error encrypting FAST armor authenticator")
+	}
+	apReq := APReq{
+		PVNO:          iana.PVNO,
+		MsgType:       msgtype.KRB_AP_REQ,
+		APOptions:     types.NewKrbFlags(),
+		Ticket:        tkt,
+		Authenticator: ed,
+	}
+	b, err := apReq.Marshal()
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncodingError, "error marshaling FAST armor AP_REQ")
+	}
+	a = KrbFastArmor{
+		ArmorType:  FXFastArmorAPRequest,
+		ArmorValue: b,
+	}
+	return a, nil
+}
+
+// Marshal the KrbFastArmoredReq as the PA-FX-FAST-REQUEST choice carried in the PA_FX_FAST pre-authentication data.
+func (a *KrbFastArmoredReq) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*a)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling KrbFastArmoredReq")
+	}
+	return wrapFastChoice(b)
+}
+
+// Unmarshal bytes b, the PA-FX-FAST-REQUEST choice, into the KrbFastArmoredReq struct.
+func (a *KrbFastArmoredReq) Unmarshal(b []byte) error {
+	_, err := asn1.UnmarshalWithParams(b, a, "explicit,tag:0")
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KrbFastArmoredReq")
+	}
+	return nil
+}
+
+// Marshal the KrbFastReq.
+func (k *KrbFastReq) Marshal() ([]byte, error) {
+	m := marshalKrbFastReq{
+		FastOptions: k.FastOptions,
+		PAData:      k.PAData,
+	}
+	if m.PAData == nil {
+		// The padata field is not optional so must be encoded as an empty sequence
+		m.PAData = types.PADataSequence{}
+	}
+	b, err := k.ReqBody.Marshal()
+	if err != nil {
+		return b, err
+	}
+	m.ReqBody = asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		IsCompound: true,
+		Tag:        2,
+		Bytes:      b,
+	}
+	mk, err := asn1.Marshal(m)
+	if err != nil {
+		return mk, krberror.Errorf(err, krberror.EncodingError, "error marshaling KrbFastReq")
+	}
+	return mk, nil
+}
+
+// Unmarshal bytes b into the KrbFastReq struct.
+func (k *KrbFastReq) Unmarshal(b []byte) error {
+	var m marshalKrbFastReq
+	_, err := asn1.Unmarshal(b, &m)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KrbFastReq")
+	}
+	var reqb KDCReqBody
+	err = reqb.Unmarshal(m.ReqBody.Bytes)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error processing KrbFastReq body")
+	}
+	k.FastOptions = m.FastOptions
+	k.PAData = m.PAData
+	k.ReqBody = reqb
+	return nil
+}
+
+// Marshal the KrbFastArmoredRep as the PA-FX-FAST-REPLY choice carried in the PA_FX_FAST pre-authentication data.
+func (a *KrbFastArmoredRep) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*a)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling KrbFastArmoredRep")
+	}
+	return wrapFastChoice(b)
+}
+
+// Unmarshal bytes b, the PA-FX-FAST-REPLY choice, into the KrbFastArmoredRep struct.
+func (a *KrbFastArmoredRep) Unmarshal(b []byte) error {
+	_, err := asn1.UnmarshalWithParams(b, a, "explicit,tag:0")
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KrbFastArmoredRep")
+	}
+	return nil
+}
+
+// DecryptEncPart decrypts the encrypted KrbFastResponse within the KrbFastArmoredRep using the armor key.
+func (a *KrbFastArmoredRep) DecryptEncPart(armorKey types.EncryptionKey) (KrbFastResponse, error) {
+	var r KrbFastResponse
+	b, err := crypto.DecryptEncPart(a.EncFastRep, armorKey, keyusage.KEY_USAGE_FAST_REP)
+	if err != nil {
+		return r, krberror.Errorf(err, krberror.DecryptingError, "error decrypting KrbFastArmoredRep encrypted part")
+	}
+	err = r.Unmarshal(b)
+	if err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+// Marshal the KrbFastResponse.
+func (k *KrbFastResponse) Marshal() ([]byte, error) {
+	if k.PAData == nil {
+		k.PAData = types.PADataSequence{}
+	}
+	b, err := asn1.Marshal(*k)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling KrbFastResponse")
+	}
+	return b, nil
+}
+
+// Unmarshal bytes b into the KrbFastResponse struct.
+func (k *KrbFastResponse) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, k)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KrbFastResponse")
+	}
+	return nil
+}
+
+// wrapFastChoice wraps the bytes provided in the context specific tag 0 of the PA-FX-FAST-REQUEST and PA-FX-FAST-REPLY choices.
+func wrapFastChoice(b []byte) ([]byte, error) {
+	r := asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		IsCompound: true,
+		Tag:        0,
+		Bytes:      b,
+	}
+	mk, err := asn1.Marshal(r)
+	if err != nil {
+		return mk, krberror.Errorf(err, krberror.EncodingError, "error marshaling FAST choice")
+	}
+	return mk, nil
+}
@@ -0,0 +1,153 @@
+package messages
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/iana"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/patype"
+	"gopkg.in/jcmturner/gokrb5.v5/testdata"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+func TestUnmarshalKrbFastResponse(t *testing.T) {
+	t.Parallel()
+	var a KrbFastResponse
+	v := "encode_krb5_fast_response"
+	b, err := hex.DecodeString(testdata.TestVectors[v])
+	if err != nil {
+		t.Fatalf("Test vector read error of %s: %v\n", v, err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error of %s: %v\n", v, err)
+	}
+	//Parse the test time value into a time.Time type
+	tt, _ := time.Parse(testdata.TEST_TIME_FORMAT, testdata.TEST_TIME)
+
+	assert.Equal(t, 2, len(a.PAData), "Number of PAData items not as expected")
+	for _, pa := range a.PAData {
+		assert.Equal(t, patype.PA_SAM_RESPONSE, pa.PADataType, "PAData type not as expected")
+		assert.Equal(t, []byte(testdata.TEST_PADATA_VALUE), pa.PADataValue, "PAData value not as expected")
+	}
+	assert.Equal(t, int32(1), a.StrengthenKey.KeyType, "Strengthen key type not as expected")
+	assert.Equal(t, []byte("12345678"), a.StrengthenKey.KeyValue, "Strengthen key value not as expected")
+	assert.Equal(t, tt, a.Finished.Timestamp, "Finished timestamp not as expected")
+	assert.Equal(t, 123456, a.Finished.Usec, "Finished microseconds not as expected")
+	assert.Equal(t, testdata.TEST_REALM, a.Finished.CRealm, "Finished CRealm not as expected")
+	assert.Equal(t, nametype.KRB_NT_PRINCIPAL, a.Finished.CName.NameType, "Finished CName NameType not as expected")
+	assert.Equal(t, testdata.TEST_PRINCIPALNAME_NAMESTRING, a.Finished.CName.NameString, "Finished CName entries not as expected")
+	assert.Equal(t, int32(1), a.Finished.TicketChecksum.CksumType, "Finished ticket checksum type not as expected")
+	assert.Equal(t, []byte("1234"), a.Finished.TicketChecksum.Checksum, "Finished ticket checksum not as expected")
+	assert.Equal(t, testdata.TEST_NONCE, a.Nonce, "Nonce not as expected")
+}
+
+func TestMarshalKrbFastResponse(t *testing.T) {
+	t.Parallel()
+	var a KrbFastResponse
+	v := "encode_krb5_fast_response"
+	b, err := hex.DecodeString(testdata.TestVectors[v])
+	if err != nil {
+		t.Fatalf("Test vector read error of %s: %v\n", v, err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error of %s: %v\n", v, err)
+	}
+	mb, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal of KrbFastResponse failed: %v", err)
+	}
+	assert.Equal(t, b, mb, "Marshal bytes of KrbFastResponse not as expected")
+}
+
+func TestUnmarshalKrbFastArmoredRep(t *testing.T) {
+	t.Parallel()
+	var a KrbFastArmoredRep
+	v := "encode_krb5_pa_fx_fast_reply"
+	b, err := hex.DecodeString(testdata.TestVectors[v])
+	if err != nil {
+		t.Fatalf("Test vector read error of %s: %v\n", v, err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error of %s: %v\n", v, err)
+	}
+	assert.Equal(t, testdata.TEST_ETYPE, a.EncFastRep.EType, "Etype of encrypted FAST response not as expected")
+	assert.Equal(t, iana.PVNO, a.EncFastRep.KVNO, "KVNO of encrypted FAST response not as expected")
+	assert.Equal(t, []byte(testdata.TEST_CIPHERTEXT), a.EncFastRep.Cipher, "Ciphertext of encrypted FAST response not as expected")
+	mb, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal of KrbFastArmoredRep failed: %v", err)
+	}
+	assert.Equal(t, b, mb, "Marshal bytes of KrbFastArmoredRep not as expected")
+}
+
+func TestKrbFastArmoredReq_MarshalUnmarshal(t *testing.T) {
+	t.Parallel()
+	a := KrbFastArmoredReq{
+		Armor: KrbFastArmor{
+			ArmorType:  FXFastArmorAPRequest,
+			ArmorValue: []byte("armor"),
+		},
+		ReqChecksum: types.Checksum{
+			CksumType: 1,
+			Checksum:  []byte("1234"),
+		},
+		EncFastReq: types.EncryptedData{
+			EType:  testdata.TEST_ETYPE,
+			KVNO:   iana.PVNO,
+			Cipher: []byte(testdata.TEST_CIPHERTEXT),
+		},
+	}
+	b, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal of KrbFastArmoredReq failed: %v", err)
+	}
+	var u KrbFastArmoredReq
+	err = u.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal of KrbFastArmoredReq failed: %v", err)
+	}
+	assert.Equal(t, a, u, "KrbFastArmoredReq not as expected after marshal and unmarshal")
+}
+
+func TestKrbFastReq_MarshalUnmarshal(t *testing.T) {
+	t.Parallel()
+	var body KDCReqBody
+	v := "encode_krb5_kdc_req_body"
+	b, err := hex.DecodeString(testdata.TestVectors[v])
+	if err != nil {
+		t.Fatalf("Test vector read error of %s: %v\n", v, err)
+	}
+	err = body.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error of %s: %v\n", v, err)
+	}
+	a := KrbFastReq{
+		FastOptions: types.NewKrbFlags(),
+		PAData: types.PADataSequence{
+			{
+				PADataType:  patype.PA_FX_COOKIE,
+				PADataValue: []byte("cookie"),
+			},
+		},
+		ReqBody: body,
+	}
+	fb, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal of KrbFastReq failed: %v", err)
+	}
+	var u KrbFastReq
+	err = u.Unmarshal(fb)
+	if err != nil {
+		t.Fatalf("Unmarshal of KrbFastReq failed: %v", err)
+	}
+	assert.Equal(t, a.PAData, u.PAData, "KrbFastReq PAData not as expected")
+	assert.Equal(t, a.FastOptions.Bytes, u.FastOptions.Bytes, "KrbFastReq options not as expected")
+	bb, _ := u.ReqBody.Marshal()
+	assert.Equal(t, b, bb, "KrbFastReq request body not as expected")
+}
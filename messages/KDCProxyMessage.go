@@ -0,0 +1,59 @@
+package messages
+
+// Reference: https://msdn.microsoft.com/en-us/library/hh553774.aspx
+// Section: 2.2.2
+
+import (
+	"encoding/binary"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"gopkg.in/jcmturner/gokrb5.v5/krberror"
+)
+
+// KDCProxyMessage implements MS-KKDCP KDC-PROXY-MESSAGE: https://msdn.microsoft.com/en-us/library/hh553774.aspx
+type KDCProxyMessage struct {
+	KerbMessage   []byte `asn1:"explicit,tag:0"`
+	TargetDomain  string `asn1:"generalstring,optional,explicit,tag:1"`
+	DCLocatorHint int    `asn1:"optional,explicit,tag:2"`
+}
+
+// NewKDCProxyMessage creates a new KDC-PROXY-MESSAGE carrying the Kerberos message provided to the KDCs of the realm.
+// The Kerberos message is framed with its length as it would be when sent to a KDC over TCP.
+func NewKDCProxyMessage(b []byte, realm string) KDCProxyMessage {
+	m := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint32(m, uint32(len(b)))
+	return KDCProxyMessage{
+		KerbMessage:  append(m, b...),
+		TargetDomain: realm,
+	}
+}
+
+// Message returns the Kerberos message carried with its TCP length framing removed.
+func (k *KDCProxyMessage) Message() ([]byte, error) {
+	if len(k.KerbMessage) < 4 {
+		return nil, krberror.NewErrorf(krberror.EncodingError, "KDC-PROXY-MESSAGE Kerberos message too short")
+	}
+	l := binary.BigEndian.Uint32(k.KerbMessage[:4])
+	if int(l) != len(k.KerbMessage)-4 {
+		return nil, krberror.NewErrorf(krberror.EncodingError, "KDC-PROXY-MESSAGE Kerberos message length (%d) does not match its framing (%d)", len(k.KerbMessage)-4, l)
+	}
+	return k.KerbMessage[4:], nil
+}
+
+// Marshal the KDC-PROXY-MESSAGE.
+func (k *KDCProxyMessage) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*k)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling KDC-PROXY-MESSAGE")
+	}
+	return b, nil
+}
+
+// Unmarshal bytes b into the KDC-PROXY-MESSAGE struct.
+func (k *KDCProxyMessage) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, k)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KDC-PROXY-MESSAGE")
+	}
+	return nil
+}
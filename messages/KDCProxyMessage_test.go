@@ -0,0 +1,33 @@
+package messages
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKDCProxyMessage(t *testing.T) {
+	t.Parallel()
+	m := NewKDCProxyMessage([]byte{0x6a, 0x01, 0x02}, "TEST")
+	b, err := m.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling KDC-PROXY-MESSAGE: %v", err)
+	}
+	assert.Equal(t, "3013a0090407000000036a0102a1061b0454455354", hex.EncodeToString(b), "KDC-PROXY-MESSAGE encoding not as expected")
+	var a KDCProxyMessage
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling KDC-PROXY-MESSAGE: %v", err)
+	}
+	assert.Equal(t, "TEST", a.TargetDomain, "Target domain not as expected")
+	assert.Equal(t, 0, a.DCLocatorHint, "DC locator hint not as expected")
+	kb, err := a.Message()
+	if err != nil {
+		t.Fatalf("Error getting Kerberos message: %v", err)
+	}
+	assert.Equal(t, []byte{0x6a, 0x01, 0x02}, kb, "Kerberos message not as expected")
+	a.KerbMessage = a.KerbMessage[:5]
+	_, err = a.Message()
+	assert.Error(t, err, "Error expected when the framed length does not match")
+}
@@ -145,51 +145,85 @@ func (e *EncKDCRepPart) Unmarshal(b []byte) error {
 
 // DecryptEncPart decrypts the encrypted part of an AS_REP.
 func (k *ASRep) DecryptEncPart(c *credentials.Credentials) (types.EncryptionKey, error) {
+	key, err := k.GetClientKey(c)
+	if err != nil {
+		return key, krberror.Errorf(err, krberror.DecryptingError, "error decrypting AS_REP encrypted part")
+	}
+	err = k.DecryptEncPartWithKey(key)
+	return key, err
+}
+
+// GetClientKey returns the client's long term key, from the credentials provided, that is used to decrypt the AS_REP.
+func (k *ASRep) GetClientKey(c *credentials.Credentials) (types.EncryptionKey, error) {
 	var key types.EncryptionKey
 	var err error
 	if c.HasKeytab() {
 		key, err = c.Keytab.GetEncryptionKey(k.CName.NameString, k.CRealm, k.EncPart.KVNO, k.EncPart.EType)
 		if err != nil {
-			return key, krberror.Errorf(err, krberror.DecryptingError, "error decrypting AS_REP encrypted part")
+			return key, krberror.Errorf(err, krberror.DecryptingError, "error getting client key from keytab")
 		}
 	}
 	if c.HasPassword() {
 		key, _, err = crypto.GetKeyFromPassword(c.Password, k.CName, k.CRealm, k.EncPart.EType, k.PAData)
 		if err != nil {
-			return key, krberror.Errorf(err, krberror.DecryptingError, "error decrypting AS_REP encrypted part")
+			return key, krberror.Errorf(err, krberror.DecryptingError, "error getting client key from password")
 		}
 	}
 	if !c.HasKeytab() && !c.HasPassword() {
 		return key, krberror.NewErrorf(krberror.DecryptingError, "no secret available in credentials to preform decryption of AS_REP encrypted part")
 	}
+	return key, nil
+}
+
+// DecryptEncPartWithKey decrypts the encrypted part of an AS_REP using the reply key provided.
+func (k *ASRep) DecryptEncPartWithKey(key types.EncryptionKey) error {
 	b, err := crypto.DecryptEncPart(k.EncPart, key, keyusage.AS_REP_ENCPART)
 	if err != nil {
-		return key, krberror.Errorf(err, krberror.DecryptingError, "error decrypting AS_REP encrypted part")
+		return krberror.Errorf(err, krberror.DecryptingError, "error decrypting AS_REP encrypted part")
 	}
 	var denc EncKDCRepPart
 	err = denc.Unmarshal(b)
 	if err != nil {
-		return key, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling decrypted encpart of AS_REP")
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling decrypted encpart of AS_REP")
 	}
 	k.DecryptedEncPart = denc
-	return key, nil
+	return nil
 }
 
 // IsValid checks the validity of AS_REP message.
 func (k *ASRep) IsValid(cfg *config.Config, creds *credentials.Credentials, asReq ASReq) (bool, error) {
+	key, err := k.GetClientKey(creds)
+	if err != nil {
+		return false, krberror.Errorf(err, krberror.DecryptingError, "error decrypting EncPart of AS_REP")
+	}
+	return k.IsValidWithKey(cfg, key, asReq)
+}
+
+// IsValidWithKey checks the validity of AS_REP message using the reply key provided to decrypt the encrypted part.
+func (k *ASRep) IsValidWithKey(cfg *config.Config, key types.EncryptionKey, asReq ASReq) (bool, error) {
 	//Ref RFC 4120 Section 3.1.5
-	if k.CName.NameType != asReq.ReqBody.CName.NameType || k.CName.NameString == nil {
+	// When canonicalization is requested the KDC may return a different client name and realm. The change must be
+	// protected by FAST or the PA_REQ_ENC_PA_REP checksum: https://tools.ietf.org/html/rfc6806.html#section-11
+	canonicalize := types.IsFlagSet(&asReq.ReqBody.KDCOptions, flags.Canonicalize)
+	var renamed bool
+	if k.CName.NameString == nil {
 		return false, krberror.NewErrorf(krberror.KRBMsgError, "CName in response does not match what was requested. Requested: %+v; Reply: %+v", asReq.ReqBody.CName, k.CName)
 	}
-	for i := range k.CName.NameString {
-		if k.CName.NameString[i] != asReq.ReqBody.CName.NameString[i] {
+	if k.CName.NameType != asReq.ReqBody.CName.NameType || !k.CName.Equal(asReq.ReqBody.CName) {
+		if !canonicalize {
 			return false, krberror.NewErrorf(krberror.KRBMsgError, "CName in response does not match what was requested. Requested: %+v; Reply: %+v", asReq.ReqBody.CName, k.CName)
 		}
+		renamed = true
 	}
-	if k.CRealm != asReq.ReqBody.Realm {
-		return false, krberror.NewErrorf(krberror.KRBMsgError, "CRealm in response does not match what was requested. Requested: %s; Reply: %s", asReq.ReqBody.Realm, k.CRealm)
+	// An anonymous ticket is issued to the anonymous realm: https://tools.ietf.org/html/rfc8062#section-4.1
+	anonymous := types.IsFlagSet(&asReq.ReqBody.KDCOptions, flags.RequestAnonymous) && k.CName.IsAnonymous() && k.CRealm == types.AnonymousRealm
+	if k.CRealm != asReq.ReqBody.Realm && !anonymous {
+		if !canonicalize {
+			return false, krberror.NewErrorf(krberror.KRBMsgError, "CRealm in response does not match what was requested. Requested: %s; Reply: %s", asReq.ReqBody.Realm, k.CRealm)
+		}
+		renamed = true
 	}
-	key, err := k.DecryptEncPart(creds)
+	err := k.DecryptEncPartWithKey(key)
 	if err != nil {
 		return false, krberror.Errorf(err, krberror.DecryptingError, "error decrypting EncPart of AS_REP")
 	}
@@ -217,6 +251,7 @@ func (k *ASRep) IsValid(cfg *config.Config, creds *credentials.Credentials, asRe
 		return false, krberror.NewErrorf(krberror.KRBMsgError, "clock skew with KDC too large. Greater than %v seconds", cfg.LibDefaults.Clockskew.Seconds())
 	}
 	// RFC 6806 https://tools.ietf.org/html/rfc6806.html#section-11
+	var encPARep bool
 	if asReq.PAData.Contains(patype.PA_REQ_ENC_PA_REP) && types.IsFlagSet(&k.DecryptedEncPart.Flags, flags.EncPARep) {
 		if len(k.DecryptedEncPart.EncPAData) < 2 || !k.DecryptedEncPart.EncPAData.Contains(patype.PA_FX_FAST) {
 			return false, krberror.NewErrorf(krberror.KRBMsgError, "KDC did not respond appropriately to FAST negotiation")
@@ -236,9 +271,13 @@ func (k *ASRep) IsValid(cfg *config.Config, creds *credentials.Credentials, asRe
 				if !etype.VerifyChecksum(key.KeyValue, ab, pafast.Chksum, keyusage.KEY_USAGE_AS_REQ) {
 					return false, krberror.Errorf(err, krberror.ChksumError, "KDC FAST negotiation response checksum invalid")
 				}
+				encPARep = true
 			}
 		}
 	}
+	if renamed && !encPARep && !asReq.PAData.Contains(patype.PA_FX_FAST) {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "canonical client name in response is not protected. Requested: %+v@%s; Reply: %+v@%s", asReq.ReqBody.CName, asReq.ReqBody.Realm, k.CName, k.CRealm)
+	}
 	return true, nil
 }
 
@@ -257,6 +296,49 @@ func (k *TGSRep) DecryptEncPart(key types.EncryptionKey) error {
 	return nil
 }
 
+// SvrReferralData returns the PA-SVR-REFERRAL-DATA of a referral TGS_REP, decrypted with the session key of the TGT
+// used in the request, if the KDC included PA_SVR_REFERRAL_INFO pre-authentication data.
+// Reference: https://tools.ietf.org/html/draft-ietf-krb-wg-kerberos-referrals-11#section-8
+func (k *TGSRep) SvrReferralData(sessionKey types.EncryptionKey) (types.PASvrReferralData, bool, error) {
+	var d types.PASvrReferralData
+	for _, pa := range k.PAData {
+		if pa.PADataType != patype.PA_SVR_REFERRAL_INFO {
+			continue
+		}
+		var ed types.EncryptedData
+		err := ed.Unmarshal(pa.PADataValue)
+		if err != nil {
+			return d, false, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA_SVR_REFERRAL_INFO")
+		}
+		b, err := crypto.DecryptEncPart(ed, sessionKey, keyusage.KEY_USAGE_PA_SERVER_REFERRAL_DATA)
+		if err != nil {
+			return d, false, krberror.Errorf(err, krberror.DecryptingError, "error decrypting PA_SVR_REFERRAL_INFO")
+		}
+		err = d.Unmarshal(b)
+		if err != nil {
+			return d, false, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-SVR-REFERRAL-DATA")
+		}
+		return d, true, nil
+	}
+	return d, false, nil
+}
+
+// DecryptEncPartWithSubKey decrypts the encrypted part of an TGS_REP that has been encrypted with the sub-key from the
+// authenticator of the TGS_REQ.
+func (k *TGSRep) DecryptEncPartWithSubKey(key types.EncryptionKey) error {
+	b, err := crypto.DecryptEncPart(k.EncPart, key, keyusage.TGS_REP_ENCPART_AUTHENTICATOR_SUB_KEY)
+	if err != nil {
+		return krberror.Errorf(err, krberror.DecryptingError, "error decrypting TGS_REP EncPart")
+	}
+	var denc EncKDCRepPart
+	err = denc.Unmarshal(b)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling encrypted part")
+	}
+	k.DecryptedEncPart = denc
+	return nil
+}
+
 // IsValid checks the validity of the TGS_REP message.
 func (k *TGSRep) IsValid(cfg *config.Config, tgsReq TGSReq) (bool, error) {
 	if k.CName.NameType != tgsReq.ReqBody.CName.NameType || k.CName.NameString == nil {
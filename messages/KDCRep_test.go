@@ -6,15 +6,19 @@ import (
 	"testing"
 	"time"
 
+	"github.com/jcmturner/gofork/encoding/asn1"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/jcmturner/gokrb5.v5/credentials"
+	"gopkg.in/jcmturner/gokrb5.v5/crypto"
 	"gopkg.in/jcmturner/gokrb5.v5/iana"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/etypeID"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/keyusage"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/msgtype"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/patype"
 	"gopkg.in/jcmturner/gokrb5.v5/keytab"
 	"gopkg.in/jcmturner/gokrb5.v5/testdata"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
 )
 
 const (
@@ -318,3 +322,39 @@ func TestUnmarshalASRepDecodeAndDecrypt_withPassword(t *testing.T) {
 	assert.Equal(t, nametype.KRB_NT_SRV_INST, asRep.DecryptedEncPart.SName.NameType, "Name type for AS_REP not as expected")
 	assert.Equal(t, []string{"krbtgt", testRealm}, asRep.DecryptedEncPart.SName.NameString, "Service name string not as expected")
 }
+
+func TestTGSRep_SvrReferralData(t *testing.T) {
+	t.Parallel()
+	key := types.EncryptionKey{
+		KeyType:  etypeID.AES256_CTS_HMAC_SHA1_96,
+		KeyValue: make([]byte, 32),
+	}
+	d := types.PASvrReferralData{
+		ReferredName:  types.NewPrincipalName(nametype.KRB_NT_SRV_HST, "HTTP/host.res.gokrb5"),
+		ReferredRealm: "RES.GOKRB5",
+	}
+	b, err := asn1.Marshal(d)
+	if err != nil {
+		t.Fatalf("Error marshaling PA-SVR-REFERRAL-DATA: %v", err)
+	}
+	ed, err := crypto.GetEncryptedData(b, key, keyusage.KEY_USAGE_PA_SERVER_REFERRAL_DATA, 0)
+	if err != nil {
+		t.Fatalf("Error encrypting PA-SVR-REFERRAL-DATA: %v", err)
+	}
+	edb, err := ed.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling encrypted data: %v", err)
+	}
+	var tgsRep TGSRep
+	_, ok, err := tgsRep.SvrReferralData(key)
+	if err != nil || ok {
+		t.Fatalf("Referral data should not be found: %v", err)
+	}
+	tgsRep.PAData = types.PADataSequence{{PADataType: patype.PA_SVR_REFERRAL_INFO, PADataValue: edb}}
+	rd, ok, err := tgsRep.SvrReferralData(key)
+	if err != nil || !ok {
+		t.Fatalf("Error getting referral data: %v", err)
+	}
+	assert.Equal(t, "RES.GOKRB5", rd.ReferredRealm, "Referred realm not as expected")
+	assert.Equal(t, []string{"HTTP", "host.res.gokrb5"}, rd.ReferredName.NameString, "Referred name not as expected")
+}
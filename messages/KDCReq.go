@@ -200,23 +200,41 @@ func NewTGSReq(cname types.PrincipalName, kdcRealm string, c *config.Config, tkt
 		types.SetFlag(&a.ReqBody.KDCOptions, flags.Renew)
 		types.SetFlag(&a.ReqBody.KDCOptions, flags.Renewable)
 	}
-	auth, err := types.NewAuthenticator(tkt.Realm, cname)
+	// Add the CName to make validation of the reply easier
+	a.ReqBody.CName = cname
+	err = a.SetPAData(cname, tkt, sessionKey, types.EncryptionKey{})
+	return a, err
+}
+
+// SetPAData sets the PA_TGS_REQ pre-authentication data of the TGS_REQ. The AP_REQ generated contains an authenticator
+// with a checksum of the current request body. If a sub-key is provided, with a non-zero key type, it is included in the
+// authenticator and the KDC will use it to encrypt the reply.
+//
+// This must be called again if the request body is modified after the TGS_REQ has been created.
+func (k *TGSReq) SetPAData(cname types.PrincipalName, tkt Ticket, sessionKey, subKey types.EncryptionKey) error {
+	crealm := tkt.Realm
+	if cname.IsAnonymous() {
+		// Anonymous tickets are issued to the anonymous realm
+		crealm = types.AnonymousRealm
+	}
+	auth, err := types.NewAuthenticator(crealm, cname)
 	if err != nil {
-		return a, krberror.Errorf(err, krberror.KRBMsgError, "error generating new authenticator")
+		return krberror.Errorf(err, krberror.KRBMsgError, "error generating new authenticator")
 	}
-	// Add the CName to make validation of the reply easier
-	a.ReqBody.CName = auth.CName
-	b, err := a.ReqBody.Marshal()
+	if subKey.KeyType != 0 {
+		auth.SubKey = subKey
+	}
+	b, err := k.ReqBody.Marshal()
 	if err != nil {
-		return a, krberror.Errorf(err, krberror.EncodingError, "error marshaling TGS_REQ body")
+		return krberror.Errorf(err, krberror.EncodingError, "error marshaling TGS_REQ body")
 	}
 	etype, err := crypto.GetEtype(sessionKey.KeyType)
 	if err != nil {
-		return a, krberror.Errorf(err, krberror.EncryptingError, "error getting etype to encrypt authenticator")
+		return krberror.Errorf(err, krberror.EncryptingError, "error getting etype to encrypt authenticator")
 	}
 	cb, err := etype.GetChecksumHash(sessionKey.KeyValue, b, keyusage.TGS_REQ_PA_TGS_REQ_AP_REQ_AUTHENTICATOR_CHKSUM)
 	if err != nil {
-		return a, krberror.Errorf(err, krberror.ChksumError, "error getting etype checksum hash")
+		return krberror.Errorf(err, krberror.ChksumError, "error getting etype checksum hash")
 	}
 	auth.Cksum = types.Checksum{
 		CksumType: etype.GetHashID(),
@@ -224,19 +242,25 @@ func NewTGSReq(cname types.PrincipalName, kdcRealm string, c *config.Config, tkt
 	}
 	apReq, err := NewAPReq(tkt, sessionKey, auth)
 	if err != nil {
-		return a, krberror.Errorf(err, krberror.KRBMsgError, "error generating new AP_REQ")
+		return krberror.Errorf(err, krberror.KRBMsgError, "error generating new AP_REQ")
 	}
 	apb, err := apReq.Marshal()
 	if err != nil {
-		return a, krberror.Errorf(err, krberror.EncodingError, "error marshaling AP_REQ for pre-authentication data")
+		return krberror.Errorf(err, krberror.EncodingError, "error marshaling AP_REQ for pre-authentication data")
 	}
-	a.PAData = types.PADataSequence{
-		types.PAData{
-			PADataType:  patype.PA_TGS_REQ,
-			PADataValue: apb,
-		},
+	pa := types.PAData{
+		PADataType:  patype.PA_TGS_REQ,
+		PADataValue: apb,
 	}
-	return a, nil
+	// Replace any existing PA_TGS_REQ retaining any other pre-authentication data
+	for i := range k.PAData {
+		if k.PAData[i].PADataType == patype.PA_TGS_REQ {
+			k.PAData[i] = pa
+			return nil
+		}
+	}
+	k.PAData = append(types.PADataSequence{pa}, k.PAData...)
+	return nil
 }
 
 // Unmarshal bytes b into the ASReq struct.
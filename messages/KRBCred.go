@@ -5,7 +5,9 @@ import (
 	"time"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
+	"gopkg.in/jcmturner/gokrb5.v5/asn1tools"
 	"gopkg.in/jcmturner/gokrb5.v5/crypto"
+	"gopkg.in/jcmturner/gokrb5.v5/iana"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/asnAppTag"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/keyusage"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/msgtype"
@@ -49,11 +51,58 @@ type KrbCredInfo struct {
 	StartTime time.Time           `asn1:"generalized,optional,explicit,tag:5"`
 	EndTime   time.Time           `asn1:"generalized,optional,explicit,tag:6"`
 	RenewTill time.Time           `asn1:"generalized,optional,explicit,tag:7"`
-	SRealm    string              `asn1:"optional,explicit,ia5,tag:8"`
+	SRealm    string              `asn1:"generalstring,optional,explicit,tag:8"`
 	SName     types.PrincipalName `asn1:"optional,explicit,tag:9"`
 	CAddr     types.HostAddresses `asn1:"optional,explicit,tag:10"`
 }
 
+// NewKRBCred creates a new KRB_CRED containing the tickets provided, and the information about them, with the encrypted
+// part encrypted using the key provided. This is usually the session key, or sub-key, of the AP exchange with the
+// recipient.
+func NewKRBCred(tkts []Ticket, info []KrbCredInfo, key types.EncryptionKey) (KRBCred, error) {
+	t := time.Now().UTC()
+	k := KRBCred{
+		PVNO:    iana.PVNO,
+		MsgType: msgtype.KRB_CRED,
+		Tickets: tkts,
+		DecryptedEncPart: EncKrbCredPart{
+			TicketInfo: info,
+			Timestamp:  t,
+			Usec:       int((t.UnixNano() / int64(time.Microsecond)) - (t.Unix() * 1e6)),
+		},
+	}
+	b, err := k.DecryptedEncPart.Marshal()
+	if err != nil {
+		return k, err
+	}
+	k.EncPart, err = crypto.GetEncryptedData(b, key, keyusage.KRB_CRED_ENCPART, 0)
+	if err != nil {
+		return k, krberror.Errorf(err, krberror.EncryptingError, "error encrypting KRB_CRED EncPart")
+	}
+	return k, nil
+}
+
+// Marshal the KRBCred.
+func (k *KRBCred) Marshal() ([]byte, error) {
+	m := marshalKRBCred{
+		PVNO:    k.PVNO,
+		MsgType: k.MsgType,
+		EncPart: k.EncPart,
+	}
+	var err error
+	m.Tickets, err = MarshalTicketSequence(k.Tickets)
+	if err != nil {
+		return []byte{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling tickets within KRB_CRED")
+	}
+	m.Tickets.Tag = 2
+	b, err := asn1.Marshal(m)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling KRB_CRED")
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.KRBCred)
+	return b, nil
+}
+
 // Unmarshal bytes b into the KRBCred struct.
 func (k *KRBCred) Unmarshal(b []byte) error {
 	var m marshalKRBCred
@@ -100,3 +149,13 @@ func (k *EncKrbCredPart) Unmarshal(b []byte) error {
 	}
 	return nil
 }
+
+// Marshal the encrypted part of KRB_CRED.
+func (k *EncKrbCredPart) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*k)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling EncKrbCredPart")
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.EncKrbCredPart)
+	return b, nil
+}
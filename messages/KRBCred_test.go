@@ -9,9 +9,11 @@ import (
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/jcmturner/gokrb5.v5/iana"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/addrtype"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/etypeID"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/msgtype"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
 	"gopkg.in/jcmturner/gokrb5.v5/testdata"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
 )
 
 func TestUnmarshalKRBCred(t *testing.T) {
@@ -133,3 +135,85 @@ func TestUnmarshalEncCredPart_optionalsNULL(t *testing.T) {
 		assert.Equal(t, "12d00023", hex.EncodeToString(addr.Address), fmt.Sprintf("Host address not as expected for address item %d within ticket info %d", j+1, i+1))
 	}
 }
+
+func TestMarshalKRBCred(t *testing.T) {
+	t.Parallel()
+	var a KRBCred
+	v := "encode_krb5_cred"
+	b, err := hex.DecodeString(testdata.TestVectors[v])
+	if err != nil {
+		t.Fatalf("Test vector read error of %s: %v\n", v, err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error of %s: %v\n", v, err)
+	}
+	mb, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal of KRBCred failed: %v", err)
+	}
+	assert.Equal(t, b, mb, "Marshal bytes of KRBCred not as expected")
+}
+
+func TestMarshalEncCredPart(t *testing.T) {
+	t.Parallel()
+	var a EncKrbCredPart
+	v := "encode_krb5_enc_cred_part"
+	b, err := hex.DecodeString(testdata.TestVectors[v])
+	if err != nil {
+		t.Fatalf("Test vector read error of %s: %v\n", v, err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error of %s: %v\n", v, err)
+	}
+	assert.Equal(t, testdata.TEST_REALM, a.TicketInfo[0].SRealm, "SRealm not as expected")
+	mb, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal of EncKrbCredPart failed: %v", err)
+	}
+	assert.Equal(t, b, mb, "Marshal bytes of EncKrbCredPart not as expected")
+}
+
+func TestNewKRBCred(t *testing.T) {
+	t.Parallel()
+	key := types.EncryptionKey{
+		KeyType:  etypeID.AES256_CTS_HMAC_SHA1_96,
+		KeyValue: make([]byte, 32),
+	}
+	var tkt Ticket
+	b, _ := hex.DecodeString(testdata.TestVectors["encode_krb5_ticket"])
+	err := tkt.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling test ticket: %v", err)
+	}
+	info := KrbCredInfo{
+		Key:    types.EncryptionKey{KeyType: 1, KeyValue: []byte("12345678")},
+		PRealm: testdata.TEST_REALM,
+		PName:  types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1"),
+		SRealm: testdata.TEST_REALM,
+		SName:  types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+testdata.TEST_REALM),
+	}
+	k, err := NewKRBCred([]Ticket{tkt}, []KrbCredInfo{info}, key)
+	if err != nil {
+		t.Fatalf("Error creating KRBCred: %v", err)
+	}
+	mb, err := k.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal of KRBCred failed: %v", err)
+	}
+	var a KRBCred
+	err = a.Unmarshal(mb)
+	if err != nil {
+		t.Fatalf("Unmarshal of KRBCred failed: %v", err)
+	}
+	assert.Equal(t, 1, len(a.Tickets), "Number of tickets not as expected")
+	assert.Equal(t, tkt.EncPart, a.Tickets[0].EncPart, "Ticket not as expected")
+	err = a.DecryptEncPart(key)
+	if err != nil {
+		t.Fatalf("Error decrypting KRBCred: %v", err)
+	}
+	assert.Equal(t, info.PName, a.DecryptedEncPart.TicketInfo[0].PName, "PName not as expected")
+	assert.Equal(t, info.SName, a.DecryptedEncPart.TicketInfo[0].SName, "SName not as expected")
+	assert.Equal(t, info.Key, a.DecryptedEncPart.TicketInfo[0].Key, "Key not as expected")
+}
@@ -0,0 +1,230 @@
+package messages
+
+// Reference: https://tools.ietf.org/html/rfc6560
+// Section: 4.1
+
+import (
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"gopkg.in/jcmturner/gokrb5.v5/krberror"
+	"gopkg.in/jcmturner/gokrb5.v5/pkinit"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+// otpTimeFormat is the KerberosTime GeneralizedTime format of the otp-time.
+const otpTimeFormat = "20060102150405Z"
+
+// OTPFlags bits.
+const (
+	OTPFlagNextOTP             = 1
+	OTPFlagCombine             = 2
+	OTPFlagCollectPIN          = 3
+	OTPFlagDoNotCollectPIN     = 4
+	OTPFlagMustEncryptNonce    = 5
+	OTPFlagSeparatePINRequired = 6
+	OTPFlagCheckDigit          = 7
+)
+
+// PinFlags bits.
+const (
+	PINFlagSystemSetPIN = 1
+	PINFlagMandatory    = 2
+)
+
+// OTPFormat values.
+const (
+	OTPFormatDecimal      = 0
+	OTPFormatHexadecimal  = 1
+	OTPFormatAlphanumeric = 2
+	OTPFormatBinary       = 3
+	OTPFormatBase64       = 4
+)
+
+// PAOTPChallenge implements RFC 6560 PA-OTP-CHALLENGE: https://tools.ietf.org/html/rfc6560#section-4.1.1
+type PAOTPChallenge struct {
+	Nonce     []byte         `asn1:"tag:0"`
+	Service   string         `asn1:"utf8,optional,tag:1"`
+	TokenInfo []OTPTokenInfo `asn1:"tag:2"`
+	Salt      string         `asn1:"generalstring,optional,tag:3"`
+	S2KParams []byte         `asn1:"optional,tag:4"`
+}
+
+// OTPTokenInfo implements RFC 6560 OTP-TOKENINFO: https://tools.ietf.org/html/rfc6560#section-4.1.1
+type OTPTokenInfo struct {
+	Flags            asn1.BitString               `asn1:"tag:0"`
+	Vendor           string                       `asn1:"utf8,optional,tag:1"`
+	Challenge        []byte                       `asn1:"optional,tag:2"`
+	Length           int32                        `asn1:"optional,tag:3"`
+	Format           int32                        `asn1:"optional,tag:4"`
+	TokenID          []byte                       `asn1:"optional,tag:5"`
+	AlgID            string                       `asn1:"utf8,optional,tag:6"`
+	SupportedHashAlg []pkinit.AlgorithmIdentifier `asn1:"optional,tag:7"`
+	IterationCount   int32                        `asn1:"optional,tag:8"`
+}
+
+// PAOTPRequest implements RFC 6560 PA-OTP-REQUEST: https://tools.ietf.org/html/rfc6560#section-4.1.2
+type PAOTPRequest struct {
+	Flags          asn1.BitString             `asn1:"tag:0"`
+	Nonce          []byte                     `asn1:"optional,tag:1"`
+	EncData        types.EncryptedData        `asn1:"tag:2"`
+	HashAlg        pkinit.AlgorithmIdentifier `asn1:"optional,tag:3"`
+	IterationCount int32                      `asn1:"optional,tag:4"`
+	OTPValue       []byte                     `asn1:"optional,tag:5"`
+	OTPPIN         string                     `asn1:"utf8,optional,tag:6"`
+	OTPChallenge   []byte                     `asn1:"optional,tag:7"`
+	OTPTime        time.Time                  `asn1:"optional,tag:8"`
+	OTPCounter     []byte                     `asn1:"optional,tag:9"`
+	OTPFormat      int32                      `asn1:"optional,tag:10"`
+	OTPTokenID     []byte                     `asn1:"optional,tag:11"`
+	OTPAlgID       string                     `asn1:"utf8,optional,tag:12"`
+	OTPVendor      string                     `asn1:"utf8,optional,tag:13"`
+}
+
+// marshalPAOTPRequest is used to marshal and unmarshal the PA-OTP-REQUEST. The implicitly tagged otp-time cannot be
+// unmarshaled as a time.Time as the tag does not indicate that it is a GeneralizedTime.
+type marshalPAOTPRequest struct {
+	Flags          asn1.BitString             `asn1:"tag:0"`
+	Nonce          []byte                     `asn1:"optional,tag:1"`
+	EncData        types.EncryptedData        `asn1:"tag:2"`
+	HashAlg        pkinit.AlgorithmIdentifier `asn1:"optional,tag:3"`
+	IterationCount int32                      `asn1:"optional,tag:4"`
+	OTPValue       []byte                     `asn1:"optional,tag:5"`
+	OTPPIN         string                     `asn1:"utf8,optional,tag:6"`
+	OTPChallenge   []byte                     `asn1:"optional,tag:7"`
+	OTPTime        []byte                     `asn1:"optional,tag:8"`
+	OTPCounter     []byte                     `asn1:"optional,tag:9"`
+	OTPFormat      int32                      `asn1:"optional,tag:10"`
+	OTPTokenID     []byte                     `asn1:"optional,tag:11"`
+	OTPAlgID       string                     `asn1:"utf8,optional,tag:12"`
+	OTPVendor      string                     `asn1:"utf8,optional,tag:13"`
+}
+
+// PAOTPEncRequest implements RFC 6560 PA-OTP-ENC-REQUEST: https://tools.ietf.org/html/rfc6560#section-4.1.2
+type PAOTPEncRequest struct {
+	Nonce []byte `asn1:"tag:0"`
+}
+
+// PAOTPPINChange implements RFC 6560 PA-OTP-PIN-CHANGE: https://tools.ietf.org/html/rfc6560#section-4.1.3
+type PAOTPPINChange struct {
+	Flags     asn1.BitString `asn1:"tag:0"`
+	PIN       string         `asn1:"utf8,optional,tag:1"`
+	MinLength int            `asn1:"optional,tag:2"`
+	MaxLength int            `asn1:"optional,tag:3"`
+	LastReqs  []LastReq      `asn1:"optional,tag:4"`
+	Format    int32          `asn1:"optional,tag:5"`
+}
+
+// Marshal the PA-OTP-CHALLENGE.
+func (p *PAOTPChallenge) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*p)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-OTP-CHALLENGE")
+	}
+	return b, nil
+}
+
+// Unmarshal bytes b into the PA-OTP-CHALLENGE struct.
+func (p *PAOTPChallenge) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, p)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-OTP-CHALLENGE")
+	}
+	return nil
+}
+
+// Marshal the PA-OTP-REQUEST.
+func (p *PAOTPRequest) Marshal() ([]byte, error) {
+	m := marshalPAOTPRequest{
+		Flags:          p.Flags,
+		Nonce:          p.Nonce,
+		EncData:        p.EncData,
+		HashAlg:        p.HashAlg,
+		IterationCount: p.IterationCount,
+		OTPValue:       p.OTPValue,
+		OTPPIN:         p.OTPPIN,
+		OTPChallenge:   p.OTPChallenge,
+		OTPCounter:     p.OTPCounter,
+		OTPFormat:      p.OTPFormat,
+		OTPTokenID:     p.OTPTokenID,
+		OTPAlgID:       p.OTPAlgID,
+		OTPVendor:      p.OTPVendor,
+	}
+	if !p.OTPTime.IsZero() {
+		m.OTPTime = []byte(p.OTPTime.UTC().Format(otpTimeFormat))
+	}
+	b, err := asn1.Marshal(m)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-OTP-REQUEST")
+	}
+	return b, nil
+}
+
+// Unmarshal bytes b into the PA-OTP-REQUEST struct.
+func (p *PAOTPRequest) Unmarshal(b []byte) error {
+	var m marshalPAOTPRequest
+	_, err := asn1.Unmarshal(b, &m)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-OTP-REQUEST")
+	}
+	var t time.Time
+	if len(m.OTPTime) > 0 {
+		t, err = time.Parse(otpTimeFormat, string(m.OTPTime))
+		if err != nil {
+			return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-OTP-REQUEST otp-time")
+		}
+	}
+	*p = PAOTPRequest{
+		Flags:          m.Flags,
+		Nonce:          m.Nonce,
+		EncData:        m.EncData,
+		HashAlg:        m.HashAlg,
+		IterationCount: m.IterationCount,
+		OTPValue:       m.OTPValue,
+		OTPPIN:         m.OTPPIN,
+		OTPChallenge:   m.OTPChallenge,
+		OTPTime:        t,
+		OTPCounter:     m.OTPCounter,
+		OTPFormat:      m.OTPFormat,
+		OTPTokenID:     m.OTPTokenID,
+		OTPAlgID:       m.OTPAlgID,
+		OTPVendor:      m.OTPVendor,
+	}
+	return nil
+}
+
+// Marshal the PA-OTP-ENC-REQUEST.
+func (p *PAOTPEncRequest) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*p)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-OTP-ENC-REQUEST")
+	}
+	return b, nil
+}
+
+// Unmarshal bytes b into the PA-OTP-ENC-REQUEST struct.
+func (p *PAOTPEncRequest) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, p)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-OTP-ENC-REQUEST")
+	}
+	return nil
+}
+
+// Marshal the PA-OTP-PIN-CHANGE.
+func (p *PAOTPPINChange) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*p)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-OTP-PIN-CHANGE")
+	}
+	return b, nil
+}
+
+// Unmarshal bytes b into the PA-OTP-PIN-CHANGE struct.
+func (p *PAOTPPINChange) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, p)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-OTP-PIN-CHANGE")
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package messages
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/testdata"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+func TestUnmarshalPAOTPChallenge(t *testing.T) {
+	t.Parallel()
+	var a PAOTPChallenge
+	v := "encode_krb5_pa_otp_challenge"
+	b, err := hex.DecodeString(testdata.TestVectors[v])
+	if err != nil {
+		t.Fatalf("Test vector read error of %s: %v\n", v, err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error of %s: %v\n", v, err)
+	}
+	assert.Equal(t, []byte("maxnonce"), a.Nonce, "Nonce not as expected")
+	assert.Equal(t, "testservice", a.Service, "Service not as expected")
+	assert.Equal(t, 2, len(a.TokenInfo), "Number of token info entries not as expected")
+	assert.Equal(t, "keysalt", a.Salt, "Salt not as expected")
+	assert.Equal(t, []byte("1234"), a.S2KParams, "S2K params not as expected")
+	ti := a.TokenInfo[1]
+	assert.True(t, types.IsFlagSet(&ti.Flags, OTPFlagNextOTP), "Next OTP flag not set")
+	assert.True(t, types.IsFlagSet(&ti.Flags, OTPFlagCheckDigit), "Check digit flag not set")
+	assert.False(t, types.IsFlagSet(&ti.Flags, OTPFlagDoNotCollectPIN), "Do not collect PIN flag should not be set")
+	assert.Equal(t, "Examplecorp", ti.Vendor, "Vendor not as expected")
+	assert.Equal(t, []byte("hark!"), ti.Challenge, "Challenge not as expected")
+	assert.Equal(t, int32(10), ti.Length, "Length not as expected")
+	assert.Equal(t, int32(OTPFormatAlphanumeric), ti.Format, "Format not as expected")
+	assert.Equal(t, []byte("yourtoken"), ti.TokenID, "Token ID not as expected")
+	assert.Equal(t, "urn:ietf:params:xml:ns:keyprov:pskc:hotp", ti.AlgID, "Algorithm ID not as expected")
+	assert.Equal(t, 2, len(ti.SupportedHashAlg), "Number of supported hash algorithms not as expected")
+	assert.Equal(t, int32(1000), ti.IterationCount, "Iteration count not as expected")
+	mb, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal of PAOTPChallenge failed: %v", err)
+	}
+	assert.Equal(t, b, mb, "Marshal bytes of PAOTPChallenge not as expected")
+}
+
+func TestUnmarshalPAOTPChallenge_optionalsNULL(t *testing.T) {
+	t.Parallel()
+	var a PAOTPChallenge
+	v := "encode_krb5_pa_otp_challenge(optionalsNULL)"
+	b, err := hex.DecodeString(testdata.TestVectors[v])
+	if err != nil {
+		t.Fatalf("Test vector read error of %s: %v\n", v, err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error of %s: %v\n", v, err)
+	}
+	assert.Equal(t, []byte("minnonce"), a.Nonce, "Nonce not as expected")
+	assert.Equal(t, 1, len(a.TokenInfo), "Number of token info entries not as expected")
+	assert.Equal(t, "", a.Service, "Service not as expected")
+	mb, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal of PAOTPChallenge failed: %v", err)
+	}
+	assert.Equal(t, b, mb, "Marshal bytes of PAOTPChallenge not as expected")
+}
+
+func TestUnmarshalPAOTPRequest(t *testing.T) {
+	t.Parallel()
+	var a PAOTPRequest
+	v := "encode_krb5_pa_otp_req"
+	b, err := hex.DecodeString(testdata.TestVectors[v])
+	if err != nil {
+		t.Fatalf("Test vector read error of %s: %v\n", v, err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error of %s: %v\n", v, err)
+	}
+	assert.True(t, types.IsFlagSet(&a.Flags, OTPFlagNextOTP), "Next OTP flag not set")
+	assert.True(t, types.IsFlagSet(&a.Flags, OTPFlagCombine), "Combine flag not set")
+	assert.Equal(t, []byte("nonce"), a.Nonce, "Nonce not as expected")
+	assert.Equal(t, int32(0), a.EncData.EType, "Encrypted data etype not as expected")
+	assert.Equal(t, 5, a.EncData.KVNO, "Encrypted data KVNO not as expected")
+	assert.Equal(t, []byte("krbASN.1 test message"), a.EncData.Cipher, "Encrypted data cipher not as expected")
+	assert.Equal(t, "2.16.840.1.101.3.4.2.1", a.HashAlg.Algorithm.String(), "Hash algorithm not as expected")
+	assert.Equal(t, int32(1000), a.IterationCount, "Iteration count not as expected")
+	assert.Equal(t, []byte("frogs"), a.OTPValue, "OTP value not as expected")
+	assert.Equal(t, "myfirstpin", a.OTPPIN, "OTP PIN not as expected")
+	assert.Equal(t, []byte("hark!"), a.OTPChallenge, "OTP challenge not as expected")
+	assert.Equal(t, time.Date(1994, 6, 10, 6, 3, 17, 0, time.UTC), a.OTPTime, "OTP time not as expected")
+	assert.Equal(t, []byte("346"), a.OTPCounter, "OTP counter not as expected")
+	assert.Equal(t, int32(OTPFormatAlphanumeric), a.OTPFormat, "OTP format not as expected")
+	assert.Equal(t, []byte("yourtoken"), a.OTPTokenID, "OTP token ID not as expected")
+	assert.Equal(t, "urn:ietf:params:xml:ns:keyprov:pskc:hotp", a.OTPAlgID, "OTP algorithm ID not as expected")
+	assert.Equal(t, "Examplecorp", a.OTPVendor, "OTP vendor not as expected")
+	mb, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal of PAOTPRequest failed: %v", err)
+	}
+	assert.Equal(t, b, mb, "Marshal bytes of PAOTPRequest not as expected")
+}
+
+func TestUnmarshalPAOTPRequest_optionalsNULL(t *testing.T) {
+	t.Parallel()
+	var a PAOTPRequest
+	v := "encode_krb5_pa_otp_req(optionalsNULL)"
+	b, err := hex.DecodeString(testdata.TestVectors[v])
+	if err != nil {
+		t.Fatalf("Test vector read error of %s: %v\n", v, err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error of %s: %v\n", v, err)
+	}
+	assert.Equal(t, []byte("krbASN.1 test message"), a.EncData.Cipher, "Encrypted data cipher not as expected")
+	assert.Nil(t, a.OTPValue, "OTP value should not be present")
+	mb, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal of PAOTPRequest failed: %v", err)
+	}
+	assert.Equal(t, b, mb, "Marshal bytes of PAOTPRequest not as expected")
+}
+
+func TestUnmarshalPAOTPEncRequest(t *testing.T) {
+	t.Parallel()
+	var a PAOTPEncRequest
+	v := "encode_krb5_pa_otp_enc_req"
+	b, err := hex.DecodeString(testdata.TestVectors[v])
+	if err != nil {
+		t.Fatalf("Test vector read error of %s: %v\n", v, err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error of %s: %v\n", v, err)
+	}
+	assert.Equal(t, []byte("krb5data"), a.Nonce, "Nonce not as expected")
+	mb, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal of PAOTPEncRequest failed: %v", err)
+	}
+	assert.Equal(t, b, mb, "Marshal bytes of PAOTPEncRequest not as expected")
+}
+
+func TestMarshalPAOTPPINChange(t *testing.T) {
+	t.Parallel()
+	p := PAOTPPINChange{
+		Flags:     types.NewKrbFlags(),
+		PIN:       "1234",
+		MinLength: 4,
+		MaxLength: 8,
+	}
+	types.SetFlag(&p.Flags, PINFlagSystemSetPIN)
+	b, err := p.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal of PAOTPPINChange failed: %v", err)
+	}
+	var a PAOTPPINChange
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal of PAOTPPINChange failed: %v", err)
+	}
+	assert.True(t, types.IsFlagSet(&a.Flags, PINFlagSystemSetPIN), "System set PIN flag not set")
+	assert.False(t, types.IsFlagSet(&a.Flags, PINFlagMandatory), "Mandatory flag should not be set")
+	assert.Equal(t, "1234", a.PIN, "PIN not as expected")
+	assert.Equal(t, 4, a.MinLength, "Minimum length not as expected")
+	assert.Equal(t, 8, a.MaxLength, "Maximum length not as expected")
+}
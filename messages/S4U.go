@@ -0,0 +1,216 @@
+package messages
+
+// Reference: https://msdn.microsoft.com/en-us/library/cc246071.aspx
+// Section: 2.2
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"gopkg.in/jcmturner/gokrb5.v5/crypto"
+	"gopkg.in/jcmturner/gokrb5.v5/crypto/rfc4757"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/chksumtype"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/keyusage"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/patype"
+	"gopkg.in/jcmturner/gokrb5.v5/krberror"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+// S4UAuthPackage is the authentication package name used in PA-FOR-USER.
+const S4UAuthPackage = "Kerberos"
+
+// PA-PAC-OPTIONS flag bits: https://msdn.microsoft.com/en-us/library/hh554101.aspx
+const (
+	PACOptionClaims                             = 0
+	PACOptionBranchAware                        = 1
+	PACOptionForwardToFullDC                    = 2
+	PACOptionResourceBasedConstrainedDelegation = 3
+)
+
+// PAForUser implements MS-SFU PA-FOR-USER: https://msdn.microsoft.com/en-us/library/cc246083.aspx
+type PAForUser struct {
+	UserName    types.PrincipalName `asn1:"explicit,tag:0"`
+	UserRealm   string              `asn1:"generalstring,explicit,tag:1"`
+	Cksum       types.Checksum      `asn1:"explicit,tag:2"`
+	AuthPackage string              `asn1:"generalstring,explicit,tag:3"`
+}
+
+// PAS4UX509User implements MS-SFU PA-S4U-X509-USER: https://msdn.microsoft.com/en-us/library/cc246084.aspx
+type PAS4UX509User struct {
+	UserID   S4UUserID      `asn1:"explicit,tag:0"`
+	Checksum types.Checksum `asn1:"explicit,tag:1"`
+}
+
+// S4UUserID implements MS-SFU S4UUserID: https://msdn.microsoft.com/en-us/library/cc246084.aspx
+type S4UUserID struct {
+	Nonce              int                 `asn1:"explicit,tag:0"`
+	CName              types.PrincipalName `asn1:"explicit,optional,tag:1"`
+	CRealm             string              `asn1:"generalstring,explicit,tag:2"`
+	SubjectCertificate []byte              `asn1:"explicit,optional,tag:3"`
+	Options            asn1.BitString      `asn1:"explicit,optional,tag:4"`
+}
+
+// PAPACOptions implements MS-KILE PA-PAC-OPTIONS: https://msdn.microsoft.com/en-us/library/hh554101.aspx
+type PAPACOptions struct {
+	KerberosFlags asn1.BitString `asn1:"explicit,tag:0"`
+}
+
+// NewPAForUser creates a new PA_FOR_USER pre-authentication data for the user principal provided.
+// The checksum is keyed with the session key of the TGT used in the TGS_REQ.
+func NewPAForUser(user types.PrincipalName, userRealm string, sessionKey types.EncryptionKey) (types.PAData, error) {
+	p := PAForUser{
+		UserName:    user,
+		UserRealm:   userRealm,
+		AuthPackage: S4UAuthPackage,
+	}
+	cb, err := rfc4757.Checksum(sessionKey.KeyValue, keyusage.KERB_NON_KERB_CKSUM_SALT, p.checksumData())
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.ChksumError, "error calculating PA-FOR-USER checksum")
+	}
+	p.Cksum = types.Checksum{
+		CksumType: chksumtype.KERB_CHECKSUM_HMAC_MD5,
+		Checksum:  cb,
+	}
+	b, err := p.Marshal()
+	if err != nil {
+		return types.PAData{}, err
+	}
+	return types.PAData{
+		PADataType:  patype.PA_FOR_USER,
+		PADataValue: b,
+	}, nil
+}
+
+// NewPAS4UX509User creates a new PA_S4U_X509_USER pre-authentication data identifying the user either by principal name,
+// by certificate or both. The nonce must be that of the TGS_REQ. The checksum is keyed with the sub-key of the TGS_REQ
+// authenticator, if one is used, otherwise the session key of the TGT.
+func NewPAS4UX509User(nonce int, user types.PrincipalName, userRealm string, cert []byte, key types.EncryptionKey) (types.PAData, error) {
+	p := PAS4UX509User{
+		UserID: S4UUserID{
+			Nonce:              nonce,
+			CName:              user,
+			CRealm:             userRealm,
+			SubjectCertificate: cert,
+		},
+	}
+	b, err := asn1.Marshal(p.UserID)
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling S4UUserID")
+	}
+	et, err := crypto.GetEtype(key.KeyType)
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.ChksumError, "error getting etype for PA-S4U-X509-USER checksum")
+	}
+	cb, err := et.GetChecksumHash(key.KeyValue, b, keyusage.PA_S4U_X509_USER_REQUEST)
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.ChksumError, "error calculating PA-S4U-X509-USER checksum")
+	}
+	p.Checksum = types.Checksum{
+		CksumType: et.GetHashID(),
+		Checksum:  cb,
+	}
+	b, err = p.Marshal()
+	if err != nil {
+		return types.PAData{}, err
+	}
+	return types.PAData{
+		PADataType:  patype.PA_FOR_X509_USER,
+		PADataValue: b,
+	}, nil
+}
+
+// checksumData returns the data over which the PA-FOR-USER checksum is calculated. This is the little endian name type
+// followed by the name strings, realm and auth package.
+func (p *PAForUser) checksumData() []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(p.UserName.NameType))
+	for _, n := range p.UserName.NameString {
+		b = append(b, []byte(n)...)
+	}
+	b = append(b, []byte(p.UserRealm)...)
+	b = append(b, []byte(p.AuthPackage)...)
+	return b
+}
+
+// VerifyChecksum verifies the PA-FOR-USER checksum using the session key of the TGT.
+func (p *PAForUser) VerifyChecksum(sessionKey types.EncryptionKey) bool {
+	if p.Cksum.CksumType != chksumtype.KERB_CHECKSUM_HMAC_MD5 {
+		return false
+	}
+	cb, err := rfc4757.Checksum(sessionKey.KeyValue, keyusage.KERB_NON_KERB_CKSUM_SALT, p.checksumData())
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(cb, p.Cksum.Checksum)
+}
+
+// Marshal the PA-FOR-USER.
+func (p *PAForUser) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*p)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-FOR-USER")
+	}
+	return b, nil
+}
+
+// Unmarshal bytes b into the PA-FOR-USER struct.
+func (p *PAForUser) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, p)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-FOR-USER")
+	}
+	return nil
+}
+
+// Marshal the PA-S4U-X509-USER.
+func (p *PAS4UX509User) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*p)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-S4U-X509-USER")
+	}
+	return b, nil
+}
+
+// Unmarshal bytes b into the PA-S4U-X509-USER struct.
+func (p *PAS4UX509User) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, p)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-S4U-X509-USER")
+	}
+	return nil
+}
+
+// NewPAPACOptions creates a new PA_PAC_OPTIONS pre-authentication data with the option flags provided set.
+func NewPAPACOptions(options ...int) (types.PAData, error) {
+	p := PAPACOptions{
+		KerberosFlags: types.NewKrbFlags(),
+	}
+	types.SetFlags(&p.KerberosFlags, options)
+	b, err := p.Marshal()
+	if err != nil {
+		return types.PAData{}, err
+	}
+	return types.PAData{
+		PADataType:  patype.PA_PAC_OPTIONS,
+		PADataValue: b,
+	}, nil
+}
+
+// Marshal the PA-PAC-OPTIONS.
+func (p *PAPACOptions) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*p)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-PAC-OPTIONS")
+	}
+	return b, nil
+}
+
+// Unmarshal bytes b into the PA-PAC-OPTIONS struct.
+func (p *PAPACOptions) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, p)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-PAC-OPTIONS")
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package messages
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/crypto"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/chksumtype"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/etypeID"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/keyusage"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/patype"
+	"gopkg.in/jcmturner/gokrb5.v5/testdata"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+func TestUnmarshalPAForUser(t *testing.T) {
+	t.Parallel()
+	var a PAForUser
+	v := "encode_krb5_pa_for_user"
+	b, err := hex.DecodeString(testdata.TestVectors[v])
+	if err != nil {
+		t.Fatalf("Test vector read error of %s: %v\n", v, err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error of %s: %v\n", v, err)
+	}
+	assert.Equal(t, nametype.KRB_NT_PRINCIPAL, a.UserName.NameType, "User name type not as expected")
+	assert.Equal(t, testdata.TEST_PRINCIPALNAME_NAMESTRING, a.UserName.NameString, "User name not as expected")
+	assert.Equal(t, testdata.TEST_REALM, a.UserRealm, "User realm not as expected")
+	assert.Equal(t, int32(1), a.Cksum.CksumType, "Checksum type not as expected")
+	assert.Equal(t, []byte("1234"), a.Cksum.Checksum, "Checksum not as expected")
+	assert.Equal(t, "krb5data", a.AuthPackage, "Auth package not as expected")
+	mb, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal of PAForUser failed: %v", err)
+	}
+	assert.Equal(t, b, mb, "Marshal bytes of PAForUser not as expected")
+}
+
+func TestUnmarshalPAS4UX509User(t *testing.T) {
+	t.Parallel()
+	var a PAS4UX509User
+	v := "encode_krb5_pa_s4u_x509_user"
+	b, err := hex.DecodeString(testdata.TestVectors[v])
+	if err != nil {
+		t.Fatalf("Test vector read error of %s: %v\n", v, err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error of %s: %v\n", v, err)
+	}
+	assert.Equal(t, 13243546, a.UserID.Nonce, "Nonce not as expected")
+	assert.Equal(t, nametype.KRB_NT_PRINCIPAL, a.UserID.CName.NameType, "CName type not as expected")
+	assert.Equal(t, testdata.TEST_PRINCIPALNAME_NAMESTRING, a.UserID.CName.NameString, "CName not as expected")
+	assert.Equal(t, testdata.TEST_REALM, a.UserID.CRealm, "CRealm not as expected")
+	assert.Equal(t, []byte("pa_s4u_x509_user"), a.UserID.SubjectCertificate, "Subject certificate not as expected")
+	assert.Equal(t, []byte{0x80, 0, 0, 0}, a.UserID.Options.Bytes, "Options not as expected")
+	assert.Equal(t, int32(1), a.Checksum.CksumType, "Checksum type not as expected")
+	assert.Equal(t, []byte("1234"), a.Checksum.Checksum, "Checksum not as expected")
+	mb, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal of PAS4UX509User failed: %v", err)
+	}
+	assert.Equal(t, b, mb, "Marshal bytes of PAS4UX509User not as expected")
+}
+
+func TestNewPAForUser(t *testing.T) {
+	t.Parallel()
+	key := types.EncryptionKey{
+		KeyType:  etypeID.AES256_CTS_HMAC_SHA1_96,
+		KeyValue: make([]byte, 32),
+	}
+	user := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	pa, err := NewPAForUser(user, "TEST.GOKRB5", key)
+	if err != nil {
+		t.Fatalf("Error creating PA-FOR-USER: %v", err)
+	}
+	assert.Equal(t, patype.PA_FOR_USER, pa.PADataType, "PAData type not as expected")
+	var a PAForUser
+	err = a.Unmarshal(pa.PADataValue)
+	if err != nil {
+		t.Fatalf("Error unmarshaling PA-FOR-USER: %v", err)
+	}
+	assert.Equal(t, user, a.UserName, "User name not as expected")
+	assert.Equal(t, S4UAuthPackage, a.AuthPackage, "Auth package not as expected")
+	assert.Equal(t, chksumtype.KERB_CHECKSUM_HMAC_MD5, a.Cksum.CksumType, "Checksum type not as expected")
+	assert.True(t, a.VerifyChecksum(key), "PA-FOR-USER checksum not valid")
+	a.UserRealm = "OTHER.GOKRB5"
+	assert.False(t, a.VerifyChecksum(key), "PA-FOR-USER checksum valid after modification")
+}
+
+func TestNewPAS4UX509User(t *testing.T) {
+	t.Parallel()
+	key := types.EncryptionKey{
+		KeyType:  etypeID.AES128_CTS_HMAC_SHA1_96,
+		KeyValue: make([]byte, 16),
+	}
+	user := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	pa, err := NewPAS4UX509User(testdata.TEST_NONCE, user, "TEST.GOKRB5", nil, key)
+	if err != nil {
+		t.Fatalf("Error creating PA-S4U-X509-USER: %v", err)
+	}
+	assert.Equal(t, patype.PA_FOR_X509_USER, pa.PADataType, "PAData type not as expected")
+	var a PAS4UX509User
+	err = a.Unmarshal(pa.PADataValue)
+	if err != nil {
+		t.Fatalf("Error unmarshaling PA-S4U-X509-USER: %v", err)
+	}
+	assert.Equal(t, testdata.TEST_NONCE, a.UserID.Nonce, "Nonce not as expected")
+	assert.Equal(t, user, a.UserID.CName, "CName not as expected")
+	assert.Nil(t, a.UserID.SubjectCertificate, "Subject certificate should not be present")
+	b, _ := asn1.Marshal(a.UserID)
+	et, _ := crypto.GetEtype(key.KeyType)
+	assert.True(t, et.VerifyChecksum(key.KeyValue, b, a.Checksum.Checksum, keyusage.PA_S4U_X509_USER_REQUEST), "PA-S4U-X509-USER checksum not valid")
+}
+
+func TestNewPAPACOptions(t *testing.T) {
+	t.Parallel()
+	pa, err := NewPAPACOptions(PACOptionResourceBasedConstrainedDelegation)
+	if err != nil {
+		t.Fatalf("Error creating PA-PAC-OPTIONS: %v", err)
+	}
+	assert.Equal(t, patype.PA_PAC_OPTIONS, pa.PADataType, "PAData type not as expected")
+	assert.Equal(t, "3009a00703050010000000", hex.EncodeToString(pa.PADataValue), "PA-PAC-OPTIONS encoding not as expected")
+	var a PAPACOptions
+	err = a.Unmarshal(pa.PADataValue)
+	if err != nil {
+		t.Fatalf("Error unmarshaling PA-PAC-OPTIONS: %v", err)
+	}
+	assert.True(t, types.IsFlagSet(&a.KerberosFlags, PACOptionResourceBasedConstrainedDelegation), "Resource based constrained delegation flag not set")
+	assert.False(t, types.IsFlagSet(&a.KerberosFlags, PACOptionClaims), "Claims flag should not be set")
+}
+
+func TestNewPAForUser_ChecksumKnownAnswer(t *testing.T) {
+	t.Parallel()
+	// The expected checksum is calculated independently following MS-SFU 2.2.1: the KERB_CHECKSUM_HMAC_MD5 of RFC 4757
+	// section 4 with key usage 17 over the little endian name type, name, realm and auth package.
+	key := types.EncryptionKey{
+		KeyType:  etypeID.RC4_HMAC,
+		KeyValue: []byte{0x7f, 0xc2, 0xeb, 0xe2, 0x5c, 0xa8, 0xa6, 0xc3, 0xc5, 0xd0, 0xa7, 0xb8, 0xe4, 0xd3, 0xf0, 0xc1},
+	}
+	user := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	pa, err := NewPAForUser(user, "TEST.GOKRB5", key)
+	if err != nil {
+		t.Fatalf("Error creating PA-FOR-USER: %v", err)
+	}
+	var a PAForUser
+	err = a.Unmarshal(pa.PADataValue)
+	if err != nil {
+		t.Fatalf("Error unmarshaling PA-FOR-USER: %v", err)
+	}
+	assert.Equal(t, "b2c331ae22c60005bf9b31f530e3faa1", hex.EncodeToString(a.Cksum.Checksum), "PA-FOR-USER checksum not as expected")
+}
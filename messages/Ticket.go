@@ -55,7 +55,18 @@ type TransitedEncoding struct {
 
 // NewTicket creates a new Ticket instance.
 func NewTicket(cname types.PrincipalName, crealm string, sname types.PrincipalName, srealm string, flags asn1.BitString, sktab keytab.Keytab, eTypeID int32, kvno int, authTime, startTime, endTime, renewTill time.Time) (Ticket, types.EncryptionKey, error) {
-	etype, err := crypto.GetEtype(eTypeID)
+	skey, err := sktab.GetEncryptionKey(sname.NameString, srealm, kvno, eTypeID)
+	if err != nil {
+		return Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error getting encryption key for new ticket")
+	}
+	return NewTicketWithKey(cname, crealm, sname, srealm, flags, skey, kvno, authTime, startTime, endTime, renewTill)
+}
+
+// NewTicketWithKey creates a new Ticket instance with its encrypted part encrypted with the key provided.
+// The session key generated is of the same encryption type as the key.
+// For user-to-user tickets the key is the session key of the service's TGT.
+func NewTicketWithKey(cname types.PrincipalName, crealm string, sname types.PrincipalName, srealm string, flags asn1.BitString, skey types.EncryptionKey, kvno int, authTime, startTime, endTime, renewTill time.Time) (Ticket, types.EncryptionKey, error) {
+	etype, err := crypto.GetEtype(skey.KeyType)
 	if err != nil {
 		return Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error getting etype for new ticket")
 	}
@@ -63,7 +74,7 @@ func NewTicket(cname types.PrincipalName, crealm string, sname types.PrincipalNa
 	kv := make([]byte, ks, ks)
 	rand.Read(kv)
 	sessionKey := types.EncryptionKey{
-		KeyType:  eTypeID,
+		KeyType:  skey.KeyType,
 		KeyValue: kv,
 	}
 	etp := EncTicketPart{
@@ -82,10 +93,6 @@ func NewTicket(cname types.PrincipalName, crealm string, sname types.PrincipalNa
 		return Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncodingError, "error marshalling ticket encpart")
 	}
 	b = asn1tools.AddASNAppTag(b, asnAppTag.EncTicketPart)
-	skey, err := sktab.GetEncryptionKey(sname.NameString, srealm, kvno, eTypeID)
-	if err != nil {
-		return Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error getting encryption key for new ticket")
-	}
 	ed, err := crypto.GetEncryptedData(b, skey, keyusage.KDC_REP_TICKET, kvno)
 	if err != nil {
 		return Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error encrypting ticket encpart")
@@ -107,7 +114,10 @@ func (t *Ticket) Unmarshal(b []byte) error {
 
 // Marshal the Ticket.
 func (t *Ticket) Marshal() ([]byte, error) {
-	b, err := asn1.Marshal(*t)
+	// The decrypted part is not part of the ticket's encoding
+	m := *t
+	m.DecryptedEncPart = EncTicketPart{}
+	b, err := asn1.Marshal(m)
 	if err != nil {
 		return nil, err
 	}
@@ -195,6 +205,11 @@ func (t *Ticket) DecryptEncPart(keytab keytab.Keytab, ktprinc string) error {
 	if err != nil {
 		return NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_NOKEY, fmt.Sprintf("Could not get key from keytab: %v", err))
 	}
+	return t.DecryptEncPartWithKey(key)
+}
+
+// DecryptEncPartWithKey decrypts the encrypted part of the ticket using the service key provided.
+func (t *Ticket) DecryptEncPartWithKey(key types.EncryptionKey) error {
 	b, err := crypto.DecryptEncPart(t.EncPart, key, keyusage.KDC_REP_TICKET)
 	if err != nil {
 		return fmt.Errorf("error decrypting Ticket EncPart: %v", err)
@@ -210,7 +225,36 @@ func (t *Ticket) DecryptEncPart(keytab keytab.Keytab, ktprinc string) error {
 
 // GetPACType returns a Microsoft PAC that has been extracted from the ticket and processed.
 func (t *Ticket) GetPACType(keytab keytab.Keytab, ktprinc string) (bool, pac.PACType, error) {
-	var isPAC bool
+	isPAC, p, err := t.unmarshalPAC()
+	if !isPAC || err != nil {
+		return isPAC, p, err
+	}
+	var upn []string
+	if ktprinc != "" {
+		upn = strings.Split(ktprinc, "/")
+	} else {
+		upn = t.SName.NameString
+	}
+	key, err := keytab.GetEncryptionKey(upn, t.Realm, t.EncPart.KVNO, t.EncPart.EType)
+	if err != nil {
+		return isPAC, p, NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_NOKEY, fmt.Sprintf("Could not get key from keytab: %v", err))
+	}
+	err = p.ProcessPACInfoBuffers(key)
+	return isPAC, p, err
+}
+
+// GetPACTypeWithKey returns a Microsoft PAC that has been extracted from the ticket and processed using the service key provided.
+func (t *Ticket) GetPACTypeWithKey(key types.EncryptionKey) (bool, pac.PACType, error) {
+	isPAC, p, err := t.unmarshalPAC()
+	if !isPAC || err != nil {
+		return isPAC, p, err
+	}
+	err = p.ProcessPACInfoBuffers(key)
+	return isPAC, p, err
+}
+
+// unmarshalPAC returns the unprocessed Microsoft PAC from the authorization data of the decrypted ticket.
+func (t *Ticket) unmarshalPAC() (bool, pac.PACType, error) {
 	for _, ad := range t.DecryptedEncPart.AuthorizationData {
 		if ad.ADType == adtype.ADIfRelevant {
 			var ad2 types.AuthorizationData
@@ -219,26 +263,14 @@ func (t *Ticket) GetPACType(keytab keytab.Keytab, ktprinc string) (bool, pac.PAC
 				continue
 			}
 			if ad2[0].ADType == adtype.ADWin2KPAC {
-				isPAC = true
 				var p pac.PACType
 				err = p.Unmarshal(ad2[0].ADData)
 				if err != nil {
-					return isPAC, p, fmt.Errorf("error unmarshaling PAC: %v", err)
-				}
-				var upn []string
-				if ktprinc != "" {
-					upn = strings.Split(ktprinc, "/")
-				} else {
-					upn = t.SName.NameString
-				}
-				key, err := keytab.GetEncryptionKey(upn, t.Realm, t.EncPart.KVNO, t.EncPart.EType)
-				if err != nil {
-					return isPAC, p, NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_NOKEY, fmt.Sprintf("Could not get key from keytab: %v", err))
+					return true, p, fmt.Errorf("error unmarshaling PAC: %v", err)
 				}
-				err = p.ProcessPACInfoBuffers(key)
-				return isPAC, p, err
+				return true, p, nil
 			}
 		}
 	}
-	return isPAC, pac.PACType{}, nil
+	return false, pac.PACType{}, nil
 }
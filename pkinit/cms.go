@@ -0,0 +1,524 @@
+package pkinit
+
+// Reference: https://tools.ietf.org/html/rfc5652
+// Section: 5
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256" // Register the SHA256 hash
+	_ "crypto/sha512" // Register the SHA384 and SHA512 hashes
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+// CMS object identifiers.
+var (
+	oidSignedData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidAttContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSHA1             = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidRSAEncryption    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256  = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// AlgorithmIdentifier implements RFC 5280 AlgorithmIdentifier: https://tools.ietf.org/html/rfc5280#section-4.1.1.2
+type AlgorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+// contentInfo implements RFC 5652 ContentInfo. The content is an explicit context specific tag 0 which must be set on
+// the RawValue directly.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+// signedData implements RFC 5652 SignedData. The digest algorithms and signer infos are each a SET OF which must be set
+// on the RawValue directly.
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     rawContent `asn1:"optional,tag:0"`
+	CRLs             rawContent `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+// encapsulatedContentInfo implements RFC 5652 EncapsulatedContentInfo. The eContent is an explicit context specific tag
+// 0 which must be set on the RawValue directly.
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"optional"`
+}
+
+// signerInfo implements RFC 5652 SignerInfo.
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    AlgorithmIdentifier
+	SignedAttrs        rawContent `asn1:"optional,tag:0"`
+	SignatureAlgorithm AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      rawContent `asn1:"optional,tag:1"`
+}
+
+// issuerAndSerialNumber implements RFC 5652 IssuerAndSerialNumber.
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// attribute implements RFC 5652 Attribute. The values are a SET which must be set on the RawValue directly.
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// rawContent holds the complete encoding of an implicitly tagged field. It is used for optional fields as the tag
+// parameters of RawValue fields are not honoured.
+type rawContent struct {
+	Raw asn1.RawContent
+}
+
+// signData creates a CMS ContentInfo of SignedData type encapsulating the content provided and signed with the
+// certificate and private key.
+func signData(contentType asn1.ObjectIdentifier, content []byte, cert *x509.Certificate, key crypto.Signer) ([]byte, error) {
+	if cert == nil || key == nil {
+		return nil, errors.New("certificate and private key are required to sign data")
+	}
+	sigAlg, err := signatureAlgorithm(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	digestAlg := AlgorithmIdentifier{Algorithm: oidSHA256}
+	h := crypto.SHA256.New()
+	h.Write(content)
+	attrs, err := marshalSignedAttributes(contentType, h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	h = crypto.SHA256.New()
+	h.Write(attrs)
+	sig, err := key.Sign(rand.Reader, h.Sum(nil), crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("error signing data: %v", err)
+	}
+	sid, err := asn1.Marshal(issuerAndSerialNumber{
+		Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+		SerialNumber: cert.SerialNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ec, err := asn1.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        0,
+		IsCompound: true,
+		Bytes:      cert.Raw,
+	})
+	if err != nil {
+		return nil, err
+	}
+	digestAlgs, err := marshalSet(digestAlg)
+	if err != nil {
+		return nil, err
+	}
+	signerInfos, err := marshalSet(signerInfo{
+		Version:            1,
+		SID:                asn1.RawValue{FullBytes: sid},
+		DigestAlgorithm:    digestAlg,
+		SignedAttrs:        rawContent{Raw: attrs},
+		SignatureAlgorithm: sigAlg,
+		Signature:          sig,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sd := signedData{
+		Version:          3,
+		DigestAlgorithms: digestAlgs,
+		EncapContentInfo: encapsulatedContentInfo{
+			EContentType: contentType,
+			EContent: asn1.RawValue{
+				Class:      asn1.ClassContextSpecific,
+				Tag:        0,
+				IsCompound: true,
+				Bytes:      ec,
+			},
+		},
+		Certificates: rawContent{Raw: certs},
+		SignerInfos:  signerInfos,
+	}
+	sdb, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      sdb,
+		},
+	})
+}
+
+// verifySignedData verifies the CMS ContentInfo of SignedData type and returns the encapsulated content along with the
+// signer's certificate. The signer's certificate chain is verified using the options provided with any intermediate
+// certificates included in the SignedData added.
+func verifySignedData(b []byte, contentType asn1.ObjectIdentifier, opts x509.VerifyOptions) ([]byte, *x509.Certificate, error) {
+	sd, content, err := parseSignedData(b, contentType)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(sd.SignerInfos.Bytes) < 1 {
+		return nil, nil, errors.New("SignedData is not signed")
+	}
+	certs, err := sd.certificates()
+	if err != nil {
+		return nil, nil, err
+	}
+	var si signerInfo
+	rest, err := asn1.Unmarshal(sd.SignerInfos.Bytes, &si)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error unmarshaling SignerInfo: %v", err)
+	}
+	if len(rest) > 0 {
+		return nil, nil, errors.New("SignedData has more than one signer")
+	}
+	cert, err := si.signer(certs)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = si.verify(cert, contentType, content)
+	if err != nil {
+		return nil, cert, err
+	}
+	if len(opts.KeyUsages) == 0 {
+		// The PKINIT key purposes are not known to the x509 package so are checked by the caller.
+		opts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+	if opts.Intermediates != nil {
+		// The caller's pool is not modified so the certificates in the SignedData are tried separately.
+		if _, err = cert.Verify(opts); err == nil {
+			return content, cert, nil
+		}
+	}
+	opts.Intermediates = x509.NewCertPool()
+	for _, c := range certs {
+		if c != cert {
+			opts.Intermediates.AddCert(c)
+		}
+	}
+	_, err = cert.Verify(opts)
+	if err != nil {
+		return nil, cert, fmt.Errorf("signer certificate is not trusted: %v", err)
+	}
+	return content, cert, nil
+}
+
+// unsignedData creates a CMS ContentInfo of SignedData type encapsulating the content provided without any signers or
+// certificates, as used for anonymous PKINIT.
+func unsignedData(contentType asn1.ObjectIdentifier, content []byte) ([]byte, error) {
+	ec, err := asn1.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	empty, err := marshalSet()
+	if err != nil {
+		return nil, err
+	}
+	sdb, err := asn1.Marshal(signedData{
+		Version:          3,
+		DigestAlgorithms: empty,
+		EncapContentInfo: encapsulatedContentInfo{
+			EContentType: contentType,
+			EContent: asn1.RawValue{
+				Class:      asn1.ClassContextSpecific,
+				Tag:        0,
+				IsCompound: true,
+				Bytes:      ec,
+			},
+		},
+		SignerInfos: empty,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      sdb,
+		},
+	})
+}
+
+// unsignedContent returns the encapsulated content of a CMS ContentInfo of SignedData type that has no signers.
+func unsignedContent(b []byte, contentType asn1.ObjectIdentifier) ([]byte, error) {
+	sd, content, err := parseSignedData(b, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if len(sd.SignerInfos.Bytes) > 0 {
+		return nil, errors.New("SignedData is signed")
+	}
+	return content, nil
+}
+
+// parseSignedData unmarshals the CMS ContentInfo of SignedData type and returns the SignedData along with its
+// encapsulated content, which must be of the content type provided.
+func parseSignedData(b []byte, contentType asn1.ObjectIdentifier) (signedData, []byte, error) {
+	var ci contentInfo
+	var sd signedData
+	_, err := asn1.Unmarshal(b, &ci)
+	if err != nil {
+		return sd, nil, fmt.Errorf("error unmarshaling ContentInfo: %v", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return sd, nil, fmt.Errorf("ContentInfo content type %v is not SignedData", ci.ContentType)
+	}
+	_, err = asn1.Unmarshal(ci.Content.Bytes, &sd)
+	if err != nil {
+		return sd, nil, fmt.Errorf("error unmarshaling SignedData: %v", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(contentType) {
+		return sd, nil, fmt.Errorf("SignedData content type %v not as expected", sd.EncapContentInfo.EContentType)
+	}
+	var content []byte
+	_, err = asn1.Unmarshal(sd.EncapContentInfo.EContent.Bytes, &content)
+	if err != nil {
+		return sd, nil, fmt.Errorf("error unmarshaling SignedData content: %v", err)
+	}
+	return sd, content, nil
+}
+
+// certificates returns the certificates included in the SignedData.
+func (sd *signedData) certificates() ([]*x509.Certificate, error) {
+	if len(sd.Certificates.Raw) == 0 {
+		return nil, nil
+	}
+	var r asn1.RawValue
+	_, err := asn1.Unmarshal(sd.Certificates.Raw, &r)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling SignedData certificates: %v", err)
+	}
+	certs, err := x509.ParseCertificates(r.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing SignedData certificates: %v", err)
+	}
+	return certs, nil
+}
+
+// signer returns the certificate, from those provided, identified by the SignerInfo.
+func (si *signerInfo) signer(certs []*x509.Certificate) (*x509.Certificate, error) {
+	if si.SID.Class == asn1.ClassContextSpecific && si.SID.Tag == 0 {
+		for _, c := range certs {
+			if bytes.Equal(c.SubjectKeyId, si.SID.Bytes) {
+				return c, nil
+			}
+		}
+		return nil, errors.New("signer certificate identified by subject key identifier not found")
+	}
+	var isn issuerAndSerialNumber
+	_, err := asn1.Unmarshal(si.SID.FullBytes, &isn)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling SignerInfo issuer and serial number: %v", err)
+	}
+	for _, c := range certs {
+		if c.SerialNumber.Cmp(isn.SerialNumber) == 0 && bytes.Equal(c.RawIssuer, isn.Issuer.FullBytes) {
+			return c, nil
+		}
+	}
+	return nil, errors.New("signer certificate identified by issuer and serial number not found")
+}
+
+// verify checks the SignerInfo's signature and signed attributes against the content.
+func (si *signerInfo) verify(cert *x509.Certificate, contentType asn1.ObjectIdentifier, content []byte) error {
+	hash, err := hashAlgorithm(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write(content)
+	digest := h.Sum(nil)
+	signed := content
+	if len(si.SignedAttrs.Raw) > 0 {
+		var r asn1.RawValue
+		_, err = asn1.Unmarshal(si.SignedAttrs.Raw, &r)
+		if err != nil {
+			return fmt.Errorf("error unmarshaling signed attributes: %v", err)
+		}
+		var ct, md bool
+		rest := r.Bytes
+		for len(rest) > 0 {
+			var a attribute
+			rest, err = asn1.Unmarshal(rest, &a)
+			if err != nil {
+				return fmt.Errorf("error unmarshaling signed attribute: %v", err)
+			}
+			switch {
+			case a.Type.Equal(oidAttContentType):
+				var oid asn1.ObjectIdentifier
+				_, err = asn1.Unmarshal(a.Values.Bytes, &oid)
+				if err != nil || !oid.Equal(contentType) {
+					return errors.New("signed content type attribute not as expected")
+				}
+				ct = true
+			case a.Type.Equal(oidAttMessageDigest):
+				var d []byte
+				_, err = asn1.Unmarshal(a.Values.Bytes, &d)
+				if err != nil || !bytes.Equal(d, digest) {
+					return errors.New("signed message digest attribute does not match content")
+				}
+				md = true
+			}
+		}
+		if !ct || !md {
+			return errors.New("signed attributes do not include content type and message digest")
+		}
+		// The signature is calculated over the DER encoding of the attributes as a SET rather than the implicit tag.
+		signed = append([]byte{0x31}, si.SignedAttrs.Raw[1:]...)
+	}
+	algo, err := x509SignatureAlgorithm(hash, cert.PublicKeyAlgorithm)
+	if err != nil {
+		return err
+	}
+	err = cert.CheckSignature(algo, signed, si.Signature)
+	if err != nil {
+		return fmt.Errorf("signature verification failed: %v", err)
+	}
+	return nil
+}
+
+// marshalSignedAttributes returns the DER encoding, as a SET, of the content type and message digest signed attributes.
+func marshalSignedAttributes(contentType asn1.ObjectIdentifier, digest []byte) ([]byte, error) {
+	ctb, err := asn1.Marshal(contentType)
+	if err != nil {
+		return nil, err
+	}
+	mdb, err := asn1.Marshal(digest)
+	if err != nil {
+		return nil, err
+	}
+	var attrs [][]byte
+	for _, a := range []attribute{
+		{Type: oidAttContentType, Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: ctb}},
+		{Type: oidAttMessageDigest, Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: mdb}},
+	} {
+		b, err := asn1.Marshal(a)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, b)
+	}
+	// DER requires the elements of a SET OF to be sorted by their encoding.
+	sort.Sort(derSetOf(attrs))
+	return asn1.Marshal(asn1.RawValue{
+		Tag:        asn1.TagSet,
+		IsCompound: true,
+		Bytes:      bytes.Join(attrs, nil),
+	})
+}
+
+// marshalSet returns a RawValue of the SET OF the values provided.
+func marshalSet(v ...interface{}) (asn1.RawValue, error) {
+	var b []byte
+	for _, e := range v {
+		eb, err := asn1.Marshal(e)
+		if err != nil {
+			return asn1.RawValue{}, err
+		}
+		b = append(b, eb...)
+	}
+	return asn1.RawValue{
+		Tag:        asn1.TagSet,
+		IsCompound: true,
+		Bytes:      b,
+	}, nil
+}
+
+// signatureAlgorithm returns the CMS signature algorithm identifier to be used with the public key.
+func signatureAlgorithm(pub crypto.PublicKey) (AlgorithmIdentifier, error) {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return AlgorithmIdentifier{
+			Algorithm:  oidRSAEncryption,
+			Parameters: asn1.RawValue{Tag: 5}, // NULL
+		}, nil
+	case *ecdsa.PublicKey:
+		return AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}, nil
+	}
+	return AlgorithmIdentifier{}, fmt.Errorf("unsupported signing key type %T", pub)
+}
+
+// hashAlgorithm returns the hash function for the digest algorithm object identifier.
+func hashAlgorithm(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, nil
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported digest algorithm %v", oid)
+}
+
+// x509SignatureAlgorithm returns the x509 signature algorithm for the hash and public key algorithm of the signer.
+func x509SignatureAlgorithm(hash crypto.Hash, pub x509.PublicKeyAlgorithm) (x509.SignatureAlgorithm, error) {
+	switch pub {
+	case x509.RSA:
+		switch hash {
+		case crypto.SHA1:
+			return x509.SHA1WithRSA, nil
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case x509.ECDSA:
+		switch hash {
+		case crypto.SHA1:
+			return x509.ECDSAWithSHA1, nil
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported signature algorithm for %v with %v", pub, hash)
+}
+
+// derSetOf sorts the encoded elements of a SET OF into DER order.
+type derSetOf [][]byte
+
+func (s derSetOf) Len() int           { return len(s) }
+func (s derSetOf) Less(i, j int) bool { return bytes.Compare(s[i], s[j]) < 0 }
+func (s derSetOf) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,218 @@
+package pkinit
+
+// Reference: https://tools.ietf.org/html/rfc4556#section-3.2.3.1
+// Reference: https://tools.ietf.org/html/rfc5349
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+// Key agreement object identifiers.
+var (
+	OIDDHPublicNumber = asn1.ObjectIdentifier{1, 2, 840, 10046, 2, 1}
+	OIDECPublicKey    = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidCurveP256      = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidCurveP384      = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	oidCurveP521      = asn1.ObjectIdentifier{1, 3, 132, 0, 35}
+)
+
+// Well known MODP Diffie-Hellman groups.
+const (
+	// MODPGroup2 is the 1024-bit MODP group defined in RFC 2409.
+	MODPGroup2 = 2
+	// MODPGroup14 is the 2048-bit MODP group defined in RFC 3526.
+	MODPGroup14 = 14
+)
+
+var modpPrimes = map[int]string{
+	MODPGroup2: "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
+		"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE65381FFFFFFFFFFFFFFFF",
+	MODPGroup14: "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
+		"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F" +
+		"83655D23DCA3AD961C62F356208552BB9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+		"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF6955817183995497CEA956AE515D2261898FA0510" +
+		"15728E5A8AACAA68FFFFFFFFFFFFFFFF",
+}
+
+// SubjectPublicKeyInfo implements RFC 5280 SubjectPublicKeyInfo: https://tools.ietf.org/html/rfc5280#section-4.1.2.7
+type SubjectPublicKeyInfo struct {
+	Algorithm        AlgorithmIdentifier
+	SubjectPublicKey asn1.BitString
+}
+
+// DomainParameters implements the Diffie-Hellman DomainParameters defined in RFC 3279: https://tools.ietf.org/html/rfc3279#section-2.3.3
+type DomainParameters struct {
+	P               *big.Int
+	G               *big.Int
+	Q               *big.Int
+	J               *big.Int      `asn1:"optional"`
+	ValidationParms asn1.RawValue `asn1:"optional"`
+}
+
+// KeyAgreement is the interface for the ephemeral key agreement used to derive the PKINIT reply key.
+type KeyAgreement interface {
+	// PublicKeyInfo returns the public value to be sent to the KDC in the AuthPack.
+	PublicKeyInfo() (SubjectPublicKeyInfo, error)
+	// PublicKey returns the encoding of the public value as carried in the KDCDHKeyInfo.
+	PublicKey() []byte
+	// SharedSecret returns the shared secret, ZZ, agreed with the peer's public value.
+	SharedSecret(publicKey []byte) ([]byte, error)
+}
+
+// ModPKeyAgreement implements finite field Diffie-Hellman key agreement over a MODP group.
+type ModPKeyAgreement struct {
+	p, g, q *big.Int
+	x, y    *big.Int
+}
+
+// NewModPKeyAgreement generates a new ephemeral Diffie-Hellman key pair in the MODP group provided.
+func NewModPKeyAgreement(group int) (*ModPKeyAgreement, error) {
+	h, ok := modpPrimes[group]
+	if !ok {
+		return nil, fmt.Errorf("MODP group %d not supported", group)
+	}
+	p, _ := new(big.Int).SetString(h, 16)
+	// The MODP groups are safe primes so q = (p-1)/2
+	q := new(big.Int).Rsh(new(big.Int).Sub(p, big.NewInt(1)), 1)
+	return newModPKeyAgreement(p, big.NewInt(2), q)
+}
+
+func newModPKeyAgreement(p, g, q *big.Int) (*ModPKeyAgreement, error) {
+	// Private exponent in the range 2 to q-1
+	x, err := rand.Int(rand.Reader, new(big.Int).Sub(q, big.NewInt(2)))
+	if err != nil {
+		return nil, fmt.Errorf("error generating Diffie-Hellman private key: %v", err)
+	}
+	x.Add(x, big.NewInt(2))
+	return &ModPKeyAgreement{
+		p: p,
+		g: g,
+		q: q,
+		x: x,
+		y: new(big.Int).Exp(g, x, p),
+	}, nil
+}
+
+// PublicKeyInfo returns the Diffie-Hellman domain parameters and public value.
+func (k *ModPKeyAgreement) PublicKeyInfo() (SubjectPublicKeyInfo, error) {
+	var spki SubjectPublicKeyInfo
+	params, err := asn1.Marshal(DomainParameters{P: k.p, G: k.g, Q: k.q})
+	if err != nil {
+		return spki, fmt.Errorf("error marshaling Diffie-Hellman domain parameters: %v", err)
+	}
+	spki.Algorithm = AlgorithmIdentifier{
+		Algorithm:  OIDDHPublicNumber,
+		Parameters: asn1.RawValue{FullBytes: params},
+	}
+	spki.SubjectPublicKey = asn1.BitString{
+		Bytes:     k.PublicKey(),
+		BitLength: len(k.PublicKey()) * 8,
+	}
+	return spki, nil
+}
+
+// PublicKey returns the Diffie-Hellman public value encoded as an ASN.1 INTEGER.
+func (k *ModPKeyAgreement) PublicKey() []byte {
+	b, _ := asn1.Marshal(k.y)
+	return b
+}
+
+// SharedSecret returns the Diffie-Hellman shared secret padded to the size of the prime.
+func (k *ModPKeyAgreement) SharedSecret(publicKey []byte) ([]byte, error) {
+	y := new(big.Int)
+	_, err := asn1.Unmarshal(publicKey, &y)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling Diffie-Hellman public value: %v", err)
+	}
+	if y.Cmp(big.NewInt(1)) <= 0 || y.Cmp(new(big.Int).Sub(k.p, big.NewInt(1))) >= 0 {
+		return nil, errors.New("Diffie-Hellman public value out of range")
+	}
+	z := new(big.Int).Exp(y, k.x, k.p)
+	return padBytes(z.Bytes(), (k.p.BitLen()+7)/8), nil
+}
+
+// padBytes left pads the big-endian bytes of an integer with zeros to the length provided.
+func padBytes(b []byte, l int) []byte {
+	if len(b) >= l {
+		return b
+	}
+	p := make([]byte, l)
+	copy(p[l-len(b):], b)
+	return p
+}
+
+// ECDHKeyAgreement implements elliptic curve Diffie-Hellman key agreement as specified in RFC 5349.
+type ECDHKeyAgreement struct {
+	oid   asn1.ObjectIdentifier
+	curve elliptic.Curve
+	d     []byte
+	x, y  *big.Int
+}
+
+// NewECDHKeyAgreement generates a new ephemeral key pair on the curve provided. The NIST P-256, P-384 and P-521 curves
+// are supported.
+func NewECDHKeyAgreement(c elliptic.Curve) (*ECDHKeyAgreement, error) {
+	var oid asn1.ObjectIdentifier
+	switch c {
+	case elliptic.P256():
+		oid = oidCurveP256
+	case elliptic.P384():
+		oid = oidCurveP384
+	case elliptic.P521():
+		oid = oidCurveP521
+	default:
+		return nil, fmt.Errorf("elliptic curve %s not supported", c.Params().Name)
+	}
+	d, x, y, err := elliptic.GenerateKey(c, rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating ECDH private key: %v", err)
+	}
+	return &ECDHKeyAgreement{
+		oid:   oid,
+		curve: c,
+		d:     d,
+		x:     x,
+		y:     y,
+	}, nil
+}
+
+// PublicKeyInfo returns the named curve and public point.
+func (k *ECDHKeyAgreement) PublicKeyInfo() (SubjectPublicKeyInfo, error) {
+	var spki SubjectPublicKeyInfo
+	params, err := asn1.Marshal(k.oid)
+	if err != nil {
+		return spki, fmt.Errorf("error marshaling elliptic curve parameters: %v", err)
+	}
+	spki.Algorithm = AlgorithmIdentifier{
+		Algorithm:  OIDECPublicKey,
+		Parameters: asn1.RawValue{FullBytes: params},
+	}
+	spki.SubjectPublicKey = asn1.BitString{
+		Bytes:     k.PublicKey(),
+		BitLength: len(k.PublicKey()) * 8,
+	}
+	return spki, nil
+}
+
+// PublicKey returns the public point in uncompressed form.
+func (k *ECDHKeyAgreement) PublicKey() []byte {
+	return elliptic.Marshal(k.curve, k.x, k.y)
+}
+
+// SharedSecret returns the x-coordinate of the shared point.
+func (k *ECDHKeyAgreement) SharedSecret(publicKey []byte) ([]byte, error) {
+	x, y := elliptic.Unmarshal(k.curve, publicKey)
+	if x == nil || !k.curve.IsOnCurve(x, y) {
+		return nil, errors.New("invalid ECDH public value")
+	}
+	zx, _ := k.curve.ScalarMult(x, y, k.d)
+	return padBytes(zx.Bytes(), (k.curve.Params().BitSize+7)/8), nil
+}
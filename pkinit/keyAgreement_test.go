@@ -0,0 +1,103 @@
+package pkinit
+
+import (
+	"crypto/elliptic"
+	"testing"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+)
+
+func asn1BitString(b []byte) asn1.BitString {
+	return asn1.BitString{Bytes: b, BitLength: len(b) * 8}
+}
+
+func TestModPKeyAgreement(t *testing.T) {
+	t.Parallel()
+	for _, g := range []int{MODPGroup2, MODPGroup14} {
+		c, err := NewModPKeyAgreement(g)
+		if err != nil {
+			t.Fatalf("Error creating client key agreement for group %d: %v", g, err)
+		}
+		k, err := NewModPKeyAgreement(g)
+		if err != nil {
+			t.Fatalf("Error creating KDC key agreement for group %d: %v", g, err)
+		}
+		cz, err := c.SharedSecret(k.PublicKey())
+		if err != nil {
+			t.Fatalf("Error calculating client shared secret for group %d: %v", g, err)
+		}
+		kz, err := k.SharedSecret(c.PublicKey())
+		if err != nil {
+			t.Fatalf("Error calculating KDC shared secret for group %d: %v", g, err)
+		}
+		assert.Equal(t, cz, kz, "Shared secrets do not match for group %d", g)
+		assert.Equal(t, (c.p.BitLen()+7)/8, len(cz), "Shared secret length not as expected for group %d", g)
+
+		spki, err := c.PublicKeyInfo()
+		if err != nil {
+			t.Fatalf("Error getting public key info for group %d: %v", g, err)
+		}
+		var params DomainParameters
+		_, err = asn1.Unmarshal(spki.Algorithm.Parameters.FullBytes, &params)
+		if err != nil {
+			t.Fatalf("Error unmarshaling domain parameters for group %d: %v", g, err)
+		}
+		assert.Equal(t, 0, c.p.Cmp(params.P), "Prime not as expected for group %d", g)
+		assert.Equal(t, int64(2), params.G.Int64(), "Generator not as expected for group %d", g)
+	}
+	_, err := NewModPKeyAgreement(5)
+	assert.Error(t, err, "Unsupported group should error")
+}
+
+func TestModPKeyAgreement_InvalidPublicValue(t *testing.T) {
+	t.Parallel()
+	c, err := NewModPKeyAgreement(MODPGroup2)
+	if err != nil {
+		t.Fatalf("Error creating key agreement: %v", err)
+	}
+	b, _ := asn1.Marshal(1)
+	_, err = c.SharedSecret(b)
+	assert.Error(t, err, "Public value of 1 should be rejected")
+}
+
+func TestECDHKeyAgreement(t *testing.T) {
+	t.Parallel()
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		c, err := NewECDHKeyAgreement(curve)
+		if err != nil {
+			t.Fatalf("Error creating client key agreement for %s: %v", curve.Params().Name, err)
+		}
+		k, err := NewECDHKeyAgreement(curve)
+		if err != nil {
+			t.Fatalf("Error creating KDC key agreement for %s: %v", curve.Params().Name, err)
+		}
+		cz, err := c.SharedSecret(k.PublicKey())
+		if err != nil {
+			t.Fatalf("Error calculating client shared secret for %s: %v", curve.Params().Name, err)
+		}
+		kz, err := k.SharedSecret(c.PublicKey())
+		if err != nil {
+			t.Fatalf("Error calculating KDC shared secret for %s: %v", curve.Params().Name, err)
+		}
+		assert.Equal(t, cz, kz, "Shared secrets do not match for %s", curve.Params().Name)
+		assert.Equal(t, (curve.Params().BitSize+7)/8, len(cz), "Shared secret length not as expected for %s", curve.Params().Name)
+		spki, err := c.PublicKeyInfo()
+		if err != nil {
+			t.Fatalf("Error getting public key info for %s: %v", curve.Params().Name, err)
+		}
+		assert.True(t, OIDECPublicKey.Equal(spki.Algorithm.Algorithm), "Algorithm not as expected for %s", curve.Params().Name)
+	}
+}
+
+func TestECDHKeyAgreement_InvalidPublicValue(t *testing.T) {
+	t.Parallel()
+	c, err := NewECDHKeyAgreement(elliptic.P256())
+	if err != nil {
+		t.Fatalf("Error creating key agreement: %v", err)
+	}
+	b := c.PublicKey()
+	b[len(b)-1] ^= 0x01
+	_, err = c.SharedSecret(b)
+	assert.Error(t, err, "Point not on the curve should be rejected")
+}
@@ -0,0 +1,21 @@
+package pkinit
+
+import (
+	"gopkg.in/jcmturner/gokrb5.v5/crypto"
+	"gopkg.in/jcmturner/gokrb5.v5/crypto/rfc4556"
+	"gopkg.in/jcmturner/gokrb5.v5/krberror"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+// ReplyKey derives the AS reply key of the encryption type provided from the output of the key agreement.
+// The input x is the shared secret concatenated with any nonces as returned by DHRepInfo.DHSharedSecretInput.
+func ReplyKey(x []byte, etypeID int32) (types.EncryptionKey, error) {
+	et, err := crypto.GetEtype(etypeID)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error getting etype for PKINIT reply key")
+	}
+	return types.EncryptionKey{
+		KeyType:  etypeID,
+		KeyValue: rfc4556.OctetString2Key(x, et),
+	}, nil
+}
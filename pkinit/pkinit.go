@@ -0,0 +1,415 @@
+// Package pkinit provides the types and functions for public key cryptography for initial authentication in Kerberos
+// (PKINIT) as specified in RFC 4556.
+package pkinit
+
+import (
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
+	"gopkg.in/jcmturner/gokrb5.v5/krberror"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+// PKINIT object identifiers.
+var (
+	OIDPKINITAuthData     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 1}
+	OIDPKINITDHKeyData    = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 2}
+	OIDPKINITRKeyData     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 3}
+	OIDPKINITKPClientAuth = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 4}
+	OIDPKINITKPKdc        = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 5}
+	OIDPKINITSAN          = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 2}
+	oidSubjectAltName     = asn1.ObjectIdentifier{2, 5, 29, 17}
+)
+
+// PAPKASReq implements RFC 4556 PA-PK-AS-REQ: https://tools.ietf.org/html/rfc4556#section-3.2.1
+type PAPKASReq struct {
+	SignedAuthPack    []byte                        `asn1:"tag:0"`
+	TrustedCertifiers []ExternalPrincipalIdentifier `asn1:"explicit,optional,tag:1"`
+	KDCPkID           []byte                        `asn1:"optional,tag:2"`
+}
+
+// ExternalPrincipalIdentifier implements RFC 4556 ExternalPrincipalIdentifier: https://tools.ietf.org/html/rfc4556#section-3.2.1
+type ExternalPrincipalIdentifier struct {
+	SubjectName           []byte `asn1:"optional,tag:0"`
+	IssuerAndSerialNumber []byte `asn1:"optional,tag:1"`
+	SubjectKeyIdentifier  []byte `asn1:"optional,tag:2"`
+}
+
+// AuthPack implements RFC 4556 AuthPack: https://tools.ietf.org/html/rfc4556#section-3.2.1
+type AuthPack struct {
+	PKAuthenticator   PKAuthenticator       `asn1:"explicit,tag:0"`
+	ClientPublicValue SubjectPublicKeyInfo  `asn1:"explicit,optional,tag:1"`
+	SupportedCMSTypes []AlgorithmIdentifier `asn1:"explicit,optional,tag:2"`
+	ClientDHNonce     []byte                `asn1:"explicit,optional,tag:3"`
+}
+
+// PKAuthenticator implements RFC 4556 PKAuthenticator: https://tools.ietf.org/html/rfc4556#section-3.2.1
+type PKAuthenticator struct {
+	Cusec      int       `asn1:"explicit,tag:0"`
+	CTime      time.Time `asn1:"generalized,explicit,tag:1"`
+	Nonce      int       `asn1:"explicit,tag:2"`
+	PAChecksum []byte    `asn1:"explicit,optional,tag:3"`
+}
+
+// PAPKASRep implements RFC 4556 PA-PK-AS-REP: https://tools.ietf.org/html/rfc4556#section-3.2.3
+//
+// PA-PK-AS-REP is a choice so only one of DHInfo or EncKeyPack will be populated.
+type PAPKASRep struct {
+	DHInfo     DHRepInfo
+	EncKeyPack []byte
+}
+
+// DHRepInfo implements RFC 4556 DHRepInfo: https://tools.ietf.org/html/rfc4556#section-3.2.3
+type DHRepInfo struct {
+	DHSignedData  []byte `asn1:"tag:0"`
+	ServerDHNonce []byte `asn1:"explicit,optional,tag:1"`
+}
+
+// KDCDHKeyInfo implements RFC 4556 KDCDHKeyInfo: https://tools.ietf.org/html/rfc4556#section-3.2.3.1
+type KDCDHKeyInfo struct {
+	SubjectPublicKey asn1.BitString `asn1:"explicit,tag:0"`
+	Nonce            int            `asn1:"explicit,tag:1"`
+	DHKeyExpiration  time.Time      `asn1:"generalized,explicit,optional,tag:2"`
+}
+
+// KRB5PrincipalName implements RFC 4556 KRB5PrincipalName, carried in the id-pkinit-san subject alternative name of a
+// certificate: https://tools.ietf.org/html/rfc4556#section-3.2.2
+type KRB5PrincipalName struct {
+	Realm         string              `asn1:"generalstring,explicit,tag:0"`
+	PrincipalName types.PrincipalName `asn1:"explicit,tag:1"`
+}
+
+// otherName implements the RFC 5280 otherName choice of GeneralName: https://tools.ietf.org/html/rfc5280#section-4.2.1.6
+type otherName struct {
+	TypeID asn1.ObjectIdentifier
+	Value  asn1.RawValue
+}
+
+// NewAuthPack creates a new AuthPack for the KDC request body and client public key agreement value provided.
+// The nonce should be that of the KDC request.
+func NewAuthPack(reqBody []byte, nonce int, clientPublicValue SubjectPublicKeyInfo) AuthPack {
+	t := time.Now().UTC()
+	h := sha1.Sum(reqBody)
+	return AuthPack{
+		PKAuthenticator: PKAuthenticator{
+			Cusec:      int((t.UnixNano() / int64(time.Microsecond)) - (t.Unix() * 1e6)),
+			CTime:      t,
+			Nonce:      nonce,
+			PAChecksum: h[:],
+		},
+		ClientPublicValue: clientPublicValue,
+	}
+}
+
+// Marshal the AuthPack.
+func (a *AuthPack) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*a)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling AuthPack")
+	}
+	return b, nil
+}
+
+// Unmarshal bytes b into the AuthPack struct.
+func (a *AuthPack) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, a)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling AuthPack")
+	}
+	return nil
+}
+
+// NewPAPKASReq creates a new PA-PK-AS-REQ containing the AuthPack signed with the client's certificate and private key.
+func NewPAPKASReq(a AuthPack, cert *x509.Certificate, key crypto.Signer) (PAPKASReq, error) {
+	var pa PAPKASReq
+	b, err := a.Marshal()
+	if err != nil {
+		return pa, err
+	}
+	sb, err := signData(OIDPKINITAuthData, b, cert, key)
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.EncryptingError, "error signing AuthPack")
+	}
+	pa.SignedAuthPack = sb
+	return pa, nil
+}
+
+// NewAnonymousPAPKASReq creates a new PA-PK-AS-REQ for anonymous PKINIT containing the AuthPack in a SignedData without
+// any signers or certificates: https://tools.ietf.org/html/rfc8062#section-4.1
+func NewAnonymousPAPKASReq(a AuthPack) (PAPKASReq, error) {
+	var pa PAPKASReq
+	b, err := a.Marshal()
+	if err != nil {
+		return pa, err
+	}
+	sb, err := unsignedData(OIDPKINITAuthData, b)
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.EncodingError, "error marshaling unsigned AuthPack")
+	}
+	pa.SignedAuthPack = sb
+	return pa, nil
+}
+
+// Marshal the PA-PK-AS-REQ.
+func (pa *PAPKASReq) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*pa)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-PK-AS-REQ")
+	}
+	return b, nil
+}
+
+// Unmarshal bytes b into the PA-PK-AS-REQ struct.
+func (pa *PAPKASReq) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, pa)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-PK-AS-REQ")
+	}
+	return nil
+}
+
+// AuthPack verifies the signature of the signed AuthPack within the PA-PK-AS-REQ and returns the AuthPack along with
+// the client's certificate. The certificate chain is verified using the options provided.
+func (pa *PAPKASReq) AuthPack(opts x509.VerifyOptions) (AuthPack, *x509.Certificate, error) {
+	var a AuthPack
+	b, cert, err := verifySignedData(pa.SignedAuthPack, OIDPKINITAuthData, opts)
+	if err != nil {
+		return a, cert, krberror.Errorf(err, krberror.DecryptingError, "error verifying signed AuthPack")
+	}
+	err = a.Unmarshal(b)
+	return a, cert, err
+}
+
+// AnonymousAuthPack returns the AuthPack within an anonymous PA-PK-AS-REQ. An error is returned if the AuthPack is
+// signed.
+func (pa *PAPKASReq) AnonymousAuthPack() (AuthPack, error) {
+	var a AuthPack
+	b, err := unsignedContent(pa.SignedAuthPack, OIDPKINITAuthData)
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncodingError, "error extracting anonymous AuthPack")
+	}
+	err = a.Unmarshal(b)
+	return a, err
+}
+
+// Marshal the PA-PK-AS-REP.
+func (pa *PAPKASRep) Marshal() ([]byte, error) {
+	if len(pa.EncKeyPack) > 0 {
+		b, err := asn1.Marshal(asn1.RawValue{
+			Class: asn1.ClassContextSpecific,
+			Tag:   1,
+			Bytes: pa.EncKeyPack,
+		})
+		if err != nil {
+			return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-PK-AS-REP")
+		}
+		return b, nil
+	}
+	b, err := asn1.Marshal(pa.DHInfo)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-PK-AS-REP")
+	}
+	r := asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		IsCompound: true,
+		Tag:        0,
+		Bytes:      b,
+	}
+	b, err = asn1.Marshal(r)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-PK-AS-REP")
+	}
+	return b, nil
+}
+
+// Unmarshal bytes b into the PA-PK-AS-REP struct.
+func (pa *PAPKASRep) Unmarshal(b []byte) error {
+	var r asn1.RawValue
+	_, err := asn1.Unmarshal(b, &r)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-PK-AS-REP")
+	}
+	if r.Class != asn1.ClassContextSpecific {
+		return krberror.NewErrorf(krberror.EncodingError, "PA-PK-AS-REP choice not recognised")
+	}
+	switch r.Tag {
+	case 0:
+		_, err = asn1.Unmarshal(r.Bytes, &pa.DHInfo)
+		if err != nil {
+			return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-PK-AS-REP DHRepInfo")
+		}
+	case 1:
+		pa.EncKeyPack = r.Bytes
+	default:
+		return krberror.NewErrorf(krberror.EncodingError, "PA-PK-AS-REP choice not recognised: %d", r.Tag)
+	}
+	return nil
+}
+
+// NewDHRepInfo creates a new DHRepInfo containing the KDCDHKeyInfo signed with the KDC's certificate and private key.
+func NewDHRepInfo(k KDCDHKeyInfo, serverDHNonce []byte, cert *x509.Certificate, key crypto.Signer) (DHRepInfo, error) {
+	var d DHRepInfo
+	b, err := asn1.Marshal(k)
+	if err != nil {
+		return d, krberror.Errorf(err, krberror.EncodingError, "error marshaling KDCDHKeyInfo")
+	}
+	sb, err := signData(OIDPKINITDHKeyData, b, cert, key)
+	if err != nil {
+		return d, krberror.Errorf(err, krberror.EncryptingError, "error signing KDCDHKeyInfo")
+	}
+	d.DHSignedData = sb
+	d.ServerDHNonce = serverDHNonce
+	return d, nil
+}
+
+// Values of the EKUChecking of KDCCertificateChecks, as given by the pkinit_eku_checking configuration relation.
+const (
+	EKUCheckingKDC        = "kpKDC"
+	EKUCheckingServerAuth = "kpServerAuth"
+	EKUCheckingNone       = "none"
+)
+
+// KDCCertificateChecks are the checks made of the KDC's certificate in addition to the verification of its chain.
+type KDCCertificateChecks struct {
+	// EKUChecking is the extended key usage required of the certificate. EKUCheckingKDC, the default, requires the
+	// id-pkinit-KPKdc key purpose, EKUCheckingServerAuth also accepts the id-kp-serverAuth key purpose of Active Directory
+	// domain controller certificates and EKUCheckingNone does not check the extended key usage.
+	EKUChecking string
+	// KDCHostnames are the host names of the KDC accepted in a dNSName subject alternative name of the certificate in
+	// place of an id-pkinit-san naming the TGS principal of the realm.
+	KDCHostnames []string
+}
+
+// KDCDHKeyInfo verifies the signature of the signed KDCDHKeyInfo within the DHRepInfo and returns the KDCDHKeyInfo.
+// The certificate chain of the signer is verified using the options provided. The signer's certificate must have the
+// extended key usage and name the TGS principal of the realm provided, or one of the KDC's host names, as required by
+// the checks provided.
+func (d *DHRepInfo) KDCDHKeyInfo(opts x509.VerifyOptions, realm string, checks KDCCertificateChecks) (KDCDHKeyInfo, error) {
+	var k KDCDHKeyInfo
+	b, cert, err := verifySignedData(d.DHSignedData, OIDPKINITDHKeyData, opts)
+	if err != nil {
+		return k, krberror.Errorf(err, krberror.DecryptingError, "error verifying signed KDCDHKeyInfo")
+	}
+	switch checks.EKUChecking {
+	case "", EKUCheckingKDC:
+		if !hasExtKeyUsage(cert, OIDPKINITKPKdc) {
+			return k, krberror.NewErrorf(krberror.DecryptingError, "KDC certificate %s does not have the PKINIT KDC extended key usage", cert.Subject)
+		}
+	case EKUCheckingServerAuth:
+		if !hasExtKeyUsage(cert, OIDPKINITKPKdc) && !hasServerAuth(cert) {
+			return k, krberror.NewErrorf(krberror.DecryptingError, "KDC certificate %s has neither the PKINIT KDC nor the server authentication extended key usage", cert.Subject)
+		}
+	case EKUCheckingNone:
+	default:
+		return k, krberror.NewErrorf(krberror.ConfigError, "PKINIT EKU checking %s is not supported", checks.EKUChecking)
+	}
+	// The certificate must be issued to the TGS of the realm: https://tools.ietf.org/html/rfc4556#section-3.2.4
+	names, err := CertificatePrincipalNames(cert)
+	if err != nil {
+		return k, krberror.Errorf(err, krberror.EncodingError, "error getting principal names of KDC certificate %s", cert.Subject)
+	}
+	tgs := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+realm)
+	var found bool
+	for _, n := range names {
+		if n.Realm == realm && n.PrincipalName.Equal(tgs) {
+			found = true
+			break
+		}
+	}
+	// Otherwise the certificate may name the KDC's host, as Active Directory domain controller certificates do
+	for _, h := range checks.KDCHostnames {
+		for _, n := range cert.DNSNames {
+			if strings.EqualFold(strings.TrimSuffix(h, "."), strings.TrimSuffix(n, ".")) {
+				found = true
+			}
+		}
+	}
+	if !found {
+		return k, krberror.NewErrorf(krberror.DecryptingError, "KDC certificate %s is not issued to %s@%s", cert.Subject, tgs.GetPrincipalNameString(), realm)
+	}
+	_, err = asn1.Unmarshal(b, &k)
+	if err != nil {
+		return k, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KDCDHKeyInfo")
+	}
+	return k, nil
+}
+
+// DHSharedSecretInput returns the input to the octetstring2key function given the shared secret from the key agreement
+// and the client's DH nonce, if one was sent.
+func (d *DHRepInfo) DHSharedSecretInput(sharedSecret, clientDHNonce []byte) ([]byte, error) {
+	if len(d.ServerDHNonce) > 0 && len(clientDHNonce) < 1 {
+		return nil, fmt.Errorf("KDC returned a DH nonce but the client did not send one")
+	}
+	x := make([]byte, 0, len(sharedSecret)+len(clientDHNonce)+len(d.ServerDHNonce))
+	x = append(x, sharedSecret...)
+	x = append(x, clientDHNonce...)
+	x = append(x, d.ServerDHNonce...)
+	return x, nil
+}
+
+// CertificatePrincipalNames returns the Kerberos principal names in the id-pkinit-san subject alternative names of the
+// certificate.
+func CertificatePrincipalNames(cert *x509.Certificate) ([]KRB5PrincipalName, error) {
+	var names []KRB5PrincipalName
+	for _, e := range cert.Extensions {
+		if !oidSubjectAltName.Equal(asn1.ObjectIdentifier(e.Id)) {
+			continue
+		}
+		var seq asn1.RawValue
+		_, err := asn1.Unmarshal(e.Value, &seq)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshaling subject alternative names: %v", err)
+		}
+		rest := seq.Bytes
+		for len(rest) > 0 {
+			var gn asn1.RawValue
+			rest, err = asn1.Unmarshal(rest, &gn)
+			if err != nil {
+				return nil, fmt.Errorf("error unmarshaling subject alternative name: %v", err)
+			}
+			// otherName is the implicitly tagged [0] choice of GeneralName
+			if gn.Class != asn1.ClassContextSpecific || gn.Tag != 0 {
+				continue
+			}
+			var on otherName
+			_, err = asn1.UnmarshalWithParams(gn.FullBytes, &on, "tag:0")
+			if err != nil {
+				return nil, fmt.Errorf("error unmarshaling otherName subject alternative name: %v", err)
+			}
+			if !OIDPKINITSAN.Equal(on.TypeID) {
+				continue
+			}
+			var n KRB5PrincipalName
+			_, err = asn1.Unmarshal(on.Value.Bytes, &n)
+			if err != nil {
+				return nil, fmt.Errorf("error unmarshaling KRB5PrincipalName: %v", err)
+			}
+			names = append(names, n)
+		}
+	}
+	return names, nil
+}
+
+func hasServerAuth(cert *x509.Certificate) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == x509.ExtKeyUsageServerAuth {
+			return true
+		}
+	}
+	return false
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+	for _, u := range cert.UnknownExtKeyUsage {
+		if oid.Equal(asn1.ObjectIdentifier(u)) {
+			return true
+		}
+	}
+	return false
+}
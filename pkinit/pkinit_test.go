@@ -0,0 +1,331 @@
+package pkinit
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	krbasn1 "github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+const testRealm = "TEST.GOKRB5"
+
+func testTGSName(realm string) KRB5PrincipalName {
+	return KRB5PrincipalName{
+		Realm:         realm,
+		PrincipalName: types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+realm),
+	}
+}
+
+// testPrincipalNameSAN returns a subject alternative name extension holding the names as id-pkinit-san otherNames.
+func testPrincipalNameSAN(t *testing.T, names []KRB5PrincipalName) pkix.Extension {
+	var gns []byte
+	for _, n := range names {
+		nb, err := krbasn1.Marshal(n)
+		if err != nil {
+			t.Fatalf("Error marshaling KRB5PrincipalName: %v", err)
+		}
+		b, err := krbasn1.Marshal(otherName{
+			TypeID: OIDPKINITSAN,
+			Value:  krbasn1.RawValue{Class: krbasn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: nb},
+		})
+		if err != nil {
+			t.Fatalf("Error marshaling otherName: %v", err)
+		}
+		// otherName is implicitly tagged [0] within GeneralName
+		b[0] = 0xa0
+		gns = append(gns, b...)
+	}
+	v, err := krbasn1.Marshal(krbasn1.RawValue{Tag: krbasn1.TagSequence, IsCompound: true, Bytes: gns})
+	if err != nil {
+		t.Fatalf("Error marshaling subject alternative names: %v", err)
+	}
+	return pkix.Extension{Id: asn1.ObjectIdentifier(oidSubjectAltName), Value: v}
+}
+
+func testCertificate(t *testing.T, key crypto.Signer, eku asn1.ObjectIdentifier, names ...KRB5PrincipalName) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "kdc.test.gokrb5"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		UnknownExtKeyUsage:    []asn1.ObjectIdentifier{eku},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	if len(names) > 0 {
+		tmpl.ExtraExtensions = []pkix.Extension{testPrincipalNameSAN(t, names)}
+	}
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("Error creating test certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatalf("Error parsing test certificate: %v", err)
+	}
+	return cert
+}
+
+func TestPAPKASReq_SignVerify(t *testing.T) {
+	t.Parallel()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	cert := testCertificate(t, key, asn1.ObjectIdentifier(OIDPKINITKPClientAuth))
+	ka, err := NewModPKeyAgreement(MODPGroup14)
+	if err != nil {
+		t.Fatalf("Error creating key agreement: %v", err)
+	}
+	spki, err := ka.PublicKeyInfo()
+	if err != nil {
+		t.Fatalf("Error getting public key info: %v", err)
+	}
+	a := NewAuthPack([]byte("request body"), 123456, spki)
+	pa, err := NewPAPKASReq(a, cert, key)
+	if err != nil {
+		t.Fatalf("Error creating PA-PK-AS-REQ: %v", err)
+	}
+	b, err := pa.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling PA-PK-AS-REQ: %v", err)
+	}
+	var u PAPKASReq
+	err = u.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling PA-PK-AS-REQ: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	ua, ucert, err := u.AuthPack(x509.VerifyOptions{Roots: roots})
+	if err != nil {
+		t.Fatalf("Error verifying AuthPack: %v", err)
+	}
+	assert.Equal(t, cert.Raw, ucert.Raw, "Signer certificate not as expected")
+	assert.Equal(t, 123456, ua.PKAuthenticator.Nonce, "Nonce not as expected")
+	assert.Equal(t, a.PKAuthenticator.PAChecksum, ua.PKAuthenticator.PAChecksum, "PAChecksum not as expected")
+	assert.Equal(t, spki.SubjectPublicKey.Bytes, ua.ClientPublicValue.SubjectPublicKey.Bytes, "Client public value not as expected")
+	assert.True(t, OIDDHPublicNumber.Equal(ua.ClientPublicValue.Algorithm.Algorithm), "Client public value algorithm not as expected")
+
+	_, _, err = u.AuthPack(x509.VerifyOptions{Roots: x509.NewCertPool()})
+	assert.Error(t, err, "AuthPack signed by untrusted certificate should not verify")
+}
+
+func TestAnonymousPAPKASReq(t *testing.T) {
+	t.Parallel()
+	ka, err := NewModPKeyAgreement(MODPGroup14)
+	if err != nil {
+		t.Fatalf("Error creating key agreement: %v", err)
+	}
+	spki, err := ka.PublicKeyInfo()
+	if err != nil {
+		t.Fatalf("Error getting public key info: %v", err)
+	}
+	a := NewAuthPack([]byte("request body"), 123456, spki)
+	pa, err := NewAnonymousPAPKASReq(a)
+	if err != nil {
+		t.Fatalf("Error creating anonymous PA-PK-AS-REQ: %v", err)
+	}
+	b, err := pa.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling PA-PK-AS-REQ: %v", err)
+	}
+	var u PAPKASReq
+	err = u.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling PA-PK-AS-REQ: %v", err)
+	}
+	ua, err := u.AnonymousAuthPack()
+	if err != nil {
+		t.Fatalf("Error getting anonymous AuthPack: %v", err)
+	}
+	assert.Equal(t, 123456, ua.PKAuthenticator.Nonce, "Nonce not as expected")
+	assert.Equal(t, spki.SubjectPublicKey.Bytes, ua.ClientPublicValue.SubjectPublicKey.Bytes, "Client public value not as expected")
+
+	_, _, err = u.AuthPack(x509.VerifyOptions{Roots: x509.NewCertPool()})
+	assert.Error(t, err, "unsigned AuthPack should not verify")
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	signed, err := NewPAPKASReq(a, testCertificate(t, key, asn1.ObjectIdentifier(OIDPKINITKPClientAuth)), key)
+	if err != nil {
+		t.Fatalf("Error creating PA-PK-AS-REQ: %v", err)
+	}
+	_, err = signed.AnonymousAuthPack()
+	assert.Error(t, err, "signed AuthPack should not be accepted as anonymous")
+}
+
+func TestPAPKASRep_SignVerify(t *testing.T) {
+	t.Parallel()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	cert := testCertificate(t, key, asn1.ObjectIdentifier(OIDPKINITKPKdc), testTGSName(testRealm))
+	k := KDCDHKeyInfo{
+		SubjectPublicKey: asn1BitString([]byte{1, 2, 3, 4}),
+		Nonce:            98765,
+	}
+	d, err := NewDHRepInfo(k, []byte("servernonce"), cert, key)
+	if err != nil {
+		t.Fatalf("Error creating DHRepInfo: %v", err)
+	}
+	rep := PAPKASRep{DHInfo: d}
+	b, err := rep.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling PA-PK-AS-REP: %v", err)
+	}
+	var u PAPKASRep
+	err = u.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling PA-PK-AS-REP: %v", err)
+	}
+	assert.Equal(t, []byte("servernonce"), u.DHInfo.ServerDHNonce, "Server DH nonce not as expected")
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	uk, err := u.DHInfo.KDCDHKeyInfo(x509.VerifyOptions{Roots: roots}, testRealm, KDCCertificateChecks{})
+	if err != nil {
+		t.Fatalf("Error verifying KDCDHKeyInfo: %v", err)
+	}
+	assert.Equal(t, 98765, uk.Nonce, "Nonce not as expected")
+	assert.Equal(t, []byte{1, 2, 3, 4}, uk.SubjectPublicKey.Bytes, "KDC public value not as expected")
+
+	x, err := u.DHInfo.DHSharedSecretInput([]byte("zz"), []byte("clientnonce"))
+	if err != nil {
+		t.Fatalf("Error getting shared secret input: %v", err)
+	}
+	assert.Equal(t, []byte("zzclientnonceservernonce"), x, "Shared secret input not as expected")
+	_, err = u.DHInfo.DHSharedSecretInput([]byte("zz"), nil)
+	assert.Error(t, err, "Server nonce without client nonce should error")
+}
+
+func TestDHRepInfo_KDCDHKeyInfo_NotKDCCert(t *testing.T) {
+	t.Parallel()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	cert := testCertificate(t, key, asn1.ObjectIdentifier(OIDPKINITKPClientAuth), testTGSName(testRealm))
+	d, err := NewDHRepInfo(KDCDHKeyInfo{SubjectPublicKey: asn1BitString([]byte{1}), Nonce: 1}, nil, cert, key)
+	if err != nil {
+		t.Fatalf("Error creating DHRepInfo: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	_, err = d.KDCDHKeyInfo(x509.VerifyOptions{Roots: roots}, testRealm, KDCCertificateChecks{})
+	assert.Error(t, err, "KDCDHKeyInfo signed without the KDC key purpose should not verify")
+}
+
+func TestDHRepInfo_KDCDHKeyInfo_KDCName(t *testing.T) {
+	t.Parallel()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	other := testTGSName("OTHER.GOKRB5")
+	host := KRB5PrincipalName{
+		Realm:         testRealm,
+		PrincipalName: types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "host/kdc.test.gokrb5"),
+	}
+	var tests = []struct {
+		names []KRB5PrincipalName
+		ok    bool
+	}{
+		{[]KRB5PrincipalName{testTGSName(testRealm)}, true},
+		{[]KRB5PrincipalName{host, testTGSName(testRealm)}, true},
+		{nil, false},
+		{[]KRB5PrincipalName{other}, false},
+		{[]KRB5PrincipalName{host}, false},
+		{[]KRB5PrincipalName{{Realm: "OTHER.GOKRB5", PrincipalName: testTGSName(testRealm).PrincipalName}}, false},
+	}
+	for i, test := range tests {
+		cert := testCertificate(t, key, asn1.ObjectIdentifier(OIDPKINITKPKdc), test.names...)
+		names, err := CertificatePrincipalNames(cert)
+		if err != nil {
+			t.Fatalf("Error getting principal names of certificate (test %d): %v", i, err)
+		}
+		assert.Equal(t, len(test.names), len(names), "Number of principal names not as expected (test %d)", i)
+		d, err := NewDHRepInfo(KDCDHKeyInfo{SubjectPublicKey: asn1BitString([]byte{1}), Nonce: 1}, nil, cert, key)
+		if err != nil {
+			t.Fatalf("Error creating DHRepInfo (test %d): %v", i, err)
+		}
+		roots := x509.NewCertPool()
+		roots.AddCert(cert)
+		_, err = d.KDCDHKeyInfo(x509.VerifyOptions{Roots: roots}, testRealm, KDCCertificateChecks{})
+		if test.ok {
+			assert.NoError(t, err, "KDC certificate for the realm's TGS should verify (test %d)", i)
+		} else {
+			assert.Error(t, err, "KDC certificate not issued to the realm's TGS should not verify (test %d)", i)
+		}
+	}
+}
+
+func TestDHRepInfo_KDCDHKeyInfo_ADCertificate(t *testing.T) {
+	t.Parallel()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	// Active Directory domain controller certificates name the host and have the server authentication key purpose
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "dc1.test.gokrb5"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		DNSNames:              []string{"dc1.test.gokrb5"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("Error creating test certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatalf("Error parsing test certificate: %v", err)
+	}
+	d, err := NewDHRepInfo(KDCDHKeyInfo{SubjectPublicKey: asn1BitString([]byte{1}), Nonce: 1}, nil, cert, key)
+	if err != nil {
+		t.Fatalf("Error creating DHRepInfo: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	var tests = []struct {
+		name   string
+		checks KDCCertificateChecks
+		ok     bool
+	}{
+		{"default checks", KDCCertificateChecks{}, false},
+		{"kpKDC with host name", KDCCertificateChecks{EKUChecking: EKUCheckingKDC, KDCHostnames: []string{"dc1.test.gokrb5"}}, false},
+		{"kpServerAuth without host name", KDCCertificateChecks{EKUChecking: EKUCheckingServerAuth}, false},
+		{"kpServerAuth with other host name", KDCCertificateChecks{EKUChecking: EKUCheckingServerAuth, KDCHostnames: []string{"dc2.test.gokrb5"}}, false},
+		{"kpServerAuth with host name", KDCCertificateChecks{EKUChecking: EKUCheckingServerAuth, KDCHostnames: []string{"dc2.test.gokrb5", "DC1.test.gokrb5"}}, true},
+		{"none with host name", KDCCertificateChecks{EKUChecking: EKUCheckingNone, KDCHostnames: []string{"dc1.test.gokrb5"}}, true},
+		{"unsupported checking", KDCCertificateChecks{EKUChecking: "other", KDCHostnames: []string{"dc1.test.gokrb5"}}, false},
+	}
+	for _, test := range tests {
+		_, err = d.KDCDHKeyInfo(x509.VerifyOptions{Roots: roots}, testRealm, test.checks)
+		if test.ok {
+			assert.NoError(t, err, "AD KDC certificate should verify: %s", test.name)
+		} else {
+			assert.Error(t, err, "AD KDC certificate should not verify: %s", test.name)
+		}
+	}
+}
@@ -5,21 +5,65 @@ import (
 	"time"
 
 	"gopkg.in/jcmturner/gokrb5.v5/credentials"
+	"gopkg.in/jcmturner/gokrb5.v5/gssapi"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/chksumtype"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/errorcode"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/flags"
 	"gopkg.in/jcmturner/gokrb5.v5/keytab"
 	"gopkg.in/jcmturner/gokrb5.v5/krberror"
 	"gopkg.in/jcmturner/gokrb5.v5/messages"
+	"gopkg.in/jcmturner/gokrb5.v5/pac"
 	"gopkg.in/jcmturner/gokrb5.v5/types"
 )
 
 // ValidateAPREQ validates an AP_REQ sent to the service. Returns a boolean for if the AP_REQ is valid and the client's principal name and realm.
+// If the client used an anonymous ticket the credentials returned are marked as anonymous.
 func ValidateAPREQ(APReq messages.APReq, kt keytab.Keytab, sa string, cAddr string, requireHostAddr bool) (bool, credentials.Credentials, error) {
 	var creds credentials.Credentials
 	err := APReq.Ticket.DecryptEncPart(kt, sa)
 	if err != nil {
 		return false, creds, krberror.Errorf(err, krberror.DecryptingError, "error decrypting encpart of service ticket provided")
 	}
+	ok, creds, err := validateAPREQ(APReq, cAddr, requireHostAddr)
+	if !ok {
+		return ok, creds, err
+	}
+	isPAC, pac, err := APReq.Ticket.GetPACType(kt, sa)
+	if isPAC && err != nil {
+		return false, creds, err
+	}
+	if isPAC {
+		setADCredentials(&creds, pac)
+	}
+	return true, creds, nil
+}
+
+// ValidateUserToUserAPREQ validates a user-to-user AP_REQ sent to a service that has no keytab. The service ticket in the
+// AP_REQ must have been issued encrypted in the session key of the service's TGT, which is provided.
+// Returns a boolean for if the AP_REQ is valid and the client's principal name and realm.
+func ValidateUserToUserAPREQ(APReq messages.APReq, tgtSessionKey types.EncryptionKey, cAddr string, requireHostAddr bool) (bool, credentials.Credentials, error) {
+	var creds credentials.Credentials
+	err := APReq.Ticket.DecryptEncPartWithKey(tgtSessionKey)
+	if err != nil {
+		return false, creds, krberror.Errorf(err, krberror.DecryptingError, "error decrypting encpart of user-to-user ticket provided")
+	}
+	ok, creds, err := validateAPREQ(APReq, cAddr, requireHostAddr)
+	if !ok {
+		return ok, creds, err
+	}
+	isPAC, pac, err := APReq.Ticket.GetPACTypeWithKey(tgtSessionKey)
+	if isPAC && err != nil {
+		return false, creds, err
+	}
+	if isPAC {
+		setADCredentials(&creds, pac)
+	}
+	return true, creds, nil
+}
+
+// validateAPREQ validates an AP_REQ whose ticket has already been decrypted.
+func validateAPREQ(APReq messages.APReq, cAddr string, requireHostAddr bool) (bool, credentials.Credentials, error) {
+	var creds credentials.Credentials
 	a, err := APReq.DecryptAuthenticator(APReq.Ticket.DecryptedEncPart.Key)
 	if err != nil {
 		return false, creds, krberror.Errorf(err, krberror.DecryptingError, "error extracting authenticator")
@@ -76,25 +120,67 @@ func ValidateAPREQ(APReq messages.APReq, kt keytab.Keytab, sa string, cAddr stri
 	creds.SetAuthTime(t)
 	creds.SetAuthenticated(true)
 	creds.SetValidUntil(APReq.Ticket.DecryptedEncPart.EndTime)
-	isPAC, pac, err := APReq.Ticket.GetPACType(kt, sa)
-	if isPAC && err != nil {
-		return false, creds, err
+	// Anonymous tickets: https://tools.ietf.org/html/rfc8062#section-3
+	if types.IsFlagSet(&APReq.Ticket.DecryptedEncPart.Flags, flags.Anonymous) || APReq.Ticket.DecryptedEncPart.CName.IsAnonymous() {
+		creds.SetAnonymous(true)
 	}
-	if isPAC {
-		// There is a valid PAC. Adding attributes to creds
-		creds.SetADCredentials(credentials.ADCredentials{
-			GroupMembershipSIDs: pac.KerbValidationInfo.GetGroupMembershipSIDs(),
-			LogOnTime:           pac.KerbValidationInfo.LogOnTime.Time(),
-			LogOffTime:          pac.KerbValidationInfo.LogOffTime.Time(),
-			PasswordLastSet:     pac.KerbValidationInfo.PasswordLastSet.Time(),
-			EffectiveName:       pac.KerbValidationInfo.EffectiveName.Value,
-			FullName:            pac.KerbValidationInfo.FullName.Value,
-			UserID:              int(pac.KerbValidationInfo.UserID),
-			PrimaryGroupID:      int(pac.KerbValidationInfo.PrimaryGroupID),
-			LogonServer:         pac.KerbValidationInfo.LogonServer.Value,
-			LogonDomainName:     pac.KerbValidationInfo.LogonDomainName.Value,
-			LogonDomainID:       pac.KerbValidationInfo.LogonDomainID.ToString(),
-		})
+	if a.Cksum.CksumType == chksumtype.GSSAPI {
+		krbCred, ok, err := delegatedKRBCred(a, APReq.Ticket.DecryptedEncPart.Key)
+		if err != nil {
+			return false, creds, krberror.Errorf(err, krberror.KRBMsgError, "error processing delegated credentials")
+		}
+		if ok {
+			creds.Attributes[credentials.AttributeKeyDelegatedCredentials] = krbCred
+		}
 	}
 	return true, creds, nil
 }
+
+// DelegatedCredentials returns the KRB_CRED, already decrypted, that the client delegated to the service in its AP_REQ,
+// if any. A client can be created from it with client.NewClientFromKRBCred to act on behalf of the user.
+func DelegatedCredentials(creds *credentials.Credentials) (messages.KRBCred, bool) {
+	krbCred, ok := creds.Attributes[credentials.AttributeKeyDelegatedCredentials].(messages.KRBCred)
+	return krbCred, ok
+}
+
+// delegatedKRBCred extracts and decrypts the KRB_CRED from the RFC 4121 checksum of the authenticator if the client
+// delegated its credentials. The KRB_CRED is encrypted in the authenticator's sub-key, if present, or the ticket's
+// session key.
+func delegatedKRBCred(a types.Authenticator, sessionKey types.EncryptionKey) (messages.KRBCred, bool, error) {
+	var c gssapi.AuthenticatorChksum
+	err := c.Unmarshal(a.Cksum.Checksum)
+	if err != nil {
+		return messages.KRBCred{}, false, err
+	}
+	krbCred, ok, err := c.KRBCred()
+	if !ok || err != nil {
+		return krbCred, ok, err
+	}
+	if a.SubKey.KeyType != 0 {
+		if err = krbCred.DecryptEncPart(a.SubKey); err == nil {
+			return krbCred, true, nil
+		}
+	}
+	err = krbCred.DecryptEncPart(sessionKey)
+	if err != nil {
+		return krbCred, false, err
+	}
+	return krbCred, true, nil
+}
+
+// setADCredentials adds the attributes from a valid PAC to the credentials.
+func setADCredentials(creds *credentials.Credentials, p pac.PACType) {
+	creds.SetADCredentials(credentials.ADCredentials{
+		GroupMembershipSIDs: p.KerbValidationInfo.GetGroupMembershipSIDs(),
+		LogOnTime:           p.KerbValidationInfo.LogOnTime.Time(),
+		LogOffTime:          p.KerbValidationInfo.LogOffTime.Time(),
+		PasswordLastSet:     p.KerbValidationInfo.PasswordLastSet.Time(),
+		EffectiveName:       p.KerbValidationInfo.EffectiveName.Value,
+		FullName:            p.KerbValidationInfo.FullName.Value,
+		UserID:              int(p.KerbValidationInfo.UserID),
+		PrimaryGroupID:      int(p.KerbValidationInfo.PrimaryGroupID),
+		LogonServer:         p.KerbValidationInfo.LogonServer.Value,
+		LogonDomainName:     p.KerbValidationInfo.LogonDomainName.Value,
+		LogonDomainID:       p.KerbValidationInfo.LogonDomainID.ToString(),
+	})
+}
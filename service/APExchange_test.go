@@ -1,6 +1,7 @@
 package service
 
 import (
+	"crypto/rand"
 	"encoding/hex"
 	"testing"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"gopkg.in/jcmturner/gokrb5.v5/client"
 	"gopkg.in/jcmturner/gokrb5.v5/config"
 	"gopkg.in/jcmturner/gokrb5.v5/credentials"
+	"gopkg.in/jcmturner/gokrb5.v5/gssapi"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/errorcode"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/flags"
 	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
@@ -51,10 +53,11 @@ func TestValidateAPREQ(t *testing.T) {
 		t.Fatalf("Error getting test AP_REQ: %v", err)
 	}
 
-	ok, _, err := ValidateAPREQ(APReq, kt, "", "127.0.0.1", false)
+	ok, creds, err := ValidateAPREQ(APReq, kt, "", "127.0.0.1", false)
 	if !ok || err != nil {
 		t.Fatalf("Validation of AP_REQ failed when it should not have: %v", err)
 	}
+	assert.False(t, creds.Anonymous(), "Credentials should not be anonymous")
 }
 
 func TestValidateAPREQ_KRB_AP_ERR_BADMATCH(t *testing.T) {
@@ -334,6 +337,165 @@ func TestValidateAPREQ_ExpiredTicket(t *testing.T) {
 	}
 }
 
+func TestValidateUserToUserAPREQ(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"testuser2"},
+	}
+	tgtSessionKey := types.EncryptionKey{
+		KeyType:  18,
+		KeyValue: make([]byte, 32),
+	}
+	rand.Read(tgtSessionKey.KeyValue)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicketWithKey(cl.Credentials.CName, cl.Credentials.Realm,
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		tgtSessionKey,
+		0,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		newTestAuthenticator(*cl.Credentials),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+
+	wrongKey := types.EncryptionKey{
+		KeyType:  18,
+		KeyValue: make([]byte, 32),
+	}
+	ok, _, err := ValidateUserToUserAPREQ(APReq, wrongKey, "127.0.0.1", false)
+	if ok || err == nil {
+		t.Fatal("Validation of user-to-user AP_REQ passed with the wrong TGT session key")
+	}
+	ok, creds, err := ValidateUserToUserAPREQ(APReq, tgtSessionKey, "127.0.0.1", false)
+	if !ok || err != nil {
+		t.Fatalf("Validation of user-to-user AP_REQ failed when it should not have: %v", err)
+	}
+	assert.Equal(t, cl.Credentials.CName.NameString, creds.CName.NameString, "Client name not as expected")
+}
+
+func TestValidateAPREQ_DelegatedCredentials(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt, _ := keytab.Parse(b)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName, cl.Credentials.Realm,
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	info := messages.KrbCredInfo{
+		Key:    sessionKey,
+		PRealm: cl.Credentials.Realm,
+		PName:  cl.Credentials.CName,
+		SRealm: "TEST.GOKRB5",
+		SName:  sname,
+	}
+	krbCred, err := messages.NewKRBCred([]messages.Ticket{tkt}, []messages.KrbCredInfo{info}, sessionKey)
+	if err != nil {
+		t.Fatalf("Error creating KRB_CRED: %v", err)
+	}
+	a, err := gssapi.NewAuthenticatorWithDelegation(*cl.Credentials, krbCred, []int{gssapi.GSS_C_INTEG_FLAG, gssapi.GSS_C_CONF_FLAG})
+	if err != nil {
+		t.Fatalf("Error creating authenticator: %v", err)
+	}
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		a,
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+
+	ok, creds, err := ValidateAPREQ(APReq, kt, "", "127.0.0.1", false)
+	if !ok || err != nil {
+		t.Fatalf("Validation of AP_REQ failed when it should not have: %v", err)
+	}
+	dc, ok := DelegatedCredentials(&creds)
+	if !ok {
+		t.Fatal("Delegated credentials not found")
+	}
+	assert.Equal(t, 1, len(dc.Tickets), "Number of delegated tickets not as expected")
+	assert.Equal(t, cl.Credentials.CName, dc.DecryptedEncPart.TicketInfo[0].PName, "Delegated principal not as expected")
+	assert.Equal(t, sessionKey, dc.DecryptedEncPart.TicketInfo[0].Key, "Delegated ticket key not as expected")
+}
+
+func TestValidateAPREQ_Anonymous(t *testing.T) {
+	t.Parallel()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt, _ := keytab.Parse(b)
+	st := time.Now().UTC()
+	f := types.NewKrbFlags()
+	types.SetFlag(&f, flags.Anonymous)
+	tkt, sessionKey, err := messages.NewTicket(types.NewAnonymousPrincipalName(), types.AnonymousRealm,
+		sname, "TEST.GOKRB5",
+		f,
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	creds := credentials.NewCredentialsFromPrincipal(types.NewAnonymousPrincipalName(), "TEST.GOKRB5")
+	a, err := gssapi.NewAuthenticator(creds, []int{gssapi.GSS_C_INTEG_FLAG, gssapi.GSS_C_CONF_FLAG})
+	if err != nil {
+		t.Fatalf("Error creating authenticator: %v", err)
+	}
+	assert.Equal(t, types.AnonymousRealm, a.CRealm, "Authenticator realm of anonymous client not as expected")
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		a,
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+
+	ok, vcreds, err := ValidateAPREQ(APReq, kt, "", "127.0.0.1", false)
+	if !ok || err != nil {
+		t.Fatalf("Validation of AP_REQ failed when it should not have: %v", err)
+	}
+	assert.True(t, vcreds.Anonymous(), "Credentials should be anonymous")
+	assert.Equal(t, types.AnonymousRealm, vcreds.Realm, "Realm of anonymous credentials not as expected")
+}
+
 func newTestAuthenticator(creds credentials.Credentials) types.Authenticator {
 	auth, _ := types.NewAuthenticator(creds.Realm, creds.CName)
 	auth.GenerateSeqNumberAndSubKey(18, 32)
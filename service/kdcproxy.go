@@ -0,0 +1,100 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"gopkg.in/jcmturner/gokrb5.v5/client"
+	"gopkg.in/jcmturner/gokrb5.v5/config"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+)
+
+// Reference: https://msdn.microsoft.com/en-us/library/hh553774.aspx
+
+const (
+	// kdcProxyContentType is the content type of KDC-PROXY-MESSAGE requests and replies.
+	kdcProxyContentType = "application/kerberos"
+	// kdcProxyMaxMessageSize is the largest KDC-PROXY-MESSAGE request accepted.
+	kdcProxyMaxMessageSize = 1 << 20
+)
+
+// KDCProxyHandler is an MS-KKDCP KDC proxy HTTP handler. It accepts KDC-PROXY-MESSAGE requests carrying AS_REQs or
+// TGS_REQs, forwards them over TCP to the KDCs of the target realm defined in the configuration provided and returns the
+// KDC's reply wrapped in a KDC-PROXY-MESSAGE.
+//
+// The handler should be served over HTTPS.
+func KDCProxyHandler(c *config.Config, l *log.Logger) http.Handler {
+	// The transport is shared by the requests so that the health of the KDCs it records is used to order them.
+	t := &client.NetworkTransport{Config: c}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		b, err := ioutil.ReadAll(io.LimitReader(r.Body, kdcProxyMaxMessageSize+1))
+		if err != nil || len(b) > kdcProxyMaxMessageSize {
+			rejectKDCProxy(w, l, http.StatusBadRequest, fmt.Sprintf("%v - KDC proxy error reading request: %v", r.RemoteAddr, err))
+			return
+		}
+		var m messages.KDCProxyMessage
+		err = m.Unmarshal(b)
+		if err != nil {
+			rejectKDCProxy(w, l, http.StatusBadRequest, fmt.Sprintf("%v - KDC proxy request is not a KDC-PROXY-MESSAGE: %v", r.RemoteAddr, err))
+			return
+		}
+		kb, err := m.Message()
+		if err != nil {
+			rejectKDCProxy(w, l, http.StatusBadRequest, fmt.Sprintf("%v - KDC proxy request message not valid: %v", r.RemoteAddr, err))
+			return
+		}
+		realm, err := kdcReqRealm(kb)
+		if err != nil {
+			rejectKDCProxy(w, l, http.StatusBadRequest, fmt.Sprintf("%v - KDC proxy request does not contain an AS_REQ or TGS_REQ: %v", r.RemoteAddr, err))
+			return
+		}
+		if m.TargetDomain != "" {
+			realm = m.TargetDomain
+		}
+		rb, err := t.SendToKDCTCP(r.Context(), kb, realm)
+		if _, ok := err.(messages.KRBError); err != nil && !ok {
+			// A KRB_ERROR is a valid reply to return to the client
+			rejectKDCProxy(w, l, http.StatusBadGateway, fmt.Sprintf("%v - KDC proxy error communicating with KDC for realm %s: %v", r.RemoteAddr, realm, err))
+			return
+		}
+		rm := messages.NewKDCProxyMessage(rb, "")
+		mb, err := rm.Marshal()
+		if err != nil {
+			rejectKDCProxy(w, l, http.StatusInternalServerError, fmt.Sprintf("%v - KDC proxy error marshaling reply: %v", r.RemoteAddr, err))
+			return
+		}
+		w.Header().Set("Content-Type", kdcProxyContentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write(mb)
+	})
+}
+
+// kdcReqRealm returns the realm of the AS_REQ or TGS_REQ in the bytes provided.
+func kdcReqRealm(b []byte) (string, error) {
+	var as messages.ASReq
+	err := as.Unmarshal(b)
+	if err == nil {
+		return as.ReqBody.Realm, nil
+	}
+	var tgs messages.TGSReq
+	if e := tgs.Unmarshal(b); e != nil {
+		return "", err
+	}
+	return tgs.ReqBody.Realm, nil
+}
+
+// Log the message and return the HTTP status code provided for a failed KDC proxy request.
+func rejectKDCProxy(w http.ResponseWriter, l *log.Logger, status int, logMsg string) {
+	if l != nil {
+		l.Println(logMsg)
+	}
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jcmturner/gokrb5.v5/client"
+	"gopkg.in/jcmturner/gokrb5.v5/config"
+	"gopkg.in/jcmturner/gokrb5.v5/iana/nametype"
+	"gopkg.in/jcmturner/gokrb5.v5/messages"
+	"gopkg.in/jcmturner/gokrb5.v5/testdata"
+	"gopkg.in/jcmturner/gokrb5.v5/types"
+)
+
+func TestKDCProxyHandler(t *testing.T) {
+	t.Parallel()
+	reply, _ := hex.DecodeString(testdata.TestVectors["encode_krb5_error"])
+	kdc, reqs := testKDC(t, reply)
+	defer kdc.Close()
+
+	kc, _ := config.NewConfigFromString("[realms]\n TEST.GOKRB5 = {\n  kdc = " + kdc.Addr().String() + "\n }\n")
+	l := log.New(ioutil.Discard, "GOKRB5 Service Tests: ", log.Ldate|log.Ltime|log.Lshortfile)
+	s := httptest.NewTLSServer(KDCProxyHandler(kc, l))
+	defer s.Close()
+	cert, err := x509.ParseCertificate(s.TLS.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatalf("Error parsing test server certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	hc := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	cc, _ := config.NewConfigFromString("[libdefaults]\n default_realm = TEST.GOKRB5\n\n[realms]\n TEST.GOKRB5 = {\n  kdc = " + s.URL + "/KdcProxy\n }\n")
+	req, err := messages.NewASReqForTGT("TEST.GOKRB5", cc, types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1"))
+	if err != nil {
+		t.Fatalf("Error creating AS_REQ: %v", err)
+	}
+	b, err := req.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling AS_REQ: %v", err)
+	}
+	tr := client.KDCProxyTransport{Config: cc, HTTPClient: hc}
+	rb, err := tr.SendToKDC(context.Background(), b, "TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error sending via KDC proxy: %v", err)
+	}
+	assert.Equal(t, reply, rb, "Reply from KDC via the proxy not as expected")
+	assert.Equal(t, b, <-reqs, "Request forwarded to the KDC not as expected")
+
+	// Requests that do not contain a KDC-PROXY-MESSAGE are rejected
+	httpResp, err := hc.Post(s.URL, "application/kerberos", bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("Error posting to KDC proxy: %v", err)
+	}
+	httpResp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, httpResp.StatusCode, "Status code not as expected for an invalid request")
+	httpResp, err = hc.Get(s.URL)
+	if err != nil {
+		t.Fatalf("Error getting from KDC proxy: %v", err)
+	}
+	httpResp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, httpResp.StatusCode, "Status code not as expected for a GET request")
+}
+
+// testKDC starts a stand-in KDC on a local TCP port that replies to each request with the reply provided. The requests
+// received are sent on the channel returned.
+func testKDC(t *testing.T, reply []byte) (net.Listener, <-chan []byte) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error starting stand-in KDC: %v", err)
+	}
+	reqs := make(chan []byte, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			sh := make([]byte, 4)
+			if _, err := io.ReadFull(conn, sh); err == nil {
+				b := make([]byte, binary.BigEndian.Uint32(sh))
+				if _, err := io.ReadFull(conn, b); err == nil {
+					select {
+					case reqs <- b:
+					default:
+					}
+					binary.BigEndian.PutUint32(sh, uint32(len(reply)))
+					conn.Write(append(sh, reply...))
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return ln, reqs
+}
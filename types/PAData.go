@@ -80,6 +80,13 @@ type PAReqEncPARep struct {
 	Chksum     []byte `asn1:"explicit,tag:1"`
 }
 
+// PASvrReferralData implements the PA-SVR-REFERRAL-DATA of PA_SVR_REFERRAL_INFO pre-authentication data:
+// https://tools.ietf.org/html/draft-ietf-krb-wg-kerberos-referrals-11#section-8
+type PASvrReferralData struct {
+	ReferredName  PrincipalName `asn1:"explicit,optional,tag:1"`
+	ReferredRealm string        `asn1:"generalstring,explicit,tag:0"`
+}
+
 // Unmarshal bytes into the PAData
 func (pa *PAData) Unmarshal(b []byte) error {
 	_, err := asn1.Unmarshal(b, pa)
@@ -98,6 +105,12 @@ func (pa *PAReqEncPARep) Unmarshal(b []byte) error {
 	return err
 }
 
+// Unmarshal bytes into the PASvrReferralData
+func (pa *PASvrReferralData) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, pa)
+	return err
+}
+
 // Unmarshal bytes into the PAEncTimestamp
 func (pa *PAEncTimestamp) Unmarshal(b []byte) error {
 	_, err := asn1.Unmarshal(b, pa)
@@ -15,6 +15,12 @@ type PrincipalName struct {
 	NameString []string `asn1:"generalstring,explicit,tag:1"`
 }
 
+// Anonymous principal name and realm: https://tools.ietf.org/html/rfc8062#section-3
+const (
+	AnonymousPrincipalName = "WELLKNOWN/ANONYMOUS"
+	AnonymousRealm         = "WELLKNOWN:ANONYMOUS"
+)
+
 // NewPrincipalName creates a new PrincipalName from the name type int32 and name string provided.
 func NewPrincipalName(ntype int32, spn string) PrincipalName {
 	return PrincipalName{
@@ -23,6 +29,25 @@ func NewPrincipalName(ntype int32, spn string) PrincipalName {
 	}
 }
 
+// NewAnonymousPrincipalName creates the well-known anonymous PrincipalName WELLKNOWN/ANONYMOUS.
+func NewAnonymousPrincipalName() PrincipalName {
+	return NewPrincipalName(nametype.KRB_NT_WELLKNOWN, AnonymousPrincipalName)
+}
+
+// NewEnterprisePrincipalName creates an enterprise PrincipalName from a user principal name such as user@example.com.
+// The whole name is held in a single component: https://tools.ietf.org/html/rfc6806.html#section-5
+func NewEnterprisePrincipalName(upn string) PrincipalName {
+	return PrincipalName{
+		NameType:   nametype.KRB_NT_ENTERPRISE,
+		NameString: []string{upn},
+	}
+}
+
+// IsAnonymous indicates if the PrincipalName is the well-known anonymous principal name.
+func (pn *PrincipalName) IsAnonymous() bool {
+	return len(pn.NameString) == 2 && pn.GetPrincipalNameString() == AnonymousPrincipalName
+}
+
 // GetSalt returns a salt derived from the PrincipalName.
 func (pn *PrincipalName) GetSalt(realm string) string {
 	var sb []byte
@@ -36,6 +61,9 @@ func (pn *PrincipalName) GetSalt(realm string) string {
 // Equal tests if the PrincipalName is equal to the one provided.
 func (pn *PrincipalName) Equal(n PrincipalName) bool {
 	//https://tools.ietf.org/html/rfc4120#section-6.2 - the name type is not significant when checking for equivalence
+	if len(pn.NameString) != len(n.NameString) {
+		return false
+	}
 	for i, s := range pn.NameString {
 		if n.NameString[i] != s {
 			return false
@@ -35,3 +35,29 @@ func TestParseSPNString(t *testing.T) {
 	assert.Equal(t, "www.example.com", pn.NameString[0], "second element of name string not as expected")
 
 }
+
+func TestPrincipalName_IsAnonymous(t *testing.T) {
+	t.Parallel()
+	pn := NewAnonymousPrincipalName()
+	assert.Equal(t, nametype.KRB_NT_WELLKNOWN, pn.NameType, "name type not as expected")
+	assert.Equal(t, []string{"WELLKNOWN", "ANONYMOUS"}, pn.NameString, "name string not as expected")
+	assert.True(t, pn.IsAnonymous(), "anonymous principal name not recognised")
+	pn = NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	assert.False(t, pn.IsAnonymous(), "principal name should not be anonymous")
+}
+
+func TestPrincipalName_Equal(t *testing.T) {
+	t.Parallel()
+	pn := NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5")
+	assert.True(t, pn.Equal(NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "krbtgt/TEST.GOKRB5")), "principal names should be equal")
+	assert.False(t, pn.Equal(NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/RES.GOKRB5")), "principal names should not be equal")
+	assert.False(t, pn.Equal(NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "krbtgt")), "principal names of different lengths should not be equal")
+}
+
+func TestNewEnterprisePrincipalName(t *testing.T) {
+	t.Parallel()
+	pn := NewEnterprisePrincipalName("user/a@corp.example.com")
+	assert.Equal(t, nametype.KRB_NT_ENTERPRISE, pn.NameType, "Name type not as expected")
+	assert.Equal(t, []string{"user/a@corp.example.com"}, pn.NameString, "Enterprise name should be a single component")
+	assert.Equal(t, "TEST.GOKRB5user/a@corp.example.com", pn.GetSalt("TEST.GOKRB5"), "Salt not as expected")
+}